@@ -0,0 +1,572 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateAcademicYear() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body periodRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		if strings.TrimSpace(body.Name) == "" || body.SchoolID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Name, school ID, start date and end date are required",
+			})
+		}
+		startDate, endDate, err := body.dates()
+		if err != nil {
+			return checkError(c, err, "Invalid dates")
+		}
+
+		if !middleware.CanAccessSchool(c, body.SchoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Check if school exists
+		if err := database.GetCollection("schools").FindOne(ctx, bson.M{"_id": body.SchoolID}).Err(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "School not found with the provided ID",
+			})
+		}
+
+		if err := ensureNoPeriodOverlap(ctx, "academic_years", bson.M{"school_id": body.SchoolID}, primitive.NilObjectID, startDate, endDate); err != nil {
+			return checkError(c, err, "Error checking academic years")
+		}
+
+		newYear := model.AcademicYear{
+			ID:        primitive.NewObjectID(),
+			SchoolID:  body.SchoolID,
+			Name:      strings.TrimSpace(body.Name),
+			StartDate: startDate,
+			EndDate:   endDate,
+			Status:    model.PeriodStatusOpen,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+
+		// The unique (school_id, name) index rejects duplicates
+		if _, err := database.GetCollection("academic_years").InsertOne(ctx, newYear); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "An academic year with this name already exists in the school",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create academic year",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":         "success",
+			"message":        "Academic year created successfully",
+			"academicYearId": newYear.ID,
+			"info":           newYear,
+		})
+	}
+}
+
+func ListAcademicYears() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: -1}})
+		cursor, err := database.GetCollection("academic_years").Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch academic years",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		years := []model.AcademicYear{}
+		if err := cursor.All(ctx, &years); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode academic years",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":         "success",
+			"academic_years": years,
+		})
+	}
+}
+
+func GetAcademicYear() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		year, err := findAcademicYear(ctx, c, objectID)
+		if err != nil {
+			return academicYearLookupError(c, err)
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+		cursor, err := database.GetCollection("terms").Find(ctx, bson.M{"academic_year_id": objectID}, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching terms",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		terms := []model.Term{}
+		if err := cursor.All(ctx, &terms); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error parsing terms",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":        "success",
+			"academic_year": year,
+			"terms":         terms,
+		})
+	}
+}
+
+func UpdateAcademicYear() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		existingYear, err := findAcademicYear(ctx, c, objectID)
+		if err != nil {
+			return academicYearLookupError(c, err)
+		}
+		if existingYear.Status == model.PeriodStatusClosed {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Academic year is closed",
+			})
+		}
+
+		var updateData map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &updateData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		setMap := bson.M{}
+		if name, ok := updateData["name"].(string); ok && strings.TrimSpace(name) != "" {
+			setMap["name"] = strings.TrimSpace(name)
+		}
+
+		startDate, endDate, err := updatedPeriodDates(updateData, existingYear.StartDate, existingYear.EndDate)
+		if err != nil {
+			return checkError(c, err, "Invalid dates")
+		}
+		if !startDate.Equal(existingYear.StartDate) || !endDate.Equal(existingYear.EndDate) {
+			if err := ensureNoPeriodOverlap(ctx, "academic_years", bson.M{"school_id": existingYear.SchoolID}, objectID, startDate, endDate); err != nil {
+				return checkError(c, err, "Error checking academic years")
+			}
+			// Terms have to stay inside their year
+			outside, err := database.GetCollection("terms").CountDocuments(ctx, bson.M{
+				"academic_year_id": objectID,
+				"$or": []bson.M{
+					{"start_date": bson.M{"$lt": startDate}},
+					{"end_date": bson.M{"$gt": endDate}},
+				},
+			})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error checking terms",
+				})
+			}
+			if outside > 0 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Some terms fall outside the new dates",
+				})
+			}
+			setMap["start_date"] = startDate
+			setMap["end_date"] = endDate
+		}
+		setMap["updated_at"] = time.Now()
+
+		var updatedYear model.AcademicYear
+		err = database.GetCollection("academic_years").FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": setMap},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedYear)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "An academic year with this name already exists in the school",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating academic year",
+			})
+		}
+
+		// Classes keep a copy of the year's name
+		if updatedYear.Name != existingYear.Name {
+			_, err = database.GetCollection("classes").UpdateMany(ctx,
+				bson.M{"academic_year_id": objectID},
+				bson.M{"$set": bson.M{"academic_year": updatedYear.Name}},
+			)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Academic year updated but its classes could not be refreshed",
+				})
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"status":        "success",
+			"message":       "Academic year updated successfully",
+			"academic_year": updatedYear,
+		})
+	}
+}
+
+// DeleteAcademicYear refuses to delete a year that still has terms, classes or offerings.
+func DeleteAcademicYear() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findAcademicYear(ctx, c, objectID); err != nil {
+			return academicYearLookupError(c, err)
+		}
+
+		references := fiber.Map{}
+		for _, name := range []string{"terms", "classes", "subjects", "attendance_sessions", "assessments"} {
+			count, err := database.GetCollection(name).CountDocuments(ctx, bson.M{"academic_year_id": objectID})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error counting " + name,
+				})
+			}
+			if count > 0 {
+				references[name] = count
+			}
+		}
+		if len(references) > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":      "Academic year still has terms, classes or subject offerings",
+				"references": references,
+			})
+		}
+
+		if _, err := database.GetCollection("academic_years").DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting academic year",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Academic year deleted successfully",
+		})
+	}
+}
+
+// SetCurrentAcademicYear makes the year the school's current one.
+func SetCurrentAcademicYear() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		year, err := findAcademicYear(ctx, c, objectID)
+		if err != nil {
+			return academicYearLookupError(c, err)
+		}
+		if year.Status == model.PeriodStatusClosed {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A closed academic year cannot be made current",
+			})
+		}
+
+		if err := setCurrentPeriod(ctx, "academic_years", year.SchoolID, objectID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error setting current academic year",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Academic year is now current",
+		})
+	}
+}
+
+// CloseAcademicYear closes the year and all of its terms, locking their records.
+func CloseAcademicYear() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findAcademicYear(ctx, c, objectID); err != nil {
+			return academicYearLookupError(c, err)
+		}
+
+		closed := bson.M{"$set": bson.M{"status": model.PeriodStatusClosed, "is_current": false, "updated_at": time.Now()}}
+		if _, err := database.GetCollection("terms").UpdateMany(ctx, bson.M{"academic_year_id": objectID}, closed); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error closing terms",
+			})
+		}
+		if _, err := database.GetCollection("academic_years").UpdateOne(ctx, bson.M{"_id": objectID}, closed); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error closing academic year",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Academic year closed successfully",
+		})
+	}
+}
+
+// ReopenAcademicYear reopens the year. Its terms stay closed until reopened one by one.
+func ReopenAcademicYear() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findAcademicYear(ctx, c, objectID); err != nil {
+			return academicYearLookupError(c, err)
+		}
+
+		_, err = database.GetCollection("academic_years").UpdateOne(ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": bson.M{"status": model.PeriodStatusOpen, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error reopening academic year",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Academic year reopened successfully",
+		})
+	}
+}
+
+// findAcademicYear loads an academic year the caller's schools can see.
+func findAcademicYear(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.AcademicYear, error) {
+	var year model.AcademicYear
+	err := database.GetCollection("academic_years").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&year)
+	if err != nil {
+		return nil, err
+	}
+	return &year, nil
+}
+
+func academicYearLookupError(c *fiber.Ctx, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Academic year not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error fetching academic year",
+	})
+}
+
+// resolveAcademicYear returns the given year of the school, or the school's
+// current year when yearID is empty.
+func resolveAcademicYear(ctx context.Context, schoolID primitive.ObjectID, yearID primitive.ObjectID) (*model.AcademicYear, error) {
+	filter := bson.M{"school_id": schoolID, "_id": yearID}
+	if yearID.IsZero() {
+		filter = bson.M{"school_id": schoolID, "is_current": true}
+	}
+
+	var year model.AcademicYear
+	err := database.GetCollection("academic_years").FindOne(ctx, filter).Decode(&year)
+	if err == mongo.ErrNoDocuments {
+		if yearID.IsZero() {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "The school has no current academic year, academic_year_id is required")
+		}
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Academic year not found in the same school")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &year, nil
+}
+
+// ensurePeriodOpen refuses edits to records of a closed academic year or term.
+// Either ID may be empty.
+func ensurePeriodOpen(ctx context.Context, yearID primitive.ObjectID, termID primitive.ObjectID) error {
+	if !termID.IsZero() {
+		var term model.Term
+		if err := database.GetCollection("terms").FindOne(ctx, bson.M{"_id": termID}).Decode(&term); err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if term.Status == model.PeriodStatusClosed {
+			return fiber.NewError(fiber.StatusConflict, "Term "+term.Name+" is closed and its records can no longer be edited")
+		}
+	}
+	if !yearID.IsZero() {
+		var year model.AcademicYear
+		if err := database.GetCollection("academic_years").FindOne(ctx, bson.M{"_id": yearID}).Decode(&year); err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if year.Status == model.PeriodStatusClosed {
+			return fiber.NewError(fiber.StatusConflict, "Academic year "+year.Name+" is closed and its records can no longer be edited")
+		}
+	}
+	return nil
+}
+
+// ensureNoPeriodOverlap checks that [start, end] does not overlap another
+// period in the collection matching scope.
+func ensureNoPeriodOverlap(ctx context.Context, collection string, scope bson.M, excludeID primitive.ObjectID, start, end time.Time) error {
+	filter := bson.M{
+		"start_date": bson.M{"$lte": end},
+		"end_date":   bson.M{"$gte": start},
+	}
+	for key, value := range scope {
+		filter[key] = value
+	}
+	if !excludeID.IsZero() {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+
+	count, err := database.GetCollection(collection).CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Dates overlap with another period")
+	}
+	return nil
+}
+
+// setCurrentPeriod flags one period as current, clearing the flag on the
+// school's other periods in the collection.
+func setCurrentPeriod(ctx context.Context, collection string, schoolID primitive.ObjectID, id primitive.ObjectID) error {
+	periods := database.GetCollection(collection)
+	_, err := periods.UpdateMany(ctx,
+		bson.M{"school_id": schoolID, "_id": bson.M{"$ne": id}, "is_current": true},
+		bson.M{"$set": bson.M{"is_current": false, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = periods.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"is_current": true, "updated_at": time.Now()}})
+	return err
+}
+
+// periodRequest is the body for creating an academic year or term.
+type periodRequest struct {
+	SchoolID       primitive.ObjectID `json:"school_id"`
+	AcademicYearID primitive.ObjectID `json:"academic_year_id"`
+	Name           string             `json:"name"`
+	StartDate      string             `json:"start_date"`
+	EndDate        string             `json:"end_date"`
+}
+
+func (r periodRequest) dates() (time.Time, time.Time, error) {
+	if r.StartDate == "" || r.EndDate == "" {
+		return time.Time{}, time.Time{}, fiber.NewError(fiber.StatusBadRequest, "Start date and end date are required")
+	}
+	return updatedPeriodDates(map[string]interface{}{"start_date": r.StartDate, "end_date": r.EndDate}, time.Time{}, time.Time{})
+}
+
+// updatedPeriodDates applies start_date and end_date from an update body,
+// accepting RFC 3339 timestamps or plain dates.
+func updatedPeriodDates(updateData map[string]interface{}, start, end time.Time) (time.Time, time.Time, error) {
+	for field, target := range map[string]*time.Time{"start_date": &start, "end_date": &end} {
+		value, ok := updateData[field].(string)
+		if !ok {
+			continue
+		}
+		parsed, err := parseDate(value)
+		if err != nil {
+			return start, end, fiber.NewError(fiber.StatusBadRequest, "Invalid "+field+", use YYYY-MM-DD")
+		}
+		*target = parsed
+	}
+	if !start.Before(end) {
+		return start, end, fiber.NewError(fiber.StatusBadRequest, "Start date must be before end date")
+	}
+	return start, end, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
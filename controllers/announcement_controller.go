@@ -0,0 +1,970 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	announcementPollInterval = 30 * time.Second
+	announcementLease        = 5 * time.Minute
+	announcementFeedSize     = 50
+	announcementFeedMax      = 100
+)
+
+type announcementRequest struct {
+	SchoolID     primitive.ObjectID          `json:"school_id"`
+	Title        *string                     `json:"title"`
+	Body         *string                     `json:"body"`
+	Audience     *model.AnnouncementAudience `json:"audience"`
+	PublishAt    *string                     `json:"publish_at"` // RFC3339, empty to publish now
+	ExpiresAt    *string                     `json:"expires_at"` // RFC3339 or YYYY-MM-DD, empty for never
+	Pinned       *bool                       `json:"pinned"`
+	EmailParents *bool                       `json:"email_parents"`
+}
+
+// CreateAnnouncement schedules an announcement. Teachers may only address
+// classes and offerings they teach, and their own department.
+func CreateAnnouncement() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body announcementRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if body.Title == nil || body.Body == nil || body.Audience == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Title, body and audience are required",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		principal := middleware.GetPrincipal(c)
+		now := time.Now()
+		announcement := model.Announcement{
+			ID:        primitive.NewObjectID(),
+			SchoolID:  body.SchoolID,
+			Audience:  *body.Audience,
+			PublishAt: now,
+			Status:    model.AnnouncementScheduled,
+			AuthorID:  principal.UserID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if author, err := findMessagingUser(ctx, principal.UserID); err == nil {
+			announcement.AuthorName = author.Name
+		}
+		if err := applyAnnouncementRequest(&announcement, body, now); err != nil {
+			return checkError(c, err, "Invalid announcement")
+		}
+		if err := validateAudience(ctx, c, &announcement); err != nil {
+			return checkError(c, err, "Error checking audience")
+		}
+
+		if _, err := database.GetCollection("announcements").InsertOne(ctx, announcement); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create announcement",
+			})
+		}
+		if !announcement.PublishAt.After(now) {
+			go dispatchDueAnnouncements()
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":         "success",
+			"message":        "Announcement created successfully",
+			"announcementId": announcement.ID,
+			"announcement":   announcement,
+		})
+	}
+}
+
+// ListAnnouncements returns the announcements of the caller's schools for
+// managing them, filtered by ?status=. Teachers only see their own.
+func ListAnnouncements() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		principal := middleware.GetPrincipal(c)
+		if !principal.Can(middleware.PermAnnouncementManage) {
+			filter["author_id"] = principal.UserID
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "publish_at", Value: -1}}).SetLimit(500)
+		cursor, err := database.GetCollection("announcements").Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch announcements",
+			})
+		}
+		announcements := []model.Announcement{}
+		if err := cursor.All(ctx, &announcements); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode announcements",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":        "success",
+			"announcements": announcements,
+		})
+	}
+}
+
+// AnnouncementFeed returns the caller's published, unexpired announcements,
+// pinned ones first. ?unread=true leaves out those already read.
+func AnnouncementFeed() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", announcementFeedSize)
+		if limit < 1 || limit > announcementFeedMax {
+			limit = announcementFeedSize
+		}
+		match := bson.M{"user_id": middleware.GetPrincipal(c).UserID}
+		if c.QueryBool("unread") {
+			match["read_at"] = bson.M{"$exists": false}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		cursor, err := database.GetCollection("announcement_recipients").Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: match}},
+			{{Key: "$lookup", Value: bson.M{
+				"from":         "announcements",
+				"localField":   "announcement_id",
+				"foreignField": "_id",
+				"as":           "announcement",
+			}}},
+			{{Key: "$unwind", Value: "$announcement"}},
+			{{Key: "$match", Value: bson.M{"$or": bson.A{
+				bson.M{"announcement.expires_at": bson.M{"$exists": false}},
+				bson.M{"announcement.expires_at": bson.M{"$gt": now}},
+			}}}},
+			{{Key: "$sort", Value: bson.D{{Key: "announcement.pinned", Value: -1}, {Key: "announcement.publish_at", Value: -1}}}},
+			{{Key: "$limit", Value: limit}},
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch announcements",
+			})
+		}
+		items := []struct {
+			Announcement model.Announcement `bson:"announcement" json:"announcement"`
+			ReadAt       *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+		}{}
+		if err := cursor.All(ctx, &items); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode announcements",
+			})
+		}
+
+		unread, err := database.GetCollection("announcement_recipients").CountDocuments(ctx, bson.M{
+			"user_id": match["user_id"],
+			"read_at": bson.M{"$exists": false},
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting unread announcements",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":        "success",
+			"announcements": items,
+			"unread":        unread,
+		})
+	}
+}
+
+// GetAnnouncement is open to the announcement's managers and recipients.
+func GetAnnouncement() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		announcement, err := findAnnouncement(ctx, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching announcement")
+		}
+		response := fiber.Map{"status": "success", "announcement": announcement}
+		if canManageAnnouncement(c, announcement) {
+			return c.JSON(response)
+		}
+
+		var recipient model.AnnouncementRecipient
+		err = database.GetCollection("announcement_recipients").
+			FindOne(ctx, bson.M{"announcement_id": objectID, "user_id": middleware.GetPrincipal(c).UserID}).
+			Decode(&recipient)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Announcement not found",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching announcement",
+			})
+		}
+		response["read_at"] = recipient.ReadAt
+		return c.JSON(response)
+	}
+}
+
+// UpdateAnnouncement changes an announcement. Once published only its
+// title, body, pinning and expiry can change; the audience is fixed.
+func UpdateAnnouncement() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body announcementRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		announcement, err := findAnnouncement(ctx, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching announcement")
+		}
+		if !canManageAnnouncement(c, announcement) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the author or a school admin can change this announcement",
+			})
+		}
+		scheduled := announcement.Status == model.AnnouncementScheduled
+		if !scheduled && (body.Audience != nil || body.PublishAt != nil || body.EmailParents != nil) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The announcement is already published, its audience, publish time and email cannot change",
+			})
+		}
+
+		now := time.Now()
+		previousStatus := announcement.Status
+		if body.Audience != nil {
+			announcement.Audience = *body.Audience
+			announcement.SchoolID = body.SchoolID
+		}
+		if err := applyAnnouncementRequest(announcement, body, now); err != nil {
+			return checkError(c, err, "Invalid announcement")
+		}
+		if body.Audience != nil {
+			if err := validateAudience(ctx, c, announcement); err != nil {
+				return checkError(c, err, "Error checking audience")
+			}
+		}
+
+		update := bson.M{
+			"title":      announcement.Title,
+			"body":       announcement.Body,
+			"pinned":     announcement.Pinned,
+			"expires_at": announcement.ExpiresAt,
+			"updated_at": now,
+		}
+		if scheduled {
+			update["school_id"] = announcement.SchoolID
+			update["audience"] = announcement.Audience
+			update["publish_at"] = announcement.PublishAt
+			update["email_parents"] = announcement.EmailParents
+		}
+
+		// The dispatcher may have claimed it meanwhile
+		var updated model.Announcement
+		err = database.GetCollection("announcements").FindOneAndUpdate(ctx,
+			bson.M{"_id": objectID, "status": previousStatus},
+			bson.M{"$set": update},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The announcement is being published, try again",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating announcement",
+			})
+		}
+		if scheduled && !updated.PublishAt.After(now) {
+			go dispatchDueAnnouncements()
+		}
+
+		return c.JSON(fiber.Map{
+			"status":       "success",
+			"message":      "Announcement updated successfully",
+			"announcement": updated,
+		})
+	}
+}
+
+// PublishAnnouncement publishes a scheduled announcement right away.
+func PublishAnnouncement() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		announcement, err := findAnnouncement(ctx, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching announcement")
+		}
+		if !canManageAnnouncement(c, announcement) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the author or a school admin can publish this announcement",
+			})
+		}
+
+		result, err := database.GetCollection("announcements").UpdateOne(ctx,
+			bson.M{"_id": objectID, "status": model.AnnouncementScheduled},
+			bson.M{"$set": bson.M{"publish_at": time.Now(), "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error publishing announcement",
+			})
+		}
+		if result.MatchedCount == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The announcement is already published",
+			})
+		}
+		go dispatchDueAnnouncements()
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Announcement is being published",
+		})
+	}
+}
+
+// DeleteAnnouncement removes an announcement and takes it out of every feed.
+func DeleteAnnouncement() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		announcement, err := findAnnouncement(ctx, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching announcement")
+		}
+		if !canManageAnnouncement(c, announcement) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the author or a school admin can delete this announcement",
+			})
+		}
+		if announcement.Status == model.AnnouncementPublishing && announcement.LockedUntil.After(time.Now()) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The announcement is being published, try again shortly",
+			})
+		}
+
+		if _, err := database.GetCollection("announcements").DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting announcement",
+			})
+		}
+		if _, err := database.GetCollection("announcement_recipients").DeleteMany(ctx, bson.M{"announcement_id": objectID}); err != nil {
+			log.Printf("Error removing recipients of announcement %s: %v\n", objectID.Hex(), err)
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Announcement deleted successfully",
+		})
+	}
+}
+
+func MarkAnnouncementRead() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := bson.M{"announcement_id": objectID, "user_id": middleware.GetPrincipal(c).UserID}
+		collection := database.GetCollection("announcement_recipients")
+		count, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching announcement",
+			})
+		}
+		if count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Announcement not found",
+			})
+		}
+
+		filter["read_at"] = bson.M{"$exists": false}
+		if _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"read_at": time.Now()}}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error marking announcement as read",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Announcement marked as read",
+		})
+	}
+}
+
+// AnnouncementReads reports how many recipients have read an announcement,
+// and who. ?unread=true lists those who have not.
+func AnnouncementReads() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		announcement, err := findAnnouncement(ctx, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching announcement")
+		}
+		if !canManageAnnouncement(c, announcement) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the author or a school admin can see who read this announcement",
+			})
+		}
+
+		collection := database.GetCollection("announcement_recipients")
+		read, err := collection.CountDocuments(ctx, bson.M{"announcement_id": objectID, "read_at": bson.M{"$exists": true}})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting reads",
+			})
+		}
+
+		match := bson.M{"announcement_id": objectID, "read_at": bson.M{"$exists": !c.QueryBool("unread")}}
+		cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: match}},
+			{{Key: "$sort", Value: bson.M{"read_at": -1}}},
+			{{Key: "$limit", Value: 1000}},
+			{{Key: "$lookup", Value: bson.M{
+				"from":         "users",
+				"localField":   "user_id",
+				"foreignField": "_id",
+				"as":           "user",
+			}}},
+			{{Key: "$unwind", Value: "$user"}},
+			{{Key: "$project", Value: bson.M{
+				"_id":     0,
+				"user_id": 1,
+				"read_at": 1,
+				"name":    "$user.name",
+				"role":    "$user.role",
+			}}},
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching reads",
+			})
+		}
+		recipients := []bson.M{}
+		if err := cursor.All(ctx, &recipients); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding reads",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"total":      announcement.RecipientCount,
+			"read":       read,
+			"recipients": recipients,
+		})
+	}
+}
+
+// StartAnnouncementDispatcher publishes announcements whose time has come.
+func StartAnnouncementDispatcher() {
+	go func() {
+		for {
+			dispatchDueAnnouncements()
+			time.Sleep(announcementPollInterval)
+		}
+	}()
+}
+
+func dispatchDueAnnouncements() {
+	for dispatchNextAnnouncement() {
+	}
+}
+
+// dispatchNextAnnouncement claims one due announcement and delivers it. A
+// claim left behind by a crashed process is taken over once its lease ends.
+func dispatchNextAnnouncement() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), announcementLease)
+	defer cancel()
+
+	collection := database.GetCollection("announcements")
+	now := time.Now()
+	var announcement model.Announcement
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"$or": []bson.M{
+			{"status": model.AnnouncementScheduled, "publish_at": bson.M{"$lte": now}},
+			{"status": model.AnnouncementPublishing, "locked_until": bson.M{"$lt": now}},
+		}},
+		bson.M{"$set": bson.M{
+			"status":       model.AnnouncementPublishing,
+			"locked_until": now.Add(announcementLease),
+		}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "publish_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&announcement)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("Error claiming announcement:", err)
+		}
+		return false
+	}
+
+	if err := deliverAnnouncement(ctx, &announcement); err != nil {
+		log.Printf("Error publishing announcement %s: %v\n", announcement.ID.Hex(), err)
+	}
+	return true
+}
+
+// deliverAnnouncement adds the announcement to its recipients' feeds and
+// queues the parent emails. Adding recipients is idempotent, so a retry
+// after a crash only fills in who is missing.
+func deliverAnnouncement(ctx context.Context, announcement *model.Announcement) error {
+	userIDs, students, err := audienceRecipients(ctx, announcement)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	recipients := database.GetCollection("announcement_recipients")
+	for start := 0; start < len(userIDs); start += 500 {
+		end := start + 500
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		writes := make([]mongo.WriteModel, 0, end-start)
+		for _, userID := range userIDs[start:end] {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"announcement_id": announcement.ID, "user_id": userID}).
+				SetUpdate(bson.M{"$setOnInsert": bson.M{"created_at": now}}).
+				SetUpsert(true))
+		}
+		if _, err := recipients.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+
+	emails := 0
+	if announcement.EmailParents && announcement.EmailCount == 0 {
+		if emails, err = emailAnnouncement(ctx, announcement, students); err != nil {
+			return err
+		}
+	}
+
+	publishedAt := announcement.PublishAt
+	if announcement.PublishedAt != nil {
+		publishedAt = *announcement.PublishedAt
+	}
+	_, err = database.GetCollection("announcements").UpdateOne(ctx,
+		bson.M{"_id": announcement.ID},
+		bson.M{
+			"$set": bson.M{
+				"status":          model.AnnouncementPublished,
+				"recipient_count": len(userIDs),
+				"email_count":     announcement.EmailCount + emails,
+				"published_at":    publishedAt,
+			},
+			"$unset": bson.M{"locked_until": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	announcement.Status = model.AnnouncementPublished
+	announcement.PublishedAt = &publishedAt
+	helpers.PublishRealtime(userIDs, helpers.RealtimeEvent{Type: "announcement.published", Data: announcement})
+	return nil
+}
+
+// emailAnnouncement queues the announcement for every parent email of the
+// students, once per address.
+func emailAnnouncement(ctx context.Context, announcement *model.Announcement, students []model.Student) (int, error) {
+	addresses := []string{}
+	seen := map[string]bool{}
+	for _, student := range students {
+		for _, contact := range parentContacts(student.ParentDetails) {
+			if contact.Email != "" && !seen[contact.Email] {
+				seen[contact.Email] = true
+				addresses = append(addresses, contact.Email)
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return 0, nil
+	}
+
+	rule, err := loadNotificationRule(ctx, announcement.SchoolID)
+	if err != nil {
+		return 0, err
+	}
+	email, err := helpers.RenderEmail(helpers.TemplateAnnouncement, rule.Locale, helpers.LoadBranding(ctx, announcement.SchoolID), map[string]interface{}{
+		"Title":       announcement.Title,
+		"Body":        announcement.Body,
+		"AuthorName":  announcement.AuthorName,
+		"PublishedAt": announcement.PublishAt.Format("2 January 2006"),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Recorded before queueing so a retry never emails anyone twice
+	_, err = database.GetCollection("announcements").UpdateOne(ctx,
+		bson.M{"_id": announcement.ID},
+		bson.M{"$set": bson.M{"email_count": len(addresses)}})
+	if err != nil {
+		return 0, err
+	}
+	for _, address := range addresses {
+		if err := helpers.EnqueueMail(ctx, address, email); err != nil {
+			log.Printf("Error queueing announcement %s for %s: %v\n", announcement.ID.Hex(), address, err)
+		}
+	}
+	return len(addresses), nil
+}
+
+// audienceRecipients returns the user accounts an announcement goes to:
+// the teachers, students and parents of the audience, and for the whole
+// school its staff too. Students are returned for emailing their parents.
+func audienceRecipients(ctx context.Context, announcement *model.Announcement) ([]primitive.ObjectID, []model.Student, error) {
+	audience := announcement.Audience
+	studentFilter := bson.M{}
+	teacherIDs := []primitive.ObjectID{}
+	userFilters := bson.A{}
+
+	switch audience.Type {
+	case model.AudienceSchool:
+		studentFilter["school_id"] = announcement.SchoolID
+		userFilters = append(userFilters, bson.M{
+			"school_ids": announcement.SchoolID,
+			"role":       bson.M{"$in": bson.A{model.RoleSchoolAdmin, model.RoleTeacher}},
+		})
+	case model.AudienceGrade, model.AudienceClass:
+		classFilter := bson.M{"_id": audience.ClassID}
+		if audience.Type == model.AudienceGrade {
+			year, err := resolveAcademicYear(ctx, announcement.SchoolID, primitive.NilObjectID)
+			if err != nil {
+				return nil, nil, err
+			}
+			classFilter = bson.M{"school_id": announcement.SchoolID, "academic_year_id": year.ID, "grade": audience.Grade}
+		}
+		cursor, err := database.GetCollection("classes").Find(ctx, classFilter)
+		if err != nil {
+			return nil, nil, err
+		}
+		var classes []model.Class
+		if err := cursor.All(ctx, &classes); err != nil {
+			return nil, nil, err
+		}
+		classIDs := []primitive.ObjectID{}
+		for _, class := range classes {
+			classIDs = append(classIDs, class.ID)
+			if !class.HomeroomTeacherID.IsZero() {
+				teacherIDs = append(teacherIDs, class.HomeroomTeacherID)
+			}
+		}
+		studentFilter["class_id"] = bson.M{"$in": classIDs}
+
+		offeringTeachers, err := database.GetCollection("subjects").Distinct(ctx, "teacher_id", bson.M{"class_id": bson.M{"$in": classIDs}})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, id := range offeringTeachers {
+			if teacherID, ok := id.(primitive.ObjectID); ok && !teacherID.IsZero() {
+				teacherIDs = append(teacherIDs, teacherID)
+			}
+		}
+	case model.AudienceSubject:
+		var offering model.SchoolSubject
+		if err := database.GetCollection("subjects").FindOne(ctx, bson.M{"_id": audience.SubjectID}).Decode(&offering); err != nil {
+			return nil, nil, err
+		}
+		roster, err := offeringStudents(ctx, &offering)
+		if err != nil {
+			return nil, nil, err
+		}
+		studentIDs := make([]primitive.ObjectID, 0, len(roster))
+		for id := range roster {
+			studentIDs = append(studentIDs, id)
+		}
+		studentFilter["_id"] = bson.M{"$in": studentIDs}
+		if !offering.TeacherID.IsZero() {
+			teacherIDs = append(teacherIDs, offering.TeacherID)
+		}
+	case model.AudienceDepartment:
+		ids, err := database.GetCollection("teachers").Distinct(ctx, "_id", bson.M{"department_id": audience.DepartmentID})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, id := range ids {
+			if teacherID, ok := id.(primitive.ObjectID); ok {
+				teacherIDs = append(teacherIDs, teacherID)
+			}
+		}
+	}
+
+	students := []model.Student{}
+	if len(studentFilter) > 0 {
+		studentFilter["status"] = bson.M{"$ne": model.StudentStatusGraduated}
+		opts := options.Find().SetProjection(bson.M{"parent_details": 1, "school_id": 1})
+		cursor, err := database.GetCollection("students").Find(ctx, studentFilter, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := cursor.All(ctx, &students); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(teacherIDs) > 0 {
+		userFilters = append(userFilters, bson.M{"teacher_id": bson.M{"$in": teacherIDs}})
+	}
+	if len(students) > 0 {
+		studentIDs := make([]primitive.ObjectID, 0, len(students))
+		for _, student := range students {
+			studentIDs = append(studentIDs, student.ID)
+		}
+		userFilters = append(userFilters,
+			bson.M{"student_id": bson.M{"$in": studentIDs}},
+			bson.M{"child_ids": bson.M{"$in": studentIDs}},
+		)
+	}
+	if len(userFilters) == 0 {
+		return []primitive.ObjectID{}, students, nil
+	}
+
+	ids, err := database.GetCollection("users").Distinct(ctx, "_id", bson.M{"$or": userFilters})
+	if err != nil {
+		return nil, nil, err
+	}
+	userIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if userID, ok := id.(primitive.ObjectID); ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, students, nil
+}
+
+// validateAudience checks the audience exists, sets the announcement's
+// school from it, and checks the caller may address it.
+func validateAudience(ctx context.Context, c *fiber.Ctx, announcement *model.Announcement) error {
+	principal := middleware.GetPrincipal(c)
+	manager := principal.Can(middleware.PermAnnouncementManage)
+	audience := &announcement.Audience
+	audience.Grade = strings.TrimSpace(audience.Grade)
+
+	switch audience.Type {
+	case model.AudienceSchool, model.AudienceGrade:
+		*audience = model.AnnouncementAudience{Type: audience.Type, Grade: audience.Grade}
+		if announcement.SchoolID.IsZero() {
+			return fiber.NewError(fiber.StatusBadRequest, "school_id is required")
+		}
+		if audience.Type == model.AudienceGrade && audience.Grade == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "audience.grade is required")
+		}
+		if !manager {
+			return fiber.NewError(fiber.StatusForbidden, "Only school admins can address a whole school or grade")
+		}
+	case model.AudienceClass:
+		*audience = model.AnnouncementAudience{Type: audience.Type, ClassID: audience.ClassID}
+		class, err := findClass(ctx, c, audience.ClassID)
+		if err == mongo.ErrNoDocuments {
+			return fiber.NewError(fiber.StatusBadRequest, "Class not found")
+		}
+		if err != nil {
+			return err
+		}
+		announcement.SchoolID = class.SchoolID
+		if !manager && (principal.TeacherID.IsZero() || class.HomeroomTeacherID != principal.TeacherID) {
+			count, err := database.GetCollection("subjects").CountDocuments(ctx, bson.M{"class_id": class.ID, "teacher_id": principal.TeacherID})
+			if err != nil {
+				return err
+			}
+			if principal.TeacherID.IsZero() || count == 0 {
+				return fiber.NewError(fiber.StatusForbidden, "You can only address classes you teach")
+			}
+		}
+	case model.AudienceSubject:
+		*audience = model.AnnouncementAudience{Type: audience.Type, SubjectID: audience.SubjectID}
+		offering, err := findOffering(ctx, c, audience.SubjectID)
+		if err == mongo.ErrNoDocuments {
+			return fiber.NewError(fiber.StatusBadRequest, "Subject not found")
+		}
+		if err != nil {
+			return err
+		}
+		announcement.SchoolID = offering.SchoolID
+		if !canTeachOffering(c, offering, middleware.PermAnnouncementManage) {
+			return fiber.NewError(fiber.StatusForbidden, "You can only address subjects you teach")
+		}
+	case model.AudienceDepartment:
+		*audience = model.AnnouncementAudience{Type: audience.Type, DepartmentID: audience.DepartmentID}
+		var department model.Department
+		err := database.GetCollection("departments").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": audience.DepartmentID}, "school_id")).
+			Decode(&department)
+		if err == mongo.ErrNoDocuments {
+			return fiber.NewError(fiber.StatusBadRequest, "Department not found")
+		}
+		if err != nil {
+			return err
+		}
+		announcement.SchoolID = department.SchoolID
+		if !manager {
+			count, err := database.GetCollection("teachers").CountDocuments(ctx, bson.M{"_id": principal.TeacherID, "department_id": department.ID})
+			if err != nil {
+				return err
+			}
+			if principal.TeacherID.IsZero() || count == 0 {
+				return fiber.NewError(fiber.StatusForbidden, "You can only address your own department")
+			}
+		}
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "audience.type must be school, grade, class, subject or department")
+	}
+
+	if !middleware.CanAccessSchool(c, announcement.SchoolID) {
+		return fiber.NewError(fiber.StatusForbidden, "You do not have access to this school")
+	}
+	return nil
+}
+
+// applyAnnouncementRequest copies the fields present in the request.
+func applyAnnouncementRequest(announcement *model.Announcement, body announcementRequest, now time.Time) error {
+	if body.Title != nil {
+		announcement.Title = strings.TrimSpace(*body.Title)
+	}
+	if body.Body != nil {
+		announcement.Body = strings.TrimSpace(*body.Body)
+	}
+	if announcement.Title == "" || announcement.Body == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Title and body cannot be empty")
+	}
+	if body.Pinned != nil {
+		announcement.Pinned = *body.Pinned
+	}
+	if body.EmailParents != nil {
+		announcement.EmailParents = *body.EmailParents
+	}
+	if body.PublishAt != nil {
+		announcement.PublishAt = now
+		if *body.PublishAt != "" {
+			publishAt, err := time.Parse(time.RFC3339, *body.PublishAt)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "publish_at must use RFC3339")
+			}
+			if publishAt.After(now) {
+				announcement.PublishAt = publishAt
+			}
+		}
+	}
+	if body.ExpiresAt != nil {
+		announcement.ExpiresAt = nil
+		if *body.ExpiresAt != "" {
+			expiresAt, err := parseDueAt(*body.ExpiresAt)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "expires_at must use RFC3339 or YYYY-MM-DD")
+			}
+			announcement.ExpiresAt = &expiresAt
+		}
+	}
+	if announcement.ExpiresAt != nil && !announcement.ExpiresAt.After(announcement.PublishAt) {
+		return fiber.NewError(fiber.StatusBadRequest, "expires_at must be after the publish time")
+	}
+	return nil
+}
+
+func findAnnouncement(ctx context.Context, id primitive.ObjectID) (*model.Announcement, error) {
+	var announcement model.Announcement
+	err := database.GetCollection("announcements").FindOne(ctx, bson.M{"_id": id}).Decode(&announcement)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Announcement not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &announcement, nil
+}
+
+// canManageAnnouncement allows the author, and school admins of its school.
+func canManageAnnouncement(c *fiber.Ctx, announcement *model.Announcement) bool {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil {
+		return false
+	}
+	if principal.UserID == announcement.AuthorID {
+		return true
+	}
+	return principal.Can(middleware.PermAnnouncementManage) && middleware.CanAccessSchool(c, announcement.SchoolID)
+}
@@ -0,0 +1,776 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type attendanceMark struct {
+	StudentID primitive.ObjectID `json:"student_id"`
+	Status    string             `json:"status"`
+	Remark    string             `json:"remark"`
+}
+
+// TakeAttendance marks a whole class in one request. Students left out of
+// records get default_status; without it every student must be listed.
+func TakeAttendance() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			ClassID       primitive.ObjectID `json:"class_id"`
+			SubjectID     primitive.ObjectID `json:"subject_id"`
+			Period        int                `json:"period"`
+			Date          string             `json:"date"`
+			DefaultStatus string             `json:"default_status"`
+			Records       []attendanceMark   `json:"records"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if body.ClassID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Class ID is required",
+			})
+		}
+		if body.DefaultStatus != "" && !model.IsValidAttendanceStatus(body.DefaultStatus) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid default status",
+			})
+		}
+		if body.Period < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Period cannot be negative",
+			})
+		}
+
+		date := startOfDay(time.Now())
+		if body.Date != "" {
+			parsed, err := parseDate(body.Date)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid date, use YYYY-MM-DD",
+				})
+			}
+			date = startOfDay(parsed)
+		}
+		if date.After(time.Now()) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Attendance cannot be taken for a future date",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, body.ClassID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+
+		var offering *model.SchoolSubject
+		if !body.SubjectID.IsZero() {
+			offering = &model.SchoolSubject{}
+			err := database.GetCollection("subjects").FindOne(ctx, bson.M{"_id": body.SubjectID, "class_id": class.ID}).Decode(offering)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Subject is not offered to this class",
+				})
+			}
+		}
+
+		if !canTeachClass(c, class, offering) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the class's teachers can take its attendance",
+			})
+		}
+
+		term, err := termForDate(ctx, class.AcademicYearID, date)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching term",
+			})
+		}
+		termID := primitive.NilObjectID
+		if term != nil {
+			termID = term.ID
+		}
+		if err := ensurePeriodOpen(ctx, class.AcademicYearID, termID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		roster, err := classRoster(ctx, class.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching class roster",
+			})
+		}
+
+		marks := map[primitive.ObjectID]attendanceMark{}
+		for _, mark := range body.Records {
+			if !roster[mark.StudentID] {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Student is not in this class: " + mark.StudentID.Hex(),
+				})
+			}
+			if !model.IsValidAttendanceStatus(mark.Status) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid status for student " + mark.StudentID.Hex(),
+				})
+			}
+			marks[mark.StudentID] = mark
+		}
+		for studentID := range roster {
+			if _, ok := marks[studentID]; ok {
+				continue
+			}
+			if body.DefaultStatus == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Every student in the class needs a status, or set default_status",
+				})
+			}
+			marks[studentID] = attendanceMark{StudentID: studentID, Status: body.DefaultStatus}
+		}
+
+		principal := middleware.GetPrincipal(c)
+		now := time.Now()
+		session := model.AttendanceSession{
+			ID:             primitive.NewObjectID(),
+			SchoolID:       class.SchoolID,
+			ClassID:        class.ID,
+			SubjectID:      body.SubjectID,
+			Period:         body.Period,
+			Date:           date,
+			AcademicYearID: class.AcademicYearID,
+			TermID:         termID,
+			TakenBy:        principal.UserID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+
+		// The unique (class_id, date, subject_id, period) index rejects a second roll call
+		if _, err := database.GetCollection("attendance_sessions").InsertOne(ctx, session); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Attendance was already taken for this session, correct individual records instead",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to take attendance",
+			})
+		}
+
+		records := make([]model.AttendanceRecord, 0, len(marks))
+		counts := map[string]int{}
+		for _, mark := range marks {
+			records = append(records, model.AttendanceRecord{
+				ID:             primitive.NewObjectID(),
+				SessionID:      session.ID,
+				SchoolID:       session.SchoolID,
+				ClassID:        session.ClassID,
+				SubjectID:      session.SubjectID,
+				StudentID:      mark.StudentID,
+				Date:           date,
+				AcademicYearID: session.AcademicYearID,
+				TermID:         session.TermID,
+				Status:         mark.Status,
+				Remark:         mark.Remark,
+				MarkedBy:       principal.UserID,
+				MarkedAt:       now,
+				Corrections:    []model.AttendanceCorrection{},
+			})
+			counts[mark.Status]++
+		}
+		if len(records) > 0 {
+			documents := make([]interface{}, len(records))
+			for i := range records {
+				documents[i] = records[i]
+			}
+			if _, err := database.GetCollection("attendance_records").InsertMany(ctx, documents); err != nil {
+				// Leave no half-taken session behind
+				database.GetCollection("attendance_sessions").DeleteOne(ctx, bson.M{"_id": session.ID})
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to save attendance records",
+				})
+			}
+		}
+
+		go notifyParents(records)
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":    "success",
+			"message":   "Attendance taken successfully",
+			"sessionId": session.ID,
+			"session":   session,
+			"counts":    counts,
+		})
+	}
+}
+
+func ListAttendanceSessions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter, err := attendanceQueryFilter(c)
+		if err != nil {
+			return checkError(c, err, "Invalid query")
+		}
+		for _, field := range []string{"class_id", "subject_id"} {
+			if value := c.Query(field); value != "" {
+				id, err := primitive.ObjectIDFromHex(value)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid " + field + " format",
+					})
+				}
+				filter[field] = id
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "period", Value: 1}})
+		cursor, err := database.GetCollection("attendance_sessions").Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch attendance sessions",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		sessions := []model.AttendanceSession{}
+		if err := cursor.All(ctx, &sessions); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode attendance sessions",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"sessions": sessions,
+		})
+	}
+}
+
+func GetAttendanceSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var session model.AttendanceSession
+		err = database.GetCollection("attendance_sessions").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")).
+			Decode(&session)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Attendance session not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching attendance session",
+			})
+		}
+
+		records, err := findAttendanceRecords(ctx, bson.M{"session_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching attendance records",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"session": session,
+			"records": records,
+		})
+	}
+}
+
+// CorrectAttendanceRecord changes a marked status. The reason and previous
+// status are kept in the record's correction history.
+func CorrectAttendanceRecord() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+			Remark string `json:"remark"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if !model.IsValidAttendanceStatus(body.Status) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid status",
+			})
+		}
+		if body.Reason == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "A reason is required to correct attendance",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		collection := database.GetCollection("attendance_records")
+		var record model.AttendanceRecord
+		err = collection.FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")).Decode(&record)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Attendance record not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching attendance record",
+			})
+		}
+		if record.Status == body.Status {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Record already has this status",
+			})
+		}
+
+		class, err := findClass(ctx, c, record.ClassID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+		var offering *model.SchoolSubject
+		if !record.SubjectID.IsZero() {
+			offering = &model.SchoolSubject{}
+			if err := database.GetCollection("subjects").FindOne(ctx, bson.M{"_id": record.SubjectID}).Decode(offering); err != nil {
+				offering = nil
+			}
+		}
+		if !canTeachClass(c, class, offering) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the class's teachers can correct its attendance",
+			})
+		}
+		if err := ensurePeriodOpen(ctx, record.AcademicYearID, record.TermID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		correction := model.AttendanceCorrection{
+			PreviousStatus: record.Status,
+			Status:         body.Status,
+			Reason:         body.Reason,
+			CorrectedBy:    middleware.GetPrincipal(c).UserID,
+			CorrectedAt:    time.Now(),
+		}
+		setMap := bson.M{"status": body.Status}
+		if body.Remark != "" {
+			setMap["remark"] = body.Remark
+		}
+
+		var updatedRecord model.AttendanceRecord
+		err = collection.FindOneAndUpdate(ctx,
+			bson.M{"_id": objectID, "status": record.Status},
+			bson.M{"$set": setMap, "$push": bson.M{"corrections": correction}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedRecord)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Record was changed by someone else, reload and try again",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error correcting attendance record",
+			})
+		}
+
+		go notifyParents([]model.AttendanceRecord{updatedRecord})
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Attendance corrected successfully",
+			"record":  updatedRecord,
+		})
+	}
+}
+
+// ListStudentAttendance returns a student's records, filtered by
+// ?from=, ?to= and ?term_id=.
+func ListStudentAttendance() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		filter, err := attendanceQueryFilter(c)
+		if err != nil {
+			return checkError(c, err, "Invalid query")
+		}
+		filter["student_id"] = studentID
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		records, err := findAttendanceRecords(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching attendance records",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"records": records,
+		})
+	}
+}
+
+// ListClassAttendance returns a class's records, filtered by ?from=, ?to=,
+// ?term_id= and ?status=.
+func ListClassAttendance() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		classID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		filter, err := attendanceQueryFilter(c)
+		if err != nil {
+			return checkError(c, err, "Invalid query")
+		}
+		filter["class_id"] = classID
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		records, err := findAttendanceRecords(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching attendance records",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"records": records,
+		})
+	}
+}
+
+// StudentAttendanceSummary returns a student's attendance percentage for
+// ?term_id=, defaulting to the school's current term.
+func StudentAttendanceSummary() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var student model.Student
+		err = database.GetCollection("students").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": studentID}, "school_id")).
+			Decode(&student)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Student not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching student",
+			})
+		}
+
+		term, err := summaryTerm(ctx, c, student.SchoolID)
+		if err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+
+		summaries, err := attendanceSummaries(ctx, bson.M{"student_id": studentID, "term_id": term.ID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error computing attendance summary",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"term":    term,
+			"summary": summaries[studentID],
+		})
+	}
+}
+
+// ClassAttendanceSummary returns every student's attendance percentage for
+// ?term_id=, defaulting to the school's current term.
+func ClassAttendanceSummary() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		classID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, classID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+
+		term, err := summaryTerm(ctx, c, class.SchoolID)
+		if err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+
+		summaries, err := attendanceSummaries(ctx, bson.M{"class_id": classID, "term_id": term.ID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error computing attendance summary",
+			})
+		}
+
+		students := []fiber.Map{}
+		for studentID, summary := range summaries {
+			students = append(students, fiber.Map{"student_id": studentID, "summary": summary})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"term":     term,
+			"students": students,
+		})
+	}
+}
+
+// attendanceSummary counts a student's statuses. Percentage is the share of
+// sessions attended (present or late), leaving excused absences out.
+type attendanceSummary struct {
+	Present    int     `json:"present"`
+	Absent     int     `json:"absent"`
+	Late       int     `json:"late"`
+	Excused    int     `json:"excused"`
+	Total      int     `json:"total"`
+	Percentage float64 `json:"percentage"`
+}
+
+// attendanceSummaries computes a summary per student of the matching records.
+func attendanceSummaries(ctx context.Context, filter bson.M) (map[primitive.ObjectID]*attendanceSummary, error) {
+	cursor, err := database.GetCollection("attendance_records").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"student_id": "$student_id", "status": "$status"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		ID struct {
+			StudentID primitive.ObjectID `bson:"student_id"`
+			Status    string             `bson:"status"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	summaries := map[primitive.ObjectID]*attendanceSummary{}
+	for _, group := range groups {
+		summary, ok := summaries[group.ID.StudentID]
+		if !ok {
+			summary = &attendanceSummary{}
+			summaries[group.ID.StudentID] = summary
+		}
+		switch group.ID.Status {
+		case model.AttendancePresent:
+			summary.Present += group.Count
+		case model.AttendanceAbsent:
+			summary.Absent += group.Count
+		case model.AttendanceLate:
+			summary.Late += group.Count
+		case model.AttendanceExcused:
+			summary.Excused += group.Count
+		}
+		summary.Total += group.Count
+	}
+	for _, summary := range summaries {
+		if counted := summary.Present + summary.Late + summary.Absent; counted > 0 {
+			summary.Percentage = math.Round(float64(summary.Present+summary.Late)/float64(counted)*10000) / 100
+		}
+	}
+	return summaries, nil
+}
+
+// summaryTerm returns the term named by ?term_id=, or the school's current term.
+func summaryTerm(ctx context.Context, c *fiber.Ctx, schoolID primitive.ObjectID) (*model.Term, error) {
+	filter := bson.M{"school_id": schoolID, "is_current": true}
+	if termID := c.Query("term_id"); termID != "" {
+		termObjID, err := primitive.ObjectIDFromHex(termID)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid term ID format")
+		}
+		filter = bson.M{"school_id": schoolID, "_id": termObjID}
+	}
+
+	var term model.Term
+	err := database.GetCollection("terms").FindOne(ctx, filter).Decode(&term)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Term not found, pass term_id")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+// attendanceQueryFilter builds the tenant, ?from=, ?to= and ?term_id= filter
+// shared by the attendance listings.
+func attendanceQueryFilter(c *fiber.Ctx) (bson.M, error) {
+	filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+
+	dateRange := bson.M{}
+	for param, op := range map[string]string{"from": "$gte", "to": "$lte"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseDate(value)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid "+param+" date, use YYYY-MM-DD")
+		}
+		dateRange[op] = startOfDay(parsed)
+	}
+	if len(dateRange) > 0 {
+		filter["date"] = dateRange
+	}
+
+	if termID := c.Query("term_id"); termID != "" {
+		termObjID, err := primitive.ObjectIDFromHex(termID)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid term ID format")
+		}
+		filter["term_id"] = termObjID
+	}
+	return filter, nil
+}
+
+func findAttendanceRecords(ctx context.Context, filter bson.M) ([]model.AttendanceRecord, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "student_id", Value: 1}})
+	cursor, err := database.GetCollection("attendance_records").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	records := []model.AttendanceRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// classRoster returns the IDs of the students currently in the class.
+func classRoster(ctx context.Context, classID primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := database.GetCollection("students").Find(ctx, bson.M{"class_id": classID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var students []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &students); err != nil {
+		return nil, err
+	}
+
+	roster := make(map[primitive.ObjectID]bool, len(students))
+	for _, student := range students {
+		roster[student.ID] = true
+	}
+	return roster, nil
+}
+
+// termForDate returns the term of the academic year that contains date, or
+// nil when the date falls between terms.
+func termForDate(ctx context.Context, academicYearID primitive.ObjectID, date time.Time) (*model.Term, error) {
+	if academicYearID.IsZero() {
+		return nil, nil
+	}
+	var term model.Term
+	err := database.GetCollection("terms").FindOne(ctx, bson.M{
+		"academic_year_id": academicYearID,
+		"start_date":       bson.M{"$lte": date},
+		"end_date":         bson.M{"$gte": date},
+	}).Decode(&term)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+// canTeachClass reports whether the caller may take attendance or grades for
+// the class: school staff with the manage permission, the homeroom teacher,
+// or the teacher of the given subject offering.
+func canTeachClass(c *fiber.Ctx, class *model.Class, offering *model.SchoolSubject) bool {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil {
+		return false
+	}
+	if principal.Can(middleware.PermAttendanceManage) {
+		return true
+	}
+	if principal.TeacherID.IsZero() {
+		return false
+	}
+	if class.HomeroomTeacherID == principal.TeacherID {
+		return true
+	}
+	return offering != nil && offering.TeacherID == principal.TeacherID
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
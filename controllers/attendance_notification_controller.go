@@ -0,0 +1,498 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetNotificationRule returns the school's attendance notification rule,
+// or the default one when the school has not set its own.
+func GetNotificationRule() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		schoolID, err := primitive.ObjectIDFromHex(c.Params("schoolId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid school ID format",
+			})
+		}
+		if !middleware.CanAccessSchool(c, schoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rule, err := loadNotificationRule(ctx, schoolID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching notification rule",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"rule":   rule,
+		})
+	}
+}
+
+func UpdateNotificationRule() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		schoolID, err := primitive.ObjectIDFromHex(c.Params("schoolId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid school ID format",
+			})
+		}
+		if !middleware.CanAccessSchool(c, schoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Fields left out of the body keep their current value
+		rule, err := loadNotificationRule(ctx, schoolID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching notification rule",
+			})
+		}
+		if err := c.BodyParser(&rule); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if err := validateNotificationRule(&rule); err != nil {
+			return checkError(c, err, "Invalid notification rule")
+		}
+
+		now := time.Now()
+		var updatedRule model.NotificationRule
+		err = database.GetCollection("notification_rules").FindOneAndUpdate(ctx,
+			bson.M{"school_id": schoolID},
+			bson.M{
+				"$set": bson.M{
+					"enabled":              rule.Enabled,
+					"consecutive_absences": rule.ConsecutiveAbsences,
+					"notify_late":          rule.NotifyLate,
+					"channels":             rule.Channels,
+					"quiet_hours_start":    rule.QuietHoursStart,
+					"quiet_hours_end":      rule.QuietHoursEnd,
+					"timezone":             rule.Timezone,
+					"locale":               rule.Locale,
+					"updated_at":           now,
+				},
+				"$setOnInsert": bson.M{"created_at": now},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&updatedRule)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating notification rule",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Notification rule updated successfully",
+			"rule":    updatedRule,
+		})
+	}
+}
+
+// ListAttendanceNotifications returns the notifications sent to parents,
+// filtered by ?student_id=, ?from= and ?to=.
+func ListAttendanceNotifications() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter, err := attendanceQueryFilter(c)
+		if err != nil {
+			return checkError(c, err, "Invalid query")
+		}
+		delete(filter, "term_id")
+		if studentID := c.Query("student_id"); studentID != "" {
+			objectID, err := primitive.ObjectIDFromHex(studentID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid student ID format",
+				})
+			}
+			filter["student_id"] = objectID
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(500)
+		cursor, err := database.GetCollection("attendance_notifications").Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching notifications",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		notifications := []model.AttendanceNotification{}
+		if err := cursor.All(ctx, &notifications); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding notifications",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":        "success",
+			"notifications": notifications,
+		})
+	}
+}
+
+func validateNotificationRule(rule *model.NotificationRule) error {
+	if rule.ConsecutiveAbsences < 1 {
+		return fiber.NewError(fiber.StatusBadRequest, "consecutive_absences must be at least 1")
+	}
+	channels := []string{}
+	seen := map[string]bool{}
+	for _, channel := range rule.Channels {
+		if !model.IsValidNotificationChannel(channel) {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid channel: "+channel)
+		}
+		if !seen[channel] {
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+	rule.Channels = channels
+
+	if (rule.QuietHoursStart == "") != (rule.QuietHoursEnd == "") {
+		return fiber.NewError(fiber.StatusBadRequest, "Quiet hours need both a start and an end")
+	}
+	for _, value := range []string{rule.QuietHoursStart, rule.QuietHoursEnd} {
+		if _, ok := parseClock(value); value != "" && !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Quiet hours must use HH:MM")
+		}
+	}
+	if rule.Timezone == "" {
+		rule.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(rule.Timezone); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown timezone: "+rule.Timezone)
+	}
+	if rule.Locale == "" {
+		rule.Locale = helpers.DefaultLocale
+	}
+	return nil
+}
+
+func loadNotificationRule(ctx context.Context, schoolID primitive.ObjectID) (model.NotificationRule, error) {
+	var rule model.NotificationRule
+	err := database.GetCollection("notification_rules").FindOne(ctx, bson.M{"school_id": schoolID}).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		return model.DefaultNotificationRule(schoolID), nil
+	}
+	return rule, err
+}
+
+// notifyParents tells parents about absent and late records, following each
+// school's rule. It runs after the response is sent, so failures are logged.
+func notifyParents(records []model.AttendanceRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rules := map[primitive.ObjectID]model.NotificationRule{}
+	for _, record := range records {
+		if record.Status != model.AttendanceAbsent && record.Status != model.AttendanceLate {
+			continue
+		}
+		rule, ok := rules[record.SchoolID]
+		if !ok {
+			var err error
+			if rule, err = loadNotificationRule(ctx, record.SchoolID); err != nil {
+				log.Println("Error loading notification rule:", err)
+				continue
+			}
+			rules[record.SchoolID] = rule
+		}
+		if err := notifyRecord(ctx, rule, record); err != nil {
+			log.Printf("Error notifying parents of student %s: %v\n", record.StudentID.Hex(), err)
+		}
+	}
+}
+
+func notifyRecord(ctx context.Context, rule model.NotificationRule, record model.AttendanceRecord) error {
+	if !rule.Enabled || len(rule.Channels) == 0 {
+		return nil
+	}
+	if record.Status == model.AttendanceLate && !rule.NotifyLate {
+		return nil
+	}
+
+	streak := 0
+	if record.Status == model.AttendanceAbsent {
+		var err error
+		if streak, err = consecutiveAbsentDays(ctx, record.StudentID, record.Date); err != nil {
+			return err
+		}
+		if streak < rule.ConsecutiveAbsences {
+			return nil
+		}
+	}
+
+	var student model.Student
+	if err := database.GetCollection("students").FindOne(ctx, bson.M{"_id": record.StudentID}).Decode(&student); err != nil {
+		return err
+	}
+	contacts := parentContacts(student.ParentDetails)
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	sendAt := afterQuietHours(rule, time.Now())
+	notification := model.AttendanceNotification{
+		ID:              primitive.NewObjectID(),
+		SchoolID:        record.SchoolID,
+		StudentID:       record.StudentID,
+		RecordID:        record.ID,
+		Date:            record.Date,
+		Status:          record.Status,
+		ConsecutiveDays: streak,
+		Recipients:      []string{},
+		SendAt:          sendAt,
+		CreatedAt:       time.Now(),
+	}
+	for _, contact := range contacts {
+		if contact.Email != "" && hasChannel(rule, model.NotificationChannelEmail) {
+			notification.Recipients = append(notification.Recipients, contact.Email)
+		}
+		if contact.Phone != "" && hasChannel(rule, model.NotificationChannelSMS) {
+			notification.Recipients = append(notification.Recipients, contact.Phone)
+		}
+	}
+	if len(notification.Recipients) == 0 {
+		return nil
+	}
+
+	className := ""
+	var class model.Class
+	if err := database.GetCollection("classes").FindOne(ctx, bson.M{"_id": record.ClassID}).Decode(&class); err == nil {
+		className = class.Name
+	}
+	brand := helpers.LoadBranding(ctx, record.SchoolID)
+
+	// Render every message up front so that nothing is recorded for a
+	// notification that cannot be sent
+	var emails []pendingEmail
+	var texts []pendingSMS
+	for _, contact := range contacts {
+		data := map[string]interface{}{
+			"ParentName":      contact.Name,
+			"StudentName":     strings.TrimSpace(student.FirstName + " " + student.LastName),
+			"Status":          record.Status,
+			"Date":            record.Date.Format("2 January 2006"),
+			"ClassName":       className,
+			"Remark":          record.Remark,
+			"ConsecutiveDays": streak,
+		}
+		if contact.Email != "" && hasChannel(rule, model.NotificationChannelEmail) {
+			email, err := helpers.RenderEmail(helpers.TemplateAttendanceAlert, rule.Locale, brand, data)
+			if err != nil {
+				return err
+			}
+			emails = append(emails, pendingEmail{to: contact.Email, email: email})
+		}
+		if contact.Phone != "" && hasChannel(rule, model.NotificationChannelSMS) {
+			body, err := helpers.RenderSMS(helpers.TemplateAttendanceAlert, rule.Locale, brand, data)
+			if err != nil {
+				return err
+			}
+			texts = append(texts, pendingSMS{to: contact.Phone, body: body})
+		}
+	}
+
+	// The unique (student_id, date, status) index stops a second session that
+	// day from notifying again
+	notifications := database.GetCollection("attendance_notifications")
+	if _, err := notifications.InsertOne(ctx, notification); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return err
+	}
+
+	err := func() error {
+		for _, pending := range emails {
+			if err := helpers.EnqueueMailAt(ctx, pending.to, pending.email, sendAt); err != nil {
+				return err
+			}
+		}
+		for _, pending := range texts {
+			if err := helpers.EnqueueSMS(ctx, pending.to, pending.body, sendAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		// Let the next save of the record try again
+		if _, deleteErr := notifications.DeleteOne(ctx, bson.M{"_id": notification.ID}); deleteErr != nil {
+			log.Println("Error deleting attendance notification:", deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+type pendingEmail struct {
+	to    string
+	email *helpers.RenderedEmail
+}
+
+type pendingSMS struct {
+	to, body string
+}
+
+// consecutiveAbsentDays counts the school days up to and including date on
+// which the student was absent from every session. Days without any
+// attendance taken, such as weekends, do not break the streak.
+func consecutiveAbsentDays(ctx context.Context, studentID primitive.ObjectID, date time.Time) (int, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "date", Value: -1}}).
+		SetProjection(bson.M{"date": 1, "status": 1}).
+		SetLimit(200)
+	cursor, err := database.GetCollection("attendance_records").Find(ctx, bson.M{
+		"student_id": studentID,
+		"date":       bson.M{"$lte": date},
+	}, opts)
+	if err != nil {
+		return 0, err
+	}
+	var records []model.AttendanceRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return 0, err
+	}
+
+	streak := 0
+	for i := 0; i < len(records); {
+		day := records[i].Date
+		absent := true
+		for ; i < len(records) && records[i].Date.Equal(day); i++ {
+			if records[i].Status != model.AttendanceAbsent {
+				absent = false
+			}
+		}
+		if !absent {
+			break
+		}
+		streak++
+	}
+	return streak, nil
+}
+
+type parentContact struct {
+	Name  string
+	Email string
+	Phone string
+}
+
+// parentContacts lists the father, mother and guardian who have an email or
+// phone, skipping contact details already listed for someone else.
+func parentContacts(details model.ParentDetails) []parentContact {
+	candidates := []parentContact{
+		{details.FatherName, details.FatherEmail, details.FatherPhone},
+		{details.MotherName, details.MotherEmail, details.MotherPhone},
+		{details.GuardianName, details.GuardianEmail, details.GuardianPhone},
+	}
+
+	seen := map[string]bool{}
+	contacts := []parentContact{}
+	for _, contact := range candidates {
+		contact.Email = strings.ToLower(strings.TrimSpace(contact.Email))
+		contact.Phone = strings.TrimSpace(contact.Phone)
+		if seen[contact.Email] {
+			contact.Email = ""
+		}
+		if seen[contact.Phone] {
+			contact.Phone = ""
+		}
+		if contact.Email == "" && contact.Phone == "" {
+			continue
+		}
+		seen[contact.Email] = contact.Email != ""
+		seen[contact.Phone] = contact.Phone != ""
+		if contact.Name == "" {
+			contact.Name = "Parent"
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts
+}
+
+func hasChannel(rule model.NotificationRule, channel string) bool {
+	for _, c := range rule.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// afterQuietHours returns now, or the end of the school's quiet hours when
+// now falls inside them. Quiet hours may span midnight, e.g. 20:00-07:00.
+func afterQuietHours(rule model.NotificationRule, now time.Time) time.Time {
+	start, okStart := parseClock(rule.QuietHoursStart)
+	end, okEnd := parseClock(rule.QuietHoursEnd)
+	if !okStart || !okEnd || start == end {
+		return now
+	}
+	location, err := time.LoadLocation(rule.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	quiet := (start < end && minute >= start && minute < end) ||
+		(start > end && (minute >= start || minute < end))
+	if !quiet {
+		return now
+	}
+
+	resume := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, location)
+	if !resume.After(local) {
+		resume = resume.AddDate(0, 0, 1)
+	}
+	return resume
+}
+
+// parseClock turns "HH:MM" into minutes after midnight.
+func parseClock(value string) (int, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 23 {
+		return 0, false
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, false
+	}
+	return hours*60 + minutes, true
+}
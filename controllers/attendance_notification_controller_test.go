@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/model"
+)
+
+func TestAfterQuietHours(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	overnight := model.NotificationRule{QuietHoursStart: "20:00", QuietHoursEnd: "07:00", Timezone: "UTC"}
+	midday := model.NotificationRule{QuietHoursStart: "12:00", QuietHoursEnd: "13:30", Timezone: "UTC"}
+
+	tests := []struct {
+		name string
+		rule model.NotificationRule
+		now  time.Time
+		want time.Time
+	}{
+		{"before overnight quiet hours", overnight, at(10, 19, 59), at(10, 19, 59)},
+		{"start of overnight quiet hours", overnight, at(10, 20, 0), at(11, 7, 0)},
+		{"after midnight", overnight, at(11, 2, 30), at(11, 7, 0)},
+		{"end of overnight quiet hours", overnight, at(11, 7, 0), at(11, 7, 0)},
+		{"inside midday quiet hours", midday, at(10, 12, 45), at(10, 13, 30)},
+		{"after midday quiet hours", midday, at(10, 13, 30), at(10, 13, 30)},
+		{"no quiet hours", model.NotificationRule{}, at(10, 22, 0), at(10, 22, 0)},
+		{"same start and end", model.NotificationRule{QuietHoursStart: "08:00", QuietHoursEnd: "08:00"}, at(10, 8, 0), at(10, 8, 0)},
+		{"invalid clock", model.NotificationRule{QuietHoursStart: "25:00", QuietHoursEnd: "07:00"}, at(10, 2, 0), at(10, 2, 0)},
+		{"unknown timezone falls back to UTC", model.NotificationRule{QuietHoursStart: "20:00", QuietHoursEnd: "07:00", Timezone: "Mars/Olympus"}, at(10, 23, 0), at(11, 7, 0)},
+		// Lagos is an hour ahead of UTC
+		{"school timezone", model.NotificationRule{QuietHoursStart: "20:00", QuietHoursEnd: "07:00", Timezone: "Africa/Lagos"}, at(10, 19, 30), at(11, 6, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := afterQuietHours(tt.rule, tt.now); !got.Equal(tt.want) {
+				t.Fatalf("afterQuietHours(%v) = %v, want %v", tt.now, got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		minutes int
+		ok      bool
+	}{
+		{"00:00", 0, true},
+		{"07:30", 450, true},
+		{"23:59", 1439, true},
+		{"7:05", 425, true},
+		{"24:00", 0, false},
+		{"12:60", 0, false},
+		{"1230", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		minutes, ok := parseClock(tt.value)
+		if minutes != tt.minutes || ok != tt.ok {
+			t.Errorf("parseClock(%q) = %d, %v, want %d, %v", tt.value, minutes, ok, tt.minutes, tt.ok)
+		}
+	}
+}
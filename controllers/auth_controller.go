@@ -3,9 +3,9 @@ package controllers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ReddIndiann/go-messanger/database"
@@ -13,7 +13,6 @@ import (
 	"github.com/ReddIndiann/go-messanger/middleware"
 	"github.com/ReddIndiann/go-messanger/model"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -41,7 +40,6 @@ func RegisterUser() fiber.Handler {
 		}
 
 		password, passwordExists := requestData["password"].(string)
-		role, roleExists := requestData["role"].(string)
 
 		if user.Name == "" || user.Email == "" || !passwordExists || password == "" || user.Phone == "" {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -49,18 +47,20 @@ func RegisterUser() fiber.Handler {
 			})
 		}
 
-		// Set default role if not provided
-		if !roleExists || role == "" {
-			role = string(model.RoleUser)
-		}
-
-		// Validate role
-		if role != string(model.RoleUser) && role != string(model.RoleAdmin) {
+		if err := helpers.ValidatePassword(password); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid role. Must be either 'user' or 'admin'",
+				"error": err.Error(),
 			})
 		}
 
+		// Roles are granted by an admin, never self-assigned. The configured
+		// platform admin email is the only exception so a fresh deployment
+		// can bootstrap its first admin.
+		role := string(model.RoleUser)
+		if adminEmail := os.Getenv("PLATFORM_ADMIN_EMAIL"); adminEmail != "" && strings.EqualFold(adminEmail, user.Email) {
+			role = string(model.RoleAdmin)
+		}
+
 		collection := database.GetCollection("users")
 		existingUser := collection.FindOne(context.Background(), bson.M{"email": user.Email})
 		if existingUser.Err() == nil {
@@ -98,7 +98,9 @@ func RegisterUser() fiber.Handler {
 				"error": "Error creating user",
 			})
 		}
-		go helpers.SendOTP(user.Email, "register", user.Name)
+		if err := helpers.SendOTP(newUser, helpers.OTPPurposeRegister); err != nil {
+			log.Println("Error sending verification code:", err)
+		}
 
 		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 			"status":  "success",
@@ -117,7 +119,6 @@ func VerifyMail() fiber.Handler {
 		}
 
 		var request Request
-		var user model.User
 
 		if err := c.BodyParser(&request); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -125,30 +126,15 @@ func VerifyMail() fiber.Handler {
 				"message": "Invalid request body",
 			})
 		}
-		storedOTP, found := helpers.GetOTP(request.Email)
-		if !found {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  false,
-				"message": "OTP expired or not found",
-			})
-		}
-
-		if storedOTP != request.OTP {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  false,
-				"message": "Invalid OTP",
-			})
-		}
 
-		if user.Verified {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "User already verified",
-			})
-		}
-		collection := database.GetCollection("users")
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
+		if err := helpers.VerifyOTP(ctx, request.Email, helpers.OTPPurposeRegister, request.OTP); err != nil {
+			return otpError(c, err)
+		}
+
+		collection := database.GetCollection("users")
 		filter := bson.M{"email": request.Email}
 		update := bson.M{"$set": bson.M{"verified": true}}
 
@@ -167,7 +153,6 @@ func VerifyMail() fiber.Handler {
 				"message": "Failed to verify user",
 			})
 		}
-		helpers.DeleteOTP(request.Email)
 
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"success": true,
@@ -206,9 +191,9 @@ func ResendOTP() fiber.Handler {
 			})
 		}
 
-		newCode := helpers.GenerateOTP()
-
-		go helpers.SendOTP(request.Email, newCode, user.Name)
+		if err := helpers.SendOTP(user, helpers.OTPPurposeRegister); err != nil {
+			return otpError(c, err)
+		}
 
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"message": "A new verification code has been sent to your email",
@@ -217,6 +202,131 @@ func ResendOTP() fiber.Handler {
 
 }
 
+func ForgotPassword() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		type ForgotRequest struct {
+			Email string `json:"email"`
+		}
+
+		var request ForgotRequest
+		if err := c.BodyParser(&request); err != nil || request.Email == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Email is required",
+			})
+		}
+
+		collection := database.GetCollection("users")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Respond the same way whether or not the account exists so the
+		// endpoint cannot be used to discover registered emails
+		var user model.User
+		if err := collection.FindOne(ctx, bson.M{"email": request.Email}).Decode(&user); err == nil {
+			if err := helpers.SendOTP(user, helpers.OTPPurposeForgot); err != nil {
+				log.Println("Error sending password reset code:", err)
+			}
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "If an account exists for this email, a password reset code has been sent",
+		})
+	}
+}
+
+func ResetPassword() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		type ResetRequest struct {
+			Email    string `json:"email"`
+			OTP      string `json:"otp"`
+			Password string `json:"password"`
+		}
+
+		var request ResetRequest
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid request body",
+			})
+		}
+
+		if request.Email == "" || request.OTP == "" || request.Password == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Email, OTP and password are required",
+			})
+		}
+
+		// Check the policy first so a weak password does not use up the code
+		if err := helpers.ValidatePassword(request.Password); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := helpers.VerifyOTP(ctx, request.Email, helpers.OTPPurposeForgot, request.OTP); err != nil {
+			return otpError(c, err)
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error hashing password",
+			})
+		}
+
+		collection := database.GetCollection("users")
+
+		var user model.User
+		err = collection.FindOne(ctx, bson.M{"email": request.Email}).Decode(&user)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"status":  "error",
+					"message": "User not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error resetting password",
+			})
+		}
+
+		// Sessions are revoked before the password changes, so that a reset
+		// never leaves a possibly stolen session alive
+		if err := middleware.RevokeUserSessions(ctx, user.ID, "password_reset"); err != nil {
+			log.Println("Error revoking sessions before password reset:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error resetting password, request a new code and try again",
+			})
+		}
+
+		_, err = collection.UpdateOne(ctx,
+			bson.M{"_id": user.ID},
+			bson.M{"$set": bson.M{"password": string(hashedPassword), "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error resetting password, request a new code and try again",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Password reset successfully. Please log in with your new password",
+		})
+	}
+}
+
 func GetAllUsers() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		collection := database.GetCollection("users")
@@ -225,7 +335,7 @@ func GetAllUsers() fiber.Handler {
 
 		opts := options.Find().SetProjection(bson.M{"password": 0})
 
-		cursor, err := collection.Find(ctx, bson.M{}, opts)
+		cursor, err := collection.Find(ctx, middleware.TenantFilter(c, bson.M{}, "school_ids"), opts)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -271,7 +381,7 @@ func GetUserByID() fiber.Handler {
 		opts := options.FindOne().SetProjection(bson.M{"password": 0})
 
 		var user model.User
-		err = collection.FindOne(ctx, bson.M{"_id": objectID}, opts).Decode(&user)
+		err = collection.FindOne(ctx, userFilter(c, objectID), opts).Decode(&user)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -311,7 +421,7 @@ func UpdateUser() fiber.Handler {
 		defer cancel()
 
 		var existingUser model.User
-		err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&existingUser)
+		err = collection.FindOne(ctx, userFilter(c, objectID)).Decode(&existingUser)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -354,11 +464,8 @@ func UpdateUser() fiber.Handler {
 		if fieldExists("phone") {
 			setMap["phone"] = updateData["phone"]
 		}
-		if fieldExists("role") {
-			setMap["role"] = updateData["role"]
-		}
-		if fieldExists("verified") {
-			setMap["verified"] = updateData["verified"]
+		if fieldExists("locale") {
+			setMap["locale"] = updateData["locale"]
 		}
 
 		// Always update the updated_at field
@@ -406,6 +513,256 @@ func UpdateUser() fiber.Handler {
 	}
 }
 
+func UpdateUserRole() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid ID format",
+			})
+		}
+
+		type RoleRequest struct {
+			Role string `json:"role"`
+		}
+
+		var request RoleRequest
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid request body",
+			})
+		}
+
+		if !model.IsValidRole(request.Role) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid role",
+				"roles":   model.Roles,
+			})
+		}
+
+		principal := middleware.GetPrincipal(c)
+		if principal.UserID == objectID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "You cannot change your own role",
+			})
+		}
+
+		collection := database.GetCollection("users")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		opts.SetProjection(bson.M{"password": 0})
+
+		var updatedUser model.User
+		err = collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": bson.M{"role": request.Role, "updated_at": time.Now()}},
+			opts,
+		).Decode(&updatedUser)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"status":  "error",
+					"message": "User not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error updating user role",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "User role updated successfully",
+			"user":    updatedUser,
+		})
+	}
+}
+
+func UpdateUserSchools() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid ID format",
+			})
+		}
+
+		type SchoolsRequest struct {
+			SchoolIDs []primitive.ObjectID `json:"school_ids"`
+		}
+
+		var request SchoolsRequest
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid request body",
+			})
+		}
+		if request.SchoolIDs == nil {
+			request.SchoolIDs = []primitive.ObjectID{}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Check that every school exists
+		schoolCollection := database.GetCollection("schools")
+		count, err := schoolCollection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": request.SchoolIDs}})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error checking schools",
+			})
+		}
+		if int(count) != len(request.SchoolIDs) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "One or more schools were not found",
+			})
+		}
+
+		collection := database.GetCollection("users")
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		opts.SetProjection(bson.M{"password": 0})
+
+		var updatedUser model.User
+		err = collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": bson.M{"school_ids": request.SchoolIDs, "updated_at": time.Now()}},
+			opts,
+		).Decode(&updatedUser)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"status":  "error",
+					"message": "User not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error updating user schools",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "User schools updated successfully",
+			"user":    updatedUser,
+		})
+	}
+}
+
+// UpdateUserLinks links an account to its teacher or student record. An
+// empty ID removes the link.
+func UpdateUserLinks() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid ID format",
+			})
+		}
+
+		var request map[string]string
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid request body",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		collection := database.GetCollection("users")
+		var user model.User
+		if err := collection.FindOne(ctx, userFilter(c, objectID)).Decode(&user); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"status":  "error",
+					"message": "User not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error fetching user",
+			})
+		}
+
+		setMap := bson.M{"updated_at": time.Now()}
+		unsetMap := bson.M{}
+		for field, records := range map[string]string{"teacher_id": "teachers", "student_id": "students"} {
+			value, ok := request[field]
+			if !ok {
+				continue
+			}
+			if value == "" {
+				unsetMap[field] = ""
+				continue
+			}
+			recordID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"status":  "error",
+					"message": "Invalid " + field + " format",
+				})
+			}
+			// The record has to belong to one of the user's schools
+			err = database.GetCollection(records).FindOne(ctx, bson.M{"_id": recordID, "school_id": bson.M{"$in": user.SchoolIDs}}).Err()
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"status":  "error",
+					"message": "Record for " + field + " not found in the user's schools",
+				})
+			}
+			if err := collection.FindOne(ctx, bson.M{field: recordID, "_id": bson.M{"$ne": objectID}}).Err(); err == nil {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"status":  "error",
+					"message": "Record for " + field + " is already linked to another user",
+				})
+			}
+			setMap[field] = recordID
+		}
+
+		update := bson.M{"$set": setMap}
+		if len(unsetMap) > 0 {
+			update["$unset"] = unsetMap
+		}
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		opts.SetProjection(bson.M{"password": 0})
+
+		var updatedUser model.User
+		if err := collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update, opts).Decode(&updatedUser); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error updating user links",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "User links updated successfully",
+			"user":    updatedUser,
+		})
+	}
+}
+
 func DeleteUser() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id := c.Params("id")
@@ -422,7 +779,7 @@ func DeleteUser() fiber.Handler {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID})
+		result, err := collection.DeleteOne(ctx, userFilter(c, objectID))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -495,7 +852,7 @@ func LoginUser() fiber.Handler {
 			})
 		}
 
-		tokens, err := middleware.GenerateTokens(user.ID)
+		session, tokens, err := middleware.CreateSession(ctx, c, user.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -512,7 +869,9 @@ func LoginUser() fiber.Handler {
 				"email":    user.Email,
 				"phone":    user.Phone,
 				"verified": user.Verified,
+				"role":     user.Role,
 			},
+			"session_id": session.ID,
 			"tokens": fiber.Map{
 				"access_token":  tokens.AccessToken,
 				"refresh_token": tokens.RefreshToken,
@@ -536,46 +895,18 @@ func RefreshToken() fiber.Handler {
 			})
 		}
 
-		token, err := jwt.Parse(request.RefreshToken, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_REFRESH_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Invalid refresh token",
-			})
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Invalid token claims",
-			})
-		}
-
-		userIdStr, ok := claims["user_id"].(string)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Invalid user ID in token",
-			})
-		}
-
-		userId, err := primitive.ObjectIDFromHex(userIdStr)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Invalid user ID format",
-			})
-		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
 
-		newTokens, err := middleware.GenerateTokens(userId)
+		newTokens, err := middleware.RotateSession(ctx, c, request.RefreshToken)
 		if err != nil {
+			switch err {
+			case middleware.ErrInvalidRefreshToken, middleware.ErrSessionRevoked, middleware.ErrRefreshTokenReused:
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"status":  "error",
+					"message": err.Error(),
+				})
+			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
 				"message": "Error generating tokens",
@@ -596,50 +927,72 @@ func RefreshToken() fiber.Handler {
 
 func LogoutUser() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		tokenMetadata, err := middleware.ExtractTokenMetadata(c)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		principal := middleware.GetPrincipal(c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := middleware.RevokeSession(ctx, principal.SessionID, "logout"); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
-				"message": "Unauthorized",
+				"message": "Failed to revoke token",
 			})
 		}
 
-		tokenString := middleware.ExtractToken(c)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Successfully logged out",
 		})
+	}
+}
 
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Invalid token",
-			})
-		}
+func LogoutAllSessions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := middleware.GetPrincipal(c)
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Failed to parse token claims",
-			})
-		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
 
-		exp, ok := claims["exp"].(float64)
-		if !ok {
+		if err := middleware.RevokeUserSessions(ctx, principal.UserID, "logout_all"); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
-				"message": "Failed to get token expiration",
+				"message": "Failed to revoke sessions",
 			})
 		}
 
-		middleware.BlacklistToken(tokenMetadata.AccessUuid, int64(exp))
-
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"status":  "success",
-			"message": "Successfully logged out",
+			"message": "Successfully logged out of all sessions",
+		})
+	}
+}
+
+// otpError maps OTP service errors to responses.
+func otpError(c *fiber.Ctx, err error) error {
+	switch err {
+	case helpers.ErrOTPInvalid, helpers.ErrOTPExpired:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	case helpers.ErrOTPLocked, helpers.ErrOTPCooldown:
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
 		})
 	}
+	log.Println("OTP error:", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Error processing OTP",
+	})
+}
+
+// userFilter scopes a user lookup to the caller's schools, except for the caller's own record.
+func userFilter(c *fiber.Ctx, objectID primitive.ObjectID) bson.M {
+	filter := bson.M{"_id": objectID}
+	if principal := middleware.GetPrincipal(c); principal != nil && principal.UserID == objectID {
+		return filter
+	}
+	return middleware.TenantFilter(c, filter, "school_ids")
 }
@@ -0,0 +1,670 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateClass() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var class model.Class
+		if err := c.BodyParser(&class); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		class.Grade = strings.TrimSpace(class.Grade)
+		class.Section = strings.TrimSpace(class.Section)
+		if class.Grade == "" || class.Section == "" || class.SchoolID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Grade, section and school ID are required",
+			})
+		}
+		if class.Capacity < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Capacity cannot be negative",
+			})
+		}
+
+		if !middleware.CanAccessSchool(c, class.SchoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Check if school exists
+		if err := database.GetCollection("schools").FindOne(ctx, bson.M{"_id": class.SchoolID}).Err(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "School not found with the provided ID",
+			})
+		}
+
+		// Without an academic year the class goes into the school's current one
+		year, err := resolveAcademicYear(ctx, class.SchoolID, class.AcademicYearID)
+		if err != nil {
+			return checkError(c, err, "Error fetching academic year")
+		}
+		if err := ensurePeriodOpen(ctx, year.ID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		if !class.HomeroomTeacherID.IsZero() {
+			if err := validateHomeroomTeacher(ctx, class.HomeroomTeacherID, class.SchoolID); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+		}
+
+		name := strings.TrimSpace(class.Name)
+		if name == "" {
+			name = class.Grade + " " + class.Section
+		}
+
+		newClass := model.Class{
+			ID:                primitive.NewObjectID(),
+			SchoolID:          class.SchoolID,
+			AcademicYearID:    year.ID,
+			AcademicYear:      year.Name,
+			Grade:             class.Grade,
+			Section:           class.Section,
+			Name:              name,
+			HomeroomTeacherID: class.HomeroomTeacherID,
+			Capacity:          class.Capacity,
+			CreatedAt:         time.Now(),
+			UpdatedAt:         time.Now(),
+		}
+
+		// The unique (school_id, academic_year_id, grade, section) index rejects duplicates
+		_, err = database.GetCollection("classes").InsertOne(ctx, newClass)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "This grade and section already exists for the academic year",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create class",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Class created successfully",
+			"classId": newClass.ID,
+			"info":    newClass,
+		})
+	}
+}
+
+func ListClasses() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		if yearID := c.Query("academic_year_id"); yearID != "" {
+			yearObjID, err := primitive.ObjectIDFromHex(yearID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid academic year ID format",
+				})
+			}
+			filter["academic_year_id"] = yearObjID
+		}
+		if grade := c.Query("grade"); grade != "" {
+			filter["grade"] = grade
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "grade", Value: 1}, {Key: "section", Value: 1}})
+		cursor, err := database.GetCollection("classes").Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch classes",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		classes := []model.Class{}
+		if err := cursor.All(ctx, &classes); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode classes",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"classes": classes,
+		})
+	}
+}
+
+func GetClass() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, objectID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+
+		enrolled, err := database.GetCollection("students").CountDocuments(ctx, bson.M{"class_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting students",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"class":    class,
+			"enrolled": enrolled,
+		})
+	}
+}
+
+func UpdateClass() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		existingClass, err := findClass(ctx, c, objectID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+		if err := ensurePeriodOpen(ctx, existingClass.AcademicYearID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		var updateData map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &updateData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		setMap := bson.M{}
+		for _, field := range []string{"name", "grade", "section"} {
+			if value, ok := updateData[field].(string); ok && strings.TrimSpace(value) != "" {
+				setMap[field] = strings.TrimSpace(value)
+			}
+		}
+		if capacity, ok := updateData["capacity"].(float64); ok {
+			if capacity < 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Capacity cannot be negative",
+				})
+			}
+			enrolled, err := database.GetCollection("students").CountDocuments(ctx, bson.M{"class_id": objectID})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error counting students",
+				})
+			}
+			if capacity > 0 && int64(capacity) < enrolled {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":    "Capacity is below the number of enrolled students",
+					"enrolled": enrolled,
+				})
+			}
+			setMap["capacity"] = int(capacity)
+		}
+		if teacherID, ok := updateData["homeroom_teacher_id"].(string); ok {
+			if teacherID == "" {
+				setMap["homeroom_teacher_id"] = primitive.NilObjectID
+			} else {
+				teacherObjID, err := primitive.ObjectIDFromHex(teacherID)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid homeroom teacher ID format",
+					})
+				}
+				if err := validateHomeroomTeacher(ctx, teacherObjID, existingClass.SchoolID); err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": err.Error(),
+					})
+				}
+				setMap["homeroom_teacher_id"] = teacherObjID
+			}
+		}
+		setMap["updated_at"] = time.Now()
+
+		var updatedClass model.Class
+		err = database.GetCollection("classes").FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": setMap},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedClass)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "This grade and section already exists for the academic year",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating class",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Class updated successfully",
+			"class":   updatedClass,
+		})
+	}
+}
+
+// DeleteClass refuses to delete a class that still has students or subject offerings.
+func DeleteClass() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, objectID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+		if err := ensurePeriodOpen(ctx, class.AcademicYearID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		students, err := database.GetCollection("students").CountDocuments(ctx, bson.M{"class_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting students",
+			})
+		}
+		offerings, err := database.GetCollection("subjects").CountDocuments(ctx, bson.M{"class_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting subject offerings",
+			})
+		}
+		sessions, err := database.GetCollection("attendance_sessions").CountDocuments(ctx, bson.M{"class_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting attendance sessions",
+			})
+		}
+		if students > 0 || offerings > 0 || sessions > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":              "Class still has students, subject offerings or attendance",
+				"students":           students,
+				"offerings":          offerings,
+				"attendanceSessions": sessions,
+			})
+		}
+
+		if _, err := database.GetCollection("classes").DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting class",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Class deleted successfully",
+		})
+	}
+}
+
+func ListClassStudents() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, objectID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "roll_number", Value: 1}, {Key: "last_name", Value: 1}})
+		cursor, err := database.GetCollection("students").Find(ctx, bson.M{"class_id": objectID}, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching students",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		students := []model.Student{}
+		if err = cursor.All(ctx, &students); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error parsing students",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"class":    class,
+			"count":    len(students),
+			"students": students,
+		})
+	}
+}
+
+// AddClassStudents enrolls students who are not in a class yet. Students
+// already in another class have to be transferred instead.
+func AddClassStudents() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			StudentIDs []primitive.ObjectID `json:"student_ids"`
+		}
+		if err := c.BodyParser(&body); err != nil || len(body.StudentIDs) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "student_ids is required",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, objectID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+		if err := ensurePeriodOpen(ctx, class.AcademicYearID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		studentCollection := database.GetCollection("students")
+		cursor, err := studentCollection.Find(ctx, bson.M{"_id": bson.M{"$in": body.StudentIDs}, "school_id": class.SchoolID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching students",
+			})
+		}
+		var students []model.Student
+		if err := cursor.All(ctx, &students); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error parsing students",
+			})
+		}
+
+		found := map[primitive.ObjectID]bool{}
+		toAdd := []primitive.ObjectID{}
+		for _, student := range students {
+			found[student.ID] = true
+			if student.ClassID == objectID {
+				continue
+			}
+			if !student.ClassID.IsZero() {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":     "Student is already in another class, transfer them instead",
+					"studentId": student.ID,
+				})
+			}
+			toAdd = append(toAdd, student.ID)
+		}
+		for _, id := range body.StudentIDs {
+			if !found[id] {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Student not found in the class's school with ID: " + id.Hex(),
+				})
+			}
+		}
+
+		if err := ensureClassCapacity(ctx, class, len(toAdd)); err != nil {
+			return checkError(c, err, "Error checking class capacity")
+		}
+
+		if len(toAdd) > 0 {
+			_, err = studentCollection.UpdateMany(ctx,
+				bson.M{"_id": bson.M{"$in": toAdd}, "class_id": primitive.NilObjectID},
+				bson.M{"$set": bson.M{"class_id": objectID, "updated_at": time.Now()}},
+			)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error adding students to class",
+				})
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Students added to class successfully",
+			"added":   len(toAdd),
+		})
+	}
+}
+
+func RemoveClassStudent() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+		studentID, err := primitive.ObjectIDFromHex(c.Params("studentId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid student ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, objectID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+		if err := ensurePeriodOpen(ctx, class.AcademicYearID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		result, err := database.GetCollection("students").UpdateOne(ctx,
+			bson.M{"_id": studentID, "class_id": objectID},
+			bson.M{"$set": bson.M{"class_id": primitive.NilObjectID, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error removing student from class",
+			})
+		}
+		if result.MatchedCount == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Student is not in this class",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Student removed from class successfully",
+		})
+	}
+}
+
+// TransferClassStudent moves a student to another class of the same school.
+func TransferClassStudent() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+		studentID, err := primitive.ObjectIDFromHex(c.Params("studentId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid student ID format",
+			})
+		}
+
+		var body struct {
+			ClassID primitive.ObjectID `json:"class_id"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.ClassID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "class_id of the target class is required",
+			})
+		}
+		if body.ClassID == objectID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Student is already in this class",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, objectID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+
+		var target model.Class
+		err = database.GetCollection("classes").FindOne(ctx, bson.M{"_id": body.ClassID, "school_id": class.SchoolID}).Decode(&target)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Target class was not found in the same school",
+			})
+		}
+
+		if err := ensurePeriodOpen(ctx, class.AcademicYearID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+		if err := ensurePeriodOpen(ctx, target.AcademicYearID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		if err := ensureClassCapacity(ctx, &target, 1); err != nil {
+			return checkError(c, err, "Error checking class capacity")
+		}
+
+		result, err := database.GetCollection("students").UpdateOne(ctx,
+			bson.M{"_id": studentID, "class_id": objectID},
+			bson.M{"$set": bson.M{"class_id": target.ID, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error transferring student",
+			})
+		}
+		if result.MatchedCount == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Student is not in this class",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Student transferred successfully",
+			"from":    objectID,
+			"to":      target.ID,
+		})
+	}
+}
+
+// findClass loads a class the caller's schools can see.
+func findClass(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Class, error) {
+	var class model.Class
+	err := database.GetCollection("classes").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&class)
+	if err != nil {
+		return nil, err
+	}
+	return &class, nil
+}
+
+func classLookupError(c *fiber.Ctx, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Class not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error fetching class",
+	})
+}
+
+// ensureClassCapacity checks that the class has room for n more students.
+func ensureClassCapacity(ctx context.Context, class *model.Class, n int) error {
+	if class.Capacity == 0 || n == 0 {
+		return nil
+	}
+	enrolled, err := database.GetCollection("students").CountDocuments(ctx, bson.M{"class_id": class.ID})
+	if err != nil {
+		return err
+	}
+	if int(enrolled)+n > class.Capacity {
+		return fiber.NewError(fiber.StatusConflict, "Class is full")
+	}
+	return nil
+}
+
+// validateHomeroomTeacher checks that the teacher belongs to the class's school.
+func validateHomeroomTeacher(ctx context.Context, teacherID primitive.ObjectID, schoolID primitive.ObjectID) error {
+	err := database.GetCollection("teachers").FindOne(ctx, bson.M{"_id": teacherID, "school_id": schoolID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusBadRequest, "Homeroom teacher must be a teacher of the same school")
+	}
+	return err
+}
+
+// validateSchoolClass checks that a class belongs to the given school.
+func validateSchoolClass(ctx context.Context, classID primitive.ObjectID, schoolID primitive.ObjectID) (*model.Class, error) {
+	var class model.Class
+	err := database.GetCollection("classes").FindOne(ctx, bson.M{"_id": classID, "school_id": schoolID}).Decode(&class)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Class not found in the same school")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &class, nil
+}
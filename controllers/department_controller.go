@@ -0,0 +1,432 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateDepartment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var department model.Department
+		if err := c.BodyParser(&department); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		// Validate required fields
+		if department.Name == "" || department.Code == "" || department.SchoolID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Name, code and school ID are required",
+			})
+		}
+
+		if !middleware.CanAccessSchool(c, department.SchoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Check if school exists
+		schoolCollection := database.GetCollection("schools")
+		if err := schoolCollection.FindOne(ctx, bson.M{"_id": department.SchoolID}).Err(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "School not found with the provided ID",
+			})
+		}
+
+		// Department codes are unique within a school
+		collection := database.GetCollection("departments")
+		if err := collection.FindOne(ctx, bson.M{"school_id": department.SchoolID, "code": department.Code}).Err(); err == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "A department with this code already exists in the school",
+			})
+		}
+
+		if !department.HeadID.IsZero() {
+			if err := validateDepartmentHead(ctx, department.HeadID, department.SchoolID); err != nil {
+				return checkError(c, err, "Error checking department head")
+			}
+		}
+
+		newDepartment := model.Department{
+			ID:          primitive.NewObjectID(),
+			SchoolID:    department.SchoolID,
+			Name:        department.Name,
+			Code:        department.Code,
+			Description: department.Description,
+			HeadID:      department.HeadID,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+
+		result, err := collection.InsertOne(ctx, newDepartment)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create department",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":       "success",
+			"message":      "Department created successfully",
+			"departmentId": result.InsertedID,
+			"info":         newDepartment,
+		})
+	}
+}
+
+func ListDepartments() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		collection := database.GetCollection("departments")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "10"))
+		skip := (page - 1) * limit
+
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		if search := c.Query("search"); search != "" {
+			filter["$or"] = []bson.M{
+				{"name": bson.M{"$regex": search, "$options": "i"}},
+				{"code": bson.M{"$regex": search, "$options": "i"}},
+			}
+		}
+
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting departments",
+			})
+		}
+
+		opts := options.Find().
+			SetSkip(int64(skip)).
+			SetLimit(int64(limit)).
+			SetSort(bson.D{{Key: "name", Value: 1}})
+
+		cursor, err := collection.Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching departments",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		departments := []model.Department{}
+		if err = cursor.All(ctx, &departments); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error parsing departments",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status": "success",
+			"data": fiber.Map{
+				"departments": departments,
+				"pagination": fiber.Map{
+					"total": total,
+					"page":  page,
+					"limit": limit,
+					"pages": math.Ceil(float64(total) / float64(limit)),
+				},
+			},
+		})
+	}
+}
+
+func GetDepartment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		department, err := findDepartment(ctx, c, objectID)
+		if err != nil {
+			return departmentLookupError(c, err)
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status": "success",
+			"data":   department,
+		})
+	}
+}
+
+func UpdateDepartment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		existingDepartment, err := findDepartment(ctx, c, objectID)
+		if err != nil {
+			return departmentLookupError(c, err)
+		}
+
+		var updateData map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &updateData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		setMap := bson.M{}
+		if name, ok := updateData["name"].(string); ok && name != "" {
+			setMap["name"] = name
+		}
+		if description, ok := updateData["description"].(string); ok {
+			setMap["description"] = description
+		}
+		if code, ok := updateData["code"].(string); ok && code != "" && code != existingDepartment.Code {
+			collection := database.GetCollection("departments")
+			if err := collection.FindOne(ctx, bson.M{"school_id": existingDepartment.SchoolID, "code": code}).Err(); err == nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "A department with this code already exists in the school",
+				})
+			}
+			setMap["code"] = code
+		}
+		if headID, ok := updateData["head_id"].(string); ok {
+			if headID == "" {
+				setMap["head_id"] = primitive.NilObjectID
+			} else {
+				headObjID, err := primitive.ObjectIDFromHex(headID)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid head ID format",
+					})
+				}
+				if err := validateDepartmentHead(ctx, headObjID, existingDepartment.SchoolID); err != nil {
+					return checkError(c, err, "Error checking department head")
+				}
+				setMap["head_id"] = headObjID
+			}
+		}
+		setMap["updated_at"] = time.Now()
+
+		var updatedDepartment model.Department
+		err = database.GetCollection("departments").FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": setMap},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedDepartment)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating department",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Department updated successfully",
+			"data":    updatedDepartment,
+		})
+	}
+}
+
+// DeleteDepartment refuses to delete a department that still has teachers
+// unless ?reassign_to= names another department of the same school to move
+// them to.
+func DeleteDepartment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		department, err := findDepartment(ctx, c, objectID)
+		if err != nil {
+			return departmentLookupError(c, err)
+		}
+
+		teacherCollection := database.GetCollection("teachers")
+		members, err := teacherCollection.CountDocuments(ctx, bson.M{"department_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting department members",
+			})
+		}
+
+		var reassignedTo primitive.ObjectID
+		if members > 0 {
+			reassignTo := c.Query("reassign_to")
+			if reassignTo == "" {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":   "Department still has teachers. Reassign them with ?reassign_to=<department id>",
+					"members": members,
+				})
+			}
+
+			reassignedTo, err = primitive.ObjectIDFromHex(reassignTo)
+			if err != nil || reassignedTo == objectID {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid department to reassign teachers to",
+				})
+			}
+			err := database.GetCollection("departments").FindOne(ctx, bson.M{"_id": reassignedTo, "school_id": department.SchoolID}).Err()
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Department to reassign teachers to was not found in the same school",
+				})
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error fetching department to reassign teachers to",
+				})
+			}
+		}
+
+		// Delete first and only move the teachers once the delete matched, so a
+		// failed delete leaves them where they were
+		result, err := database.GetCollection("departments").DeleteOne(ctx, bson.M{"_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting department",
+			})
+		}
+		if result.DeletedCount == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Department not found",
+			})
+		}
+
+		if !reassignedTo.IsZero() {
+			update, err := teacherCollection.UpdateMany(ctx,
+				bson.M{"department_id": objectID},
+				bson.M{"$set": bson.M{"department_id": reassignedTo, "updated_at": time.Now()}},
+			)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Department deleted, but reassigning its teachers failed. Update their department_id to " + reassignedTo.Hex(),
+				})
+			}
+			members = update.ModifiedCount
+		}
+
+		response := fiber.Map{
+			"status":  "success",
+			"message": "Department deleted successfully",
+		}
+		if members > 0 {
+			response["reassigned"] = members
+			response["reassigned_to"] = reassignedTo
+		}
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+}
+
+func ListDepartmentTeachers() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findDepartment(ctx, c, objectID); err != nil {
+			return departmentLookupError(c, err)
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "last_name", Value: 1}, {Key: "first_name", Value: 1}})
+		cursor, err := database.GetCollection("teachers").Find(ctx, bson.M{"department_id": objectID}, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching teachers",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		teachers := []model.Teacher{}
+		if err = cursor.All(ctx, &teachers); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error parsing teachers",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":   "success",
+			"count":    len(teachers),
+			"teachers": teachers,
+		})
+	}
+}
+
+// findDepartment loads a department the caller's schools can see.
+func findDepartment(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Department, error) {
+	var department model.Department
+	err := database.GetCollection("departments").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&department)
+	if err != nil {
+		return nil, err
+	}
+	return &department, nil
+}
+
+func departmentLookupError(c *fiber.Ctx, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Department not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error fetching department",
+	})
+}
+
+// validateDepartmentHead checks that the head is a teacher of the department's school.
+func validateDepartmentHead(ctx context.Context, headID primitive.ObjectID, schoolID primitive.ObjectID) error {
+	err := database.GetCollection("teachers").FindOne(ctx, bson.M{"_id": headID, "school_id": schoolID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusBadRequest, "Department head must be a teacher of the same school")
+	}
+	return err
+}
+
+// validateTeacherDepartment checks that a teacher's department belongs to the teacher's school.
+func validateTeacherDepartment(ctx context.Context, departmentID primitive.ObjectID, schoolID primitive.ObjectID) error {
+	err := database.GetCollection("departments").FindOne(ctx, bson.M{"_id": departmentID, "school_id": schoolID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusBadRequest, "Department not found in the teacher's school")
+	}
+	return err
+}
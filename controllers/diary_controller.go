@@ -0,0 +1,641 @@
+package controllers
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type diaryRequest struct {
+	SubjectID    primitive.ObjectID    `json:"subject_id"`
+	Date         string                `json:"date"`
+	Period       int                   `json:"period"`
+	Topic        string                `json:"topic"`
+	Notes        string                `json:"notes"`
+	Homework     string                `json:"homework"`
+	AssignmentID primitive.ObjectID    `json:"assignment_id"`
+	Resources    []model.DiaryResource `json:"resources"`
+}
+
+// CreateDiaryEntry logs a lesson of an offering. There is one entry per
+// offering, date and period.
+func CreateDiaryEntry() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body diaryRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		body.Topic = strings.TrimSpace(body.Topic)
+		if body.SubjectID.IsZero() || body.Topic == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Subject ID and topic are required",
+			})
+		}
+		if body.Period < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Period cannot be negative",
+			})
+		}
+		if err := validateDiaryResources(body.Resources); err != nil {
+			return checkError(c, err, "Invalid resources")
+		}
+
+		date := startOfDay(time.Now())
+		if body.Date != "" {
+			parsed, err := parseDate(body.Date)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid date, use YYYY-MM-DD",
+				})
+			}
+			date = startOfDay(parsed)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		offering, err := findOffering(ctx, c, body.SubjectID)
+		if err != nil {
+			return offeringLookupError(c, err)
+		}
+		if !canTeachOffering(c, offering, middleware.PermDiaryManage) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the subject's teacher can write its diary",
+			})
+		}
+		if err := ensureDiaryPeriodOpen(ctx, offering, date); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+		if err := validateDiaryAssignment(ctx, body.AssignmentID, offering.ID); err != nil {
+			return checkError(c, err, "Error fetching assignment")
+		}
+
+		now := time.Now()
+		entry := model.DiaryEntry{
+			ID:           primitive.NewObjectID(),
+			SchoolID:     offering.SchoolID,
+			ClassID:      offering.ClassID,
+			SubjectID:    offering.ID,
+			Date:         date,
+			Period:       body.Period,
+			Topic:        body.Topic,
+			Notes:        body.Notes,
+			Homework:     body.Homework,
+			AssignmentID: body.AssignmentID,
+			Resources:    body.Resources,
+			AuthorID:     middleware.GetPrincipal(c).UserID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if entry.Resources == nil {
+			entry.Resources = []model.DiaryResource{}
+		}
+
+		if _, err := database.GetCollection("diary_entries").InsertOne(ctx, entry); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "This lesson already has a diary entry",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create diary entry",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Diary entry created successfully",
+			"entryId": entry.ID,
+			"entry":   entry,
+		})
+	}
+}
+
+// ListDiaryEntries filters by ?subject_id=, ?class_id=, ?from= and ?to=.
+func ListDiaryEntries() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter, err := attendanceQueryFilter(c)
+		if err != nil {
+			return checkError(c, err, "Invalid query")
+		}
+		delete(filter, "term_id")
+		for _, field := range []string{"subject_id", "class_id"} {
+			if value := c.Query(field); value != "" {
+				id, err := primitive.ObjectIDFromHex(value)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid " + field + " format",
+					})
+				}
+				filter[field] = id
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		entries, err := findDiaryEntries(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch diary entries",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"entries": entries,
+		})
+	}
+}
+
+func GetDiaryEntry() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		entry, err := findDiaryEntry(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching diary entry")
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"entry":  entry,
+		})
+	}
+}
+
+// UpdateDiaryEntry edits the content of an entry. Its offering, date and
+// period are fixed; delete and recreate the entry to move it.
+func UpdateDiaryEntry() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Topic        *string                `json:"topic"`
+			Notes        *string                `json:"notes"`
+			Homework     *string                `json:"homework"`
+			AssignmentID *primitive.ObjectID    `json:"assignment_id"`
+			Resources    *[]model.DiaryResource `json:"resources"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		entry, err := loadWritableDiaryEntry(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching diary entry")
+		}
+
+		update := bson.M{"updated_at": time.Now()}
+		if body.Topic != nil {
+			topic := strings.TrimSpace(*body.Topic)
+			if topic == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Topic cannot be empty",
+				})
+			}
+			update["topic"] = topic
+		}
+		if body.Notes != nil {
+			update["notes"] = *body.Notes
+		}
+		if body.Homework != nil {
+			update["homework"] = *body.Homework
+		}
+		if body.AssignmentID != nil {
+			if err := validateDiaryAssignment(ctx, *body.AssignmentID, entry.SubjectID); err != nil {
+				return checkError(c, err, "Error fetching assignment")
+			}
+			update["assignment_id"] = *body.AssignmentID
+		}
+		if body.Resources != nil {
+			if err := validateDiaryResources(*body.Resources); err != nil {
+				return checkError(c, err, "Invalid resources")
+			}
+			update["resources"] = *body.Resources
+		}
+
+		var updatedEntry model.DiaryEntry
+		err = database.GetCollection("diary_entries").FindOneAndUpdate(ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": update},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedEntry)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating diary entry",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Diary entry updated successfully",
+			"entry":   updatedEntry,
+		})
+	}
+}
+
+func DeleteDiaryEntry() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := loadWritableDiaryEntry(ctx, c, objectID); err != nil {
+			return checkError(c, err, "Error fetching diary entry")
+		}
+		if _, err := database.GetCollection("diary_entries").DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting diary entry",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Diary entry deleted successfully",
+		})
+	}
+}
+
+// ClassDiaryWeek returns a class's diary for the Monday-to-Sunday week
+// containing ?date= (default today), with the lessons that have no entry.
+func ClassDiaryWeek() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		classID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, classID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+		return sendDiaryWeek(ctx, c, class.ID)
+	}
+}
+
+// StudentDiaryWeek is the read-only week view of the diary of a student's class.
+func StudentDiaryWeek() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var student model.Student
+		err = database.GetCollection("students").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": studentID}, "school_id")).
+			Decode(&student)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Student not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching student",
+			})
+		}
+		if student.ClassID.IsZero() {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Student is not in a class",
+			})
+		}
+		return sendDiaryWeek(ctx, c, student.ClassID)
+	}
+}
+
+// ListMissingDiaryEntries returns the lessons of a class between ?from= and
+// ?to= (default the last 7 days) that have no diary entry.
+func ListMissingDiaryEntries() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		classID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		to := startOfDay(time.Now())
+		from := to.AddDate(0, 0, -6)
+		for param, target := range map[string]*time.Time{"from": &from, "to": &to} {
+			if value := c.Query(param); value != "" {
+				parsed, err := parseDate(value)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid " + param + " date, use YYYY-MM-DD",
+					})
+				}
+				*target = startOfDay(parsed)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, classID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+
+		entries, err := findDiaryEntries(ctx, bson.M{"class_id": class.ID, "date": bson.M{"$gte": from, "$lte": to}})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching diary entries",
+			})
+		}
+		missing, err := missingDiaryLessons(ctx, class.ID, from, to, entries)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching lessons",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"from":    from,
+			"to":      to,
+			"missing": missing,
+		})
+	}
+}
+
+func sendDiaryWeek(ctx context.Context, c *fiber.Ctx, classID primitive.ObjectID) error {
+	date := time.Now()
+	if value := c.Query("date"); value != "" {
+		parsed, err := parseDate(value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid date, use YYYY-MM-DD",
+			})
+		}
+		date = parsed
+	}
+	start := startOfWeek(date)
+	end := start.AddDate(0, 0, 6)
+
+	entries, err := findDiaryEntries(ctx, bson.M{"class_id": classID, "date": bson.M{"$gte": start, "$lte": end}})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error fetching diary entries",
+		})
+	}
+
+	// Only lessons already past can be missing their entry
+	missingUntil := end
+	if today := startOfDay(time.Now()); today.Before(missingUntil) {
+		missingUntil = today
+	}
+	missing := []diaryLesson{}
+	if !missingUntil.Before(start) {
+		missing, err = missingDiaryLessons(ctx, classID, start, missingUntil, entries)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching lessons",
+			})
+		}
+	}
+
+	days := make([]fiber.Map, 0, 7)
+	for i := 0; i < 7; i++ {
+		day := start.AddDate(0, 0, i)
+		dayEntries := []model.DiaryEntry{}
+		for _, entry := range entries {
+			if entry.Date.Equal(day) {
+				dayEntries = append(dayEntries, entry)
+			}
+		}
+		dayMissing := []diaryLesson{}
+		for _, lesson := range missing {
+			if lesson.Date.Equal(day) {
+				dayMissing = append(dayMissing, lesson)
+			}
+		}
+		days = append(days, fiber.Map{
+			"date":    day,
+			"entries": dayEntries,
+			"missing": dayMissing,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":    "success",
+		"weekStart": start,
+		"weekEnd":   end,
+		"days":      days,
+	})
+}
+
+// diaryLesson is a lesson the class had, identified by offering, day and period.
+type diaryLesson struct {
+	SubjectID primitive.ObjectID `json:"subject_id"`
+	Date      time.Time          `json:"date"`
+	Period    int                `json:"period"`
+}
+
+// scheduledLessons lists the class's lessons between from and to from its
+// timetable. Days outside the terms of a slot's year are holidays.
+func scheduledLessons(ctx context.Context, classID primitive.ObjectID, from, to time.Time) ([]diaryLesson, error) {
+	slots, err := findSlots(ctx, bson.M{"class_id": classID})
+	if err != nil {
+		return nil, err
+	}
+
+	windows := slotWindowCache{}
+	lessons := []diaryLesson{}
+	for _, slot := range slots {
+		periods, err := windows.get(ctx, slot)
+		if err != nil {
+			return nil, err
+		}
+		for _, period := range periods {
+			first := period.start
+			if first.Before(from) {
+				first = from
+			}
+			last := period.end
+			if last.After(to) {
+				last = to
+			}
+			for day := firstWeekday(first, slot.Day); !day.After(last); day = day.AddDate(0, 0, 7) {
+				lessons = append(lessons, diaryLesson{SubjectID: slot.SubjectID, Date: day, Period: slot.Period})
+			}
+		}
+	}
+	return lessons, nil
+}
+
+// missingDiaryLessons returns the scheduled lessons without an entry. An
+// entry for period 0 covers every lesson of its offering that day.
+func missingDiaryLessons(ctx context.Context, classID primitive.ObjectID, from, to time.Time, entries []model.DiaryEntry) ([]diaryLesson, error) {
+	lessons, err := scheduledLessons(ctx, classID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	covered := func(lesson diaryLesson) bool {
+		for _, entry := range entries {
+			if entry.SubjectID == lesson.SubjectID && entry.Date.Equal(lesson.Date) &&
+				(entry.Period == 0 || entry.Period == lesson.Period) {
+				return true
+			}
+		}
+		return false
+	}
+
+	missing := []diaryLesson{}
+	for _, lesson := range lessons {
+		if !covered(lesson) {
+			missing = append(missing, lesson)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if !missing[i].Date.Equal(missing[j].Date) {
+			return missing[i].Date.Before(missing[j].Date)
+		}
+		return missing[i].Period < missing[j].Period
+	})
+	return missing, nil
+}
+
+func findDiaryEntries(ctx context.Context, filter bson.M) ([]model.DiaryEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "period", Value: 1}})
+	cursor, err := database.GetCollection("diary_entries").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []model.DiaryEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// findDiaryEntry loads an entry the caller's schools can see.
+func findDiaryEntry(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.DiaryEntry, error) {
+	var entry model.DiaryEntry
+	err := database.GetCollection("diary_entries").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Diary entry not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// loadWritableDiaryEntry loads an entry the caller may change.
+func loadWritableDiaryEntry(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.DiaryEntry, error) {
+	entry, err := findDiaryEntry(ctx, c, id)
+	if err != nil {
+		return nil, err
+	}
+	var offering model.SchoolSubject
+	if err := database.GetCollection("subjects").FindOne(ctx, bson.M{"_id": entry.SubjectID}).Decode(&offering); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Subject not found")
+		}
+		return nil, err
+	}
+	if !canTeachOffering(c, &offering, middleware.PermDiaryManage) {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Only the subject's teacher can write its diary")
+	}
+	if err := ensureDiaryPeriodOpen(ctx, &offering, entry.Date); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ensureDiaryPeriodOpen checks the offering's year, and the term the date
+// falls in, are still open.
+func ensureDiaryPeriodOpen(ctx context.Context, offering *model.SchoolSubject, date time.Time) error {
+	termID := offering.TermID
+	if termID.IsZero() {
+		term, err := termForDate(ctx, offering.AcademicYearID, date)
+		if err != nil {
+			return err
+		}
+		if term != nil {
+			termID = term.ID
+		}
+	}
+	return ensurePeriodOpen(ctx, offering.AcademicYearID, termID)
+}
+
+func validateDiaryAssignment(ctx context.Context, assignmentID, subjectID primitive.ObjectID) error {
+	if assignmentID.IsZero() {
+		return nil
+	}
+	err := database.GetCollection("assignments").FindOne(ctx, bson.M{"_id": assignmentID, "subject_id": subjectID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusBadRequest, "Assignment not found in this subject")
+	}
+	return err
+}
+
+func validateDiaryResources(resources []model.DiaryResource) error {
+	for _, resource := range resources {
+		parsed, err := url.Parse(resource.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Resource URLs must be http or https links")
+		}
+	}
+	return nil
+}
+
+// startOfWeek returns the Monday of the week containing t, at midnight UTC.
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ListEmailTemplates() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		templates := make([]fiber.Map, 0, len(helpers.EmailTemplates))
+		for _, name := range helpers.EmailTemplates {
+			templates = append(templates, fiber.Map{
+				"name":    name,
+				"locales": helpers.TemplateLocales(name),
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":    "success",
+			"templates": templates,
+		})
+	}
+}
+
+// PreviewEmailTemplate renders a template with sample data. ?school_id=
+// applies that school's branding, ?format=text returns the plain-text part
+// and ?format=json returns subject, html and text together.
+func PreviewEmailTemplate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if !helpers.IsValidEmailTemplate(name) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Template not found",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		brand := helpers.DefaultBranding()
+		if schoolID := c.Query("school_id"); schoolID != "" {
+			objectID, err := primitive.ObjectIDFromHex(schoolID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid school ID format",
+				})
+			}
+			if !middleware.CanAccessSchool(c, objectID) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "You do not have access to this school",
+				})
+			}
+			brand = helpers.LoadBranding(ctx, objectID)
+		}
+
+		template := helpers.EmailTemplate(name)
+		if c.Query("format") == "sms" {
+			sms, err := helpers.RenderSMS(template, c.Query("locale", helpers.DefaultLocale), brand, helpers.SampleTemplateData(template))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "Failed to render text message",
+					"details": err.Error(),
+				})
+			}
+			c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+			return c.SendString(sms)
+		}
+
+		email, err := helpers.RenderEmail(template, c.Query("locale", helpers.DefaultLocale), brand, helpers.SampleTemplateData(template))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Failed to render template",
+				"details": err.Error(),
+			})
+		}
+
+		switch c.Query("format", "html") {
+		case "text":
+			c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+			return c.SendString(email.Text)
+		case "json":
+			return c.JSON(fiber.Map{
+				"status":  "success",
+				"subject": email.Subject,
+				"html":    email.HTML,
+				"text":    email.Text,
+			})
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(email.HTML)
+	}
+}
@@ -0,0 +1,16 @@
+package controllers
+
+import "github.com/gofiber/fiber/v2"
+
+// checkError responds to a failed validation helper: a *fiber.Error carries
+// its own status and message, anything else is reported as fallback.
+func checkError(c *fiber.Ctx, err error, fallback string) error {
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"error": fiberErr.Message,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
@@ -0,0 +1,726 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateAssessment adds an assessment to a subject offering. Its term is
+// term_id, the offering's term, or the term containing its date.
+func CreateAssessment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			SubjectID primitive.ObjectID `json:"subject_id"`
+			TermID    primitive.ObjectID `json:"term_id"`
+			Title     string             `json:"title"`
+			Type      string             `json:"type"`
+			MaxScore  float64            `json:"max_score"`
+			Weight    float64            `json:"weight"`
+			Date      string             `json:"date"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		body.Title = strings.TrimSpace(body.Title)
+		if body.SubjectID.IsZero() || body.Title == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Subject ID and title are required",
+			})
+		}
+		if !model.IsValidAssessmentType(body.Type) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Type must be one of: " + strings.Join(model.AssessmentTypes, ", "),
+			})
+		}
+		if body.MaxScore <= 0 || body.Weight < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Max score must be positive and weight cannot be negative",
+			})
+		}
+
+		date := startOfDay(time.Now())
+		if body.Date != "" {
+			parsed, err := parseDate(body.Date)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid date, use YYYY-MM-DD",
+				})
+			}
+			date = startOfDay(parsed)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		offering, err := findOffering(ctx, c, body.SubjectID)
+		if err != nil {
+			return offeringLookupError(c, err)
+		}
+		if !canGradeOffering(c, offering) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the subject's teacher can add assessments",
+			})
+		}
+
+		termID, err := resolveAssessmentTerm(ctx, offering, body.TermID, date)
+		if err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+
+		now := time.Now()
+		assessment := model.Assessment{
+			ID:             primitive.NewObjectID(),
+			SchoolID:       offering.SchoolID,
+			SubjectID:      offering.ID,
+			ClassID:        offering.ClassID,
+			AcademicYearID: offering.AcademicYearID,
+			TermID:         termID,
+			Title:          body.Title,
+			Type:           body.Type,
+			MaxScore:       body.MaxScore,
+			Weight:         body.Weight,
+			Date:           date,
+			CreatedBy:      middleware.GetPrincipal(c).UserID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if _, err := database.GetCollection("assessments").InsertOne(ctx, assessment); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create assessment",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":       "success",
+			"message":      "Assessment created successfully",
+			"assessmentId": assessment.ID,
+			"assessment":   assessment,
+		})
+	}
+}
+
+// ListAssessments filters by ?subject_id=, ?class_id= and ?term_id=.
+func ListAssessments() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		for _, field := range []string{"subject_id", "class_id", "term_id"} {
+			if value := c.Query(field); value != "" {
+				id, err := primitive.ObjectIDFromHex(value)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid " + field + " format",
+					})
+				}
+				filter[field] = id
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assessments, err := findAssessments(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch assessments",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":      "success",
+			"assessments": assessments,
+		})
+	}
+}
+
+func GetAssessment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assessment, err := findAssessment(ctx, c, objectID)
+		if err != nil {
+			return assessmentLookupError(c, err)
+		}
+
+		cursor, err := database.GetCollection("scores").Find(ctx, bson.M{"assessment_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching scores",
+			})
+		}
+		scores := []model.Score{}
+		if err := cursor.All(ctx, &scores); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding scores",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"assessment": assessment,
+			"scores":     scores,
+		})
+	}
+}
+
+func UpdateAssessment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Title    *string  `json:"title"`
+			Type     *string  `json:"type"`
+			MaxScore *float64 `json:"max_score"`
+			Weight   *float64 `json:"weight"`
+			Date     *string  `json:"date"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assessment, _, err := loadGradableAssessment(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching assessment")
+		}
+
+		update := bson.M{"updated_at": time.Now()}
+		if body.Title != nil {
+			title := strings.TrimSpace(*body.Title)
+			if title == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Title cannot be empty",
+				})
+			}
+			update["title"] = title
+		}
+		if body.Type != nil {
+			if !model.IsValidAssessmentType(*body.Type) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Type must be one of: " + strings.Join(model.AssessmentTypes, ", "),
+				})
+			}
+			update["type"] = *body.Type
+		}
+		if body.Weight != nil {
+			if *body.Weight < 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Weight cannot be negative",
+				})
+			}
+			update["weight"] = *body.Weight
+		}
+		if body.Date != nil {
+			parsed, err := parseDate(*body.Date)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid date, use YYYY-MM-DD",
+				})
+			}
+			update["date"] = startOfDay(parsed)
+		}
+		if body.MaxScore != nil {
+			if *body.MaxScore <= 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Max score must be positive",
+				})
+			}
+			// Existing marks have to stay within the new maximum
+			above, err := database.GetCollection("scores").CountDocuments(ctx, bson.M{
+				"assessment_id": assessment.ID,
+				"score":         bson.M{"$gt": *body.MaxScore},
+			})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error checking scores",
+				})
+			}
+			if above > 0 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":  "Some scores are above the new max score",
+					"scores": above,
+				})
+			}
+			update["max_score"] = *body.MaxScore
+		}
+
+		var updatedAssessment model.Assessment
+		err = database.GetCollection("assessments").FindOneAndUpdate(ctx,
+			bson.M{"_id": assessment.ID},
+			bson.M{"$set": update},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedAssessment)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating assessment",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"message":    "Assessment updated successfully",
+			"assessment": updatedAssessment,
+		})
+	}
+}
+
+func DeleteAssessment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, _, err := loadGradableAssessment(ctx, c, objectID); err != nil {
+			return checkError(c, err, "Error fetching assessment")
+		}
+
+		scores, err := database.GetCollection("scores").CountDocuments(ctx, bson.M{"assessment_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting scores",
+			})
+		}
+		if scores > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "Assessment still has scores",
+				"scores": scores,
+			})
+		}
+
+		if _, err := database.GetCollection("assessments").DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting assessment",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Assessment deleted successfully",
+		})
+	}
+}
+
+// EnterScores records the marks of several students at once. Entering a
+// mark again replaces the student's previous one.
+func EnterScores() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Scores []struct {
+				StudentID primitive.ObjectID `json:"student_id"`
+				Score     float64            `json:"score"`
+				Excused   bool               `json:"excused"`
+				Remark    string             `json:"remark"`
+			} `json:"scores"`
+		}
+		if err := c.BodyParser(&body); err != nil || len(body.Scores) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "scores must be a non-empty list",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assessment, offering, err := loadGradableAssessment(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching assessment")
+		}
+
+		students, err := offeringStudents(ctx, offering)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching students",
+			})
+		}
+
+		principal := middleware.GetPrincipal(c)
+		now := time.Now()
+		models := make([]mongo.WriteModel, 0, len(body.Scores))
+		for _, entry := range body.Scores {
+			if !students[entry.StudentID] {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Student does not take this subject: " + entry.StudentID.Hex(),
+				})
+			}
+			if !entry.Excused && (entry.Score < 0 || entry.Score > assessment.MaxScore) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Score for student " + entry.StudentID.Hex() + " must be between 0 and the max score",
+				})
+			}
+			if entry.Excused {
+				entry.Score = 0
+			}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"assessment_id": assessment.ID, "student_id": entry.StudentID}).
+				SetUpdate(bson.M{
+					"$set": bson.M{
+						"score":      entry.Score,
+						"excused":    entry.Excused,
+						"remark":     entry.Remark,
+						"graded_by":  principal.UserID,
+						"updated_at": now,
+					},
+					"$setOnInsert": bson.M{
+						"school_id":  assessment.SchoolID,
+						"subject_id": assessment.SubjectID,
+						"term_id":    assessment.TermID,
+						"created_at": now,
+					},
+				}).
+				SetUpsert(true))
+		}
+
+		result, err := database.GetCollection("scores").BulkWrite(ctx, models)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save scores",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"message":  "Scores saved successfully",
+			"created":  result.UpsertedCount,
+			"modified": result.ModifiedCount,
+		})
+	}
+}
+
+// ListSubjectGrades returns every student's weighted average in an offering
+// for ?term_id=, defaulting to the school's current term.
+func ListSubjectGrades() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		offering, err := findOffering(ctx, c, objectID)
+		if err != nil {
+			return offeringLookupError(c, err)
+		}
+		term, err := summaryTerm(ctx, c, offering.SchoolID)
+		if err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+		scale, err := loadGradingScale(ctx, offering.SchoolID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching grading scale",
+			})
+		}
+
+		grades, err := termGrades(ctx, bson.M{"subject_id": offering.ID, "term_id": term.ID}, primitive.NilObjectID, scale)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error computing grades",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"term":   term,
+			"grades": grades,
+		})
+	}
+}
+
+// ListStudentGrades returns a student's weighted average in each offering
+// for ?term_id=, defaulting to the school's current term.
+func ListStudentGrades() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var student model.Student
+		err = database.GetCollection("students").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": studentID}, "school_id")).
+			Decode(&student)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Student not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching student",
+			})
+		}
+		term, err := summaryTerm(ctx, c, student.SchoolID)
+		if err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+		scale, err := loadGradingScale(ctx, student.SchoolID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching grading scale",
+			})
+		}
+
+		grades, err := termGrades(ctx, bson.M{"school_id": student.SchoolID, "term_id": term.ID}, studentID, scale)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error computing grades",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"term":   term,
+			"grades": grades,
+		})
+	}
+}
+
+// termGrade is a student's weighted average in one offering over a term.
+type termGrade struct {
+	SubjectID   primitive.ObjectID `json:"subject_id"`
+	StudentID   primitive.ObjectID `json:"student_id"`
+	Percent     float64            `json:"percent"`
+	Letter      string             `json:"letter"`
+	GPA         float64            `json:"gpa"`
+	Assessments int                `json:"assessments"` // Scored assessments that count towards the average
+}
+
+// termGrades computes the weighted averages over the assessments matching
+// filter, for one student or, with a zero studentID, every student scored.
+// Each assessment counts as score/max_score times its weight; excused scores
+// and zero-weight assessments are left out.
+func termGrades(ctx context.Context, filter bson.M, studentID primitive.ObjectID, scale model.GradingScale) ([]termGrade, error) {
+	assessments, err := findAssessments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(assessments))
+	for _, assessment := range assessments {
+		ids = append(ids, assessment.ID)
+	}
+
+	scoreFilter := bson.M{"assessment_id": bson.M{"$in": ids}}
+	if !studentID.IsZero() {
+		scoreFilter["student_id"] = studentID
+	}
+	cursor, err := database.GetCollection("scores").Find(ctx, scoreFilter)
+	if err != nil {
+		return nil, err
+	}
+	var scores []model.Score
+	if err := cursor.All(ctx, &scores); err != nil {
+		return nil, err
+	}
+	return aggregateTermGrades(assessments, scores, scale), nil
+}
+
+// aggregateTermGrades averages the scores per offering and student, in the
+// order they first appear. An excused score is stored as 0, so counting it
+// would fail the student on work they were let off.
+func aggregateTermGrades(assessments []model.Assessment, scores []model.Score, scale model.GradingScale) []termGrade {
+	byID := make(map[primitive.ObjectID]model.Assessment, len(assessments))
+	for _, assessment := range assessments {
+		byID[assessment.ID] = assessment
+	}
+
+	type key struct{ subject, student primitive.ObjectID }
+	type total struct {
+		earned, weight float64
+		count          int
+	}
+	totals := map[key]*total{}
+	order := []key{}
+	for _, score := range scores {
+		assessment, ok := byID[score.AssessmentID]
+		if !ok || score.Excused || assessment.Weight == 0 || assessment.MaxScore == 0 {
+			continue
+		}
+		k := key{assessment.SubjectID, score.StudentID}
+		t, ok := totals[k]
+		if !ok {
+			t = &total{}
+			totals[k] = t
+			order = append(order, k)
+		}
+		t.earned += score.Score / assessment.MaxScore * assessment.Weight
+		t.weight += assessment.Weight
+		t.count++
+	}
+
+	grades := make([]termGrade, 0, len(order))
+	for _, k := range order {
+		t := totals[k]
+		percent := math.Round(t.earned/t.weight*10000) / 100
+		band := scale.Grade(percent)
+		grades = append(grades, termGrade{
+			SubjectID:   k.subject,
+			StudentID:   k.student,
+			Percent:     percent,
+			Letter:      band.Letter,
+			GPA:         band.GPA,
+			Assessments: t.count,
+		})
+	}
+	return grades
+}
+
+// resolveAssessmentTerm picks the term an assessment of the offering on
+// date counts towards: termID, the offering's own term, or the term
+// containing date. The term has to be open.
+func resolveAssessmentTerm(ctx context.Context, offering *model.SchoolSubject, termID primitive.ObjectID, date time.Time) (primitive.ObjectID, error) {
+	if termID.IsZero() {
+		termID = offering.TermID
+	}
+	if termID.IsZero() {
+		term, err := termForDate(ctx, offering.AcademicYearID, date)
+		if err != nil {
+			return termID, err
+		}
+		if term == nil {
+			return termID, fiber.NewError(fiber.StatusBadRequest, "No term contains this date, pass term_id")
+		}
+		termID = term.ID
+	}
+	if !offering.TermID.IsZero() && termID != offering.TermID {
+		return termID, fiber.NewError(fiber.StatusBadRequest, "Subject is only offered in another term")
+	}
+	if err := validateYearTerm(ctx, termID, offering.AcademicYearID); err != nil {
+		return termID, err
+	}
+	return termID, ensurePeriodOpen(ctx, offering.AcademicYearID, termID)
+}
+
+func findAssessments(ctx context.Context, filter bson.M) ([]model.Assessment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	cursor, err := database.GetCollection("assessments").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	assessments := []model.Assessment{}
+	if err := cursor.All(ctx, &assessments); err != nil {
+		return nil, err
+	}
+	return assessments, nil
+}
+
+// findAssessment loads an assessment the caller's schools can see.
+func findAssessment(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Assessment, error) {
+	var assessment model.Assessment
+	err := database.GetCollection("assessments").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&assessment)
+	if err != nil {
+		return nil, err
+	}
+	return &assessment, nil
+}
+
+func assessmentLookupError(c *fiber.Ctx, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Assessment not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error fetching assessment",
+	})
+}
+
+// loadGradableAssessment loads an assessment and its offering, checking the
+// caller teaches the offering and its term is still open.
+func loadGradableAssessment(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Assessment, *model.SchoolSubject, error) {
+	assessment, err := findAssessment(ctx, c, id)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, fiber.NewError(fiber.StatusNotFound, "Assessment not found")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var offering model.SchoolSubject
+	if err := database.GetCollection("subjects").FindOne(ctx, bson.M{"_id": assessment.SubjectID}).Decode(&offering); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, fiber.NewError(fiber.StatusNotFound, "Subject not found")
+		}
+		return nil, nil, err
+	}
+	if !canGradeOffering(c, &offering) {
+		return nil, nil, fiber.NewError(fiber.StatusForbidden, "Only the subject's teacher can grade it")
+	}
+	if err := ensurePeriodOpen(ctx, assessment.AcademicYearID, assessment.TermID); err != nil {
+		return nil, nil, err
+	}
+	return assessment, &offering, nil
+}
+
+// canGradeOffering reports whether the caller may grade the offering: school
+// staff with the manage permission, or the offering's own teacher.
+func canGradeOffering(c *fiber.Ctx, offering *model.SchoolSubject) bool {
+	return canTeachOffering(c, offering, middleware.PermGradeManage)
+}
+
+// canTeachOffering reports whether the caller holds manage, or is the
+// offering's own teacher.
+func canTeachOffering(c *fiber.Ctx, offering *model.SchoolSubject, manage middleware.Permission) bool {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil {
+		return false
+	}
+	if principal.Can(manage) {
+		return true
+	}
+	return !principal.TeacherID.IsZero() && offering.TeacherID == principal.TeacherID
+}
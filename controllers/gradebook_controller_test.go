@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/ReddIndiann/go-messanger/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAggregateTermGrades(t *testing.T) {
+	maths, science := primitive.NewObjectID(), primitive.NewObjectID()
+	jane, john := primitive.NewObjectID(), primitive.NewObjectID()
+	assessment := func(subject primitive.ObjectID, max, weight float64) model.Assessment {
+		return model.Assessment{ID: primitive.NewObjectID(), SubjectID: subject, MaxScore: max, Weight: weight}
+	}
+	quiz := assessment(maths, 10, 1)
+	exam := assessment(maths, 100, 3)
+	unweighted := assessment(maths, 20, 0)
+	lab := assessment(science, 50, 2)
+	score := func(a model.Assessment, student primitive.ObjectID, value float64) model.Score {
+		return model.Score{AssessmentID: a.ID, SubjectID: a.SubjectID, StudentID: student, Score: value}
+	}
+	// EnterScores stores excused scores as 0
+	excused := score(exam, john, 0)
+	excused.Excused = true
+
+	tests := []struct {
+		name   string
+		scores []model.Score
+		want   []termGrade
+	}{
+		{
+			name:   "no scores",
+			scores: nil,
+			want:   []termGrade{},
+		},
+		{
+			name:   "weighted average",
+			scores: []model.Score{score(quiz, jane, 10), score(exam, jane, 80)},
+			// (1*1 + 0.8*3) / 4
+			want: []termGrade{{SubjectID: maths, StudentID: jane, Percent: 85, Letter: "B", GPA: 3, Assessments: 2}},
+		},
+		{
+			name:   "zero weight assessments are left out",
+			scores: []model.Score{score(quiz, john, 5), score(unweighted, john, 20)},
+			want:   []termGrade{{SubjectID: maths, StudentID: john, Percent: 50, Letter: "F", GPA: 0, Assessments: 1}},
+		},
+		{
+			// Counted, the excused exam would bring John down to 12.5%
+			name:   "excused scores are left out",
+			scores: []model.Score{score(quiz, john, 5), excused},
+			want:   []termGrade{{SubjectID: maths, StudentID: john, Percent: 50, Letter: "F", GPA: 0, Assessments: 1}},
+		},
+		{
+			name:   "scores of unknown assessments are left out",
+			scores: []model.Score{{AssessmentID: primitive.NewObjectID(), StudentID: jane, Score: 10}},
+			want:   []termGrade{},
+		},
+		{
+			name:   "one grade per offering and student, in order of appearance",
+			scores: []model.Score{score(lab, john, 45), score(quiz, jane, 7), score(lab, jane, 33.333)},
+			want: []termGrade{
+				{SubjectID: science, StudentID: john, Percent: 90, Letter: "A", GPA: 4, Assessments: 1},
+				{SubjectID: maths, StudentID: jane, Percent: 70, Letter: "C", GPA: 2, Assessments: 1},
+				{SubjectID: science, StudentID: jane, Percent: 66.67, Letter: "D", GPA: 1, Assessments: 1},
+			},
+		},
+	}
+	scale := model.DefaultGradingScale(primitive.NewObjectID())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregateTermGrades([]model.Assessment{quiz, exam, unweighted, lab}, tt.scores, scale)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d grades, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("grade %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetGradingScale returns the school's grading scale, or the default one
+// when the school has not set its own.
+func GetGradingScale() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		schoolID, err := primitive.ObjectIDFromHex(c.Params("schoolId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid school ID format",
+			})
+		}
+		if !middleware.CanAccessSchool(c, schoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		scale, err := loadGradingScale(ctx, schoolID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching grading scale",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"scale":  scale,
+		})
+	}
+}
+
+func UpdateGradingScale() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		schoolID, err := primitive.ObjectIDFromHex(c.Params("schoolId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid school ID format",
+			})
+		}
+		if !middleware.CanAccessSchool(c, schoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		var body struct {
+			Name  string            `json:"name"`
+			Bands []model.GradeBand `json:"bands"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if err := validateGradeBands(body.Bands); err != nil {
+			return checkError(c, err, "Invalid grading scale")
+		}
+		if strings.TrimSpace(body.Name) == "" {
+			body.Name = "Custom"
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		var scale model.GradingScale
+		err = database.GetCollection("grading_scales").FindOneAndUpdate(ctx,
+			bson.M{"school_id": schoolID},
+			bson.M{
+				"$set":         bson.M{"name": strings.TrimSpace(body.Name), "bands": body.Bands, "updated_at": now},
+				"$setOnInsert": bson.M{"created_at": now},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&scale)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating grading scale",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Grading scale updated successfully",
+			"scale":   scale,
+		})
+	}
+}
+
+// validateGradeBands sorts the bands highest first and checks every
+// percentage from 0 to 100 falls in exactly one of them.
+func validateGradeBands(bands []model.GradeBand) error {
+	if len(bands) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "A grading scale needs at least one band")
+	}
+	sort.Slice(bands, func(i, j int) bool { return bands[i].MinPercent > bands[j].MinPercent })
+
+	for i, band := range bands {
+		if strings.TrimSpace(band.Letter) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Every band needs a letter")
+		}
+		if band.MinPercent < 0 || band.MinPercent > 100 || band.GPA < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "min_percent must be between 0 and 100 and gpa cannot be negative")
+		}
+		if i > 0 && band.MinPercent == bands[i-1].MinPercent {
+			return fiber.NewError(fiber.StatusBadRequest, "Two bands have the same min_percent")
+		}
+	}
+	if bands[len(bands)-1].MinPercent != 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "The lowest band must start at 0")
+	}
+	return nil
+}
+
+func loadGradingScale(ctx context.Context, schoolID primitive.ObjectID) (model.GradingScale, error) {
+	var scale model.GradingScale
+	err := database.GetCollection("grading_scales").FindOne(ctx, bson.M{"school_id": schoolID}).Decode(&scale)
+	if err == mongo.ErrNoDocuments {
+		return model.DefaultGradingScale(schoolID), nil
+	}
+	return scale, err
+}
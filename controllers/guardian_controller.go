@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InviteGuardians invites the parents on file for the students to create a
+// parent account linked to them. A parent of several students in a school
+// gets a single invitation for all of them, and one per school otherwise so
+// that a school only ever manages invitations for its own students.
+func InviteGuardians() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			StudentIDs []primitive.ObjectID `json:"student_ids"`
+		}
+		if err := c.BodyParser(&body); err != nil || len(body.StudentIDs) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "student_ids is required",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		cursor, err := database.GetCollection("students").Find(ctx,
+			middleware.TenantFilter(c, bson.M{"_id": bson.M{"$in": body.StudentIDs}}, "school_id"))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching students",
+			})
+		}
+		var students []model.Student
+		if err := cursor.All(ctx, &students); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding students",
+			})
+		}
+		if len(students) != len(body.StudentIDs) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Some students were not found",
+			})
+		}
+
+		type guardian struct {
+			email    string
+			name     string
+			schoolID primitive.ObjectID
+			childIDs []primitive.ObjectID
+		}
+		type guardianKey struct {
+			email    string
+			schoolID primitive.ObjectID
+		}
+		guardians := map[guardianKey]*guardian{}
+		keys := []guardianKey{}
+		withoutEmail := []primitive.ObjectID{}
+		for _, student := range students {
+			found := false
+			for _, contact := range parentContacts(student.ParentDetails) {
+				if contact.Email == "" {
+					continue
+				}
+				found = true
+				key := guardianKey{contact.Email, student.SchoolID}
+				g, ok := guardians[key]
+				if !ok {
+					g = &guardian{email: contact.Email, name: contact.Name, schoolID: student.SchoolID}
+					guardians[key] = g
+					keys = append(keys, key)
+				}
+				g.childIDs = append(g.childIDs, student.ID)
+			}
+			if !found {
+				withoutEmail = append(withoutEmail, student.ID)
+			}
+		}
+
+		principal := middleware.GetPrincipal(c)
+		invitations := []model.Invitation{}
+		for _, key := range keys {
+			g := guardians[key]
+			now := time.Now()
+			var invitation model.Invitation
+			err := database.GetCollection("invitations").FindOneAndUpdate(ctx,
+				bson.M{
+					"email":      g.email,
+					"role":       model.RoleParent,
+					"status":     model.InvitationPending,
+					"school_ids": []primitive.ObjectID{g.schoolID},
+				},
+				bson.M{
+					"$addToSet": bson.M{"child_ids": bson.M{"$each": g.childIDs}},
+					"$set":      bson.M{"updated_at": now},
+					"$setOnInsert": bson.M{
+						"name":       g.name,
+						"invited_by": principal.UserID,
+						"sent_count": 0,
+						"created_at": now,
+					},
+				},
+				options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+			).Decode(&invitation)
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "A pending invitation for " + g.email + " covers another school, revoke it first",
+				})
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error creating invitation for " + g.email,
+				})
+			}
+			if err := sendInvitation(ctx, inviterOf(c), &invitation); err != nil {
+				log.Printf("Error sending invitation %s: %v\n", invitation.ID.Hex(), err)
+			}
+			invitations = append(invitations, invitation)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":                     "success",
+			"message":                    "Invitations sent successfully",
+			"invitations":                invitations,
+			"studentsWithoutParentEmail": withoutEmail,
+		})
+	}
+}
+
+// ListStudentGuardians returns the parent accounts linked to a student and
+// the parent invitations still pending for them.
+func ListStudentGuardians() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findGuardianStudent(ctx, c, studentID); err != nil {
+			return checkError(c, err, "Error fetching student")
+		}
+
+		cursor, err := database.GetCollection("users").Find(ctx,
+			bson.M{"child_ids": studentID},
+			options.Find().SetProjection(bson.M{"password": 0}),
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching guardians",
+			})
+		}
+		guardians := []model.User{}
+		if err := cursor.All(ctx, &guardians); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding guardians",
+			})
+		}
+
+		cursor, err = database.GetCollection("invitations").Find(ctx, bson.M{
+			"child_ids": studentID,
+			"status":    model.InvitationPending,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching invitations",
+			})
+		}
+		invitations := []model.Invitation{}
+		if err := cursor.All(ctx, &invitations); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding invitations",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":      "success",
+			"guardians":   guardians,
+			"invitations": invitations,
+		})
+	}
+}
+
+// UnlinkGuardian removes a student from a parent account.
+func UnlinkGuardian() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+		userID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid user ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findGuardianStudent(ctx, c, studentID); err != nil {
+			return checkError(c, err, "Error fetching student")
+		}
+
+		result, err := database.GetCollection("users").UpdateOne(ctx,
+			bson.M{"_id": userID, "child_ids": studentID},
+			bson.M{"$pull": bson.M{"child_ids": studentID}, "$set": bson.M{"updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error unlinking guardian",
+			})
+		}
+		if result.MatchedCount == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "The user is not a guardian of this student",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Guardian unlinked successfully",
+		})
+	}
+}
+
+// ListChildren is the parent's starting point: their children with class
+// and school. Grades, attendance, homework, diary and report cards are then
+// read from the per-student endpoints, which guardians may use.
+func ListChildren() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := middleware.GetPrincipal(c)
+		if len(principal.ChildIDs) == 0 {
+			return c.JSON(fiber.Map{
+				"status":   "success",
+				"children": []fiber.Map{},
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		children, err := describeChildren(ctx, bson.M{"_id": bson.M{"$in": principal.ChildIDs}})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching children",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"children": children,
+		})
+	}
+}
+
+func GetChild() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		children, err := describeChildren(ctx, middleware.TenantFilter(c, bson.M{"_id": studentID}, "school_id"))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching student",
+			})
+		}
+		if len(children) == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Student not found",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"child":  children[0],
+		})
+	}
+}
+
+// describeChildren returns the students with the name of their class and
+// school.
+func describeChildren(ctx context.Context, filter bson.M) ([]fiber.Map, error) {
+	cursor, err := database.GetCollection("students").Find(ctx, filter, options.Find().SetSort(bson.M{"first_name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var students []model.Student
+	if err := cursor.All(ctx, &students); err != nil {
+		return nil, err
+	}
+
+	classNames := map[primitive.ObjectID]string{}
+	schoolNames := map[primitive.ObjectID]string{}
+	children := make([]fiber.Map, 0, len(students))
+	for _, student := range students {
+		if _, ok := classNames[student.ClassID]; !ok && !student.ClassID.IsZero() {
+			var class model.Class
+			if err := database.GetCollection("classes").FindOne(ctx, bson.M{"_id": student.ClassID}).Decode(&class); err == nil {
+				classNames[student.ClassID] = class.Name
+			}
+		}
+		if _, ok := schoolNames[student.SchoolID]; !ok {
+			var school model.School
+			if err := database.GetCollection("schools").FindOne(ctx, bson.M{"_id": student.SchoolID}).Decode(&school); err == nil {
+				schoolNames[student.SchoolID] = school.Name
+			}
+		}
+		children = append(children, fiber.Map{
+			"student":     student,
+			"class_name":  classNames[student.ClassID],
+			"school_name": schoolNames[student.SchoolID],
+		})
+	}
+	return children, nil
+}
+
+func findGuardianStudent(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Student, error) {
+	var student model.Student
+	err := database.GetCollection("students").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&student)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Student not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &student, nil
+}
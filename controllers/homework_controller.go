@@ -0,0 +1,1010 @@
+package controllers
+
+import (
+	"context"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateAssignment posts homework to a subject offering. It accepts JSON or
+// multipart/form-data with files under "attachments". A positive weight
+// also adds the assignment to the gradebook.
+func CreateAssignment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			SubjectID    string  `json:"subject_id" form:"subject_id"`
+			Title        string  `json:"title" form:"title"`
+			Instructions string  `json:"instructions" form:"instructions"`
+			DueAt        string  `json:"due_at" form:"due_at"`
+			AllowLate    bool    `json:"allow_late" form:"allow_late"`
+			MaxScore     float64 `json:"max_score" form:"max_score"`
+			Weight       float64 `json:"weight" form:"weight"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		subjectID, err := primitive.ObjectIDFromHex(body.SubjectID)
+		body.Title = strings.TrimSpace(body.Title)
+		if err != nil || body.Title == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Subject ID and title are required",
+			})
+		}
+		dueAt, err := parseDueAt(body.DueAt)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "due_at is required, use RFC3339 or YYYY-MM-DD",
+			})
+		}
+		if !dueAt.After(time.Now()) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Due date must be in the future",
+			})
+		}
+		if body.MaxScore < 0 || body.Weight < 0 || (body.Weight > 0 && body.MaxScore == 0) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Max score and weight cannot be negative, and a weighted assignment needs a max score",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		offering, err := findOffering(ctx, c, subjectID)
+		if err != nil {
+			return offeringLookupError(c, err)
+		}
+		if !canGradeOffering(c, offering) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the subject's teacher can post assignments",
+			})
+		}
+		if err := ensurePeriodOpen(ctx, offering.AcademicYearID, offering.TermID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		principal := middleware.GetPrincipal(c)
+		now := time.Now()
+		assignment := model.Assignment{
+			ID:           primitive.NewObjectID(),
+			SchoolID:     offering.SchoolID,
+			SubjectID:    offering.ID,
+			ClassID:      offering.ClassID,
+			TeacherID:    offering.TeacherID,
+			AssessmentID: primitive.NilObjectID,
+			Title:        body.Title,
+			Instructions: body.Instructions,
+			DueAt:        dueAt,
+			AllowLate:    body.AllowLate,
+			MaxScore:     body.MaxScore,
+			CreatedBy:    principal.UserID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+
+		if body.Weight > 0 {
+			termID, err := resolveAssessmentTerm(ctx, offering, primitive.NilObjectID, startOfDay(dueAt))
+			if err != nil {
+				return checkError(c, err, "Error fetching term")
+			}
+			assessment := model.Assessment{
+				ID:             primitive.NewObjectID(),
+				SchoolID:       offering.SchoolID,
+				SubjectID:      offering.ID,
+				ClassID:        offering.ClassID,
+				AcademicYearID: offering.AcademicYearID,
+				TermID:         termID,
+				Title:          body.Title,
+				Type:           model.AssessmentAssignment,
+				MaxScore:       body.MaxScore,
+				Weight:         body.Weight,
+				Date:           startOfDay(dueAt),
+				CreatedBy:      principal.UserID,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			if _, err := database.GetCollection("assessments").InsertOne(ctx, assessment); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to add assignment to the gradebook",
+				})
+			}
+			assignment.AssessmentID = assessment.ID
+		}
+
+		assignment.Attachments, err = helpers.SaveUploads(formFiles(c, "attachments"), assignmentFolder(assignment.ID))
+		if err != nil {
+			database.GetCollection("assessments").DeleteOne(ctx, bson.M{"_id": assignment.AssessmentID})
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to save attachments: " + err.Error(),
+			})
+		}
+
+		if _, err := database.GetCollection("assignments").InsertOne(ctx, assignment); err != nil {
+			helpers.DeleteUploads(assignment.Attachments, assignmentFolder(assignment.ID))
+			database.GetCollection("assessments").DeleteOne(ctx, bson.M{"_id": assignment.AssessmentID})
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create assignment",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":       "success",
+			"message":      "Assignment created successfully",
+			"assignmentId": assignment.ID,
+			"assignment":   assignment,
+		})
+	}
+}
+
+// ListAssignments filters by ?subject_id=, ?class_id= and ?teacher_id=.
+func ListAssignments() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		for _, field := range []string{"subject_id", "class_id", "teacher_id"} {
+			if value := c.Query(field); value != "" {
+				id, err := primitive.ObjectIDFromHex(value)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid " + field + " format",
+					})
+				}
+				filter[field] = id
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assignments, err := findAssignments(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch assignments",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":      "success",
+			"assignments": assignments,
+		})
+	}
+}
+
+// GetAssignment returns an assignment. Students see only their own
+// subjects' assignments, together with their submission.
+func GetAssignment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assignment, err := loadVisibleAssignment(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching assignment")
+		}
+
+		response := fiber.Map{
+			"status":     "success",
+			"assignment": assignment,
+		}
+		if studentID := middleware.GetPrincipal(c).StudentID; !studentID.IsZero() {
+			var submission model.Submission
+			err := database.GetCollection("submissions").
+				FindOne(ctx, bson.M{"assignment_id": objectID, "student_id": studentID}).
+				Decode(&submission)
+			if err == nil {
+				response["submission"] = submission
+			}
+		}
+		return c.JSON(response)
+	}
+}
+
+func UpdateAssignment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Title        *string  `json:"title"`
+			Instructions *string  `json:"instructions"`
+			DueAt        *string  `json:"due_at"`
+			AllowLate    *bool    `json:"allow_late"`
+			MaxScore     *float64 `json:"max_score"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assignment, err := loadTeachableAssignment(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching assignment")
+		}
+
+		update := bson.M{"updated_at": time.Now()}
+		assessmentUpdate := bson.M{}
+		if body.Title != nil {
+			title := strings.TrimSpace(*body.Title)
+			if title == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Title cannot be empty",
+				})
+			}
+			update["title"] = title
+			assessmentUpdate["title"] = title
+		}
+		if body.Instructions != nil {
+			update["instructions"] = *body.Instructions
+		}
+		if body.AllowLate != nil {
+			update["allow_late"] = *body.AllowLate
+		}
+		if body.DueAt != nil {
+			dueAt, err := parseDueAt(*body.DueAt)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid due_at, use RFC3339 or YYYY-MM-DD",
+				})
+			}
+			update["due_at"] = dueAt
+		}
+		if body.MaxScore != nil {
+			if *body.MaxScore < 0 || (*body.MaxScore == 0 && !assignment.AssessmentID.IsZero()) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Max score must be positive",
+				})
+			}
+			above, err := database.GetCollection("submissions").CountDocuments(ctx, bson.M{
+				"assignment_id": objectID,
+				"graded":        true,
+				"score":         bson.M{"$gt": *body.MaxScore},
+			})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error checking submissions",
+				})
+			}
+			if above > 0 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":       "Some submissions are graded above the new max score",
+					"submissions": above,
+				})
+			}
+			update["max_score"] = *body.MaxScore
+			assessmentUpdate["max_score"] = *body.MaxScore
+		}
+
+		var updatedAssignment model.Assignment
+		err = database.GetCollection("assignments").FindOneAndUpdate(ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": update},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedAssignment)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating assignment",
+			})
+		}
+
+		// Keep the gradebook copy in step
+		if !assignment.AssessmentID.IsZero() && len(assessmentUpdate) > 0 {
+			assessmentUpdate["updated_at"] = time.Now()
+			_, err := database.GetCollection("assessments").UpdateOne(ctx,
+				bson.M{"_id": assignment.AssessmentID},
+				bson.M{"$set": assessmentUpdate},
+			)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error updating gradebook assessment",
+				})
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"message":    "Assignment updated successfully",
+			"assignment": updatedAssignment,
+		})
+	}
+}
+
+func DeleteAssignment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assignment, err := loadTeachableAssignment(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching assignment")
+		}
+
+		submissions, err := database.GetCollection("submissions").CountDocuments(ctx, bson.M{"assignment_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting submissions",
+			})
+		}
+		if submissions > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":       "Assignment already has submissions",
+				"submissions": submissions,
+			})
+		}
+
+		if _, err := database.GetCollection("assignments").DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting assignment",
+			})
+		}
+		// Scores only come from graded submissions, so the assessment has none
+		if !assignment.AssessmentID.IsZero() {
+			database.GetCollection("assessments").DeleteOne(ctx, bson.M{"_id": assignment.AssessmentID})
+		}
+		helpers.DeleteUploads(assignment.Attachments, assignmentFolder(assignment.ID))
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Assignment deleted successfully",
+		})
+	}
+}
+
+func DownloadAssignmentAttachment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assignment, err := loadVisibleAssignment(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching assignment")
+		}
+		return sendAttachment(c, assignment.Attachments, assignmentFolder(assignment.ID))
+	}
+}
+
+// SubmitAssignment records the caller's submission as text and/or files
+// under "attachments". Resubmitting replaces an ungraded submission.
+func SubmitAssignment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		principal := middleware.GetPrincipal(c)
+		if principal.StudentID.IsZero() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only students can submit assignments",
+			})
+		}
+
+		var body struct {
+			Text string `json:"text" form:"text"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		files := formFiles(c, "attachments")
+		if strings.TrimSpace(body.Text) == "" && len(files) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "A submission needs text or files",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		assignment, err := loadVisibleAssignment(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching assignment")
+		}
+
+		now := time.Now()
+		late := now.After(assignment.DueAt)
+		if late && !assignment.AllowLate {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The due date has passed and late submissions are not accepted",
+			})
+		}
+
+		collection := database.GetCollection("submissions")
+		var previous model.Submission
+		err = collection.FindOne(ctx, bson.M{"assignment_id": objectID, "student_id": principal.StudentID}).Decode(&previous)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching submission",
+			})
+		}
+		exists := err == nil
+		if exists && previous.Graded {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Submission has already been graded",
+			})
+		}
+
+		submissionID := primitive.NewObjectID()
+		if exists {
+			submissionID = previous.ID
+		}
+		attachments, err := helpers.SaveUploads(files, submissionFolder(submissionID))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to save attachments: " + err.Error(),
+			})
+		}
+
+		var submission model.Submission
+		err = collection.FindOneAndUpdate(ctx,
+			bson.M{"assignment_id": objectID, "student_id": principal.StudentID, "graded": bson.M{"$ne": true}},
+			bson.M{
+				"$set": bson.M{
+					"text":         body.Text,
+					"attachments":  attachments,
+					"submitted_at": now,
+					"late":         late,
+					"updated_at":   now,
+				},
+				"$setOnInsert": bson.M{
+					"_id":        submissionID,
+					"school_id":  assignment.SchoolID,
+					"subject_id": assignment.SubjectID,
+					"teacher_id": assignment.TeacherID,
+					"graded":     false,
+					"score":      0,
+					"feedback":   "",
+					"graded_by":  primitive.NilObjectID,
+					"created_at": now,
+				},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&submission)
+		if err != nil {
+			helpers.DeleteUploads(attachments, submissionFolder(submissionID))
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Submission has already been graded",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save submission",
+			})
+		}
+		if exists {
+			helpers.DeleteUploads(previous.Attachments, submissionFolder(previous.ID))
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":     "success",
+			"message":    "Assignment submitted successfully",
+			"submission": submission,
+		})
+	}
+}
+
+// ListSubmissions returns an assignment's submissions, with ?graded=false
+// for the ones still to mark.
+func ListSubmissions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findAssignment(ctx, c, objectID); err != nil {
+			return checkError(c, err, "Error fetching assignment")
+		}
+
+		filter := bson.M{"assignment_id": objectID}
+		if graded, err := strconv.ParseBool(c.Query("graded")); err == nil {
+			filter["graded"] = graded
+		}
+		submissions, err := findSubmissions(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching submissions",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":      "success",
+			"submissions": submissions,
+		})
+	}
+}
+
+func GetSubmission() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		submission, err := loadVisibleSubmission(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching submission")
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"submission": submission,
+		})
+	}
+}
+
+func DownloadSubmissionAttachment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		submission, err := loadVisibleSubmission(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching submission")
+		}
+		return sendAttachment(c, submission.Attachments, submissionFolder(submission.ID))
+	}
+}
+
+// GradeSubmission scores a submission and leaves feedback. For weighted
+// assignments the score is also entered in the gradebook.
+func GradeSubmission() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Score    float64 `json:"score"`
+			Feedback string  `json:"feedback"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		collection := database.GetCollection("submissions")
+		var submission model.Submission
+		err = collection.FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")).Decode(&submission)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Submission not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching submission",
+			})
+		}
+
+		assignment, err := loadTeachableAssignment(ctx, c, submission.AssignmentID)
+		if err != nil {
+			return checkError(c, err, "Error fetching assignment")
+		}
+		if body.Score < 0 || (assignment.MaxScore > 0 && body.Score > assignment.MaxScore) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Score must be between 0 and the max score",
+			})
+		}
+
+		principal := middleware.GetPrincipal(c)
+		now := time.Now()
+		if !assignment.AssessmentID.IsZero() {
+			var assessment model.Assessment
+			if err := database.GetCollection("assessments").FindOne(ctx, bson.M{"_id": assignment.AssessmentID}).Decode(&assessment); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error fetching gradebook assessment",
+				})
+			}
+			if err := ensurePeriodOpen(ctx, assessment.AcademicYearID, assessment.TermID); err != nil {
+				return checkError(c, err, "Error checking academic year")
+			}
+			_, err := database.GetCollection("scores").UpdateOne(ctx,
+				bson.M{"assessment_id": assessment.ID, "student_id": submission.StudentID},
+				bson.M{
+					"$set": bson.M{
+						"score":      body.Score,
+						"excused":    false,
+						"remark":     "",
+						"graded_by":  principal.UserID,
+						"updated_at": now,
+					},
+					"$setOnInsert": bson.M{
+						"school_id":  assessment.SchoolID,
+						"subject_id": assessment.SubjectID,
+						"term_id":    assessment.TermID,
+						"created_at": now,
+					},
+				},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error saving gradebook score",
+				})
+			}
+		}
+
+		var gradedSubmission model.Submission
+		err = collection.FindOneAndUpdate(ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": bson.M{
+				"graded":     true,
+				"score":      body.Score,
+				"feedback":   body.Feedback,
+				"graded_by":  principal.UserID,
+				"graded_at":  now,
+				"updated_at": now,
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&gradedSubmission)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error grading submission",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"message":    "Submission graded successfully",
+			"submission": gradedSubmission,
+		})
+	}
+}
+
+// ListStudentDueAssignments lists the student's assignments due from now
+// until the end of the week (Sunday, UTC), or within ?days=, each with the
+// student's submission if there is one.
+func ListStudentDueAssignments() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		now := time.Now().UTC()
+		until := startOfDay(now).AddDate(0, 0, (7-int(now.Weekday()))%7+1)
+		if days, err := strconv.Atoi(c.Query("days")); err == nil && days > 0 {
+			until = now.AddDate(0, 0, days)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var student model.Student
+		err = database.GetCollection("students").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": studentID}, "school_id")).
+			Decode(&student)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Student not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching student",
+			})
+		}
+
+		offeringIDs, err := studentOfferingIDs(ctx, &student)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching subjects",
+			})
+		}
+		assignments, err := findAssignments(ctx, bson.M{
+			"subject_id": bson.M{"$in": offeringIDs},
+			"due_at":     bson.M{"$gte": now, "$lt": until},
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching assignments",
+			})
+		}
+
+		assignmentIDs := make([]primitive.ObjectID, 0, len(assignments))
+		for _, assignment := range assignments {
+			assignmentIDs = append(assignmentIDs, assignment.ID)
+		}
+		submissions, err := findSubmissions(ctx, bson.M{"assignment_id": bson.M{"$in": assignmentIDs}, "student_id": studentID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching submissions",
+			})
+		}
+		byAssignment := make(map[primitive.ObjectID]model.Submission, len(submissions))
+		for _, submission := range submissions {
+			byAssignment[submission.AssignmentID] = submission
+		}
+
+		due := make([]fiber.Map, 0, len(assignments))
+		for _, assignment := range assignments {
+			item := fiber.Map{"assignment": assignment, "submitted": false}
+			if submission, ok := byAssignment[assignment.ID]; ok {
+				item["submitted"] = true
+				item["submission"] = submission
+			}
+			due = append(due, item)
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"until":  until,
+			"due":    due,
+		})
+	}
+}
+
+// ListTeacherUngradedSubmissions lists the submissions still to mark across
+// the teacher's assignments, oldest first. Late ones are flagged by "late".
+func ListTeacherUngradedSubmissions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		teacherID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := middleware.TenantFilter(c, bson.M{"teacher_id": teacherID, "graded": false}, "school_id")
+		submissions, err := findSubmissions(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching submissions",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":      "success",
+			"submissions": submissions,
+		})
+	}
+}
+
+func findAssignments(ctx context.Context, filter bson.M) ([]model.Assignment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "due_at", Value: 1}})
+	cursor, err := database.GetCollection("assignments").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	assignments := []model.Assignment{}
+	if err := cursor.All(ctx, &assignments); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+func findSubmissions(ctx context.Context, filter bson.M) ([]model.Submission, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "submitted_at", Value: 1}})
+	cursor, err := database.GetCollection("submissions").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	submissions := []model.Submission{}
+	if err := cursor.All(ctx, &submissions); err != nil {
+		return nil, err
+	}
+	return submissions, nil
+}
+
+// findAssignment loads an assignment the caller's schools can see.
+func findAssignment(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Assignment, error) {
+	var assignment model.Assignment
+	err := database.GetCollection("assignments").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&assignment)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Assignment not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// loadVisibleAssignment loads an assignment for staff who can read homework,
+// or for a student taking its subject.
+func loadVisibleAssignment(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Assignment, error) {
+	assignment, err := findAssignment(ctx, c, id)
+	if err != nil {
+		return nil, err
+	}
+	principal := middleware.GetPrincipal(c)
+	if principal.Can(middleware.PermHomeworkRead) {
+		return assignment, nil
+	}
+
+	var offering model.SchoolSubject
+	if err := database.GetCollection("subjects").FindOne(ctx, bson.M{"_id": assignment.SubjectID}).Decode(&offering); err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Assignment not found")
+	}
+	students, err := offeringStudents(ctx, &offering)
+	if err != nil {
+		return nil, err
+	}
+	if principal.StudentID.IsZero() || !students[principal.StudentID] {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Assignment not found")
+	}
+	return assignment, nil
+}
+
+// loadTeachableAssignment loads an assignment the caller may change or grade.
+func loadTeachableAssignment(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Assignment, error) {
+	assignment, err := findAssignment(ctx, c, id)
+	if err != nil {
+		return nil, err
+	}
+	var offering model.SchoolSubject
+	if err := database.GetCollection("subjects").FindOne(ctx, bson.M{"_id": assignment.SubjectID}).Decode(&offering); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Subject not found")
+		}
+		return nil, err
+	}
+	if !canGradeOffering(c, &offering) {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Only the subject's teacher can manage its assignments")
+	}
+	return assignment, nil
+}
+
+// loadVisibleSubmission loads a submission for staff who can read homework,
+// or for the student who made it.
+func loadVisibleSubmission(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Submission, error) {
+	var submission model.Submission
+	err := database.GetCollection("submissions").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&submission)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Submission not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	principal := middleware.GetPrincipal(c)
+	if !principal.Can(middleware.PermHomeworkRead) && submission.StudentID != principal.StudentID {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Submission not found")
+	}
+	return &submission, nil
+}
+
+// studentOfferingIDs lists the offerings of the student's class and those
+// the student takes individually.
+func studentOfferingIDs(ctx context.Context, student *model.Student) ([]primitive.ObjectID, error) {
+	filter := bson.M{"student_ids": student.ID}
+	if !student.ClassID.IsZero() {
+		filter = bson.M{"$or": bson.A{bson.M{"student_ids": student.ID}, bson.M{"class_id": student.ClassID}}}
+	}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := database.GetCollection("subjects").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var offerings []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &offerings); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(offerings))
+	for _, offering := range offerings {
+		ids = append(ids, offering.ID)
+	}
+	return ids, nil
+}
+
+func sendAttachment(c *fiber.Ctx, attachments []model.Attachment, folder string) error {
+	for _, attachment := range attachments {
+		if attachment.ID == c.Params("fileId") {
+			return c.Download(helpers.UploadPath(folder, attachment), attachment.Name)
+		}
+	}
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"error": "Attachment not found",
+	})
+}
+
+// formFiles returns the uploaded files of a multipart field, if any.
+func formFiles(c *fiber.Ctx, field string) []*multipart.FileHeader {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil
+	}
+	return form.File[field]
+}
+
+// parseDueAt accepts RFC3339, or a bare date meaning the end of that day (UTC).
+func parseDueAt(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, err
+	}
+	return t.Add(24*time.Hour - time.Second), nil
+}
+
+func assignmentFolder(id primitive.ObjectID) string {
+	return "assignments/" + id.Hex()
+}
+
+func submissionFolder(id primitive.ObjectID) string {
+	return "submissions/" + id.Hex()
+}
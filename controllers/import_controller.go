@@ -0,0 +1,1058 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime/multipart"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A running import whose heartbeat is older than this was interrupted and
+// may be resumed.
+const importStaleAfter = 2 * time.Minute
+
+// importField is a field of a student or teacher that a column of the file
+// can be mapped to.
+type importField struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Help     string `json:"help,omitempty"`
+}
+
+var addressImportFields = []importField{
+	{Name: "street"}, {Name: "city"}, {Name: "state"}, {Name: "country"}, {Name: "postal_code"},
+}
+
+var studentImportFields = append([]importField{
+	{Name: "first_name", Required: true},
+	{Name: "last_name", Required: true},
+	{Name: "email", Required: true},
+	{Name: "phone", Required: true},
+	{Name: "roll_number", Required: true},
+	{Name: "date_of_birth", Help: "YYYY-MM-DD"},
+	{Name: "gender"},
+	{Name: "class", Help: "Class ID, or name of a class in the current academic year"},
+	{Name: "teacher", Help: "Teacher ID or email"},
+	{Name: "father_name"}, {Name: "father_phone"}, {Name: "father_email"},
+	{Name: "mother_name"}, {Name: "mother_phone"}, {Name: "mother_email"},
+	{Name: "guardian_name"}, {Name: "guardian_phone"}, {Name: "guardian_email"},
+}, addressImportFields...)
+
+var teacherImportFields = append([]importField{
+	{Name: "first_name", Required: true},
+	{Name: "last_name", Required: true},
+	{Name: "email", Required: true},
+	{Name: "phone", Required: true},
+	{Name: "date_of_birth", Help: "YYYY-MM-DD"},
+	{Name: "gender"},
+	{Name: "department", Help: "Department ID, name or code"},
+	{Name: "subjects", Help: "Subject catalog IDs or codes, separated by ;"},
+	{Name: "grade_levels", Help: "Separated by ;"},
+	{Name: "designation"},
+	{Name: "experience", Help: "Years"},
+	{Name: "emergency_contact_name"}, {Name: "emergency_contact_relationship"},
+	{Name: "emergency_contact_phone"}, {Name: "emergency_contact_email"},
+}, addressImportFields...)
+
+// Column headers commonly used for a field, normalized like the headers.
+var importFieldAliases = map[string]string{
+	"firstname":     "first_name",
+	"given_name":    "first_name",
+	"lastname":      "last_name",
+	"surname":       "last_name",
+	"email_address": "email",
+	"e_mail":        "email",
+	"phone_number":  "phone",
+	"telephone":     "phone",
+	"mobile":        "phone",
+	"roll_no":       "roll_number",
+	"dob":           "date_of_birth",
+	"birth_date":    "date_of_birth",
+	"sex":           "gender",
+	"class_name":    "class",
+	"class_id":      "class",
+	"teacher_id":    "teacher",
+	"department_id": "department",
+	"subject_ids":   "subjects",
+	"address":       "street",
+	"zip":           "postal_code",
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateImport uploads a CSV or XLSX file of students or teachers. The
+// response suggests a column mapping from the headers; the import itself
+// starts with RunImport once the mapping is confirmed.
+func CreateImport() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		kind := c.FormValue("kind")
+		fields := importFieldsOf(kind)
+		if fields == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "kind must be students or teachers",
+			})
+		}
+		if !middleware.GetPrincipal(c).Can(importPermission(kind)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You may not register " + kind,
+			})
+		}
+		schoolID, err := primitive.ObjectIDFromHex(c.FormValue("school_id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid school ID",
+			})
+		}
+		if !middleware.CanAccessSchool(c, schoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+		file, err := c.FormFile("file")
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "A CSV or XLSX file is required",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err = database.GetCollection("schools").FindOne(ctx, bson.M{"_id": schoolID}).Err()
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "School not found with the provided ID",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching school",
+			})
+		}
+
+		jobID := primitive.NewObjectID()
+		folder := importFolder(jobID)
+		attachments, err := helpers.SaveUploads([]*multipart.FileHeader{file}, folder)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		rows, err := helpers.ReadSpreadsheet(helpers.UploadPath(folder, attachments[0]), attachments[0].Name)
+		if err == nil && len(rows) < 2 {
+			err = fiber.NewError(fiber.StatusBadRequest, "The file has no rows below the header")
+		}
+		var headers []string
+		if err == nil {
+			headers, err = importHeaders(rows[0])
+		}
+		mapping := suggestImportMapping(fields, headers)
+		if raw := c.FormValue("mapping"); err == nil && raw != "" {
+			mapping = map[string]string{}
+			if json.Unmarshal([]byte(raw), &mapping) != nil {
+				err = fiber.NewError(fiber.StatusBadRequest, "mapping must be a JSON object of field to column header")
+			} else {
+				err = checkImportMapping(fields, headers, mapping)
+			}
+		}
+		if err != nil {
+			helpers.DeleteUploads(attachments, folder)
+			if fiberErr, ok := err.(*fiber.Error); ok {
+				return c.Status(fiberErr.Code).JSON(fiber.Map{
+					"error": fiberErr.Message,
+				})
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		dataRows := 0
+		for _, row := range rows[1:] {
+			if !blankImportRow(row) {
+				dataRows++
+			}
+		}
+		now := time.Now()
+		job := model.ImportJob{
+			ID:        jobID,
+			SchoolID:  schoolID,
+			Kind:      kind,
+			File:      attachments[0],
+			Headers:   headers,
+			Mapping:   mapping,
+			DryRun:    true,
+			Invite:    true,
+			Status:    model.ImportStatusUploaded,
+			Counts:    model.ImportCounts{Rows: dataRows},
+			CreatedBy: middleware.GetPrincipal(c).UserID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if _, err := database.GetCollection("imports").InsertOne(ctx, job); err != nil {
+			helpers.DeleteUploads(attachments, folder)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error creating import",
+			})
+		}
+
+		preview := rows[1:]
+		if len(preview) > 5 {
+			preview = preview[:5]
+		}
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":          "success",
+			"message":         "File uploaded, confirm the column mapping and run the import",
+			"import":          job,
+			"fields":          fields,
+			"missingRequired": missingImportFields(fields, mapping),
+			"preview":         preview,
+		})
+	}
+}
+
+func ListImports() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		if kind := c.Query("kind"); kind != "" {
+			filter["kind"] = kind
+		}
+		cursor, err := database.GetCollection("imports").Find(ctx, filter,
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(100))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch imports",
+			})
+		}
+		imports := []model.ImportJob{}
+		if err := cursor.All(ctx, &imports); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode imports",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"imports": imports,
+		})
+	}
+}
+
+func GetImport() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		job, err := findImport(ctx, c)
+		if err != nil {
+			return checkError(c, err, "Error fetching import")
+		}
+		fields := importFieldsOf(job.Kind)
+
+		return c.JSON(fiber.Map{
+			"status":          "success",
+			"import":          job,
+			"fields":          fields,
+			"missingRequired": missingImportFields(fields, job.Mapping),
+		})
+	}
+}
+
+// RunImport validates every row of the file in the background, and unless
+// it is a dry run, which is the default, creates the valid ones. Rows that
+// fail are reported and skipped. Running a failed or interrupted import
+// again resumes it without creating rows twice.
+func RunImport() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			Mapping map[string]string `json:"mapping"`
+			DryRun  *bool             `json:"dry_run"`
+			Invite  *bool             `json:"invite"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid request body",
+				})
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		job, err := findImport(ctx, c)
+		if err != nil {
+			return checkError(c, err, "Error fetching import")
+		}
+		if !middleware.GetPrincipal(c).Can(importPermission(job.Kind)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You may not register " + job.Kind,
+			})
+		}
+		if job.Status == model.ImportStatusCompleted {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The import has already completed",
+			})
+		}
+
+		mapping := job.Mapping
+		if body.Mapping != nil {
+			mapping = body.Mapping
+		}
+		if err := checkImportMapping(importFieldsOf(job.Kind), job.Headers, mapping); err != nil {
+			return checkError(c, err, "Invalid mapping")
+		}
+		dryRun := body.DryRun == nil || *body.DryRun
+		invite := body.Invite == nil || *body.Invite
+
+		// Claim the import so two requests cannot run it at once
+		now := time.Now()
+		var claimed model.ImportJob
+		err = database.GetCollection("imports").FindOneAndUpdate(ctx,
+			bson.M{"_id": job.ID, "$or": bson.A{
+				bson.M{"status": bson.M{"$in": bson.A{model.ImportStatusUploaded, model.ImportStatusValidated, model.ImportStatusFailed}}},
+				bson.M{"status": model.ImportStatusRunning, "heartbeat_at": bson.M{"$lt": now.Add(-importStaleAfter)}},
+			}},
+			bson.M{"$set": bson.M{
+				"mapping":      mapping,
+				"dry_run":      dryRun,
+				"invite":       invite,
+				"status":       model.ImportStatusRunning,
+				"error":        "",
+				"started_at":   now,
+				"heartbeat_at": now,
+				"updated_at":   now,
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&claimed)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The import is already running",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error starting import",
+			})
+		}
+
+		go runImport(claimed)
+
+		message := "Import started"
+		if dryRun {
+			message = "Dry run started"
+		}
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"status":  "success",
+			"message": message,
+			"import":  claimed,
+		})
+	}
+}
+
+// ListImportRows returns the outcome of each row of the last run, filtered
+// by ?status=.
+func ListImportRows() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		job, err := findImport(ctx, c)
+		if err != nil {
+			return checkError(c, err, "Error fetching import")
+		}
+		rows, err := importRows(ctx, job.ID, c.Query("status"))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch import rows",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"rows":   rows,
+		})
+	}
+}
+
+// ImportReport downloads the outcome of each row of the last run as CSV,
+// filtered by ?status=, e.g. invalid for the rows to fix.
+func ImportReport() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		job, err := findImport(ctx, c)
+		if err != nil {
+			return checkError(c, err, "Error fetching import")
+		}
+		rows, err := importRows(ctx, job.ID, c.Query("status"))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch import rows",
+			})
+		}
+
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"row", "status", "email", "name", "errors", "record_id"})
+		for _, row := range rows {
+			recordID := ""
+			if !row.RecordID.IsZero() {
+				recordID = row.RecordID.Hex()
+			}
+			w.Write([]string{strconv.Itoa(row.Row), row.Status, row.Email, row.Name, strings.Join(row.Errors, "; "), recordID})
+		}
+		w.Flush()
+
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+job.Kind+`-import-`+job.ID.Hex()+`.csv"`)
+		return c.Send(buf.Bytes())
+	}
+}
+
+// DeleteImport removes an import, its report and the uploaded file. The
+// students or teachers it created are kept.
+func DeleteImport() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		job, err := findImport(ctx, c)
+		if err != nil {
+			return checkError(c, err, "Error fetching import")
+		}
+
+		result, err := database.GetCollection("imports").DeleteOne(ctx, bson.M{"_id": job.ID, "$or": bson.A{
+			bson.M{"status": bson.M{"$ne": model.ImportStatusRunning}},
+			bson.M{"heartbeat_at": bson.M{"$lt": time.Now().Add(-importStaleAfter)}},
+		}})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete import",
+			})
+		}
+		if result.DeletedCount == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A running import cannot be deleted",
+			})
+		}
+		if _, err := database.GetCollection("import_rows").DeleteMany(ctx, bson.M{"job_id": job.ID}); err != nil {
+			log.Printf("Error deleting rows of import %s: %v\n", job.ID.Hex(), err)
+		}
+		helpers.DeleteUploads([]model.Attachment{job.File}, importFolder(job.ID))
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Import deleted successfully",
+		})
+	}
+}
+
+// runImport goes through the rows of the file. Rows imported by an earlier
+// run are kept and skipped, the rest are validated again.
+func runImport(job model.ImportJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	collection := database.GetCollection("imports")
+	fail := func(err error) {
+		log.Printf("import %s failed: %v", job.ID.Hex(), err)
+		collection.UpdateOne(context.Background(), bson.M{"_id": job.ID}, bson.M{"$set": bson.M{
+			"status":     model.ImportStatusFailed,
+			"error":      err.Error(),
+			"updated_at": time.Now(),
+		}})
+	}
+
+	rows, err := helpers.ReadSpreadsheet(helpers.UploadPath(importFolder(job.ID), job.File), job.File.Name)
+	if err != nil {
+		fail(err)
+		return
+	}
+	// The file was checked on upload, but it is read again from disk
+	if len(rows) < 2 {
+		fail(errors.New("the file has no rows below the header"))
+		return
+	}
+
+	rowsCollection := database.GetCollection("import_rows")
+	if _, err := rowsCollection.DeleteMany(ctx, bson.M{
+		"job_id": job.ID,
+		"status": bson.M{"$in": bson.A{model.ImportRowValid, model.ImportRowInvalid}},
+	}); err != nil {
+		fail(err)
+		return
+	}
+	done, err := importRows(ctx, job.ID, "")
+	if err != nil {
+		fail(err)
+		return
+	}
+	previous := map[int]model.ImportRow{}
+	for _, row := range done {
+		previous[row.Row] = row
+	}
+
+	importer := newRowImporter(&job, rows[0])
+	counts := model.ImportCounts{Rows: job.Counts.Rows}
+	progress := func() {
+		now := time.Now()
+		collection.UpdateOne(ctx, bson.M{"_id": job.ID}, bson.M{"$set": bson.M{"counts": counts, "heartbeat_at": now, "updated_at": now}})
+	}
+	for i, values := range rows[1:] {
+		line := i + 2
+		if blankImportRow(values) {
+			continue
+		}
+
+		status := ""
+		if row, ok := previous[line]; ok {
+			status, err = importer.resume(ctx, row)
+		}
+		if err == nil && status == "" {
+			status, err = importer.process(ctx, line, values)
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+		counts.Processed++
+		switch status {
+		case model.ImportRowValid:
+			counts.Valid++
+		case model.ImportRowInvalid:
+			counts.Invalid++
+		case model.ImportRowImported:
+			counts.Imported++
+		}
+		if counts.Processed%25 == 0 {
+			progress()
+		}
+	}
+
+	finished := model.ImportStatusCompleted
+	if job.DryRun {
+		finished = model.ImportStatusValidated
+	}
+	now := time.Now()
+	collection.UpdateOne(ctx, bson.M{"_id": job.ID}, bson.M{"$set": bson.M{
+		"status":       finished,
+		"counts":       counts,
+		"completed_at": now,
+		"updated_at":   now,
+	}})
+}
+
+// rowImporter turns rows of the file into students or teachers, caching
+// what it looks up along the way.
+type rowImporter struct {
+	job     *model.ImportJob
+	columns map[string]int // Field to column
+	lookups map[string]importLookup
+	year    *model.AcademicYear // Current year, for classes given by name
+	emails  map[string]int      // Lower case email to the first row with it
+	planned map[primitive.ObjectID]int
+}
+
+type importLookup struct {
+	id      primitive.ObjectID
+	problem string
+}
+
+func newRowImporter(job *model.ImportJob, headers []string) *rowImporter {
+	index := map[string]int{}
+	for i, header := range headers {
+		index[strings.TrimSpace(header)] = i
+	}
+	columns := map[string]int{}
+	for field, header := range job.Mapping {
+		if i, ok := index[header]; ok {
+			columns[field] = i
+		}
+	}
+	return &rowImporter{
+		job:     job,
+		columns: columns,
+		lookups: map[string]importLookup{},
+		emails:  map[string]int{},
+		planned: map[primitive.ObjectID]int{},
+	}
+}
+
+func (r *rowImporter) value(values []string, field string) string {
+	i, ok := r.columns[field]
+	if !ok || i >= len(values) {
+		return ""
+	}
+	return strings.TrimSpace(values[i])
+}
+
+// resume accounts for a row an earlier run imported. A row whose record was
+// being created when the run stopped is marked imported if the record
+// exists, or else dropped and, with an empty status, left to process again.
+func (r *rowImporter) resume(ctx context.Context, row model.ImportRow) (string, error) {
+	if row.Status == model.ImportRowImported || r.job.DryRun {
+		r.seen(row.Email, row.Row)
+		return row.Status, nil
+	}
+
+	err := database.GetCollection(r.job.Kind).FindOne(ctx, bson.M{"_id": row.RecordID}).Err()
+	if err == nil {
+		r.seen(row.Email, row.Row)
+		_, err = database.GetCollection("import_rows").UpdateOne(ctx, bson.M{"_id": row.ID},
+			bson.M{"$set": bson.M{"status": model.ImportRowImported}})
+		return model.ImportRowImported, err
+	}
+	if err != mongo.ErrNoDocuments {
+		return "", err
+	}
+	_, err = database.GetCollection("import_rows").DeleteOne(ctx, bson.M{"_id": row.ID})
+	return "", err
+}
+
+// process validates one row like the registration endpoints do and, unless
+// this is a dry run, creates the record. Only errors that stop the whole
+// import are returned; problems with the row are recorded on it.
+func (r *rowImporter) process(ctx context.Context, line int, values []string) (string, error) {
+	row := model.ImportRow{
+		ID:        primitive.NewObjectID(),
+		JobID:     r.job.ID,
+		Row:       line,
+		Email:     r.value(values, "email"),
+		Name:      strings.TrimSpace(r.value(values, "first_name") + " " + r.value(values, "last_name")),
+		Errors:    []string{},
+		CreatedAt: time.Now(),
+	}
+
+	var student *model.Student
+	var teacher *model.Teacher
+	var err error
+	if r.job.Kind == model.ImportKindStudents {
+		student, err = r.student(ctx, values, &row)
+	} else {
+		teacher, err = r.teacher(ctx, values, &row)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(row.Errors) == 0 {
+		if first, ok := r.emails[strings.ToLower(row.Email)]; ok {
+			row.Errors = append(row.Errors, "Email "+row.Email+" is also on row "+strconv.Itoa(first))
+		}
+	}
+	if len(row.Errors) == 0 {
+		var class *model.Class
+		if student != nil {
+			class, err = validateStudentRecord(ctx, student)
+			// Students a dry run passed are not in the class yet
+			if err == nil && class != nil && r.job.DryRun && r.planned[class.ID] > 0 {
+				err = ensureClassCapacity(ctx, class, r.planned[class.ID]+1)
+			}
+		} else {
+			err = validateTeacherRecord(ctx, teacher)
+		}
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			row.Errors = append(row.Errors, fiberErr.Message)
+		} else if err != nil {
+			return "", err
+		} else if class != nil {
+			r.planned[class.ID]++
+		}
+	}
+	r.seen(row.Email, line)
+
+	rows := database.GetCollection("import_rows")
+	if len(row.Errors) > 0 || r.job.DryRun {
+		row.Status = model.ImportRowValid
+		if len(row.Errors) > 0 {
+			row.Status = model.ImportRowInvalid
+		}
+		_, err := rows.InsertOne(ctx, row)
+		return row.Status, err
+	}
+
+	// Record the row before creating the record so that an interrupted
+	// import can tell whether it was created
+	var record interface{}
+	var recordID primitive.ObjectID
+	var role model.Role
+	var schoolID primitive.ObjectID
+	if student != nil {
+		newStudent := newStudentRecord(*student)
+		record, recordID, role, schoolID = newStudent, newStudent.ID, model.RoleStudent, newStudent.SchoolID
+	} else {
+		newTeacher := newTeacherRecord(*teacher)
+		record, recordID, role, schoolID = newTeacher, newTeacher.ID, model.RoleTeacher, newTeacher.SchoolID
+	}
+	row.Status = model.ImportRowImporting
+	row.RecordID = recordID
+	if _, err := rows.InsertOne(ctx, row); err != nil {
+		return "", err
+	}
+	if _, err := database.GetCollection(r.job.Kind).InsertOne(ctx, record); err != nil {
+		return "", err
+	}
+
+	set := bson.M{"status": model.ImportRowImported}
+	if r.job.Invite {
+		from := inviter{UserID: r.job.CreatedBy}
+		invitation, err := inviteRecord(ctx, from, role, row.Email, row.Name, schoolID, recordID)
+		if err != nil {
+			log.Printf("Error inviting %s %s: %v\n", role, recordID.Hex(), err)
+		} else {
+			set["invitation_id"] = invitation.ID
+		}
+	}
+	_, err = rows.UpdateOne(ctx, bson.M{"_id": row.ID}, bson.M{"$set": set})
+	return model.ImportRowImported, err
+}
+
+func (r *rowImporter) seen(email string, line int) {
+	key := strings.ToLower(strings.TrimSpace(email))
+	if _, ok := r.emails[key]; !ok && key != "" {
+		r.emails[key] = line
+	}
+}
+
+func (r *rowImporter) student(ctx context.Context, values []string, row *model.ImportRow) (*model.Student, error) {
+	v := func(field string) string { return r.value(values, field) }
+	student := &model.Student{
+		SchoolID:   r.job.SchoolID,
+		FirstName:  v("first_name"),
+		LastName:   v("last_name"),
+		Email:      v("email"),
+		Phone:      v("phone"),
+		Gender:     v("gender"),
+		RollNumber: v("roll_number"),
+		Address:    r.address(values),
+		ParentDetails: model.ParentDetails{
+			FatherName:    v("father_name"),
+			FatherPhone:   v("father_phone"),
+			FatherEmail:   v("father_email"),
+			MotherName:    v("mother_name"),
+			MotherPhone:   v("mother_phone"),
+			MotherEmail:   v("mother_email"),
+			GuardianName:  v("guardian_name"),
+			GuardianPhone: v("guardian_phone"),
+			GuardianEmail: v("guardian_email"),
+		},
+	}
+	student.DateOfBirth = r.date(values, row)
+
+	if class := v("class"); class != "" {
+		filter := bson.M{"name": exactMatch(class)}
+		if _, err := primitive.ObjectIDFromHex(class); err != nil {
+			if r.year == nil {
+				year, err := resolveAcademicYear(ctx, r.job.SchoolID, primitive.NilObjectID)
+				if fiberErr, ok := err.(*fiber.Error); ok {
+					row.Errors = append(row.Errors, "class: "+fiberErr.Message)
+					return student, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				r.year = year
+			}
+			filter["academic_year_id"] = r.year.ID
+		}
+		id, err := r.lookup(ctx, "classes", class, filter, row, "Class "+class+" not found in the current academic year")
+		if err != nil {
+			return nil, err
+		}
+		student.ClassID = id
+	}
+	if teacher := v("teacher"); teacher != "" {
+		id, err := r.lookup(ctx, "teachers", teacher, bson.M{"email": exactMatch(teacher)}, row, "Teacher "+teacher+" not found")
+		if err != nil {
+			return nil, err
+		}
+		student.TeacherID = id
+	}
+
+	if len(row.Errors) == 0 {
+		if err := checkStudentRequired(student); err != nil {
+			row.Errors = append(row.Errors, err.Error())
+		}
+	}
+	return student, nil
+}
+
+func (r *rowImporter) teacher(ctx context.Context, values []string, row *model.ImportRow) (*model.Teacher, error) {
+	v := func(field string) string { return r.value(values, field) }
+	teacher := &model.Teacher{
+		SchoolID:    r.job.SchoolID,
+		FirstName:   v("first_name"),
+		LastName:    v("last_name"),
+		Email:       v("email"),
+		Phone:       v("phone"),
+		Gender:      v("gender"),
+		Designation: v("designation"),
+		GradeLevels: splitImportList(v("grade_levels")),
+		Address:     r.address(values),
+		EmergencyContact: model.EmergencyContact{
+			Name:         v("emergency_contact_name"),
+			Relationship: v("emergency_contact_relationship"),
+			Phone:        v("emergency_contact_phone"),
+			Email:        v("emergency_contact_email"),
+		},
+	}
+	teacher.DateOfBirth = r.date(values, row)
+
+	if experience := v("experience"); experience != "" {
+		years, err := strconv.ParseFloat(experience, 64)
+		if err != nil || years < 0 {
+			row.Errors = append(row.Errors, "experience: "+experience+" is not a number of years")
+		}
+		teacher.Experience = int(years)
+	}
+	if department := v("department"); department != "" {
+		filter := bson.M{"$or": bson.A{bson.M{"name": exactMatch(department)}, bson.M{"code": exactMatch(department)}}}
+		id, err := r.lookup(ctx, "departments", department, filter, row, "Department "+department+" not found")
+		if err != nil {
+			return nil, err
+		}
+		teacher.DepartmentID = id
+	}
+	for _, subject := range splitImportList(v("subjects")) {
+		id, err := r.lookup(ctx, "subject_catalog", subject, bson.M{"code": exactMatch(subject)}, row, "Subject "+subject+" not found in the school's catalog")
+		if err != nil {
+			return nil, err
+		}
+		if !id.IsZero() {
+			teacher.SubjectIDs = append(teacher.SubjectIDs, id)
+		}
+	}
+
+	if len(row.Errors) == 0 {
+		if err := checkTeacherRequired(teacher); err != nil {
+			row.Errors = append(row.Errors, err.Error())
+		}
+	}
+	return teacher, nil
+}
+
+func (r *rowImporter) address(values []string) model.Address {
+	return model.Address{
+		Street:     r.value(values, "street"),
+		City:       r.value(values, "city"),
+		State:      r.value(values, "state"),
+		Country:    r.value(values, "country"),
+		PostalCode: r.value(values, "postal_code"),
+	}
+}
+
+func (r *rowImporter) date(values []string, row *model.ImportRow) time.Time {
+	value := r.value(values, "date_of_birth")
+	if value == "" {
+		return time.Time{}
+	}
+	date, err := helpers.SpreadsheetDate(value)
+	if err != nil {
+		row.Errors = append(row.Errors, "date_of_birth: "+err.Error())
+	}
+	return date
+}
+
+// lookup resolves a reference given by ID, or else by the school's document
+// matching filter. When nothing matches, problem is added to the row.
+func (r *rowImporter) lookup(ctx context.Context, collection, value string, filter bson.M, row *model.ImportRow, problem string) (primitive.ObjectID, error) {
+	if id, err := primitive.ObjectIDFromHex(value); err == nil {
+		return id, nil
+	}
+
+	key := collection + "\x00" + strings.ToLower(value)
+	found, ok := r.lookups[key]
+	if !ok {
+		filter["school_id"] = r.job.SchoolID
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		err := database.GetCollection(collection).FindOne(ctx, filter,
+			options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			found.problem = problem
+		} else if err != nil {
+			return primitive.NilObjectID, err
+		}
+		found.id = doc.ID
+		r.lookups[key] = found
+	}
+	if found.problem != "" {
+		row.Errors = append(row.Errors, found.problem)
+	}
+	return found.id, nil
+}
+
+func importFieldsOf(kind string) []importField {
+	switch kind {
+	case model.ImportKindStudents:
+		return studentImportFields
+	case model.ImportKindTeachers:
+		return teacherImportFields
+	}
+	return nil
+}
+
+func importPermission(kind string) middleware.Permission {
+	if kind == model.ImportKindTeachers {
+		return middleware.PermTeacherCreate
+	}
+	return middleware.PermStudentCreate
+}
+
+// importHeaders checks that the header row names every column once, so
+// that columns can be mapped by name.
+func importHeaders(row []string) ([]string, error) {
+	headers := make([]string, len(row))
+	seen := map[string]bool{}
+	for i, header := range row {
+		header = strings.TrimSpace(header)
+		if header != "" && seen[header] {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "The column "+header+" appears more than once in the header row")
+		}
+		seen[header] = true
+		headers[i] = header
+	}
+	return headers, nil
+}
+
+// suggestImportMapping maps the fields whose name, or a usual alias, is a
+// column header, ignoring case, spaces and punctuation.
+func suggestImportMapping(fields []importField, headers []string) map[string]string {
+	known := map[string]bool{}
+	for _, field := range fields {
+		known[field.Name] = true
+	}
+	mapping := map[string]string{}
+	for _, header := range headers {
+		name := strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(header), "_"), "_")
+		if alias, ok := importFieldAliases[name]; ok {
+			name = alias
+		}
+		if _, taken := mapping[name]; known[name] && !taken {
+			mapping[name] = header
+		}
+	}
+	return mapping
+}
+
+func checkImportMapping(fields []importField, headers []string, mapping map[string]string) error {
+	known := map[string]bool{}
+	for _, field := range fields {
+		known[field.Name] = true
+	}
+	columns := map[string]bool{}
+	for _, header := range headers {
+		columns[header] = header != ""
+	}
+	for field, header := range mapping {
+		if !known[field] {
+			return fiber.NewError(fiber.StatusBadRequest, "Unknown field "+field)
+		}
+		if header == "" {
+			delete(mapping, field)
+			continue
+		}
+		if !columns[header] {
+			return fiber.NewError(fiber.StatusBadRequest, "The file has no column "+header)
+		}
+	}
+	if missing := missingImportFields(fields, mapping); len(missing) > 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Map a column to the required fields: "+strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func missingImportFields(fields []importField, mapping map[string]string) []string {
+	missing := []string{}
+	for _, field := range fields {
+		if field.Required && mapping[field.Name] == "" {
+			missing = append(missing, field.Name)
+		}
+	}
+	return missing
+}
+
+func splitImportList(value string) []string {
+	items := []string{}
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func blankImportRow(values []string) bool {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// exactMatch matches a string ignoring case.
+func exactMatch(value string) primitive.Regex {
+	return primitive.Regex{Pattern: "^" + regexp.QuoteMeta(value) + "$", Options: "i"}
+}
+
+func importFolder(id primitive.ObjectID) string {
+	return "imports/" + id.Hex()
+}
+
+func importRows(ctx context.Context, jobID primitive.ObjectID, status string) ([]model.ImportRow, error) {
+	filter := bson.M{"job_id": jobID}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := database.GetCollection("import_rows").Find(ctx, filter, options.Find().SetSort(bson.M{"row": 1}))
+	if err != nil {
+		return nil, err
+	}
+	rows := []model.ImportRow{}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func findImport(ctx context.Context, c *fiber.Ctx) (*model.ImportJob, error) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid ID format")
+	}
+	var job model.ImportJob
+	err = database.GetCollection("imports").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Import not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     []string
+		want    []string
+		wantErr bool
+	}{
+		{"trimmed", []string{" First Name", "Email "}, []string{"First Name", "Email"}, false},
+		{"blank columns allowed", []string{"Email", "", ""}, []string{"Email", "", ""}, false},
+		{"duplicate", []string{"Email", "Name", " Email"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := importHeaders(tt.row)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("importHeaders error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("importHeaders = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestImportMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []importField
+		headers []string
+		want    map[string]string
+	}{
+		{
+			name:    "names and aliases",
+			fields:  studentImportFields,
+			headers: []string{"First Name", "Surname", "E-mail", "Mobile", "Roll No.", "DOB", "Class"},
+			want: map[string]string{
+				"first_name":    "First Name",
+				"last_name":     "Surname",
+				"email":         "E-mail",
+				"phone":         "Mobile",
+				"roll_number":   "Roll No.",
+				"date_of_birth": "DOB",
+				"class":         "Class",
+			},
+		},
+		{
+			name:    "first matching column wins",
+			fields:  studentImportFields,
+			headers: []string{"Email Address", "email"},
+			want:    map[string]string{"email": "Email Address"},
+		},
+		{
+			name:    "fields of another kind are not suggested",
+			fields:  teacherImportFields,
+			headers: []string{"Roll Number", "Department", "Subject IDs"},
+			want:    map[string]string{"department": "Department", "subjects": "Subject IDs"},
+		},
+		{
+			name:    "unknown columns",
+			fields:  teacherImportFields,
+			headers: []string{"Notes", ""},
+			want:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggestImportMapping(tt.fields, tt.headers); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("suggestImportMapping = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckImportMapping(t *testing.T) {
+	headers := []string{"First", "Last", "Email", "Phone", "Roll", "Notes", ""}
+	required := map[string]string{
+		"first_name":  "First",
+		"last_name":   "Last",
+		"email":       "Email",
+		"phone":       "Phone",
+		"roll_number": "Roll",
+	}
+	with := func(changes map[string]string) map[string]string {
+		mapping := map[string]string{}
+		for field, header := range required {
+			mapping[field] = header
+		}
+		for field, header := range changes {
+			mapping[field] = header
+		}
+		return mapping
+	}
+
+	tests := []struct {
+		name    string
+		mapping map[string]string
+		want    map[string]string // The mapping after the check, when valid
+		wantErr bool
+	}{
+		{name: "required fields", mapping: with(nil), want: with(nil)},
+		{name: "optional field", mapping: with(map[string]string{"gender": "Notes"}), want: with(map[string]string{"gender": "Notes"})},
+		{name: "unmapped optional field is dropped", mapping: with(map[string]string{"gender": ""}), want: with(nil)},
+		{name: "unknown field", mapping: with(map[string]string{"salary": "Notes"}), wantErr: true},
+		{name: "missing column", mapping: with(map[string]string{"gender": "Sex"}), wantErr: true},
+		{name: "blank column", mapping: with(map[string]string{"gender": " "}), wantErr: true},
+		{name: "required field unmapped", mapping: with(map[string]string{"roll_number": ""}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImportMapping(studentImportFields, headers, tt.mapping)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkImportMapping error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.mapping, tt.want) {
+				t.Fatalf("mapping = %v, want %v", tt.mapping, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitImportList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"MATH; ENG ,PHY", []string{"MATH", "ENG", "PHY"}},
+		{" ; ,", []string{}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := splitImportList(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitImportList(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,662 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// GetInvitation lets the invitee see what an invitation link is for before
+// accepting it, and whether they already have an account to sign in with.
+func GetInvitation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		invitation, err := findInvitationByToken(ctx, c.Params("token"))
+		if err != nil {
+			return checkError(c, err, "Error fetching invitation")
+		}
+		existing, err := findUserByEmail(ctx, invitation.Email)
+		if err != nil {
+			return checkError(c, err, "Error fetching user")
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"invitation": fiber.Map{
+				"email":          invitation.Email,
+				"name":           invitation.Name,
+				"role":           invitation.Role,
+				"expires_at":     invitation.ExpiresAt,
+				"account_exists": existing != nil,
+			},
+		})
+	}
+}
+
+// AcceptInvitation creates the invitee's account, or with the password of
+// an existing account for the same email, links that one instead.
+func AcceptInvitation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var request struct {
+			Token    string `json:"token"`
+			Name     string `json:"name"`
+			Phone    string `json:"phone"`
+			Password string `json:"password"`
+		}
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid request body",
+			})
+		}
+		if request.Token == "" || request.Password == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Token and password are required",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		invitation, err := findInvitationByToken(ctx, request.Token)
+		if err != nil {
+			return checkError(c, err, "Error fetching invitation")
+		}
+		user, err := findUserByEmail(ctx, invitation.Email)
+		if err != nil {
+			return checkError(c, err, "Error fetching user")
+		}
+
+		collection := database.GetCollection("users")
+		now := time.Now()
+		created := user == nil
+		if created {
+			name := strings.TrimSpace(request.Name)
+			if name == "" {
+				name = invitation.Name
+			}
+			if name == "" || strings.TrimSpace(request.Phone) == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"status":  "error",
+					"message": "Name and phone are required to create the account",
+				})
+			}
+			if err := helpers.ValidatePassword(request.Password); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"status":  "error",
+					"message": err.Error(),
+				})
+			}
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"status":  "error",
+					"message": "Error hashing password",
+				})
+			}
+			// Following the link proves the email address
+			user = &model.User{
+				ID:        primitive.NewObjectID(),
+				Name:      name,
+				Email:     invitation.Email,
+				Phone:     strings.TrimSpace(request.Phone),
+				Password:  string(hashedPassword),
+				Verified:  true,
+				Role:      string(model.RoleUser),
+				SchoolIDs: []primitive.ObjectID{},
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+		} else if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "An account exists for this email, enter its password to link it",
+			})
+		}
+
+		update, err := invitationUserUpdate(ctx, invitation, user)
+		if err != nil {
+			return checkError(c, err, "Error accepting invitation")
+		}
+
+		// Claim the invitation before writing the account so a link cannot be
+		// used twice, and release it if the account cannot be written
+		result, err := database.GetCollection("invitations").UpdateOne(ctx,
+			bson.M{"_id": invitation.ID, "status": model.InvitationPending, "nonce": invitation.Nonce},
+			bson.M{"$set": bson.M{
+				"status":      model.InvitationAccepted,
+				"accepted_by": user.ID,
+				"accepted_at": now,
+				"updated_at":  now,
+			}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error accepting invitation",
+			})
+		}
+		if result.ModifiedCount == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "The invitation has already been used",
+			})
+		}
+
+		if created {
+			if _, err := collection.InsertOne(ctx, user); err != nil {
+				releaseInvitation(invitation, user.ID, false)
+				if mongo.IsDuplicateKeyError(err) {
+					return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+						"status":  "error",
+						"message": "An account was created for this email in the meantime, accept the invitation again to link it",
+					})
+				}
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"status":  "error",
+					"message": "Error creating user",
+				})
+			}
+		}
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"password": 0})
+		var updatedUser model.User
+		err = collection.FindOneAndUpdate(ctx, bson.M{"_id": user.ID}, update, opts).Decode(&updatedUser)
+		if err != nil {
+			releaseInvitation(invitation, user.ID, created)
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "The " + invitation.Role + " record is already linked to another account",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error linking account",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Invitation accepted. You can now log in",
+			"user":    updatedUser,
+		})
+	}
+}
+
+// InviteTeacher invites a teacher to create an account linked to their
+// record, for teachers registered without an invitation or before
+// invitations existed.
+func InviteTeacher() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		teacherID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var teacher model.Teacher
+		err = database.GetCollection("teachers").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": teacherID}, "school_id")).
+			Decode(&teacher)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Teacher not found",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching teacher",
+			})
+		}
+
+		invitation, err := inviteRecord(ctx, inviterOf(c), model.RoleTeacher, teacher.Email,
+			teacher.FirstName+" "+teacher.LastName, teacher.SchoolID, teacher.ID)
+		if err != nil {
+			return checkError(c, err, "Error inviting teacher")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":     "success",
+			"message":    "Invitation sent successfully",
+			"invitation": invitation,
+		})
+	}
+}
+
+func InviteStudent() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		student, err := findGuardianStudent(ctx, c, studentID)
+		if err != nil {
+			return checkError(c, err, "Error fetching student")
+		}
+
+		invitation, err := inviteRecord(ctx, inviterOf(c), model.RoleStudent, student.Email,
+			student.FirstName+" "+student.LastName, student.SchoolID, student.ID)
+		if err != nil {
+			return checkError(c, err, "Error inviting student")
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":     "success",
+			"message":    "Invitation sent successfully",
+			"invitation": invitation,
+		})
+	}
+}
+
+// ListInvitations returns the invitations of the caller's schools, newest
+// first, optionally filtered by ?status and ?role.
+func ListInvitations() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		collection := database.GetCollection("invitations")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		filter := middleware.TenantFilter(c, bson.M{}, "school_ids")
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if role := c.Query("role"); role != "" {
+			filter["role"] = role
+		}
+		if search := c.Query("search"); search != "" {
+			filter["email"] = bson.M{"$regex": regexp.QuoteMeta(search), "$options": "i"}
+		}
+
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting invitations",
+			})
+		}
+
+		opts := options.Find().
+			SetSkip(int64((page - 1) * limit)).
+			SetLimit(int64(limit)).
+			SetSort(bson.D{{Key: "created_at", Value: -1}})
+		cursor, err := collection.Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching invitations",
+			})
+		}
+		invitations := []model.Invitation{}
+		if err := cursor.All(ctx, &invitations); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding invitations",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"data": fiber.Map{
+				"invitations": invitations,
+				"pagination": fiber.Map{
+					"total": total,
+					"page":  page,
+					"limit": limit,
+					"pages": (total + int64(limit) - 1) / int64(limit),
+				},
+			},
+		})
+	}
+}
+
+// ResendInvitation emails a new link, which also renews an expired
+// invitation. Links sent before stop working.
+func ResendInvitation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		invitation, err := findManagedInvitation(ctx, c)
+		if err != nil {
+			return checkError(c, err, "Error fetching invitation")
+		}
+		if invitation.Status != model.InvitationPending {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Only pending invitations can be resent",
+			})
+		}
+		if err := sendInvitation(ctx, inviterOf(c), invitation); err != nil {
+			return checkError(c, err, "Error sending invitation")
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"message":    "Invitation resent successfully",
+			"invitation": invitation,
+		})
+	}
+}
+
+// RevokeInvitation withdraws a pending invitation so its link stops
+// working. Accounts already created from it are left alone.
+func RevokeInvitation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		invitation, err := findManagedInvitation(ctx, c)
+		if err != nil {
+			return checkError(c, err, "Error fetching invitation")
+		}
+
+		result, err := database.GetCollection("invitations").UpdateOne(ctx,
+			bson.M{"_id": invitation.ID, "status": model.InvitationPending},
+			bson.M{"$set": bson.M{"status": model.InvitationRevoked, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error revoking invitation",
+			})
+		}
+		if result.ModifiedCount == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Only pending invitations can be revoked",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Invitation revoked successfully",
+		})
+	}
+}
+
+// releaseInvitation undoes the claim of an invitation whose account could
+// not be written, deleting the account when it was created for it. It has
+// its own timeout since the request's may be what ran out.
+func releaseInvitation(invitation *model.Invitation, userID primitive.ObjectID, deleteUser bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if deleteUser {
+		if _, err := database.GetCollection("users").DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+			log.Println("Error deleting account of a failed invitation:", err)
+		}
+	}
+	_, err := database.GetCollection("invitations").UpdateOne(ctx,
+		bson.M{"_id": invitation.ID, "status": model.InvitationAccepted, "accepted_by": userID},
+		bson.M{
+			"$set":   bson.M{"status": model.InvitationPending, "updated_at": time.Now()},
+			"$unset": bson.M{"accepted_by": "", "accepted_at": ""},
+		},
+	)
+	if err != nil {
+		log.Println("Error releasing invitation:", err)
+	}
+}
+
+// inviteRecord invites the owner of a teacher or student record to an
+// account bound to it, reusing a pending invitation for the same record. An
+// email has one pending invitation per role and school, so one for another
+// record is a conflict.
+func inviteRecord(ctx context.Context, from inviter, role model.Role, email, name string, schoolID, recordID primitive.ObjectID) (*model.Invitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "The "+string(role)+" has no email address")
+	}
+	field := "teacher_id"
+	if role == model.RoleStudent {
+		field = "student_id"
+	}
+
+	err := database.GetCollection("users").FindOne(ctx, bson.M{field: recordID}).Err()
+	if err == nil {
+		return nil, fiber.NewError(fiber.StatusConflict, "The "+string(role)+" already has an account")
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	now := time.Now()
+	var invitation model.Invitation
+	err = database.GetCollection("invitations").FindOneAndUpdate(ctx,
+		bson.M{"email": email, "role": role, "status": model.InvitationPending, field: recordID},
+		bson.M{
+			"$set": bson.M{
+				"name":       name,
+				"school_ids": []primitive.ObjectID{schoolID},
+				"invited_by": from.UserID,
+				"updated_at": now,
+			},
+			"$setOnInsert": bson.M{"sent_count": 0, "created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&invitation)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fiber.NewError(fiber.StatusConflict, "A pending invitation for "+email+" is for another "+string(role)+", revoke it first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := sendInvitation(ctx, from, &invitation); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// findManagedInvitation loads the invitation in the :id param if every school
+// it is for is one of the caller's.
+func findManagedInvitation(ctx context.Context, c *fiber.Ctx) (*model.Invitation, error) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid ID format")
+	}
+	var invitation model.Invitation
+	err = database.GetCollection("invitations").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_ids")).
+		Decode(&invitation)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Invitation not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, schoolID := range invitation.SchoolIDs {
+		if !middleware.CanAccessSchool(c, schoolID) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Invitation not found")
+		}
+	}
+	return &invitation, nil
+}
+
+// invitationUserUpdate grants what the invitation is for to the account.
+// An account keeps a single role and record, so it may only take ones it
+// already has or replace the placeholder "user" role.
+func invitationUserUpdate(ctx context.Context, invitation *model.Invitation, user *model.User) (bson.M, error) {
+	if user.Role != invitation.Role && user.Role != string(model.RoleUser) {
+		return nil, fiber.NewError(fiber.StatusConflict, "This account already has the "+user.Role+" role")
+	}
+
+	set := bson.M{"role": invitation.Role, "verified": true, "updated_at": time.Now()}
+	addToSet := bson.M{"school_ids": bson.M{"$each": invitation.SchoolIDs}}
+	switch model.Role(invitation.Role) {
+	case model.RoleParent:
+		addToSet["child_ids"] = bson.M{"$each": invitation.ChildIDs}
+	case model.RoleTeacher, model.RoleStudent:
+		field, recordID, linked := "teacher_id", invitation.TeacherID, user.TeacherID
+		if model.Role(invitation.Role) == model.RoleStudent {
+			field, recordID, linked = "student_id", invitation.StudentID, user.StudentID
+		}
+		if !linked.IsZero() && linked != recordID {
+			return nil, fiber.NewError(fiber.StatusConflict, "This account is already linked to another "+invitation.Role)
+		}
+		err := database.GetCollection("users").FindOne(ctx, bson.M{field: recordID, "_id": bson.M{"$ne": user.ID}}).Err()
+		if err == nil {
+			return nil, fiber.NewError(fiber.StatusConflict, "The "+invitation.Role+" record is already linked to another account")
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		set[field] = recordID
+	default:
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Unsupported invitation role")
+	}
+	return bson.M{"$set": set, "$addToSet": addToSet}, nil
+}
+
+// inviter is who sends invitations, taken from the request so that
+// background jobs can send them too.
+type inviter struct {
+	UserID primitive.ObjectID
+}
+
+func inviterOf(c *fiber.Ctx) inviter {
+	from := inviter{}
+	if principal := middleware.GetPrincipal(c); principal != nil {
+		from.UserID = principal.UserID
+	}
+	return from
+}
+
+// sendInvitation emails a fresh link for the invitation. Links sent before
+// stop working, and the invitation is valid for another InvitationTTL.
+func sendInvitation(ctx context.Context, from inviter, invitation *model.Invitation) error {
+	acceptURL, err := helpers.InvitationAcceptURL()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	nonce := helpers.NewInvitationNonce()
+	expiresAt := now.Add(helpers.InvitationTTL)
+
+	var updated model.Invitation
+	err = database.GetCollection("invitations").FindOneAndUpdate(ctx,
+		bson.M{"_id": invitation.ID, "status": model.InvitationPending},
+		bson.M{
+			"$set": bson.M{"nonce": nonce, "expires_at": expiresAt, "last_sent_at": now, "updated_at": now},
+			"$inc": bson.M{"sent_count": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusConflict, "The invitation is no longer pending")
+	}
+	if err != nil {
+		return err
+	}
+	*invitation = updated
+
+	inviterName := "Your school"
+	if !from.UserID.IsZero() {
+		if user, err := findMessagingUser(ctx, from.UserID); err == nil {
+			inviterName = user.Name
+		}
+	}
+	brand := helpers.DefaultBranding()
+	locale := helpers.DefaultLocale
+	if len(invitation.SchoolIDs) > 0 {
+		brand = helpers.LoadBranding(ctx, invitation.SchoolIDs[0])
+		if rule, err := loadNotificationRule(ctx, invitation.SchoolIDs[0]); err == nil {
+			locale = rule.Locale
+		}
+	}
+	name := invitation.Name
+	if name == "" {
+		name = invitation.Email
+	}
+
+	return helpers.SendTemplatedMail(ctx, invitation.Email, helpers.TemplateInvitation, locale, brand, map[string]interface{}{
+		"Name":        name,
+		"InviterName": inviterName,
+		"Role":        invitation.Role,
+		"AcceptURL":   invitationURL(acceptURL, helpers.InvitationToken(invitation.ID, nonce)),
+		"ExpiresAt":   expiresAt.Format("2 January 2006"),
+	})
+}
+
+// invitationURL appends the token to the page that accepts invitations.
+func invitationURL(acceptURL string, token string) string {
+	separator := "?"
+	if strings.Contains(acceptURL, "?") {
+		separator = "&"
+	}
+	return acceptURL + separator + "token=" + url.QueryEscape(token)
+}
+
+// findInvitationByToken loads the pending, unexpired invitation a token
+// was issued for.
+func findInvitationByToken(ctx context.Context, token string) (*model.Invitation, error) {
+	invalid := fiber.NewError(fiber.StatusNotFound, "Invitation not found or no longer valid")
+	id, ok := helpers.InvitationIDFromToken(token)
+	if !ok {
+		return nil, invalid
+	}
+
+	var invitation model.Invitation
+	err := database.GetCollection("invitations").FindOne(ctx, bson.M{"_id": id}).Decode(&invitation)
+	if err == mongo.ErrNoDocuments {
+		return nil, invalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !helpers.VerifyInvitationToken(token, invitation.ID, invitation.Nonce) || invitation.Status != model.InvitationPending {
+		return nil, invalid
+	}
+	if invitation.Expired(time.Now()) {
+		return nil, fiber.NewError(fiber.StatusGone, "The invitation has expired, ask the school to send a new one")
+	}
+	return &invitation, nil
+}
+
+// findUserByEmail ignores case, since invitation emails come from school
+// records. It returns nil when there is no such user.
+func findUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	var user model.User
+	match := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(email) + "$", Options: "i"}
+	err := database.GetCollection("users").FindOne(ctx, bson.M{"email": match}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func findMessagingUser(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	var user model.User
+	err := database.GetCollection("users").
+		FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{"password": 0})).
+		Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// loadContacts loads the users and checks that from may message each of them.
+func loadContacts(ctx context.Context, from *model.User, ids []primitive.ObjectID) ([]model.User, error) {
+	cursor, err := database.GetCollection("users").Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"password": 0}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	users := []model.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	if len(users) != len(ids) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Some participants do not exist")
+	}
+
+	rules := contactRules{ctx: ctx, children: map[primitive.ObjectID][]model.Student{}}
+	for i := range users {
+		allowed, err := rules.mayMessage(from, &users[i])
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fiber.NewError(fiber.StatusForbidden, "You may not message "+users[i].Name)
+		}
+	}
+	return users, nil
+}
+
+// contactRules decides who may message whom:
+//   - platform admins anyone, school admins anyone of their schools,
+//     including the parents of their students;
+//   - teachers their colleagues, the students they teach and those
+//     students' parents;
+//   - parents their children's teachers and school admins;
+//   - students their teachers and school admins.
+//
+// Apart from platform admins, who may start any conversation, the rules
+// are symmetric: whoever can be messaged can also write first.
+type contactRules struct {
+	ctx      context.Context
+	children map[primitive.ObjectID][]model.Student // Cached per parent
+}
+
+func (r *contactRules) mayMessage(from, to *model.User) (bool, error) {
+	if from.ID == to.ID {
+		return false, nil
+	}
+	if model.Role(from.Role) == model.RoleAdmin || model.Role(to.Role) == model.RoleAdmin {
+		return model.Role(from.Role) == model.RoleAdmin, nil
+	}
+	if model.Role(to.Role) == model.RoleSchoolAdmin && model.Role(from.Role) != model.RoleSchoolAdmin {
+		from, to = to, from
+	}
+	if model.Role(to.Role) == model.RoleTeacher && model.Role(from.Role) != model.RoleSchoolAdmin && model.Role(from.Role) != model.RoleTeacher {
+		from, to = to, from
+	}
+
+	switch model.Role(from.Role) {
+	case model.RoleSchoolAdmin:
+		schools, err := r.schoolsOf(to)
+		if err != nil {
+			return false, err
+		}
+		return sharesSchool(from.SchoolIDs, schools), nil
+	case model.RoleTeacher:
+		switch model.Role(to.Role) {
+		case model.RoleTeacher:
+			return sharesSchool(from.SchoolIDs, to.SchoolIDs), nil
+		case model.RoleStudent:
+			if to.StudentID.IsZero() {
+				return false, nil
+			}
+			return r.teaches(from.TeacherID, []model.Student{{ID: to.StudentID}})
+		case model.RoleParent:
+			children, err := r.childrenOf(to)
+			if err != nil {
+				return false, err
+			}
+			return r.teaches(from.TeacherID, children)
+		}
+	}
+	return false, nil
+}
+
+// schoolsOf returns the schools of a user, for parents also the schools
+// of their children.
+func (r *contactRules) schoolsOf(user *model.User) ([]primitive.ObjectID, error) {
+	schools := append([]primitive.ObjectID{}, user.SchoolIDs...)
+	switch model.Role(user.Role) {
+	case model.RoleParent:
+		children, err := r.childrenOf(user)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			schools = append(schools, child.SchoolID)
+		}
+	case model.RoleStudent:
+		if user.StudentID.IsZero() {
+			break
+		}
+		var student model.Student
+		err := database.GetCollection("students").FindOne(r.ctx, bson.M{"_id": user.StudentID}).Decode(&student)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if err == nil {
+			schools = append(schools, student.SchoolID)
+		}
+	}
+	return schools, nil
+}
+
+// childrenOf loads the students linked to a parent account.
+func (r *contactRules) childrenOf(parent *model.User) ([]model.Student, error) {
+	if children, ok := r.children[parent.ID]; ok {
+		return children, nil
+	}
+	children := []model.Student{}
+	if len(parent.ChildIDs) > 0 {
+		cursor, err := database.GetCollection("students").Find(r.ctx, bson.M{"_id": bson.M{"$in": parent.ChildIDs}})
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.All(r.ctx, &children); err != nil {
+			return nil, err
+		}
+	}
+	r.children[parent.ID] = children
+	return children, nil
+}
+
+// teaches reports whether the teacher is the homeroom teacher of one of
+// the students' classes, or teaches them a subject.
+func (r *contactRules) teaches(teacherID primitive.ObjectID, students []model.Student) (bool, error) {
+	if teacherID.IsZero() || len(students) == 0 {
+		return false, nil
+	}
+	studentIDs := make([]primitive.ObjectID, 0, len(students))
+	for _, student := range students {
+		studentIDs = append(studentIDs, student.ID)
+	}
+	cursor, err := database.GetCollection("students").Find(r.ctx,
+		bson.M{"_id": bson.M{"$in": studentIDs}},
+		options.Find().SetProjection(bson.M{"class_id": 1}),
+	)
+	if err != nil {
+		return false, err
+	}
+	var classes []struct {
+		ClassID primitive.ObjectID `bson:"class_id"`
+	}
+	if err := cursor.All(r.ctx, &classes); err != nil {
+		return false, err
+	}
+	classIDs := []primitive.ObjectID{}
+	for _, class := range classes {
+		if !class.ClassID.IsZero() {
+			classIDs = append(classIDs, class.ClassID)
+		}
+	}
+
+	if len(classIDs) > 0 {
+		count, err := database.GetCollection("classes").CountDocuments(r.ctx, bson.M{
+			"_id":                 bson.M{"$in": classIDs},
+			"homeroom_teacher_id": teacherID,
+		})
+		if err != nil || count > 0 {
+			return count > 0, err
+		}
+	}
+	count, err := database.GetCollection("subjects").CountDocuments(r.ctx, bson.M{
+		"teacher_id": teacherID,
+		"$or": bson.A{
+			bson.M{"class_id": bson.M{"$in": classIDs}},
+			bson.M{"student_ids": bson.M{"$in": studentIDs}},
+		},
+	})
+	return count > 0, err
+}
+
+func sharesSchool(a, b []primitive.ObjectID) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,785 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	messagePageSize    = 50
+	messagePageMax     = 100
+	messagePreviewSize = 120
+)
+
+// CreateConversation starts a conversation with users the caller may
+// message. With a single other user and no title it is a direct
+// conversation, and the existing one is returned if there is one.
+func CreateConversation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			ParticipantIDs []primitive.ObjectID `json:"participant_ids"`
+			Title          string               `json:"title"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		principal := middleware.GetPrincipal(c)
+		body.Title = strings.TrimSpace(body.Title)
+
+		others := []primitive.ObjectID{}
+		seen := map[primitive.ObjectID]bool{principal.UserID: true}
+		for _, id := range body.ParticipantIDs {
+			if !seen[id] {
+				seen[id] = true
+				others = append(others, id)
+			}
+		}
+		if len(others) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "At least one other participant is required",
+			})
+		}
+		direct := len(others) == 1 && body.Title == ""
+		if !direct && body.Title == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Group conversations need a title",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		me, err := findMessagingUser(ctx, principal.UserID)
+		if err != nil {
+			return checkError(c, err, "Error fetching user")
+		}
+		users, err := loadContacts(ctx, me, others)
+		if err != nil {
+			return checkError(c, err, "Error checking participants")
+		}
+
+		collection := database.GetCollection("conversations")
+		now := time.Now()
+		conversation := model.Conversation{
+			ID:        primitive.NewObjectID(),
+			Type:      model.ConversationGroup,
+			Title:     body.Title,
+			CreatedBy: me.ID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		for _, user := range append([]model.User{*me}, users...) {
+			conversation.ParticipantIDs = append(conversation.ParticipantIDs, user.ID)
+			conversation.Participants = append(conversation.Participants, newParticipant(user, now))
+		}
+		if direct {
+			conversation.Type = model.ConversationDirect
+			conversation.DirectKey = directKey(me.ID, others[0])
+
+			var existing model.Conversation
+			err := collection.FindOne(ctx, bson.M{"direct_key": conversation.DirectKey}).Decode(&existing)
+			if err == nil {
+				return c.JSON(fiber.Map{
+					"status":       "success",
+					"message":      "Conversation already exists",
+					"conversation": existing,
+				})
+			}
+			if err != mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error fetching conversation",
+				})
+			}
+		}
+
+		if _, err := collection.InsertOne(ctx, conversation); err != nil {
+			// Both users opened the direct conversation at the same time
+			if mongo.IsDuplicateKeyError(err) && direct {
+				var existing model.Conversation
+				if err := collection.FindOne(ctx, bson.M{"direct_key": conversation.DirectKey}).Decode(&existing); err == nil {
+					return c.JSON(fiber.Map{
+						"status":       "success",
+						"message":      "Conversation already exists",
+						"conversation": existing,
+					})
+				}
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create conversation",
+			})
+		}
+
+		helpers.PublishRealtime(conversation.ParticipantIDs, helpers.RealtimeEvent{Type: "conversation.created", Data: conversation})
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":         "success",
+			"message":        "Conversation created successfully",
+			"conversationId": conversation.ID,
+			"conversation":   conversation,
+		})
+	}
+}
+
+// ListConversations returns the caller's conversations, most recently
+// active first, with the number of unread messages in each.
+func ListConversations() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := middleware.GetPrincipal(c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.M{"updated_at": -1})
+		cursor, err := database.GetCollection("conversations").Find(ctx, bson.M{"participant_ids": principal.UserID}, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch conversations",
+			})
+		}
+		conversations := []model.Conversation{}
+		if err := cursor.All(ctx, &conversations); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode conversations",
+			})
+		}
+
+		unread, err := unreadCounts(ctx, principal.UserID, conversations)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting unread messages",
+			})
+		}
+		results := make([]fiber.Map, 0, len(conversations))
+		for _, conversation := range conversations {
+			results = append(results, fiber.Map{
+				"conversation": conversation,
+				"unread":       unread[conversation.ID],
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":        "success",
+			"conversations": results,
+		})
+	}
+}
+
+func GetConversation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		conversation, err := findConversation(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching conversation")
+		}
+
+		return c.JSON(fiber.Map{
+			"status":       "success",
+			"conversation": conversation,
+		})
+	}
+}
+
+// AddConversationParticipants adds users the caller may message to a group.
+func AddConversationParticipants() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			UserIDs []primitive.ObjectID `json:"user_ids"`
+		}
+		if err := c.BodyParser(&body); err != nil || len(body.UserIDs) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "user_ids is required",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		conversation, err := findConversation(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching conversation")
+		}
+		if conversation.Type != model.ConversationGroup {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Participants can only be added to group conversations",
+			})
+		}
+
+		members := map[primitive.ObjectID]bool{}
+		for _, id := range conversation.ParticipantIDs {
+			members[id] = true
+		}
+		newIDs := []primitive.ObjectID{}
+		for _, id := range body.UserIDs {
+			if !members[id] {
+				members[id] = true
+				newIDs = append(newIDs, id)
+			}
+		}
+		if len(newIDs) == 0 {
+			return c.JSON(fiber.Map{
+				"status":       "success",
+				"message":      "Everyone is already in the conversation",
+				"conversation": conversation,
+			})
+		}
+
+		me, err := findMessagingUser(ctx, middleware.GetPrincipal(c).UserID)
+		if err != nil {
+			return checkError(c, err, "Error fetching user")
+		}
+		users, err := loadContacts(ctx, me, newIDs)
+		if err != nil {
+			return checkError(c, err, "Error checking participants")
+		}
+
+		now := time.Now()
+		participants := make([]model.ConversationParticipant, 0, len(users))
+		for _, user := range users {
+			participants = append(participants, newParticipant(user, now))
+		}
+		var updated model.Conversation
+		err = database.GetCollection("conversations").FindOneAndUpdate(ctx,
+			bson.M{"_id": conversation.ID, "participant_ids": bson.M{"$nin": newIDs}},
+			bson.M{
+				"$push": bson.M{"participant_ids": bson.M{"$each": newIDs}, "participants": bson.M{"$each": participants}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Some users were added meanwhile, try again",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error adding participants",
+			})
+		}
+
+		helpers.PublishRealtime(updated.ParticipantIDs, helpers.RealtimeEvent{Type: "conversation.updated", Data: updated})
+
+		return c.JSON(fiber.Map{
+			"status":       "success",
+			"message":      "Participants added successfully",
+			"conversation": updated,
+		})
+	}
+}
+
+// RemoveConversationParticipant lets a participant leave a group, or its
+// creator remove someone.
+func RemoveConversationParticipant() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+		userID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid user ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		conversation, err := findConversation(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching conversation")
+		}
+		if conversation.Type != model.ConversationGroup {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Only group conversations can be left",
+			})
+		}
+		principal := middleware.GetPrincipal(c)
+		if userID != principal.UserID && conversation.CreatedBy != principal.UserID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the conversation's creator can remove other participants",
+			})
+		}
+
+		var updated model.Conversation
+		err = database.GetCollection("conversations").FindOneAndUpdate(ctx,
+			bson.M{"_id": conversation.ID, "participant_ids": userID},
+			bson.M{"$pull": bson.M{"participant_ids": userID, "participants": bson.M{"user_id": userID}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User is not in the conversation",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error removing participant",
+			})
+		}
+
+		helpers.PublishRealtime(append(updated.ParticipantIDs, userID), helpers.RealtimeEvent{Type: "conversation.updated", Data: updated})
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Participant removed successfully",
+		})
+	}
+}
+
+// ListMessages returns a page of history, newest first. Pass the returned
+// nextCursor as ?before= to get older messages.
+func ListMessages() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+		limit := c.QueryInt("limit", messagePageSize)
+		if limit < 1 || limit > messagePageMax {
+			limit = messagePageSize
+		}
+
+		filter := bson.M{"conversation_id": objectID}
+		if before := c.Query("before"); before != "" {
+			beforeID, err := primitive.ObjectIDFromHex(before)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid cursor",
+				})
+			}
+			filter["_id"] = bson.M{"$lt": beforeID}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findConversation(ctx, c, objectID); err != nil {
+			return checkError(c, err, "Error fetching conversation")
+		}
+
+		opts := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit))
+		cursor, err := database.GetCollection("messages").Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch messages",
+			})
+		}
+		messages := []model.Message{}
+		if err := cursor.All(ctx, &messages); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode messages",
+			})
+		}
+
+		var next interface{}
+		if len(messages) == limit {
+			next = messages[len(messages)-1].ID
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"messages":   messages,
+			"nextCursor": next,
+		})
+	}
+}
+
+// SendMessage posts text and/or attachments, as JSON or as a multipart
+// form with files in "attachments".
+func SendMessage() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Text string `json:"text" form:"text"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		body.Text = strings.TrimSpace(body.Text)
+		files := formFiles(c, "attachments")
+		if body.Text == "" && len(files) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "A message needs text or files",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		conversation, err := findConversation(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching conversation")
+		}
+
+		folder := messageFolder(conversation.ID)
+		attachments, err := helpers.SaveUploads(files, folder)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		principal := middleware.GetPrincipal(c)
+		now := time.Now()
+		message := model.Message{
+			ID:             primitive.NewObjectID(),
+			ConversationID: conversation.ID,
+			SenderID:       principal.UserID,
+			Text:           body.Text,
+			Attachments:    attachments,
+			CreatedAt:      now,
+		}
+		if _, err := database.GetCollection("messages").InsertOne(ctx, message); err != nil {
+			helpers.DeleteUploads(attachments, folder)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to send message",
+			})
+		}
+
+		// The sender has read their own message
+		preview := &model.MessagePreview{ID: message.ID, SenderID: message.SenderID, Text: previewText(message), SentAt: now}
+		_, err = database.GetCollection("conversations").UpdateOne(ctx,
+			bson.M{"_id": conversation.ID},
+			bson.M{"$set": bson.M{
+				"last_message":                    preview,
+				"updated_at":                      now,
+				"participants.$[me].last_read_id": message.ID,
+				"participants.$[me].last_read_at": now,
+			}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"me.user_id": principal.UserID}}}),
+		)
+		if err != nil {
+			log.Printf("Error updating conversation %s: %v\n", conversation.ID.Hex(), err)
+		}
+
+		helpers.PublishRealtime(conversation.ParticipantIDs, helpers.RealtimeEvent{Type: "message.created", Data: message})
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":    "success",
+			"message":   "Message sent successfully",
+			"messageId": message.ID,
+			"data":      message,
+		})
+	}
+}
+
+func DownloadMessageAttachment() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+		messageID, err := primitive.ObjectIDFromHex(c.Params("messageId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid message ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		conversation, err := findConversation(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching conversation")
+		}
+		var message model.Message
+		err = database.GetCollection("messages").FindOne(ctx, bson.M{"_id": messageID, "conversation_id": conversation.ID}).Decode(&message)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Message not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching message",
+			})
+		}
+		return sendAttachment(c, message.Attachments, messageFolder(conversation.ID))
+	}
+}
+
+// MarkConversationRead moves the caller's read marker up to message_id, or
+// to the latest message, and sends a read receipt to the participants.
+func MarkConversationRead() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			MessageID primitive.ObjectID `json:"message_id"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid request",
+				})
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		conversation, err := findConversation(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching conversation")
+		}
+
+		messageID := body.MessageID
+		if messageID.IsZero() {
+			if conversation.LastMessage == nil {
+				return c.JSON(fiber.Map{
+					"status":  "success",
+					"message": "No messages to read",
+				})
+			}
+			messageID = conversation.LastMessage.ID
+		} else {
+			err := database.GetCollection("messages").FindOne(ctx, bson.M{"_id": messageID, "conversation_id": conversation.ID}).Err()
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Message not found",
+				})
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error fetching message",
+				})
+			}
+		}
+
+		// Read markers only move forward
+		principal := middleware.GetPrincipal(c)
+		now := time.Now()
+		result, err := database.GetCollection("conversations").UpdateOne(ctx,
+			bson.M{"_id": conversation.ID},
+			bson.M{"$set": bson.M{
+				"participants.$[me].last_read_id": messageID,
+				"participants.$[me].last_read_at": now,
+			}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+				bson.M{"me.user_id": principal.UserID, "me.last_read_id": bson.M{"$lt": messageID}},
+			}}),
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating read state",
+			})
+		}
+
+		if result.ModifiedCount > 0 {
+			helpers.PublishRealtime(conversation.ParticipantIDs, helpers.RealtimeEvent{Type: "message.read", Data: fiber.Map{
+				"conversation_id": conversation.ID,
+				"user_id":         principal.UserID,
+				"message_id":      messageID,
+				"read_at":         now,
+			}})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Conversation marked as read",
+		})
+	}
+}
+
+// MessagingSocketUpgrade only lets WebSocket handshakes through to
+// MessagingSocket, and hands it the authenticated user.
+func MessagingSocketUpgrade() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+				"error": "Expected a WebSocket connection",
+			})
+		}
+		c.Locals("socketPrincipal", middleware.GetPrincipal(c))
+		return c.Next()
+	}
+}
+
+// socketAuthInterval is how often an open socket checks that its token has
+// not expired or been revoked, e.g. by logging out everywhere.
+const socketAuthInterval = time.Minute
+
+// MessagingSocket pushes new messages, read receipts and conversation
+// changes to the user. Clients send nothing but pings; messages are sent
+// through the REST API.
+func MessagingSocket() fiber.Handler {
+	return websocket.New(func(conn *websocket.Conn) {
+		principal, _ := conn.Locals("socketPrincipal").(*middleware.Principal)
+		if principal == nil {
+			return
+		}
+		userID := principal.UserID
+		client := helpers.SubscribeRealtime(userID)
+		defer helpers.UnsubscribeRealtime(client)
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(30 * time.Second)
+		defer ping.Stop()
+		auth := time.NewTicker(socketAuthInterval)
+		defer auth.Stop()
+		if err := conn.WriteJSON(helpers.RealtimeEvent{Type: "ready", Data: fiber.Map{"user_id": userID}}); err != nil {
+			return
+		}
+		for {
+			select {
+			case event := <-client.Send:
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := conn.WriteJSON(event); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+					return
+				}
+			case <-auth.C:
+				if err := middleware.RecheckAccess(principal); err != nil {
+					message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error())
+					conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(10*time.Second))
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	})
+}
+
+// findConversation loads a conversation the caller takes part in.
+func findConversation(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Conversation, error) {
+	var conversation model.Conversation
+	err := database.GetCollection("conversations").
+		FindOne(ctx, bson.M{"_id": id, "participant_ids": middleware.GetPrincipal(c).UserID}).
+		Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// unreadCounts counts, per conversation, the messages of others after the
+// user's read marker.
+func unreadCounts(ctx context.Context, userID primitive.ObjectID, conversations []model.Conversation) (map[primitive.ObjectID]int, error) {
+	counts := map[primitive.ObjectID]int{}
+	after := bson.A{}
+	for _, conversation := range conversations {
+		if conversation.LastMessage == nil {
+			continue
+		}
+		for _, participant := range conversation.Participants {
+			if participant.UserID == userID && participant.LastReadID.Hex() < conversation.LastMessage.ID.Hex() {
+				after = append(after, bson.M{"conversation_id": conversation.ID, "_id": bson.M{"$gt": participant.LastReadID}})
+			}
+		}
+	}
+	if len(after) == 0 {
+		return counts, nil
+	}
+
+	cursor, err := database.GetCollection("messages").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": after, "sender_id": bson.M{"$ne": userID}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$conversation_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		counts[result.ID] = result.Count
+	}
+	return counts, nil
+}
+
+func newParticipant(user model.User, now time.Time) model.ConversationParticipant {
+	return model.ConversationParticipant{UserID: user.ID, Name: user.Name, Role: user.Role, JoinedAt: now}
+}
+
+func directKey(a, b primitive.ObjectID) string {
+	ids := []string{a.Hex(), b.Hex()}
+	sort.Strings(ids)
+	return ids[0] + ":" + ids[1]
+}
+
+func previewText(message model.Message) string {
+	text := []rune(message.Text)
+	if len(text) > messagePreviewSize {
+		return string(text[:messagePreviewSize]) + "..."
+	}
+	if len(text) == 0 && len(message.Attachments) > 0 {
+		return message.Attachments[0].Name
+	}
+	return string(text)
+}
+
+func messageFolder(conversationID primitive.ObjectID) string {
+	return "messages/" + conversationID.Hex()
+}
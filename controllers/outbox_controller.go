@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func ListOutboxMessages() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		collection := database.GetCollection("outbox")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		limit, _ := strconv.Atoi(c.Query("limit", "20"))
+		skip := (page - 1) * limit
+
+		// Dead letters are what admins usually come here for
+		filter := bson.M{"status": c.Query("status", model.OutboxStatusDead)}
+		if to := c.Query("to"); to != "" {
+			filter["to"] = to
+		}
+		switch channel := c.Query("channel"); channel {
+		case model.OutboxChannelSMS:
+			filter["channel"] = channel
+		case model.OutboxChannelEmail:
+			filter["channel"] = bson.M{"$in": bson.A{channel, nil}}
+		}
+
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting messages",
+			})
+		}
+
+		opts := options.Find().
+			SetSkip(int64(skip)).
+			SetLimit(int64(limit)).
+			SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+			SetProjection(bson.M{"html_body": 0, "text_body": 0})
+
+		cursor, err := collection.Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching messages",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		messages := []model.OutboxMessage{}
+		if err = cursor.All(ctx, &messages); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error parsing messages",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status": "success",
+			"data": fiber.Map{
+				"messages": messages,
+				"pagination": fiber.Map{
+					"total": total,
+					"page":  page,
+					"limit": limit,
+					"pages": math.Ceil(float64(total) / float64(limit)),
+				},
+			},
+		})
+	}
+}
+
+func GetOutboxMessage() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var message model.OutboxMessage
+		// Bodies can hold one-time codes and invitation tokens
+		opts := options.FindOne().SetProjection(bson.M{"html_body": 0, "text_body": 0})
+		err = database.GetCollection("outbox").FindOne(ctx, bson.M{"_id": objectID}, opts).Decode(&message)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Message not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching message",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status": "success",
+			"data":   message,
+		})
+	}
+}
+
+func RequeueOutboxMessage() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		message, err := helpers.RequeueMail(ctx, objectID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Message not found, only dead messages can be requeued",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error requeueing message",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Message requeued successfully",
+			"data":    message,
+		})
+	}
+}
@@ -0,0 +1,547 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StudentReportCard renders a student's report card for ?term_id=,
+// defaulting to the school's current term.
+func StudentReportCard() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var student model.Student
+		err = database.GetCollection("students").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": studentID}, "school_id")).
+			Decode(&student)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Student not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching student",
+			})
+		}
+
+		term, err := summaryTerm(ctx, c, student.SchoolID)
+		if err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+		base, err := loadReportCardBase(ctx, student.SchoolID, term)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching school",
+			})
+		}
+
+		card, err := buildReportCard(ctx, base, student)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error building report card",
+			})
+		}
+
+		var pdf bytes.Buffer
+		if err := helpers.RenderReportCard(&pdf, card); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error rendering report card",
+			})
+		}
+
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+reportCardFilename(student, term)+`"`)
+		return c.Send(pdf.Bytes())
+	}
+}
+
+// ClassReportCards renders the report cards of everyone in a class for
+// ?term_id= and returns them as a zip of PDFs.
+func ClassReportCards() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		classID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		class, err := findClass(ctx, c, classID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+		term, err := summaryTerm(ctx, c, class.SchoolID)
+		if err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+		base, err := loadReportCardBase(ctx, class.SchoolID, term)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching school",
+			})
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "last_name", Value: 1}, {Key: "first_name", Value: 1}})
+		cursor, err := database.GetCollection("students").Find(ctx, bson.M{"class_id": classID}, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching students",
+			})
+		}
+		var students []model.Student
+		if err := cursor.All(ctx, &students); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding students",
+			})
+		}
+		if len(students) == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Class has no students",
+			})
+		}
+
+		var archive bytes.Buffer
+		zipWriter := zip.NewWriter(&archive)
+		used := map[string]int{}
+		for _, student := range students {
+			card, err := buildReportCard(ctx, base, student)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error building report card for student " + student.ID.Hex(),
+				})
+			}
+
+			// Two students with the same name must not overwrite each other
+			name := reportCardFilename(student, term)
+			if used[name]++; used[name] > 1 {
+				name = strings.TrimSuffix(name, ".pdf") + "-" + student.ID.Hex() + ".pdf"
+			}
+			file, err := zipWriter.Create(name)
+			if err == nil {
+				err = helpers.RenderReportCard(file, card)
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error rendering report card for student " + student.ID.Hex(),
+				})
+			}
+		}
+		if err := zipWriter.Close(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error writing archive",
+			})
+		}
+
+		c.Set(fiber.HeaderContentType, "application/zip")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+slug(class.Name+" "+term.Name)+`.zip"`)
+		return c.Send(archive.Bytes())
+	}
+}
+
+// ListReportCardRemarks returns a student's remarks for ?term_id=.
+func ListReportCardRemarks() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		filter := middleware.TenantFilter(c, bson.M{"student_id": studentID}, "school_id")
+		if termID := c.Query("term_id"); termID != "" {
+			termObjID, err := primitive.ObjectIDFromHex(termID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid term ID format",
+				})
+			}
+			filter["term_id"] = termObjID
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		cursor, err := database.GetCollection("report_card_remarks").Find(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching remarks",
+			})
+		}
+		remarks := []model.ReportCardRemark{}
+		if err := cursor.All(ctx, &remarks); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error decoding remarks",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"remarks": remarks,
+		})
+	}
+}
+
+// SetReportCardRemark writes a subject teacher's remark, or with no
+// subject_id the homeroom teacher's overall remark. An empty remark removes it.
+func SetReportCardRemark() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			TermID    primitive.ObjectID `json:"term_id"`
+			SubjectID primitive.ObjectID `json:"subject_id"`
+			Remark    string             `json:"remark"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if body.TermID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Term ID is required",
+			})
+		}
+		body.Remark = strings.TrimSpace(body.Remark)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var student model.Student
+		err = database.GetCollection("students").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": studentID}, "school_id")).
+			Decode(&student)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Student not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching student",
+			})
+		}
+
+		term, err := findTerm(ctx, c, body.TermID)
+		if err != nil {
+			return termLookupError(c, err)
+		}
+		if term.SchoolID != student.SchoolID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Term belongs to another school",
+			})
+		}
+		if err := ensurePeriodOpen(ctx, term.AcademicYearID, term.ID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		principal := middleware.GetPrincipal(c)
+		if body.SubjectID.IsZero() {
+			allowed := principal.Can(middleware.PermGradeManage)
+			if !allowed && !principal.TeacherID.IsZero() && !student.ClassID.IsZero() {
+				var class model.Class
+				err := database.GetCollection("classes").FindOne(ctx, bson.M{"_id": student.ClassID}).Decode(&class)
+				allowed = err == nil && class.HomeroomTeacherID == principal.TeacherID
+			}
+			if !allowed {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Only the homeroom teacher can write the overall remark",
+				})
+			}
+		} else {
+			offering, err := findOffering(ctx, c, body.SubjectID)
+			if err != nil {
+				return offeringLookupError(c, err)
+			}
+			if !canGradeOffering(c, offering) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Only the subject's teacher can write its remark",
+				})
+			}
+		}
+
+		collection := database.GetCollection("report_card_remarks")
+		filter := bson.M{"student_id": studentID, "term_id": term.ID, "subject_id": body.SubjectID}
+		if body.Remark == "" {
+			if _, err := collection.DeleteOne(ctx, filter); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error removing remark",
+				})
+			}
+			return c.JSON(fiber.Map{
+				"status":  "success",
+				"message": "Remark removed successfully",
+			})
+		}
+
+		now := time.Now()
+		var remark model.ReportCardRemark
+		err = collection.FindOneAndUpdate(ctx, filter,
+			bson.M{
+				"$set":         bson.M{"remark": body.Remark, "author_id": principal.UserID, "updated_at": now},
+				"$setOnInsert": bson.M{"school_id": student.SchoolID, "created_at": now},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&remark)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error saving remark",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Remark saved successfully",
+			"remark":  remark,
+		})
+	}
+}
+
+// reportCardBase holds what every report card of a school and term shares.
+type reportCardBase struct {
+	school   model.School
+	logo     []byte
+	logoType string
+	year     string
+	term     *model.Term
+	scale    model.GradingScale
+}
+
+func loadReportCardBase(ctx context.Context, schoolID primitive.ObjectID, term *model.Term) (*reportCardBase, error) {
+	base := &reportCardBase{term: term}
+	if err := database.GetCollection("schools").FindOne(ctx, bson.M{"_id": schoolID}).Decode(&base.school); err != nil {
+		return nil, err
+	}
+
+	var year model.AcademicYear
+	if err := database.GetCollection("academic_years").FindOne(ctx, bson.M{"_id": term.AcademicYearID}).Decode(&year); err == nil {
+		base.year = year.Name
+	}
+
+	scale, err := loadGradingScale(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	base.scale = scale
+
+	if base.school.Logo != "" {
+		logo, logoType, err := helpers.FetchImage(ctx, base.school.Logo)
+		if err != nil {
+			log.Println("Report card logo skipped:", err)
+		} else {
+			base.logo, base.logoType = logo, logoType
+		}
+	}
+	return base, nil
+}
+
+// buildReportCard gathers a student's offerings, scores, averages,
+// attendance and remarks for the base's term.
+func buildReportCard(ctx context.Context, base *reportCardBase, student model.Student) (helpers.ReportCard, error) {
+	term := base.term
+	card := helpers.ReportCard{
+		SchoolName:   base.school.Name,
+		Logo:         base.logo,
+		LogoType:     base.logoType,
+		AcademicYear: base.year,
+		Term:         term.Name,
+		TermStart:    term.StartDate,
+		TermEnd:      term.EndDate,
+		StudentName:  strings.TrimSpace(student.FirstName + " " + student.LastName),
+		RollNumber:   student.RollNumber,
+	}
+	if !student.ClassID.IsZero() {
+		var class model.Class
+		if err := database.GetCollection("classes").FindOne(ctx, bson.M{"_id": student.ClassID}).Decode(&class); err == nil {
+			card.ClassName = class.Name
+		}
+	}
+
+	// Offerings of the student's class or taken individually, for the whole
+	// year or this term
+	offeringFilter := bson.M{
+		"academic_year_id": term.AcademicYearID,
+		"term_id":          bson.M{"$in": bson.A{term.ID, primitive.NilObjectID}},
+		"$or":              bson.A{bson.M{"student_ids": student.ID}},
+	}
+	if !student.ClassID.IsZero() {
+		offeringFilter["$or"] = bson.A{bson.M{"student_ids": student.ID}, bson.M{"class_id": student.ClassID}}
+	}
+	cursor, err := database.GetCollection("subjects").Find(ctx, offeringFilter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return card, err
+	}
+	var offerings []model.SchoolSubject
+	if err := cursor.All(ctx, &offerings); err != nil {
+		return card, err
+	}
+	offeringIDs := make([]primitive.ObjectID, 0, len(offerings))
+	teacherIDs := []primitive.ObjectID{}
+	for _, offering := range offerings {
+		offeringIDs = append(offeringIDs, offering.ID)
+		if !offering.TeacherID.IsZero() {
+			teacherIDs = append(teacherIDs, offering.TeacherID)
+		}
+	}
+
+	teachers := map[primitive.ObjectID]string{}
+	if len(teacherIDs) > 0 {
+		cursor, err := database.GetCollection("teachers").Find(ctx, bson.M{"_id": bson.M{"$in": teacherIDs}})
+		if err != nil {
+			return card, err
+		}
+		var found []model.Teacher
+		if err := cursor.All(ctx, &found); err != nil {
+			return card, err
+		}
+		for _, teacher := range found {
+			teachers[teacher.ID] = strings.TrimSpace(teacher.FirstName + " " + teacher.LastName)
+		}
+	}
+
+	assessmentFilter := bson.M{"subject_id": bson.M{"$in": offeringIDs}, "term_id": term.ID}
+	assessments, err := findAssessments(ctx, assessmentFilter)
+	if err != nil {
+		return card, err
+	}
+	cursor, err = database.GetCollection("scores").Find(ctx, bson.M{"student_id": student.ID, "term_id": term.ID})
+	if err != nil {
+		return card, err
+	}
+	var scores []model.Score
+	if err := cursor.All(ctx, &scores); err != nil {
+		return card, err
+	}
+	scoreByAssessment := make(map[primitive.ObjectID]model.Score, len(scores))
+	for _, score := range scores {
+		scoreByAssessment[score.AssessmentID] = score
+	}
+
+	grades, err := termGrades(ctx, assessmentFilter, student.ID, base.scale)
+	if err != nil {
+		return card, err
+	}
+	gradeBySubject := make(map[primitive.ObjectID]termGrade, len(grades))
+	for _, grade := range grades {
+		gradeBySubject[grade.SubjectID] = grade
+	}
+
+	cursor, err = database.GetCollection("report_card_remarks").Find(ctx, bson.M{"student_id": student.ID, "term_id": term.ID})
+	if err != nil {
+		return card, err
+	}
+	var remarks []model.ReportCardRemark
+	if err := cursor.All(ctx, &remarks); err != nil {
+		return card, err
+	}
+	remarkBySubject := map[primitive.ObjectID]string{}
+	for _, remark := range remarks {
+		remarkBySubject[remark.SubjectID] = remark.Remark
+	}
+	card.Remark = remarkBySubject[primitive.NilObjectID]
+
+	var percentTotal, gpaTotal float64
+	for _, offering := range offerings {
+		subject := helpers.ReportCardSubject{
+			Name:    offering.Name,
+			Code:    offering.Code,
+			Teacher: teachers[offering.TeacherID],
+			Remark:  remarkBySubject[offering.ID],
+		}
+		if grade, ok := gradeBySubject[offering.ID]; ok {
+			subject.Graded = true
+			subject.Percent = grade.Percent
+			subject.Letter = grade.Letter
+			subject.GPA = grade.GPA
+			percentTotal += grade.Percent
+			gpaTotal += grade.GPA
+		}
+		for _, assessment := range assessments {
+			if assessment.SubjectID != offering.ID {
+				continue
+			}
+			score, scored := scoreByAssessment[assessment.ID]
+			subject.Assessments = append(subject.Assessments, helpers.ReportCardAssessment{
+				Title:    assessment.Title,
+				Type:     assessment.Type,
+				Score:    score.Score,
+				MaxScore: assessment.MaxScore,
+				Weight:   assessment.Weight,
+				Excused:  score.Excused,
+				Missing:  !scored,
+			})
+		}
+		card.Subjects = append(card.Subjects, subject)
+	}
+	if len(grades) > 0 {
+		card.HasAverage = true
+		card.Average = math.Round(percentTotal/float64(len(grades))*100) / 100
+		card.Letter = base.scale.Grade(card.Average).Letter
+		card.GPA = math.Round(gpaTotal/float64(len(grades))*100) / 100
+	}
+
+	summaries, err := attendanceSummaries(ctx, bson.M{"student_id": student.ID, "term_id": term.ID})
+	if err != nil {
+		return card, err
+	}
+	if summary, ok := summaries[student.ID]; ok {
+		card.Attendance = helpers.ReportCardAttendance{
+			Present:    summary.Present,
+			Absent:     summary.Absent,
+			Late:       summary.Late,
+			Excused:    summary.Excused,
+			Percentage: summary.Percentage,
+		}
+	}
+	return card, nil
+}
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug turns a display name into a safe file name.
+func slug(value string) string {
+	value = strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(value), "-"), "-")
+	if value == "" {
+		return "report-card"
+	}
+	return value
+}
+
+func reportCardFilename(student model.Student, term *model.Term) string {
+	return slug(student.LastName+" "+student.FirstName+" "+term.Name) + ".pdf"
+}
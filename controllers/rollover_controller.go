@@ -0,0 +1,994 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A running rollover whose heartbeat is older than this was interrupted
+// and may be resumed.
+const rolloverStaleAfter = 2 * time.Minute
+
+type rolloverRequest struct {
+	SchoolID       primitive.ObjectID       `json:"school_id"`
+	FromYearID     primitive.ObjectID       `json:"from_year_id"`
+	ToYearID       primitive.ObjectID       `json:"to_year_id"`
+	Grades         []string                 `json:"grades"`
+	Overrides      []model.RolloverOverride `json:"overrides"`
+	CloneOfferings *bool                    `json:"clone_offerings"`
+}
+
+// rolloverPlan is what a rollover would do, computed from the current data
+// by both the dry run and the run itself.
+type rolloverPlan struct {
+	Classes   []plannedClass    `json:"classes"`
+	Students  []plannedStudent  `json:"students"`
+	Offerings []plannedOffering `json:"offerings"`
+	Warnings  []string          `json:"warnings"`
+}
+
+type plannedClass struct {
+	Grade      string             `json:"grade"`
+	Section    string             `json:"section"`
+	Name       string             `json:"name"`
+	ExistingID primitive.ObjectID `json:"existing_id"` // Set when the new year already has the class
+	Students   int                `json:"students"`    // Promoted or retained into the class
+	source     *model.Class       // Class of the same grade and section in the old year
+}
+
+type plannedStudent struct {
+	StudentID primitive.ObjectID `json:"student_id"`
+	Name      string             `json:"name"`
+	Action    string             `json:"action"`
+	FromClass string             `json:"from_class"`
+	ToClass   string             `json:"to_class"` // Empty for graduates
+	fromID    primitive.ObjectID
+	toKey     string
+}
+
+type plannedOffering struct {
+	SourceID primitive.ObjectID `json:"source_id"`
+	Name     string             `json:"name"`
+	Class    string             `json:"class"`
+	Cloned   bool               `json:"cloned"` // Already in the new year
+	source   model.SchoolSubject
+}
+
+// CreateRollover plans moving a school from one academic year to the next.
+// Nothing changes until the plan has been previewed and run.
+func CreateRollover() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body rolloverRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if body.SchoolID.IsZero() || body.FromYearID.IsZero() || body.ToYearID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "School ID, from_year_id and to_year_id are required",
+			})
+		}
+		if body.FromYearID == body.ToYearID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The rollover must go to another academic year",
+			})
+		}
+		if !middleware.CanAccessSchool(c, body.SchoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		from, err := resolveAcademicYear(ctx, body.SchoolID, body.FromYearID)
+		if err != nil {
+			return checkError(c, err, "Error fetching academic year")
+		}
+		to, err := resolveAcademicYear(ctx, body.SchoolID, body.ToYearID)
+		if err != nil {
+			return checkError(c, err, "Error fetching academic year")
+		}
+		if !to.StartDate.After(from.StartDate) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The new academic year must start after the old one",
+			})
+		}
+		if err := ensurePeriodOpen(ctx, to.ID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+		grades, err := validateRolloverRequest(body.Grades, body.Overrides)
+		if err != nil {
+			return checkError(c, err, "Invalid rollover")
+		}
+
+		now := time.Now()
+		rollover := model.Rollover{
+			ID:             primitive.NewObjectID(),
+			SchoolID:       body.SchoolID,
+			FromYearID:     from.ID,
+			ToYearID:       to.ID,
+			Grades:         grades,
+			Overrides:      body.Overrides,
+			CloneOfferings: body.CloneOfferings == nil || *body.CloneOfferings,
+			Status:         model.RolloverStatusDraft,
+			CreatedBy:      middleware.GetPrincipal(c).UserID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if rollover.Overrides == nil {
+			rollover.Overrides = []model.RolloverOverride{}
+		}
+
+		if _, err := database.GetCollection("rollovers").InsertOne(ctx, rollover); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create rollover",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":     "success",
+			"message":    "Rollover created, preview it before running it",
+			"rolloverId": rollover.ID,
+			"rollover":   rollover,
+		})
+	}
+}
+
+func ListRollovers() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.M{"created_at": -1})
+		cursor, err := database.GetCollection("rollovers").Find(ctx, middleware.TenantFilter(c, bson.M{}, "school_id"), opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch rollovers",
+			})
+		}
+		rollovers := []model.Rollover{}
+		if err := cursor.All(ctx, &rollovers); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode rollovers",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":    "success",
+			"rollovers": rollovers,
+		})
+	}
+}
+
+func GetRollover() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rollover, err := findRollover(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching rollover")
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"rollover": rollover,
+		})
+	}
+}
+
+// UpdateRollover changes the grade order, overrides or offering cloning of
+// a rollover that has not started. It must then be previewed again.
+func UpdateRollover() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Grades         *[]string                 `json:"grades"`
+			Overrides      *[]model.RolloverOverride `json:"overrides"`
+			CloneOfferings *bool                     `json:"clone_offerings"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rollover, err := findRollover(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching rollover")
+		}
+		if !rolloverEditable(rollover) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The rollover has started and can no longer be changed",
+			})
+		}
+
+		if body.Grades != nil {
+			rollover.Grades = *body.Grades
+		}
+		if body.Overrides != nil {
+			rollover.Overrides = *body.Overrides
+		}
+		if body.CloneOfferings != nil {
+			rollover.CloneOfferings = *body.CloneOfferings
+		}
+		grades, err := validateRolloverRequest(rollover.Grades, rollover.Overrides)
+		if err != nil {
+			return checkError(c, err, "Invalid rollover")
+		}
+		if rollover.Overrides == nil {
+			rollover.Overrides = []model.RolloverOverride{}
+		}
+
+		var updated model.Rollover
+		err = database.GetCollection("rollovers").FindOneAndUpdate(ctx,
+			bson.M{"_id": rollover.ID, "status": bson.M{"$in": bson.A{model.RolloverStatusDraft, model.RolloverStatusPreviewed}}},
+			bson.M{"$set": bson.M{
+				"grades":          grades,
+				"overrides":       rollover.Overrides,
+				"clone_offerings": rollover.CloneOfferings,
+				"status":          model.RolloverStatusDraft,
+				"updated_at":      time.Now(),
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The rollover has started and can no longer be changed",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating rollover",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"message":  "Rollover updated, preview it again before running it",
+			"rollover": updated,
+		})
+	}
+}
+
+func DeleteRollover() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rollover, err := findRollover(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching rollover")
+		}
+		result, err := database.GetCollection("rollovers").DeleteOne(ctx, bson.M{
+			"_id":    rollover.ID,
+			"status": bson.M{"$in": bson.A{model.RolloverStatusDraft, model.RolloverStatusPreviewed}},
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting rollover",
+			})
+		}
+		if result.DeletedCount == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The rollover has started and can no longer be deleted",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Rollover deleted successfully",
+		})
+	}
+}
+
+// PreviewRollover is the dry run: it shows the classes, students and
+// offerings the rollover would change, and unlocks running it.
+func PreviewRollover() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+
+		rollover, err := findRollover(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching rollover")
+		}
+		plan, err := planRollover(ctx, rollover)
+		if err != nil {
+			return checkError(c, err, "Error planning rollover")
+		}
+
+		// Previewing a started rollover shows what is left to do
+		if rolloverEditable(rollover) {
+			now := time.Now()
+			_, err = database.GetCollection("rollovers").UpdateOne(ctx,
+				bson.M{"_id": rollover.ID, "status": bson.M{"$in": bson.A{model.RolloverStatusDraft, model.RolloverStatusPreviewed}}},
+				bson.M{"$set": bson.M{"status": model.RolloverStatusPreviewed, "previewed_at": now, "updated_at": now}},
+			)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error updating rollover",
+				})
+			}
+		}
+
+		summary := fiber.Map{"classes_to_create": 0, "promote": 0, "retain": 0, "graduate": 0, "offerings_to_clone": 0}
+		for _, class := range plan.Classes {
+			if class.ExistingID.IsZero() {
+				summary["classes_to_create"] = summary["classes_to_create"].(int) + 1
+			}
+		}
+		for _, student := range plan.Students {
+			summary[student.Action] = summary[student.Action].(int) + 1
+		}
+		for _, offering := range plan.Offerings {
+			if !offering.Cloned {
+				summary["offerings_to_clone"] = summary["offerings_to_clone"].(int) + 1
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"summary": summary,
+			"plan":    plan,
+		})
+	}
+}
+
+// RunRollover applies a previewed rollover in the background. Running a
+// failed or interrupted rollover again resumes it; every step skips what
+// is already done.
+func RunRollover() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rollover, err := findRollover(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching rollover")
+		}
+		switch rollover.Status {
+		case model.RolloverStatusDraft:
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Preview the rollover before running it",
+			})
+		case model.RolloverStatusCompleted:
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The rollover has already completed",
+			})
+		}
+		if err := ensurePeriodOpen(ctx, rollover.ToYearID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		// Claim the rollover so two requests cannot run it at once
+		now := time.Now()
+		var claimed model.Rollover
+		err = database.GetCollection("rollovers").FindOneAndUpdate(ctx,
+			bson.M{"_id": rollover.ID, "$or": bson.A{
+				bson.M{"status": bson.M{"$in": bson.A{model.RolloverStatusPreviewed, model.RolloverStatusFailed}}},
+				bson.M{"status": model.RolloverStatusRunning, "heartbeat_at": bson.M{"$lt": now.Add(-rolloverStaleAfter)}},
+			}},
+			bson.M{"$set": bson.M{
+				"status":       model.RolloverStatusRunning,
+				"error":        "",
+				"started_at":   now,
+				"heartbeat_at": now,
+				"updated_at":   now,
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&claimed)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The rollover is already running",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error starting rollover",
+			})
+		}
+
+		go runRollover(claimed)
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"status":   "success",
+			"message":  "Rollover started",
+			"rollover": claimed,
+		})
+	}
+}
+
+// ListRolloverStudents returns what the rollover did to each student,
+// filtered by ?action=.
+func ListRolloverStudents() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rollover, err := findRollover(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching rollover")
+		}
+		filter := bson.M{"rollover_id": rollover.ID}
+		if action := c.Query("action"); action != "" {
+			filter["action"] = action
+		}
+
+		cursor, err := database.GetCollection("rollover_students").Find(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch rollover students",
+			})
+		}
+		students := []model.RolloverStudent{}
+		if err := cursor.All(ctx, &students); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode rollover students",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"students": students,
+		})
+	}
+}
+
+// runRollover applies the rollover step by step. Each step is idempotent,
+// so a run that stops part way can simply be started again.
+func runRollover(rollover model.Rollover) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	collection := database.GetCollection("rollovers")
+	fail := func(err error) {
+		log.Printf("rollover %s failed: %v", rollover.ID.Hex(), err)
+		collection.UpdateOne(context.Background(), bson.M{"_id": rollover.ID}, bson.M{"$set": bson.M{
+			"status":     model.RolloverStatusFailed,
+			"error":      err.Error(),
+			"updated_at": time.Now(),
+		}})
+	}
+
+	plan, err := planRollover(ctx, &rollover)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	steps := []struct {
+		name string
+		run  func(context.Context, *model.Rollover, *rolloverPlan) error
+	}{
+		{model.RolloverStepClasses, rolloverClasses},
+		{model.RolloverStepStudents, rolloverStudents},
+		{model.RolloverStepOfferings, rolloverOfferings},
+	}
+	for _, step := range steps {
+		if step.name == model.RolloverStepOfferings && !rollover.CloneOfferings {
+			continue
+		}
+		now := time.Now()
+		collection.UpdateOne(ctx, bson.M{"_id": rollover.ID}, bson.M{"$set": bson.M{"step": step.name, "heartbeat_at": now, "updated_at": now}})
+		if err := step.run(ctx, &rollover, plan); err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	now := time.Now()
+	collection.UpdateOne(ctx, bson.M{"_id": rollover.ID}, bson.M{"$set": bson.M{
+		"status":       model.RolloverStatusCompleted,
+		"step":         "",
+		"completed_at": now,
+		"updated_at":   now,
+	}})
+}
+
+// rolloverClasses creates the new year's classes that do not exist yet.
+func rolloverClasses(ctx context.Context, rollover *model.Rollover, plan *rolloverPlan) error {
+	year, err := resolveAcademicYear(ctx, rollover.SchoolID, rollover.ToYearID)
+	if err != nil {
+		return err
+	}
+	for i, class := range plan.Classes {
+		insert := bson.M{
+			"_id":                 primitive.NewObjectID(),
+			"academic_year":       year.Name,
+			"name":                class.Name,
+			"homeroom_teacher_id": primitive.NilObjectID,
+			"capacity":            0,
+			"created_at":          time.Now(),
+			"updated_at":          time.Now(),
+		}
+		if class.source != nil {
+			insert["homeroom_teacher_id"] = class.source.HomeroomTeacherID
+			insert["capacity"] = class.source.Capacity
+		}
+		result, err := database.GetCollection("classes").UpdateOne(ctx,
+			bson.M{"school_id": rollover.SchoolID, "academic_year_id": year.ID, "grade": class.Grade, "section": class.Section},
+			bson.M{"$setOnInsert": insert},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+		if result.UpsertedCount > 0 {
+			plan.Classes[i].ExistingID = result.UpsertedID.(primitive.ObjectID)
+			rolloverCount(ctx, rollover, "classes_created")
+			continue
+		}
+
+		var existing model.Class
+		err = database.GetCollection("classes").FindOne(ctx,
+			bson.M{"school_id": rollover.SchoolID, "academic_year_id": year.ID, "grade": class.Grade, "section": class.Section},
+		).Decode(&existing)
+		if err != nil {
+			return err
+		}
+		plan.Classes[i].ExistingID = existing.ID
+	}
+	return nil
+}
+
+// rolloverStudents moves each student. The log entry is written before
+// the student changes, so pending entries left by an interrupted run are
+// applied first.
+func rolloverStudents(ctx context.Context, rollover *model.Rollover, plan *rolloverPlan) error {
+	classIDs := map[string]primitive.ObjectID{}
+	for _, class := range plan.Classes {
+		classIDs[classKey(class.Grade, class.Section)] = class.ExistingID
+	}
+	logs := database.GetCollection("rollover_students")
+
+	cursor, err := logs.Find(ctx, bson.M{"rollover_id": rollover.ID, "applied": false})
+	if err != nil {
+		return err
+	}
+	var pending []model.RolloverStudent
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+
+	for _, student := range plan.Students {
+		entry := model.RolloverStudent{
+			ID:          primitive.NewObjectID(),
+			RolloverID:  rollover.ID,
+			StudentID:   student.StudentID,
+			Action:      student.Action,
+			FromClassID: student.fromID,
+			ToClassID:   classIDs[student.toKey],
+			CreatedAt:   time.Now(),
+		}
+		result, err := logs.UpdateOne(ctx,
+			bson.M{"rollover_id": rollover.ID, "student_id": student.StudentID},
+			bson.M{"$setOnInsert": entry},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+		if result.UpsertedCount > 0 {
+			pending = append(pending, entry)
+		}
+	}
+
+	for i, entry := range pending {
+		update := bson.M{"class_id": entry.ToClassID, "updated_at": time.Now()}
+		if entry.Action == model.RolloverGraduate {
+			update = bson.M{"class_id": primitive.NilObjectID, "status": model.StudentStatusGraduated, "updated_at": time.Now()}
+		}
+		if _, err := database.GetCollection("students").UpdateOne(ctx, bson.M{"_id": entry.StudentID}, bson.M{"$set": update}); err != nil {
+			return err
+		}
+		result, err := logs.UpdateOne(ctx, bson.M{"_id": entry.ID, "applied": false}, bson.M{"$set": bson.M{"applied": true}})
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			rolloverCount(ctx, rollover, map[string]string{
+				model.RolloverPromote:  "promoted",
+				model.RolloverRetain:   "retained",
+				model.RolloverGraduate: "graduated",
+			}[entry.Action])
+		}
+		if i%100 == 99 {
+			database.GetCollection("rollovers").UpdateOne(ctx, bson.M{"_id": rollover.ID}, bson.M{"$set": bson.M{"heartbeat_at": time.Now()}})
+		}
+	}
+	return nil
+}
+
+// rolloverOfferings clones each offering into the class of the same grade
+// and section of the new year. Terms are matched by name.
+func rolloverOfferings(ctx context.Context, rollover *model.Rollover, plan *rolloverPlan) error {
+	classIDs := map[string]primitive.ObjectID{}
+	for _, class := range plan.Classes {
+		classIDs[classKey(class.Grade, class.Section)] = class.ExistingID
+	}
+
+	cursor, err := database.GetCollection("terms").Find(ctx, bson.M{"academic_year_id": bson.M{"$in": bson.A{rollover.FromYearID, rollover.ToYearID}}})
+	if err != nil {
+		return err
+	}
+	var terms []model.Term
+	if err := cursor.All(ctx, &terms); err != nil {
+		return err
+	}
+	newTerms := map[string]primitive.ObjectID{}
+	for _, term := range terms {
+		if term.AcademicYearID == rollover.ToYearID {
+			newTerms[strings.ToLower(term.Name)] = term.ID
+		}
+	}
+	termIDs := map[primitive.ObjectID]primitive.ObjectID{}
+	for _, term := range terms {
+		if term.AcademicYearID == rollover.FromYearID {
+			termIDs[term.ID] = newTerms[strings.ToLower(term.Name)]
+		}
+	}
+
+	for _, planned := range plan.Offerings {
+		source := planned.source
+		now := time.Now()
+		clone := model.SchoolSubject{
+			ID:             primitive.NewObjectID(),
+			SubjectID:      source.SubjectID,
+			Name:           source.Name,
+			Code:           source.Code,
+			Description:    source.Description,
+			SchoolID:       source.SchoolID,
+			TeacherID:      source.TeacherID,
+			StudentIDs:     []primitive.ObjectID{},
+			ClassID:        classIDs[planned.Class],
+			AcademicYearID: rollover.ToYearID,
+			TermID:         termIDs[source.TermID],
+			Status:         source.Status,
+			ClonedFromID:   source.ID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		result, err := database.GetCollection("subjects").UpdateOne(ctx,
+			bson.M{"academic_year_id": rollover.ToYearID, "cloned_from_id": source.ID},
+			bson.M{"$setOnInsert": clone},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+		if result.UpsertedCount > 0 {
+			rolloverCount(ctx, rollover, "offerings_cloned")
+		}
+	}
+	return nil
+}
+
+func rolloverCount(ctx context.Context, rollover *model.Rollover, field string) {
+	database.GetCollection("rollovers").UpdateOne(ctx, bson.M{"_id": rollover.ID}, bson.M{
+		"$inc": bson.M{"counts." + field: 1},
+		"$set": bson.M{"heartbeat_at": time.Now()},
+	})
+}
+
+// planRollover works out the rollover from the students still in the old
+// year's classes, so students an earlier run moved are not planned again.
+func planRollover(ctx context.Context, rollover *model.Rollover) (*rolloverPlan, error) {
+	plan := &rolloverPlan{
+		Classes:   []plannedClass{},
+		Students:  []plannedStudent{},
+		Offerings: []plannedOffering{},
+		Warnings:  []string{},
+	}
+
+	cursor, err := database.GetCollection("classes").Find(ctx, bson.M{"school_id": rollover.SchoolID, "academic_year_id": rollover.FromYearID})
+	if err != nil {
+		return nil, err
+	}
+	var sources []model.Class
+	if err := cursor.All(ctx, &sources); err != nil {
+		return nil, err
+	}
+	cursor, err = database.GetCollection("classes").Find(ctx, bson.M{"school_id": rollover.SchoolID, "academic_year_id": rollover.ToYearID})
+	if err != nil {
+		return nil, err
+	}
+	var targets []model.Class
+	if err := cursor.All(ctx, &targets); err != nil {
+		return nil, err
+	}
+
+	grades := rollover.Grades
+	if len(grades) == 0 {
+		if grades, err = numericGradeOrder(sources); err != nil {
+			return nil, err
+		}
+	}
+	gradeIndex := map[string]int{}
+	for i, grade := range grades {
+		gradeIndex[grade] = i
+	}
+	unknown := []string{}
+	for _, class := range sources {
+		if _, ok := gradeIndex[class.Grade]; !ok {
+			unknown = append(unknown, class.Grade)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Grades missing from the grade order: "+strings.Join(unknown, ", "))
+	}
+
+	// The new year gets every class of the old one, plus the classes the
+	// promoted students move up into
+	classes := map[string]*plannedClass{}
+	existing := map[string]model.Class{}
+	for _, class := range targets {
+		existing[classKey(class.Grade, class.Section)] = class
+	}
+	addClass := func(grade, section string, source *model.Class) {
+		key := classKey(grade, section)
+		planned, ok := classes[key]
+		if !ok {
+			planned = &plannedClass{Grade: grade, Section: section, Name: grade + " " + section}
+			if class, ok := existing[key]; ok {
+				planned.ExistingID = class.ID
+				planned.Name = class.Name
+			}
+			classes[key] = planned
+		}
+		if planned.source == nil && source != nil {
+			planned.source = source
+			if planned.ExistingID.IsZero() {
+				planned.Name = source.Name
+			}
+		}
+	}
+	sourceByID := map[primitive.ObjectID]*model.Class{}
+	sourceIDs := bson.A{}
+	for i := range sources {
+		class := &sources[i]
+		sourceByID[class.ID] = class
+		sourceIDs = append(sourceIDs, class.ID)
+		addClass(class.Grade, class.Section, class)
+		if next := gradeIndex[class.Grade] + 1; next < len(grades) {
+			addClass(grades[next], class.Section, nil)
+		}
+	}
+
+	overrides := map[primitive.ObjectID]string{}
+	for _, override := range rollover.Overrides {
+		overrides[override.StudentID] = override.Action
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_name", Value: 1}, {Key: "first_name", Value: 1}})
+	cursor, err = database.GetCollection("students").Find(ctx, bson.M{"class_id": bson.M{"$in": sourceIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var students []model.Student
+	if err := cursor.All(ctx, &students); err != nil {
+		return nil, err
+	}
+	for _, student := range students {
+		from := sourceByID[student.ClassID]
+		action := overrides[student.ID]
+		delete(overrides, student.ID)
+		if action == "" {
+			action = model.RolloverPromote
+		}
+		next := gradeIndex[from.Grade] + 1
+		if action == model.RolloverPromote && next >= len(grades) {
+			action = model.RolloverGraduate
+		}
+
+		planned := plannedStudent{
+			StudentID: student.ID,
+			Name:      strings.TrimSpace(student.FirstName + " " + student.LastName),
+			Action:    action,
+			FromClass: from.Name,
+			fromID:    from.ID,
+		}
+		switch action {
+		case model.RolloverPromote:
+			planned.toKey = classKey(grades[next], from.Section)
+		case model.RolloverRetain:
+			planned.toKey = classKey(from.Grade, from.Section)
+		}
+		if planned.toKey != "" {
+			planned.ToClass = classes[planned.toKey].Name
+			classes[planned.toKey].Students++
+		}
+		plan.Students = append(plan.Students, planned)
+	}
+	for studentID := range overrides {
+		plan.Warnings = append(plan.Warnings, "Override for student "+studentID.Hex()+" ignored, the student is not in a class of the old year")
+	}
+
+	keys := make([]string, 0, len(classes))
+	for key := range classes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := classes[keys[i]], classes[keys[j]]
+		if gradeIndex[a.Grade] != gradeIndex[b.Grade] {
+			return gradeIndex[a.Grade] < gradeIndex[b.Grade]
+		}
+		return a.Section < b.Section
+	})
+	for _, key := range keys {
+		class := classes[key]
+		if class.source != nil && class.source.Capacity > 0 && class.Students > class.source.Capacity {
+			plan.Warnings = append(plan.Warnings, "Class "+class.Name+" would have "+strconv.Itoa(class.Students)+" students, over its capacity of "+strconv.Itoa(class.source.Capacity))
+		}
+		plan.Classes = append(plan.Classes, *class)
+	}
+
+	if !rollover.CloneOfferings {
+		return plan, nil
+	}
+	cursor, err = database.GetCollection("subjects").Find(ctx, bson.M{"school_id": rollover.SchoolID, "academic_year_id": rollover.FromYearID})
+	if err != nil {
+		return nil, err
+	}
+	var offerings []model.SchoolSubject
+	if err := cursor.All(ctx, &offerings); err != nil {
+		return nil, err
+	}
+	cursor, err = database.GetCollection("subjects").Find(ctx, bson.M{"academic_year_id": rollover.ToYearID, "cloned_from_id": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	var clones []model.SchoolSubject
+	if err := cursor.All(ctx, &clones); err != nil {
+		return nil, err
+	}
+	cloned := map[primitive.ObjectID]bool{}
+	for _, clone := range clones {
+		cloned[clone.ClonedFromID] = true
+	}
+	for _, offering := range offerings {
+		class, ok := sourceByID[offering.ClassID]
+		if !ok {
+			plan.Warnings = append(plan.Warnings, "Subject "+offering.Name+" has no class in the old year and is not cloned")
+			continue
+		}
+		plan.Offerings = append(plan.Offerings, plannedOffering{
+			SourceID: offering.ID,
+			Name:     offering.Name,
+			Class:    classKey(class.Grade, class.Section),
+			Cloned:   cloned[offering.ID],
+			source:   offering,
+		})
+	}
+	return plan, nil
+}
+
+// numericGradeOrder orders the classes' grades when they are all numbers.
+func numericGradeOrder(classes []model.Class) ([]string, error) {
+	numbers := map[int]string{}
+	for _, class := range classes {
+		n, err := strconv.Atoi(strings.TrimSpace(class.Grade))
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Grade "+class.Grade+" is not a number, set the grade order in grades")
+		}
+		numbers[n] = class.Grade
+	}
+	keys := make([]int, 0, len(numbers))
+	for n := range numbers {
+		keys = append(keys, n)
+	}
+	sort.Ints(keys)
+	grades := make([]string, 0, len(keys))
+	for _, n := range keys {
+		grades = append(grades, numbers[n])
+	}
+	return grades, nil
+}
+
+func validateRolloverRequest(grades []string, overrides []model.RolloverOverride) ([]string, error) {
+	seen := map[string]bool{}
+	cleaned := []string{}
+	for _, grade := range grades {
+		grade = strings.TrimSpace(grade)
+		if grade == "" || seen[grade] {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Grades must be distinct and not empty")
+		}
+		seen[grade] = true
+		cleaned = append(cleaned, grade)
+	}
+	students := map[primitive.ObjectID]bool{}
+	for _, override := range overrides {
+		if override.StudentID.IsZero() || students[override.StudentID] {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Each override needs a distinct student_id")
+		}
+		students[override.StudentID] = true
+		switch override.Action {
+		case model.RolloverPromote, model.RolloverRetain, model.RolloverGraduate:
+		default:
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Override action must be promote, retain or graduate")
+		}
+	}
+	return cleaned, nil
+}
+
+func rolloverEditable(rollover *model.Rollover) bool {
+	return rollover.Status == model.RolloverStatusDraft || rollover.Status == model.RolloverStatusPreviewed
+}
+
+func classKey(grade, section string) string {
+	return grade + " " + section
+}
+
+func findRollover(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Rollover, error) {
+	var rollover model.Rollover
+	err := database.GetCollection("rollovers").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&rollover)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Rollover not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rollover, nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
 	"github.com/ReddIndiann/go-messanger/model"
 	"github.com/gofiber/fiber/v2"
 
@@ -79,7 +80,7 @@ func GetAllSchool() fiber.Handler {
 		skip := (page - 1) * limit
 
 		// Optional: Add filtering
-		filter := bson.M{}
+		filter := middleware.TenantFilter(c, bson.M{}, "_id")
 		if search := c.Query("search"); search != "" {
 			filter["name"] = bson.M{"$regex": search, "$options": "i"}
 		}
@@ -139,6 +140,12 @@ func GetSchoolByID() fiber.Handler {
 			})
 		}
 
+		if !middleware.CanAccessSchool(c, objectID) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "School not found",
+			})
+		}
+
 		collection := database.GetCollection("schools")
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -169,6 +176,12 @@ func UpdateSchool() fiber.Handler {
 			})
 		}
 
+		if !middleware.CanAccessSchool(c, objectID) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "School not found",
+			})
+		}
+
 		// Get the existing school first
 		collection := database.GetCollection("schools")
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -266,6 +279,10 @@ func DeleteSchool() fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
 		}
 
+		if !middleware.CanAccessSchool(c, objectID) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "School not found"})
+		}
+
 		collection := database.GetCollection("schools")
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ListSessions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := middleware.GetPrincipal(c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		sessions, err := middleware.ListUserSessions(ctx, principal.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error fetching sessions",
+			})
+		}
+
+		result := make([]fiber.Map, 0, len(sessions))
+		for _, session := range sessions {
+			result = append(result, fiber.Map{
+				"id":           session.ID,
+				"device":       session.Device,
+				"ip":           session.IP,
+				"user_agent":   session.UserAgent,
+				"created_at":   session.CreatedAt,
+				"last_used_at": session.LastUsedAt,
+				"expires_at":   session.ExpiresAt,
+				"current":      session.ID == principal.SessionID,
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":   "success",
+			"count":    len(result),
+			"sessions": result,
+		})
+	}
+}
+
+func DeleteSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid ID format",
+			})
+		}
+
+		principal := middleware.GetPrincipal(c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Users can only end their own sessions
+		count, err := database.GetCollection("sessions").CountDocuments(ctx, bson.M{
+			"_id":        objectID,
+			"user_id":    principal.UserID,
+			"revoked_at": bson.M{"$exists": false},
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error fetching session",
+			})
+		}
+		if count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Session not found",
+			})
+		}
+
+		if err := middleware.RevokeSession(ctx, objectID, "revoked_by_user"); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error revoking session",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Session revoked successfully",
+		})
+	}
+}
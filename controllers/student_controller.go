@@ -3,9 +3,11 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"time"
 
 	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
 	"github.com/ReddIndiann/go-messanger/model"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -32,68 +34,26 @@ func RegisterStudent() fiber.Handler {
 			})
 		}
 
-		// Validate required fields
-		if student.FirstName == "" || student.LastName == "" || student.Email == "" ||
-			student.Phone == "" || student.SchoolID.IsZero() || student.Grade == "" ||
-			student.Section == "" || student.RollNumber == "" {
+		if err := checkStudentRequired(&student); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"status":  "error",
-				"message": "First name, last name, email, phone, school ID, grade, section, and roll number are required",
+				"message": err.Error(),
 			})
 		}
 
-		// Check if school exists
-		schoolCollection := database.GetCollection("schools")
-		schoolResult := schoolCollection.FindOne(context.Background(), bson.M{"_id": student.SchoolID})
-		if schoolResult.Err() == mongo.ErrNoDocuments {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		if !middleware.CanAccessSchool(c, student.SchoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"status":  "error",
-				"message": "School not found with the provided ID",
+				"message": "You do not have access to this school",
 			})
 		}
 
-		// Check if teacher exists if teacher_id is provided
-		if !student.TeacherID.IsZero() {
-			teacherCollection := database.GetCollection("teachers")
-			teacherResult := teacherCollection.FindOne(context.Background(), bson.M{"_id": student.TeacherID})
-			if teacherResult.Err() == mongo.ErrNoDocuments {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"status":  "error",
-					"message": "Teacher not found with the provided ID",
-				})
-			}
+		if _, err := validateStudentRecord(context.Background(), &student); err != nil {
+			return checkError(c, err, "Failed to check student")
 		}
 
-		// Check if student with same email already exists
 		collection := database.GetCollection("students")
-		existingStudent := collection.FindOne(context.Background(), bson.M{"email": student.Email})
-		if existingStudent.Err() == nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Student with this email already exists",
-			})
-		}
-
-		// Create new student document
-		newStudent := model.Student{
-			ID:            primitive.NewObjectID(),
-			SchoolID:      student.SchoolID,
-			TeacherID:     student.TeacherID,
-			FirstName:     student.FirstName,
-			LastName:      student.LastName,
-			Email:         student.Email,
-			Phone:         student.Phone,
-			DateOfBirth:   student.DateOfBirth,
-			Gender:        student.Gender,
-			Address:       student.Address,
-			Grade:         student.Grade,
-			Section:       student.Section,
-			RollNumber:    student.RollNumber,
-			ParentDetails: student.ParentDetails,
-			Status:        "Active", // Default status
-			CreatedAt:     time.Now(),
-			UpdatedAt:     time.Now(),
-		}
+		newStudent := newStudentRecord(student)
 
 		// Insert the new student
 		result, err := collection.InsertOne(c.Context(), newStudent)
@@ -104,11 +64,26 @@ func RegisterStudent() fiber.Handler {
 			})
 		}
 
+		// The account is created when the invitation is accepted
+		var invitationID interface{}
+		if c.Query("invite") != "false" {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			invitation, err := inviteRecord(ctx, inviterOf(c), model.RoleStudent, newStudent.Email,
+				newStudent.FirstName+" "+newStudent.LastName, newStudent.SchoolID, newStudent.ID)
+			if err != nil {
+				log.Printf("Error inviting student %s: %v\n", newStudent.ID.Hex(), err)
+			} else {
+				invitationID = invitation.ID
+			}
+		}
+
 		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-			"status":    "success",
-			"message":   "Student registered successfully",
-			"studentId": result.InsertedID,
-			"info":      newStudent,
+			"status":       "success",
+			"message":      "Student registered successfully",
+			"studentId":    result.InsertedID,
+			"invitationId": invitationID,
+			"info":         newStudent,
 		})
 	}
 }
@@ -126,7 +101,7 @@ func GetStudent() fiber.Handler {
 
 		collection := database.GetCollection("students")
 		var student model.Student
-		err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&student)
+		err = collection.FindOne(context.Background(), middleware.TenantFilter(c, bson.M{"_id": objID}, "school_id")).Decode(&student)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -169,6 +144,10 @@ func UpdateStudent() fiber.Handler {
 		// Remove any fields that shouldn't be updated
 		delete(updateData, "_id")
 		delete(updateData, "created_at")
+		// Class membership changes go through the class roster endpoints
+		delete(updateData, "class_id")
+		delete(updateData, "grade")
+		delete(updateData, "section")
 		updateData["updated_at"] = time.Now()
 
 		// If school_id is being updated, validate the new school exists
@@ -180,6 +159,15 @@ func UpdateStudent() fiber.Handler {
 					"message": "Invalid school ID format",
 				})
 			}
+			if !middleware.CanAccessSchool(c, schoolObjID) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"status":  "error",
+					"message": "You do not have access to this school",
+				})
+			}
+			updateData["school_id"] = schoolObjID
+			// A class belongs to one school, so moving schools leaves it
+			updateData["class_id"] = primitive.NilObjectID
 			schoolCollection := database.GetCollection("schools")
 			if err := schoolCollection.FindOne(context.Background(), bson.M{"_id": schoolObjID}).Err(); err != nil {
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -198,8 +186,27 @@ func UpdateStudent() fiber.Handler {
 					"message": "Invalid teacher ID format",
 				})
 			}
+			// The teacher must be from the school the student is in after the update
+			schoolObjID, moved := updateData["school_id"].(primitive.ObjectID)
+			if !moved {
+				var current model.Student
+				err := database.GetCollection("students").FindOne(context.Background(), middleware.TenantFilter(c, bson.M{"_id": objID}, "school_id")).Decode(&current)
+				if err == mongo.ErrNoDocuments {
+					return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+						"status":  "error",
+						"message": "Student not found",
+					})
+				}
+				if err != nil {
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+						"status":  "error",
+						"message": "Error fetching student",
+					})
+				}
+				schoolObjID = current.SchoolID
+			}
 			teacherCollection := database.GetCollection("teachers")
-			if err := teacherCollection.FindOne(context.Background(), bson.M{"_id": teacherObjID}).Err(); err != nil {
+			if err := teacherCollection.FindOne(context.Background(), bson.M{"_id": teacherObjID, "school_id": schoolObjID}).Err(); err != nil {
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 					"status":  "error",
 					"message": "Teacher not found",
@@ -210,7 +217,7 @@ func UpdateStudent() fiber.Handler {
 		collection := database.GetCollection("students")
 		result, err := collection.UpdateOne(
 			context.Background(),
-			bson.M{"_id": objID},
+			middleware.TenantFilter(c, bson.M{"_id": objID}, "school_id"),
 			bson.M{"$set": updateData},
 		)
 		if err != nil {
@@ -246,7 +253,7 @@ func DeleteStudent() fiber.Handler {
 		}
 
 		collection := database.GetCollection("students")
-		result, err := collection.DeleteOne(context.Background(), bson.M{"_id": objID})
+		result, err := collection.DeleteOne(context.Background(), middleware.TenantFilter(c, bson.M{"_id": objID}, "school_id"))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -261,6 +268,11 @@ func DeleteStudent() fiber.Handler {
 			})
 		}
 
+		// Parent accounts no longer see the student
+		if _, err := database.GetCollection("users").UpdateMany(context.Background(), bson.M{"child_ids": objID}, bson.M{"$pull": bson.M{"child_ids": objID}}); err != nil {
+			log.Println("Error unlinking guardians of deleted student:", err)
+		}
+
 		return c.JSON(fiber.Map{
 			"status":  "success",
 			"message": "Student deleted successfully",
@@ -271,7 +283,7 @@ func DeleteStudent() fiber.Handler {
 func ListStudents() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		collection := database.GetCollection("students")
-		cursor, err := collection.Find(context.Background(), bson.M{})
+		cursor, err := collection.Find(context.Background(), middleware.TenantFilter(c, bson.M{}, "school_id"))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
@@ -294,3 +306,84 @@ func ListStudents() fiber.Handler {
 		})
 	}
 }
+
+// checkStudentRequired checks the fields every student must have.
+func checkStudentRequired(student *model.Student) error {
+	if student.FirstName == "" || student.LastName == "" || student.Email == "" ||
+		student.Phone == "" || student.SchoolID.IsZero() || student.RollNumber == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "First name, last name, email, phone, school ID, and roll number are required")
+	}
+	return nil
+}
+
+// validateStudentRecord checks a new student against the school's data:
+// the school, teacher and class exist, the class is open and has room, and
+// no student has the email yet. It returns the student's class, if any.
+func validateStudentRecord(ctx context.Context, student *model.Student) (*model.Class, error) {
+	// Check if school exists
+	err := database.GetCollection("schools").FindOne(ctx, bson.M{"_id": student.SchoolID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "School not found with the provided ID")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if teacher exists if teacher_id is provided
+	if !student.TeacherID.IsZero() {
+		err := database.GetCollection("teachers").FindOne(ctx, bson.M{"_id": student.TeacherID, "school_id": student.SchoolID}).Err()
+		if err == mongo.ErrNoDocuments {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Teacher not found with the provided ID")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Students can be enrolled now or added to a class's roster later
+	var class *model.Class
+	if !student.ClassID.IsZero() {
+		class, err = validateSchoolClass(ctx, student.ClassID, student.SchoolID)
+		if err == nil {
+			err = ensurePeriodOpen(ctx, class.AcademicYearID, primitive.NilObjectID)
+		}
+		if err == nil {
+			err = ensureClassCapacity(ctx, class, 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Check if student with same email already exists
+	err = database.GetCollection("students").FindOne(ctx, bson.M{"email": student.Email}).Err()
+	if err == nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Student with this email already exists")
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return class, nil
+}
+
+// newStudentRecord is the document a registered student is stored as.
+func newStudentRecord(student model.Student) model.Student {
+	return model.Student{
+		ID:            primitive.NewObjectID(),
+		SchoolID:      student.SchoolID,
+		TeacherID:     student.TeacherID,
+		FirstName:     student.FirstName,
+		LastName:      student.LastName,
+		Email:         student.Email,
+		Phone:         student.Phone,
+		DateOfBirth:   student.DateOfBirth,
+		Gender:        student.Gender,
+		Address:       student.Address,
+		ClassID:       student.ClassID,
+		RollNumber:    student.RollNumber,
+		ParentDetails: student.ParentDetails,
+		Status:        "Active", // Default status
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+}
@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateCatalogSubject() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var subject model.Subject
+		if err := c.BodyParser(&subject); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		subject.Code = normalizeSubjectCode(subject.Code)
+		if subject.Name == "" || subject.Code == "" || subject.SchoolID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Name, code and school ID are required",
+			})
+		}
+
+		if !middleware.CanAccessSchool(c, subject.SchoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Check if school exists
+		if err := database.GetCollection("schools").FindOne(ctx, bson.M{"_id": subject.SchoolID}).Err(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "School not found with the provided ID",
+			})
+		}
+
+		newSubject := model.Subject{
+			ID:          primitive.NewObjectID(),
+			SchoolID:    subject.SchoolID,
+			Name:        subject.Name,
+			Code:        subject.Code,
+			Description: subject.Description,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+
+		// The unique (school_id, code) index rejects duplicates
+		_, err := database.GetCollection("subject_catalog").InsertOne(ctx, newSubject)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "A subject with this code already exists in the school",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create subject",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":    "success",
+			"message":   "Subject added to catalog successfully",
+			"subjectId": newSubject.ID,
+			"info":      newSubject,
+		})
+	}
+}
+
+func ListCatalogSubjects() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		if search := c.Query("search"); search != "" {
+			filter["$or"] = []bson.M{
+				{"name": bson.M{"$regex": search, "$options": "i"}},
+				{"code": bson.M{"$regex": search, "$options": "i"}},
+			}
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "code", Value: 1}})
+		cursor, err := database.GetCollection("subject_catalog").Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch subjects",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		subjects := []model.Subject{}
+		if err := cursor.All(ctx, &subjects); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode subjects",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"subjects": subjects,
+		})
+	}
+}
+
+func GetCatalogSubject() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var subject model.Subject
+		err = database.GetCollection("subject_catalog").
+			FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")).
+			Decode(&subject)
+		if err != nil {
+			return catalogLookupError(c, err)
+		}
+
+		// Show where the subject is offered
+		cursor, err := database.GetCollection("subjects").Find(ctx, bson.M{"subject_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching subject offerings",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		offerings := []model.SchoolSubject{}
+		if err := cursor.All(ctx, &offerings); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error parsing subject offerings",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":    "success",
+			"subject":   subject,
+			"offerings": offerings,
+		})
+	}
+}
+
+func UpdateCatalogSubject() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var updateData map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &updateData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+
+		setMap := bson.M{}
+		if name, ok := updateData["name"].(string); ok && name != "" {
+			setMap["name"] = name
+		}
+		if code, ok := updateData["code"].(string); ok && normalizeSubjectCode(code) != "" {
+			setMap["code"] = normalizeSubjectCode(code)
+		}
+		if description, ok := updateData["description"].(string); ok {
+			setMap["description"] = description
+		}
+		setMap["updated_at"] = time.Now()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var updatedSubject model.Subject
+		err = database.GetCollection("subject_catalog").FindOneAndUpdate(
+			ctx,
+			middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id"),
+			bson.M{"$set": setMap},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedSubject)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "A subject with this code already exists in the school",
+				})
+			}
+			return catalogLookupError(c, err)
+		}
+
+		// Keep the copies on offerings in step with the catalog
+		_, err = database.GetCollection("subjects").UpdateMany(ctx,
+			bson.M{"subject_id": objectID},
+			bson.M{"$set": bson.M{"name": updatedSubject.Name, "code": updatedSubject.Code}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Subject updated but its offerings could not be refreshed",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Subject updated successfully",
+			"subject": updatedSubject,
+		})
+	}
+}
+
+// DeleteCatalogSubject refuses to delete a subject that is still offered or taught.
+func DeleteCatalogSubject() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")
+		if err := database.GetCollection("subject_catalog").FindOne(ctx, filter).Err(); err != nil {
+			return catalogLookupError(c, err)
+		}
+
+		offerings, err := database.GetCollection("subjects").CountDocuments(ctx, bson.M{"subject_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting subject offerings",
+			})
+		}
+		teachers, err := database.GetCollection("teachers").CountDocuments(ctx, bson.M{"subject_ids": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting subject teachers",
+			})
+		}
+		if offerings > 0 || teachers > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":     "Subject is still offered or assigned to teachers",
+				"offerings": offerings,
+				"teachers":  teachers,
+			})
+		}
+
+		if _, err := database.GetCollection("subject_catalog").DeleteOne(ctx, filter); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete subject",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Subject removed from catalog successfully",
+		})
+	}
+}
+
+func normalizeSubjectCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func catalogLookupError(c *fiber.Ctx, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Subject not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error fetching subject",
+	})
+}
+
+// findCatalogSubject loads a catalog subject of the given school.
+func findCatalogSubject(ctx context.Context, subjectID primitive.ObjectID, schoolID primitive.ObjectID) (*model.Subject, error) {
+	var subject model.Subject
+	err := database.GetCollection("subject_catalog").FindOne(ctx, bson.M{"_id": subjectID, "school_id": schoolID}).Decode(&subject)
+	if err != nil {
+		return nil, err
+	}
+	return &subject, nil
+}
+
+// validateTeacherSubjects checks that every subject is in the school's catalog.
+func validateTeacherSubjects(ctx context.Context, subjectIDs []primitive.ObjectID, schoolID primitive.ObjectID) error {
+	if len(subjectIDs) == 0 {
+		return nil
+	}
+	count, err := database.GetCollection("subject_catalog").CountDocuments(ctx, bson.M{
+		"_id":       bson.M{"$in": subjectIDs},
+		"school_id": schoolID,
+	})
+	if err != nil {
+		return err
+	}
+	unique := map[primitive.ObjectID]bool{}
+	for _, id := range subjectIDs {
+		unique[id] = true
+	}
+	if int(count) != len(unique) {
+		return fiber.NewError(fiber.StatusBadRequest, "One or more subjects were not found in the school's catalog")
+	}
+	return nil
+}
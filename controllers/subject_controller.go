@@ -3,9 +3,11 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
 	"github.com/ReddIndiann/go-messanger/model"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -24,9 +26,9 @@ func RegisterSubject() fiber.Handler {
 		}
 
 		// Validate required fields
-		if subject.Name == "" {
+		if subject.SubjectID.IsZero() {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Subject name is required",
+				"error": "Catalog subject ID is required",
 			})
 		}
 		if subject.SchoolID.IsZero() {
@@ -41,22 +43,18 @@ func RegisterSubject() fiber.Handler {
 		}
 
 		// Validate optional fields if provided
-		if subject.Grade != "" && (len(subject.Grade) > 2 || !isValidGrade(subject.Grade)) {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid grade format. Grade should be a number between 1-12",
-			})
-		}
-		if subject.Section != "" && (len(subject.Section) != 1 || !isValidSection(subject.Section)) {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid section format. Section should be a single letter (A-Z)",
-			})
-		}
 		if subject.Status != "" && subject.Status != "Active" && subject.Status != "Inactive" {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Invalid status. Status must be either 'Active' or 'Inactive'",
 			})
 		}
 
+		if !middleware.CanAccessSchool(c, subject.SchoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
+			})
+		}
+
 		// Check if school exists
 		schoolCollection := database.GetCollection("schools")
 		if err := schoolCollection.FindOne(context.Background(), bson.M{"_id": subject.SchoolID}).Err(); err != nil {
@@ -65,19 +63,55 @@ func RegisterSubject() fiber.Handler {
 			})
 		}
 
+		// The offering takes its name and code from the school's catalog
+		catalogSubject, err := findCatalogSubject(context.Background(), subject.SubjectID, subject.SchoolID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Subject not found in the school's catalog",
+			})
+		}
+
 		// Check if teacher exists
 		teacherCollection := database.GetCollection("teachers")
-		if err := teacherCollection.FindOne(context.Background(), bson.M{"_id": subject.TeacherID}).Err(); err != nil {
+		if err := teacherCollection.FindOne(context.Background(), bson.M{"_id": subject.TeacherID, "school_id": subject.SchoolID}).Err(); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Teacher not found with the provided ID",
 			})
 		}
 
+		// Offerings belong to their class's academic year, or to the given
+		// or current one when they have no class
+		academicYearID := subject.AcademicYearID
+		if !subject.ClassID.IsZero() {
+			class, err := validateSchoolClass(context.Background(), subject.ClassID, subject.SchoolID)
+			if err != nil {
+				return checkError(c, err, "Error fetching class")
+			}
+			if !academicYearID.IsZero() && academicYearID != class.AcademicYearID {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Class belongs to another academic year",
+				})
+			}
+			academicYearID = class.AcademicYearID
+		}
+		year, err := resolveAcademicYear(context.Background(), subject.SchoolID, academicYearID)
+		if err != nil {
+			return checkError(c, err, "Error fetching academic year")
+		}
+		if !subject.TermID.IsZero() {
+			if err := validateYearTerm(context.Background(), subject.TermID, year.ID); err != nil {
+				return checkError(c, err, "Error fetching term")
+			}
+		}
+		if err := ensurePeriodOpen(context.Background(), year.ID, subject.TermID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
 		// Check if students exist
 		if len(subject.StudentIDs) > 0 {
 			studentCollection := database.GetCollection("students")
 			for _, studentID := range subject.StudentIDs {
-				if err := studentCollection.FindOne(context.Background(), bson.M{"_id": studentID}).Err(); err != nil {
+				if err := studentCollection.FindOne(context.Background(), bson.M{"_id": studentID, "school_id": subject.SchoolID}).Err(); err != nil {
 					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 						"error": "Student not found with ID: " + studentID.Hex(),
 					})
@@ -87,17 +121,20 @@ func RegisterSubject() fiber.Handler {
 
 		// Create new subject
 		newSubject := model.SchoolSubject{
-			ID:          primitive.NewObjectID(),
-			Name:        subject.Name,
-			Description: subject.Description,
-			SchoolID:    subject.SchoolID,
-			TeacherID:   subject.TeacherID,
-			StudentIDs:  subject.StudentIDs,
-			Grade:       subject.Grade,
-			Section:     subject.Section,
-			Status:      "Active", // Default status
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
+			ID:             primitive.NewObjectID(),
+			SubjectID:      catalogSubject.ID,
+			Name:           catalogSubject.Name,
+			Code:           catalogSubject.Code,
+			Description:    subject.Description,
+			SchoolID:       subject.SchoolID,
+			TeacherID:      subject.TeacherID,
+			StudentIDs:     subject.StudentIDs,
+			ClassID:        subject.ClassID,
+			AcademicYearID: year.ID,
+			TermID:         subject.TermID,
+			Status:         "Active", // Default status
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
 		}
 
 		// Insert the new subject
@@ -119,31 +156,6 @@ func RegisterSubject() fiber.Handler {
 	}
 }
 
-// Helper function to validate grade
-func isValidGrade(grade string) bool {
-	if len(grade) > 2 {
-		return false
-	}
-	// Check if grade is a number between 1-12
-	num := 0
-	for _, c := range grade {
-		if c < '0' || c > '9' {
-			return false
-		}
-		num = num*10 + int(c-'0')
-	}
-	return num >= 1 && num <= 12
-}
-
-// Helper function to validate section
-func isValidSection(section string) bool {
-	if len(section) != 1 {
-		return false
-	}
-	c := section[0]
-	return c >= 'A' && c <= 'Z'
-}
-
 func GetSubject() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id := c.Params("id")
@@ -156,7 +168,7 @@ func GetSubject() fiber.Handler {
 
 		collection := database.GetCollection("subjects")
 		var subject model.SchoolSubject
-		err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&subject)
+		err = collection.FindOne(context.Background(), middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")).Decode(&subject)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -192,15 +204,162 @@ func UpdateSubject() fiber.Handler {
 			})
 		}
 
-		// Remove any fields that shouldn't be updated
-		delete(updateData, "_id")
-		delete(updateData, "created_at")
+		if _, ok := updateData["school_id"]; ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Subject offerings cannot move to another school",
+			})
+		}
+		updateData, err = offeringUpdateFields(updateData)
+		if err != nil {
+			return checkError(c, err, "Invalid request format")
+		}
 		updateData["updated_at"] = time.Now()
 
 		collection := database.GetCollection("subjects")
+		var current model.SchoolSubject
+		err = collection.FindOne(context.Background(), middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")).Decode(&current)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Subject not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching subject",
+			})
+		}
+		if err := checkOfferingUpdate(middleware.GetPrincipal(c), &current, updateData); err != nil {
+			return checkError(c, err, "Error checking permissions")
+		}
+		if err := ensurePeriodOpen(context.Background(), current.AcademicYearID, current.TermID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		// Re-pointing the offering keeps it linked to a catalog subject of its school
+		if idStr, ok := updateData["subject_id"]; ok {
+			catalogID, err := primitive.ObjectIDFromHex(fmt.Sprint(idStr))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid catalog subject ID format",
+				})
+			}
+			catalogSubject, err := findCatalogSubject(context.Background(), catalogID, current.SchoolID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Subject not found in the school's catalog",
+				})
+			}
+			updateData["subject_id"] = catalogSubject.ID
+			updateData["name"] = catalogSubject.Name
+			updateData["code"] = catalogSubject.Code
+		}
+
+		// Class and term must belong to the offering's academic year
+		if idStr, ok := updateData["class_id"]; ok {
+			classID := primitive.NilObjectID
+			if idStr != nil && idStr != "" {
+				classID, err = primitive.ObjectIDFromHex(fmt.Sprint(idStr))
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid class ID format",
+					})
+				}
+				class, err := validateSchoolClass(context.Background(), classID, current.SchoolID)
+				if err != nil {
+					return checkError(c, err, "Error fetching class")
+				}
+				if class.AcademicYearID != current.AcademicYearID {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Class belongs to another academic year",
+					})
+				}
+			}
+			updateData["class_id"] = classID
+		}
+		if idStr, ok := updateData["term_id"]; ok {
+			termID := primitive.NilObjectID
+			if idStr != nil && idStr != "" {
+				termID, err = primitive.ObjectIDFromHex(fmt.Sprint(idStr))
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid term ID format",
+					})
+				}
+				if err := validateYearTerm(context.Background(), termID, current.AcademicYearID); err != nil {
+					return checkError(c, err, "Error fetching term")
+				}
+				if err := ensurePeriodOpen(context.Background(), primitive.NilObjectID, termID); err != nil {
+					return checkError(c, err, "Error checking term")
+				}
+			}
+			updateData["term_id"] = termID
+		}
+
+		if raw, ok := updateData["student_ids"]; ok {
+			studentIDs, err := parseObjectIDs(raw)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "student_ids must be an array of student IDs",
+				})
+			}
+			if err := validateSchoolStudents(context.Background(), studentIDs, current.SchoolID); err != nil {
+				return checkError(c, err, "Error checking students")
+			}
+			updateData["student_ids"] = studentIDs
+		}
+
+		teacherChanged := false
+		if idStr, ok := updateData["teacher_id"]; ok {
+			teacherID := primitive.NilObjectID
+			if idStr != nil && idStr != "" {
+				teacherID, err = primitive.ObjectIDFromHex(fmt.Sprint(idStr))
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid teacher ID format",
+					})
+				}
+				err := database.GetCollection("teachers").FindOne(context.Background(), bson.M{"_id": teacherID, "school_id": current.SchoolID}).Err()
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Teacher not found in this school",
+					})
+				}
+			}
+			updateData["teacher_id"] = teacherID
+			teacherChanged = teacherID != current.TeacherID
+		}
+
+		// Moving the offering to another class, teacher or term must not
+		// double-book its timetable slots
+		rescheduled := current
+		if classID, ok := updateData["class_id"].(primitive.ObjectID); ok {
+			rescheduled.ClassID = classID
+		}
+		if teacherID, ok := updateData["teacher_id"].(primitive.ObjectID); ok {
+			rescheduled.TeacherID = teacherID
+		}
+		if termID, ok := updateData["term_id"].(primitive.ObjectID); ok {
+			rescheduled.TermID = termID
+		}
+		slotsMoved := rescheduled.ClassID != current.ClassID || rescheduled.TeacherID != current.TeacherID || rescheduled.TermID != current.TermID
+		if slotsMoved {
+			conflicts, err := offeringSlotConflicts(context.Background(), &rescheduled)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error checking timetable conflicts",
+				})
+			}
+			if len(conflicts) > 0 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":     "The subject's timetable slots would clash",
+					"conflicts": conflicts,
+				})
+			}
+		}
+
 		result, err := collection.UpdateOne(
 			context.Background(),
-			bson.M{"_id": objectID},
+			middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id"),
 			bson.M{"$set": updateData},
 		)
 		if err != nil {
@@ -215,6 +374,17 @@ func UpdateSubject() fiber.Handler {
 			})
 		}
 
+		if slotsMoved {
+			syncOfferingSlots(context.Background(), &rescheduled)
+		}
+
+		// The new teacher takes over the homework still to mark
+		if teacherChanged {
+			teacherID := updateData["teacher_id"]
+			database.GetCollection("assignments").UpdateMany(context.Background(), bson.M{"subject_id": objectID}, bson.M{"$set": bson.M{"teacher_id": teacherID}})
+			database.GetCollection("submissions").UpdateMany(context.Background(), bson.M{"subject_id": objectID, "graded": false}, bson.M{"$set": bson.M{"teacher_id": teacherID}})
+		}
+
 		return c.JSON(fiber.Map{
 			"status":  "success",
 			"message": "Subject updated successfully",
@@ -233,7 +403,50 @@ func DeleteSubject() fiber.Handler {
 		}
 
 		collection := database.GetCollection("subjects")
-		result, err := collection.DeleteOne(context.Background(), bson.M{"_id": objectID})
+		filter := middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")
+
+		var subject model.SchoolSubject
+		if err := collection.FindOne(context.Background(), filter).Decode(&subject); err == nil {
+			if err := ensurePeriodOpen(context.Background(), subject.AcademicYearID, subject.TermID); err != nil {
+				return checkError(c, err, "Error checking academic year")
+			}
+		}
+
+		assessments, err := database.GetCollection("assessments").CountDocuments(context.Background(), bson.M{"subject_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting assessments",
+			})
+		}
+		assignments, err := database.GetCollection("assignments").CountDocuments(context.Background(), bson.M{"subject_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting assignments",
+			})
+		}
+		diaryEntries, err := database.GetCollection("diary_entries").CountDocuments(context.Background(), bson.M{"subject_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting diary entries",
+			})
+		}
+		slots, err := database.GetCollection("timetable_slots").CountDocuments(context.Background(), bson.M{"subject_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting timetable slots",
+			})
+		}
+		if assessments > 0 || assignments > 0 || diaryEntries > 0 || slots > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":          "Subject still has assessments, assignments, diary entries or timetable slots",
+				"assessments":    assessments,
+				"assignments":    assignments,
+				"diaryEntries":   diaryEntries,
+				"timetableSlots": slots,
+			})
+		}
+
+		result, err := collection.DeleteOne(context.Background(), filter)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to delete subject",
@@ -256,7 +469,7 @@ func DeleteSubject() fiber.Handler {
 func ListSubjects() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		collection := database.GetCollection("subjects")
-		cursor, err := collection.Find(context.Background(), bson.M{})
+		cursor, err := collection.Find(context.Background(), middleware.TenantFilter(c, bson.M{}, "school_id"))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to fetch subjects",
@@ -277,3 +490,134 @@ func ListSubjects() fiber.Handler {
 		})
 	}
 }
+
+// findOffering loads a subject offering the caller's schools can see.
+func findOffering(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.SchoolSubject, error) {
+	var offering model.SchoolSubject
+	err := database.GetCollection("subjects").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&offering)
+	if err != nil {
+		return nil, err
+	}
+	return &offering, nil
+}
+
+func offeringLookupError(c *fiber.Ctx, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Subject not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error fetching subject",
+	})
+}
+
+// offeringStudents returns the students taking an offering: its class's
+// roster plus any students added to the offering directly.
+func offeringStudents(ctx context.Context, offering *model.SchoolSubject) (map[primitive.ObjectID]bool, error) {
+	students := map[primitive.ObjectID]bool{}
+	if !offering.ClassID.IsZero() {
+		roster, err := classRoster(ctx, offering.ClassID)
+		if err != nil {
+			return nil, err
+		}
+		students = roster
+	}
+	for _, id := range offering.StudentIDs {
+		students[id] = true
+	}
+	return students, nil
+}
+
+// offeringUpdateFields keeps the fields of an update that UpdateSubject can
+// change. Name and code follow the catalog subject, and the school, academic
+// year and history of an offering are fixed.
+func offeringUpdateFields(update map[string]interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	for _, field := range []string{"description", "status"} {
+		if value, ok := update[field]; ok {
+			text, isText := value.(string)
+			if !isText {
+				return nil, fiber.NewError(fiber.StatusBadRequest, field+" must be a string")
+			}
+			fields[field] = text
+		}
+	}
+	for _, field := range offeringStaffingFields {
+		if value, ok := update[field]; ok {
+			fields[field] = value
+		}
+	}
+	return fields, nil
+}
+
+// parseObjectIDs reads a JSON array of hex IDs, dropping repeats. null is an
+// empty list.
+func parseObjectIDs(raw interface{}) ([]primitive.ObjectID, error) {
+	ids := []primitive.ObjectID{}
+	if raw == nil {
+		return ids, nil
+	}
+	values, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array of IDs")
+	}
+	seen := map[primitive.ObjectID]bool{}
+	for _, value := range values {
+		text, _ := value.(string)
+		id, err := primitive.ObjectIDFromHex(text)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// validateSchoolStudents checks that every student is one of the school's.
+func validateSchoolStudents(ctx context.Context, studentIDs []primitive.ObjectID, schoolID primitive.ObjectID) error {
+	if len(studentIDs) == 0 {
+		return nil
+	}
+	count, err := database.GetCollection("students").CountDocuments(ctx, bson.M{
+		"_id":       bson.M{"$in": studentIDs},
+		"school_id": schoolID,
+	})
+	if err != nil {
+		return err
+	}
+	if int(count) != len(studentIDs) {
+		return fiber.NewError(fiber.StatusBadRequest, "One or more students were not found in the school")
+	}
+	return nil
+}
+
+// offeringStaffingFields decide who teaches an offering and to whom.
+// Grading, homework and the diary follow them, so changing them needs
+// grade:manage.
+var offeringStaffingFields = []string{"teacher_id", "class_id", "term_id", "student_ids", "subject_id"}
+
+// checkOfferingUpdate lets staff with grade:manage change any offering, and
+// teachers only the details of their own.
+func checkOfferingUpdate(principal *middleware.Principal, current *model.SchoolSubject, update map[string]interface{}) error {
+	if principal == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
+	}
+	if principal.Can(middleware.PermGradeManage) {
+		return nil
+	}
+	for _, field := range offeringStaffingFields {
+		if _, ok := update[field]; ok {
+			return fiber.NewError(fiber.StatusForbidden, "Only school administrators can change the "+field+" of a subject")
+		}
+	}
+	if principal.TeacherID.IsZero() || current.TeacherID != principal.TeacherID {
+		return fiber.NewError(fiber.StatusForbidden, "You can only update subjects you teach")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckOfferingUpdate(t *testing.T) {
+	owner := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	offering := &model.SchoolSubject{ID: primitive.NewObjectID(), TeacherID: owner}
+
+	teacher := func(id primitive.ObjectID) *middleware.Principal {
+		return &middleware.Principal{Role: model.RoleTeacher, TeacherID: id}
+	}
+	admin := &middleware.Principal{Role: model.RoleSchoolAdmin}
+
+	tests := []struct {
+		name      string
+		principal *middleware.Principal
+		update    map[string]interface{}
+		status    int // 0 when allowed
+	}{
+		{"other teacher takes over", teacher(other), map[string]interface{}{"teacher_id": other.Hex()}, fiber.StatusForbidden},
+		{"other teacher moves class", teacher(other), map[string]interface{}{"class_id": primitive.NewObjectID().Hex()}, fiber.StatusForbidden},
+		{"other teacher edits details", teacher(other), map[string]interface{}{"description": "x"}, fiber.StatusForbidden},
+		{"owner hands offering over", teacher(owner), map[string]interface{}{"teacher_id": other.Hex()}, fiber.StatusForbidden},
+		{"owner changes roster", teacher(owner), map[string]interface{}{"student_ids": []interface{}{}}, fiber.StatusForbidden},
+		{"owner changes term", teacher(owner), map[string]interface{}{"term_id": ""}, fiber.StatusForbidden},
+		{"owner edits details", teacher(owner), map[string]interface{}{"description": "x"}, 0},
+		{"admin reassigns", admin, map[string]interface{}{"teacher_id": other.Hex()}, 0},
+		{"no principal", nil, map[string]interface{}{"description": "x"}, fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOfferingUpdate(tt.principal, offering, tt.update)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("expected update to be allowed, got %v", err)
+				}
+				return
+			}
+			fiberErr, ok := err.(*fiber.Error)
+			if !ok || fiberErr.Code != tt.status {
+				t.Fatalf("expected status %d, got %v", tt.status, err)
+			}
+		})
+	}
+}
+
+func TestOfferingUpdateFields(t *testing.T) {
+	teacher := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name   string
+		update map[string]interface{}
+		want   []string // fields kept, nil when rejected
+	}{
+		{"details", map[string]interface{}{"description": "x", "status": "Inactive"}, []string{"description", "status"}},
+		{"staffing", map[string]interface{}{"teacher_id": teacher, "student_ids": []interface{}{}}, []string{"teacher_id", "student_ids"}},
+		{"fixed fields dropped", map[string]interface{}{"academic_year_id": teacher, "name": "x", "created_at": "x", "description": "x"}, []string{"description"}},
+		{"operators dropped", map[string]interface{}{"$where": "x", "grade": "5"}, []string{}},
+		{"non-string status", map[string]interface{}{"status": 1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := offeringUpdateFields(tt.update)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected the update to be rejected, got %v", fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(fields) != len(tt.want) {
+				t.Fatalf("expected fields %v, got %v", tt.want, fields)
+			}
+			for _, field := range tt.want {
+				if _, ok := fields[field]; !ok {
+					t.Fatalf("expected %s to be kept, got %v", field, fields)
+				}
+			}
+		})
+	}
+}
+
+func TestParseObjectIDs(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name string
+		raw  interface{}
+		want []primitive.ObjectID // nil when rejected
+	}{
+		{"null", nil, []primitive.ObjectID{}},
+		{"ids", []interface{}{a.Hex(), b.Hex()}, []primitive.ObjectID{a, b}},
+		{"repeats", []interface{}{a.Hex(), a.Hex()}, []primitive.ObjectID{a}},
+		{"not an array", a.Hex(), nil},
+		{"bad id", []interface{}{"nope"}, nil},
+		{"non-string id", []interface{}{42}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := parseObjectIDs(tt.raw)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", ids)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, ids)
+				}
+			}
+		})
+	}
+}
@@ -3,10 +3,12 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"strconv"
 	"time"
 
 	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
 	"github.com/ReddIndiann/go-messanger/model"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -32,56 +34,24 @@ func RegisterTeacher() fiber.Handler {
 			})
 		}
 
-		// Validate required fields
-		if teacher.FirstName == "" || teacher.LastName == "" || teacher.Email == "" ||
-			teacher.Phone == "" || teacher.SchoolID.IsZero() {
+		if err := checkTeacherRequired(&teacher); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "First name, last name, email, phone, and school ID are required",
+				"error": err.Error(),
 			})
 		}
 
-		// Check if school exists
-		schoolCollection := database.GetCollection("schools")
-		schoolResult := schoolCollection.FindOne(context.Background(), bson.M{"_id": teacher.SchoolID})
-		if schoolResult.Err() == mongo.ErrNoDocuments {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "School not found with the provided ID",
+		if !middleware.CanAccessSchool(c, teacher.SchoolID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this school",
 			})
 		}
 
-		// Check if teacher with same email already exists
-		collection := database.GetCollection("teachers")
-		existingTeacher := collection.FindOne(context.Background(), bson.M{"email": teacher.Email})
-		if existingTeacher.Err() == nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Teacher with this email already exists",
-			})
+		if err := validateTeacherRecord(context.Background(), &teacher); err != nil {
+			return checkError(c, err, "Failed to check teacher")
 		}
 
-		// Create new teacher document
-		newTeacher := model.Teacher{
-			ID:               primitive.NewObjectID(),
-			SchoolID:         teacher.SchoolID,
-			FirstName:        teacher.FirstName,
-			LastName:         teacher.LastName,
-			Email:            teacher.Email,
-			Phone:            teacher.Phone,
-			DateOfBirth:      teacher.DateOfBirth,
-			Gender:           teacher.Gender,
-			Address:          teacher.Address,
-			Qualifications:   teacher.Qualifications,
-			SubjectIDs:       teacher.SubjectIDs,
-			DepartmentID:     teacher.DepartmentID,
-			GradeLevels:      teacher.GradeLevels,
-			Designation:      teacher.Designation,
-			JoiningDate:      time.Now(), // Set joining date to current time
-			Experience:       teacher.Experience,
-			Salary:           teacher.Salary,
-			Status:           "Active", // Default status
-			EmergencyContact: teacher.EmergencyContact,
-			CreatedAt:        time.Now(),
-			UpdatedAt:        time.Now(),
-		}
+		collection := database.GetCollection("teachers")
+		newTeacher := newTeacherRecord(teacher)
 
 		// Insert the new teacher
 		result, err := collection.InsertOne(c.Context(), newTeacher)
@@ -91,11 +61,26 @@ func RegisterTeacher() fiber.Handler {
 			})
 		}
 
+		// The account is created when the invitation is accepted
+		var invitationID interface{}
+		if c.Query("invite") != "false" {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			invitation, err := inviteRecord(ctx, inviterOf(c), model.RoleTeacher, newTeacher.Email,
+				newTeacher.FirstName+" "+newTeacher.LastName, newTeacher.SchoolID, newTeacher.ID)
+			if err != nil {
+				log.Printf("Error inviting teacher %s: %v\n", newTeacher.ID.Hex(), err)
+			} else {
+				invitationID = invitation.ID
+			}
+		}
+
 		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-			"status":    "success",
-			"message":   "Teacher registered successfully",
-			"teacherId": result.InsertedID,
-			"info":      newTeacher,
+			"status":       "success",
+			"message":      "Teacher registered successfully",
+			"teacherId":    result.InsertedID,
+			"invitationId": invitationID,
+			"info":         newTeacher,
 		})
 	}
 }
@@ -112,7 +97,7 @@ func GetAllTeachers() fiber.Handler {
 		skip := (page - 1) * limit
 
 		// Optional: Add filtering
-		filter := bson.M{}
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
 		if search := c.Query("search"); search != "" {
 			filter["$or"] = []bson.M{
 				{"first_name": bson.M{"$regex": search, "$options": "i"}},
@@ -181,7 +166,7 @@ func GetTeacherByID() fiber.Handler {
 		defer cancel()
 
 		var teacher model.Teacher
-		err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&teacher)
+		err = collection.FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")).Decode(&teacher)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -217,7 +202,7 @@ func UpdateTeacher() fiber.Handler {
 		defer cancel()
 
 		var existingTeacher model.Teacher
-		err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&existingTeacher)
+		err = collection.FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id")).Decode(&existingTeacher)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -273,10 +258,44 @@ func UpdateTeacher() fiber.Handler {
 			setMap["qualifications"] = updateData["qualifications"]
 		}
 		if fieldExists("subject_ids") {
-			setMap["subject_ids"] = updateData["subject_ids"]
+			rawIDs, ok := updateData["subject_ids"].([]interface{})
+			if !ok {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "subject_ids must be an array of subject IDs",
+				})
+			}
+			subjectIDs := make([]primitive.ObjectID, 0, len(rawIDs))
+			for _, raw := range rawIDs {
+				idStr, _ := raw.(string)
+				subjectID, err := primitive.ObjectIDFromHex(idStr)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid subject ID format",
+					})
+				}
+				subjectIDs = append(subjectIDs, subjectID)
+			}
+			if err := validateTeacherSubjects(ctx, subjectIDs, existingTeacher.SchoolID); err != nil {
+				return checkError(c, err, "Error checking subjects")
+			}
+			setMap["subject_ids"] = subjectIDs
 		}
 		if fieldExists("department_id") {
-			setMap["department_id"] = updateData["department_id"]
+			departmentID, _ := updateData["department_id"].(string)
+			if departmentID == "" {
+				setMap["department_id"] = primitive.NilObjectID
+			} else {
+				departmentObjID, err := primitive.ObjectIDFromHex(departmentID)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid department ID format",
+					})
+				}
+				if err := validateTeacherDepartment(ctx, departmentObjID, existingTeacher.SchoolID); err != nil {
+					return checkError(c, err, "Error checking department")
+				}
+				setMap["department_id"] = departmentObjID
+			}
 		}
 		if fieldExists("grade_levels") {
 			setMap["grade_levels"] = updateData["grade_levels"]
@@ -348,7 +367,7 @@ func DeleteTeacher() fiber.Handler {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID})
+		result, err := collection.DeleteOne(ctx, middleware.TenantFilter(c, bson.M{"_id": objectID}, "school_id"))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Error deleting teacher",
@@ -361,9 +380,89 @@ func DeleteTeacher() fiber.Handler {
 			})
 		}
 
+		// Departments the teacher headed are left without a head
+		_, err = database.GetCollection("departments").UpdateMany(ctx,
+			bson.M{"head_id": objectID},
+			bson.M{"$set": bson.M{"head_id": primitive.NilObjectID, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Teacher deleted, but clearing the departments they headed failed",
+			})
+		}
+
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"status":  "success",
 			"message": "Teacher deleted successfully",
 		})
 	}
 }
+
+// checkTeacherRequired checks the fields every teacher must have.
+func checkTeacherRequired(teacher *model.Teacher) error {
+	if teacher.FirstName == "" || teacher.LastName == "" || teacher.Email == "" ||
+		teacher.Phone == "" || teacher.SchoolID.IsZero() {
+		return fiber.NewError(fiber.StatusBadRequest, "First name, last name, email, phone, and school ID are required")
+	}
+	return nil
+}
+
+// validateTeacherRecord checks a new teacher against the school's data: the
+// school exists, no teacher has the email yet, and the department and
+// subjects are the school's.
+func validateTeacherRecord(ctx context.Context, teacher *model.Teacher) error {
+	// Check if school exists
+	err := database.GetCollection("schools").FindOne(ctx, bson.M{"_id": teacher.SchoolID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusBadRequest, "School not found with the provided ID")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Check if teacher with same email already exists
+	err = database.GetCollection("teachers").FindOne(ctx, bson.M{"email": teacher.Email}).Err()
+	if err == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Teacher with this email already exists")
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if !teacher.DepartmentID.IsZero() {
+		if err := validateTeacherDepartment(ctx, teacher.DepartmentID, teacher.SchoolID); err != nil {
+			return err
+		}
+	}
+	return validateTeacherSubjects(ctx, teacher.SubjectIDs, teacher.SchoolID)
+}
+
+// newTeacherRecord is the document a registered teacher is stored as.
+func newTeacherRecord(teacher model.Teacher) model.Teacher {
+	if teacher.SubjectIDs == nil {
+		teacher.SubjectIDs = []primitive.ObjectID{}
+	}
+	return model.Teacher{
+		ID:               primitive.NewObjectID(),
+		SchoolID:         teacher.SchoolID,
+		FirstName:        teacher.FirstName,
+		LastName:         teacher.LastName,
+		Email:            teacher.Email,
+		Phone:            teacher.Phone,
+		DateOfBirth:      teacher.DateOfBirth,
+		Gender:           teacher.Gender,
+		Address:          teacher.Address,
+		Qualifications:   teacher.Qualifications,
+		SubjectIDs:       teacher.SubjectIDs,
+		DepartmentID:     teacher.DepartmentID,
+		GradeLevels:      teacher.GradeLevels,
+		Designation:      teacher.Designation,
+		JoiningDate:      time.Now(), // Set joining date to current time
+		Experience:       teacher.Experience,
+		Salary:           teacher.Salary,
+		Status:           "Active", // Default status
+		EmergencyContact: teacher.EmergencyContact,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+}
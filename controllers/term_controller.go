@@ -0,0 +1,439 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateTerm() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body periodRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		if strings.TrimSpace(body.Name) == "" || body.AcademicYearID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Name, academic year ID, start date and end date are required",
+			})
+		}
+		startDate, endDate, err := body.dates()
+		if err != nil {
+			return checkError(c, err, "Invalid dates")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		year, err := findAcademicYear(ctx, c, body.AcademicYearID)
+		if err != nil {
+			return academicYearLookupError(c, err)
+		}
+		if year.Status == model.PeriodStatusClosed {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Academic year is closed",
+			})
+		}
+		if startDate.Before(year.StartDate) || endDate.After(year.EndDate) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Term must fall within its academic year",
+			})
+		}
+		if err := ensureNoPeriodOverlap(ctx, "terms", bson.M{"academic_year_id": year.ID}, primitive.NilObjectID, startDate, endDate); err != nil {
+			return checkError(c, err, "Error checking terms")
+		}
+
+		newTerm := model.Term{
+			ID:             primitive.NewObjectID(),
+			SchoolID:       year.SchoolID,
+			AcademicYearID: year.ID,
+			Name:           strings.TrimSpace(body.Name),
+			StartDate:      startDate,
+			EndDate:        endDate,
+			Status:         model.PeriodStatusOpen,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		}
+
+		// The unique (academic_year_id, name) index rejects duplicates
+		if _, err := database.GetCollection("terms").InsertOne(ctx, newTerm); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "A term with this name already exists in the academic year",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create term",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Term created successfully",
+			"termId":  newTerm.ID,
+			"info":    newTerm,
+		})
+	}
+}
+
+func ListTerms() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		if yearID := c.Query("academic_year_id"); yearID != "" {
+			yearObjID, err := primitive.ObjectIDFromHex(yearID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid academic year ID format",
+				})
+			}
+			filter["academic_year_id"] = yearObjID
+		}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: -1}})
+		cursor, err := database.GetCollection("terms").Find(ctx, filter, opts)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch terms",
+			})
+		}
+		defer cursor.Close(ctx)
+
+		terms := []model.Term{}
+		if err := cursor.All(ctx, &terms); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to decode terms",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"terms":  terms,
+		})
+	}
+}
+
+func GetTerm() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		term, err := findTerm(ctx, c, objectID)
+		if err != nil {
+			return termLookupError(c, err)
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"term":   term,
+		})
+	}
+}
+
+func UpdateTerm() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		existingTerm, err := findTerm(ctx, c, objectID)
+		if err != nil {
+			return termLookupError(c, err)
+		}
+		if err := ensurePeriodOpen(ctx, existingTerm.AcademicYearID, existingTerm.ID); err != nil {
+			return checkError(c, err, "Error checking term")
+		}
+
+		var updateData map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &updateData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		setMap := bson.M{}
+		if name, ok := updateData["name"].(string); ok && strings.TrimSpace(name) != "" {
+			setMap["name"] = strings.TrimSpace(name)
+		}
+
+		startDate, endDate, err := updatedPeriodDates(updateData, existingTerm.StartDate, existingTerm.EndDate)
+		if err != nil {
+			return checkError(c, err, "Invalid dates")
+		}
+		if !startDate.Equal(existingTerm.StartDate) || !endDate.Equal(existingTerm.EndDate) {
+			var year model.AcademicYear
+			if err := database.GetCollection("academic_years").FindOne(ctx, bson.M{"_id": existingTerm.AcademicYearID}).Decode(&year); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Error fetching academic year",
+				})
+			}
+			if startDate.Before(year.StartDate) || endDate.After(year.EndDate) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Term must fall within its academic year",
+				})
+			}
+			if err := ensureNoPeriodOverlap(ctx, "terms", bson.M{"academic_year_id": year.ID}, objectID, startDate, endDate); err != nil {
+				return checkError(c, err, "Error checking terms")
+			}
+			setMap["start_date"] = startDate
+			setMap["end_date"] = endDate
+		}
+		setMap["updated_at"] = time.Now()
+
+		var updatedTerm model.Term
+		err = database.GetCollection("terms").FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": setMap},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedTerm)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "A term with this name already exists in the academic year",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating term",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Term updated successfully",
+			"term":    updatedTerm,
+		})
+	}
+}
+
+// DeleteTerm refuses to delete a term that subject offerings still belong to.
+func DeleteTerm() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findTerm(ctx, c, objectID); err != nil {
+			return termLookupError(c, err)
+		}
+
+		offerings, err := database.GetCollection("subjects").CountDocuments(ctx, bson.M{"term_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting subject offerings",
+			})
+		}
+		sessions, err := database.GetCollection("attendance_sessions").CountDocuments(ctx, bson.M{"term_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting attendance sessions",
+			})
+		}
+		assessments, err := database.GetCollection("assessments").CountDocuments(ctx, bson.M{"term_id": objectID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error counting assessments",
+			})
+		}
+		if offerings > 0 || sessions > 0 || assessments > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":              "Term still has subject offerings, attendance or assessments",
+				"offerings":          offerings,
+				"attendanceSessions": sessions,
+				"assessments":        assessments,
+			})
+		}
+
+		if _, err := database.GetCollection("terms").DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting term",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Term deleted successfully",
+		})
+	}
+}
+
+// SetCurrentTerm makes the term, and its academic year, the school's current ones.
+func SetCurrentTerm() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		term, err := findTerm(ctx, c, objectID)
+		if err != nil {
+			return termLookupError(c, err)
+		}
+		if term.Status == model.PeriodStatusClosed {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A closed term cannot be made current",
+			})
+		}
+
+		if err := setCurrentPeriod(ctx, "terms", term.SchoolID, objectID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error setting current term",
+			})
+		}
+		if err := setCurrentPeriod(ctx, "academic_years", term.SchoolID, term.AcademicYearID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error setting current academic year",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Term is now current",
+		})
+	}
+}
+
+// CloseTerm locks the term's records against edits.
+func CloseTerm() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findTerm(ctx, c, objectID); err != nil {
+			return termLookupError(c, err)
+		}
+
+		_, err = database.GetCollection("terms").UpdateOne(ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": bson.M{"status": model.PeriodStatusClosed, "is_current": false, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error closing term",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Term closed successfully",
+		})
+	}
+}
+
+func ReopenTerm() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		term, err := findTerm(ctx, c, objectID)
+		if err != nil {
+			return termLookupError(c, err)
+		}
+		if err := ensurePeriodOpen(ctx, term.AcademicYearID, primitive.NilObjectID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		_, err = database.GetCollection("terms").UpdateOne(ctx,
+			bson.M{"_id": objectID},
+			bson.M{"$set": bson.M{"status": model.PeriodStatusOpen, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error reopening term",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Term reopened successfully",
+		})
+	}
+}
+
+// findTerm loads a term the caller's schools can see.
+func findTerm(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Term, error) {
+	var term model.Term
+	err := database.GetCollection("terms").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&term)
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+func termLookupError(c *fiber.Ctx, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Term not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Error fetching term",
+	})
+}
+
+// validateYearTerm checks that a term belongs to the academic year.
+func validateYearTerm(ctx context.Context, termID primitive.ObjectID, yearID primitive.ObjectID) error {
+	err := database.GetCollection("terms").FindOne(ctx, bson.M{"_id": termID, "academic_year_id": yearID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return fiber.NewError(fiber.StatusBadRequest, "Term not found in the academic year")
+	}
+	return err
+}
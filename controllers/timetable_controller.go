@@ -0,0 +1,945 @@
+package controllers
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var weekdays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+type slotRequest struct {
+	SubjectID primitive.ObjectID `json:"subject_id"`
+	Day       int                `json:"day"`
+	Period    int                `json:"period"`
+	StartTime string             `json:"start_time"`
+	EndTime   string             `json:"end_time"`
+	Room      string             `json:"room"`
+}
+
+// slotConflict is an existing slot that clashes with a proposed one.
+type slotConflict struct {
+	Reasons []string            `json:"reasons"` // teacher, room, class or subject
+	Slot    model.TimetableSlot `json:"slot"`
+}
+
+// timetableEntry is a slot with the names a timetable displays.
+type timetableEntry struct {
+	model.TimetableSlot
+	SubjectName string `json:"subject_name"`
+	SubjectCode string `json:"subject_code"`
+	ClassName   string `json:"class_name"`
+	TeacherName string `json:"teacher_name"`
+}
+
+// CreateTimetableSlot schedules a weekly lesson of an offering. It is
+// refused with the clashing slots when the teacher, room or class is
+// already busy at that time.
+func CreateTimetableSlot() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body slotRequest
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+		if body.SubjectID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Subject ID is required",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		offering, err := findOffering(ctx, c, body.SubjectID)
+		if err != nil {
+			return offeringLookupError(c, err)
+		}
+		if err := ensurePeriodOpen(ctx, offering.AcademicYearID, offering.TermID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		now := time.Now()
+		slot := model.TimetableSlot{
+			ID:        primitive.NewObjectID(),
+			Day:       body.Day,
+			Period:    body.Period,
+			StartTime: body.StartTime,
+			EndTime:   body.EndTime,
+			Room:      strings.TrimSpace(body.Room),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		applyOffering(&slot, offering)
+		if err := validateSlot(&slot); err != nil {
+			return checkError(c, err, "Invalid slot")
+		}
+
+		conflicts, err := slotConflicts(ctx, slot)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error checking timetable conflicts",
+			})
+		}
+		if len(conflicts) > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":     "The slot clashes with the timetable",
+				"conflicts": conflicts,
+			})
+		}
+
+		if _, err := database.GetCollection("timetable_slots").InsertOne(ctx, slot); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create timetable slot",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status":  "success",
+			"message": "Timetable slot created successfully",
+			"slotId":  slot.ID,
+			"slot":    slot,
+		})
+	}
+}
+
+// ListTimetableSlots filters by ?subject_id=, ?class_id=, ?teacher_id=,
+// ?academic_year_id=, ?day= and ?room=.
+func ListTimetableSlots() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := middleware.TenantFilter(c, bson.M{}, "school_id")
+		for _, field := range []string{"subject_id", "class_id", "teacher_id", "academic_year_id"} {
+			if value := c.Query(field); value != "" {
+				id, err := primitive.ObjectIDFromHex(value)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": "Invalid " + field + " format",
+					})
+				}
+				filter[field] = id
+			}
+		}
+		if day := c.QueryInt("day"); day != 0 {
+			filter["day"] = day
+		}
+		if room := c.Query("room"); room != "" {
+			filter["room_key"] = roomKey(room)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		slots, err := findSlots(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch timetable slots",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"slots":  slots,
+		})
+	}
+}
+
+func GetTimetableSlot() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		slot, err := findSlot(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching timetable slot")
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"slot":   slot,
+		})
+	}
+}
+
+// UpdateTimetableSlot moves a slot to another day, time or room. The
+// offering is fixed; delete the slot and create another to change it.
+func UpdateTimetableSlot() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		var body struct {
+			Day       *int    `json:"day"`
+			Period    *int    `json:"period"`
+			StartTime *string `json:"start_time"`
+			EndTime   *string `json:"end_time"`
+			Room      *string `json:"room"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		slot, err := findSlot(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching timetable slot")
+		}
+		if err := ensurePeriodOpen(ctx, slot.AcademicYearID, slot.TermID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+
+		if body.Day != nil {
+			slot.Day = *body.Day
+		}
+		if body.Period != nil {
+			slot.Period = *body.Period
+		}
+		if body.StartTime != nil {
+			slot.StartTime = *body.StartTime
+		}
+		if body.EndTime != nil {
+			slot.EndTime = *body.EndTime
+		}
+		if body.Room != nil {
+			slot.Room = strings.TrimSpace(*body.Room)
+		}
+		if err := validateSlot(slot); err != nil {
+			return checkError(c, err, "Invalid slot")
+		}
+
+		conflicts, err := slotConflicts(ctx, *slot)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error checking timetable conflicts",
+			})
+		}
+		if len(conflicts) > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":     "The slot clashes with the timetable",
+				"conflicts": conflicts,
+			})
+		}
+
+		slot.UpdatedAt = time.Now()
+		_, err = database.GetCollection("timetable_slots").UpdateOne(ctx, bson.M{"_id": slot.ID}, bson.M{"$set": bson.M{
+			"day":        slot.Day,
+			"period":     slot.Period,
+			"start_time": slot.StartTime,
+			"end_time":   slot.EndTime,
+			"room":       slot.Room,
+			"room_key":   slot.RoomKey,
+			"updated_at": slot.UpdatedAt,
+		}})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error updating timetable slot",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Timetable slot updated successfully",
+			"slot":    slot,
+		})
+	}
+}
+
+func DeleteTimetableSlot() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		slot, err := findSlot(ctx, c, objectID)
+		if err != nil {
+			return checkError(c, err, "Error fetching timetable slot")
+		}
+		if err := ensurePeriodOpen(ctx, slot.AcademicYearID, slot.TermID); err != nil {
+			return checkError(c, err, "Error checking academic year")
+		}
+		if _, err := database.GetCollection("timetable_slots").DeleteOne(ctx, bson.M{"_id": slot.ID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error deleting timetable slot",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Timetable slot deleted successfully",
+		})
+	}
+}
+
+// ClassTimetable returns the week of a class.
+func ClassTimetable() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		classID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		class, err := findClass(ctx, c, classID)
+		if err != nil {
+			return classLookupError(c, err)
+		}
+		filter := bson.M{"class_id": class.ID}
+		if err := timetableTermFilter(ctx, c, class.SchoolID, filter); err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+		return sendTimetable(ctx, c, filter)
+	}
+}
+
+// TeacherTimetable returns the week of a teacher in ?academic_year_id=,
+// defaulting to the school's current year.
+func TeacherTimetable() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		teacherID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		teacher, err := findTimetableTeacher(ctx, c, teacherID)
+		if err != nil {
+			return checkError(c, err, "Error fetching teacher")
+		}
+		filter := bson.M{"teacher_id": teacher.ID}
+		if err := timetableYearFilter(ctx, c, teacher.SchoolID, filter); err != nil {
+			return checkError(c, err, "Error fetching academic year")
+		}
+		if err := timetableTermFilter(ctx, c, teacher.SchoolID, filter); err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+		return sendTimetable(ctx, c, filter)
+	}
+}
+
+// RoomTimetable returns the week of a room of the school in ?school_id=,
+// required for platform admins, in ?academic_year_id= or the current year.
+func RoomTimetable() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		room, err := url.PathUnescape(c.Params("room"))
+		if err != nil || strings.TrimSpace(room) == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid room",
+			})
+		}
+
+		schoolID, err := timetableSchool(c)
+		if err != nil {
+			return checkError(c, err, "Invalid school")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := bson.M{"school_id": schoolID, "room_key": roomKey(room)}
+		if err := timetableYearFilter(ctx, c, schoolID, filter); err != nil {
+			return checkError(c, err, "Error fetching academic year")
+		}
+		if err := timetableTermFilter(ctx, c, schoolID, filter); err != nil {
+			return checkError(c, err, "Error fetching term")
+		}
+		return sendTimetable(ctx, c, filter)
+	}
+}
+
+// TeacherCalendarLink returns the URL of a teacher's iCalendar feed. The URL
+// carries its own token so calendar apps can subscribe without logging in.
+func TeacherCalendarLink() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		teacherID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findTimetableTeacher(ctx, c, teacherID); err != nil {
+			return checkError(c, err, "Error fetching teacher")
+		}
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"url":    calendarURL(c, "teachers", teacherID),
+		})
+	}
+}
+
+func ClassCalendarLink() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		classID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid ID format",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := findClass(ctx, c, classID); err != nil {
+			return classLookupError(c, err)
+		}
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"url":    calendarURL(c, "classes", classID),
+		})
+	}
+}
+
+// TeacherCalendar serves a teacher's current-year lessons as iCalendar. It
+// is authenticated by the ?token= of TeacherCalendarLink.
+func TeacherCalendar() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		teacherID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil || !helpers.VerifyCalendarToken("teachers:"+teacherID.Hex(), c.Query("token")) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Calendar not found",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var teacher model.Teacher
+		if err := database.GetCollection("teachers").FindOne(ctx, bson.M{"_id": teacherID}).Decode(&teacher); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Calendar not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching teacher",
+			})
+		}
+		filter := bson.M{"teacher_id": teacher.ID}
+		if err := timetableYearFilter(ctx, c, teacher.SchoolID, filter); err != nil {
+			return checkError(c, err, "Error fetching academic year")
+		}
+		name := strings.TrimSpace(teacher.FirstName+" "+teacher.LastName) + " - Timetable"
+		return sendCalendar(ctx, c, name, filter, true)
+	}
+}
+
+// ClassCalendar serves a class's lessons as iCalendar.
+func ClassCalendar() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		classID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil || !helpers.VerifyCalendarToken("classes:"+classID.Hex(), c.Query("token")) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Calendar not found",
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var class model.Class
+		if err := database.GetCollection("classes").FindOne(ctx, bson.M{"_id": classID}).Decode(&class); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Calendar not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching class",
+			})
+		}
+		return sendCalendar(ctx, c, class.Name+" - Timetable", bson.M{"class_id": class.ID}, false)
+	}
+}
+
+func sendTimetable(ctx context.Context, c *fiber.Ctx, filter bson.M) error {
+	slots, err := findSlots(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error fetching timetable",
+		})
+	}
+	entries, err := describeSlots(ctx, slots)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error fetching timetable",
+		})
+	}
+
+	days := make([]fiber.Map, 0, len(weekdays))
+	for i, name := range weekdays {
+		daySlots := []timetableEntry{}
+		for _, entry := range entries {
+			if entry.Day == i+1 {
+				daySlots = append(daySlots, entry)
+			}
+		}
+		days = append(days, fiber.Map{
+			"day":   i + 1,
+			"name":  name,
+			"slots": daySlots,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"days":   days,
+	})
+}
+
+func sendCalendar(ctx context.Context, c *fiber.Ctx, name string, filter bson.M, withClass bool) error {
+	slots, err := findSlots(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error fetching timetable",
+		})
+	}
+	entries, err := describeSlots(ctx, slots)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error fetching timetable",
+		})
+	}
+
+	windows := slotWindowCache{}
+	events := []helpers.CalendarEvent{}
+	for _, entry := range entries {
+		periods, err := windows.get(ctx, entry.TimetableSlot)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Error fetching terms",
+			})
+		}
+		summary := entry.SubjectName
+		if withClass && entry.ClassName != "" {
+			summary += " - " + entry.ClassName
+		}
+		for _, period := range periods {
+			first := firstWeekday(period.start, entry.Day)
+			if first.After(period.end) {
+				continue
+			}
+			events = append(events, helpers.CalendarEvent{
+				UID:         entry.ID.Hex() + "-" + period.id.Hex() + "@go-messanger",
+				Summary:     summary,
+				Description: entry.TeacherName,
+				Location:    entry.Room,
+				Start:       atClock(first, entry.StartTime),
+				End:         atClock(first, entry.EndTime),
+				Until:       period.end.Add(24*time.Hour - time.Second),
+			})
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="timetable.ics"`)
+	return helpers.WriteCalendar(c.Response().BodyWriter(), name, events)
+}
+
+// slotConflicts returns the slots of the same academic year that overlap
+// slot in time and share its teacher, room, class or offering. Slots of
+// other terms never clash; a year-long slot clashes with every term.
+func slotConflicts(ctx context.Context, slot model.TimetableSlot) ([]slotConflict, error) {
+	shared := bson.A{bson.M{"subject_id": slot.SubjectID}}
+	if !slot.TeacherID.IsZero() {
+		shared = append(shared, bson.M{"teacher_id": slot.TeacherID})
+	}
+	if !slot.ClassID.IsZero() {
+		shared = append(shared, bson.M{"class_id": slot.ClassID})
+	}
+	if slot.RoomKey != "" {
+		shared = append(shared, bson.M{"room_key": slot.RoomKey})
+	}
+	filter := bson.M{
+		"_id":              bson.M{"$ne": slot.ID},
+		"academic_year_id": slot.AcademicYearID,
+		"day":              slot.Day,
+		"start_time":       bson.M{"$lt": slot.EndTime},
+		"end_time":         bson.M{"$gt": slot.StartTime},
+		"$or":              shared,
+	}
+	if !slot.TermID.IsZero() {
+		filter["term_id"] = bson.M{"$in": bson.A{slot.TermID, primitive.NilObjectID}}
+	}
+
+	others, err := findSlots(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := []slotConflict{}
+	for _, other := range others {
+		if reasons := slotClashes(slot, other); len(reasons) > 0 {
+			conflicts = append(conflicts, slotConflict{Slot: other, Reasons: reasons})
+		}
+	}
+	return conflicts, nil
+}
+
+// slotClashes returns what two slots share when they overlap in time, by
+// the rules slotConflicts queries with, or nil when they do not clash.
+func slotClashes(slot, other model.TimetableSlot) []string {
+	if other.ID == slot.ID || other.AcademicYearID != slot.AcademicYearID || other.Day != slot.Day {
+		return nil
+	}
+	if other.StartTime >= slot.EndTime || other.EndTime <= slot.StartTime {
+		return nil
+	}
+	if !slot.TermID.IsZero() && !other.TermID.IsZero() && other.TermID != slot.TermID {
+		return nil
+	}
+	var reasons []string
+	if !slot.TeacherID.IsZero() && other.TeacherID == slot.TeacherID {
+		reasons = append(reasons, "teacher")
+	}
+	if slot.RoomKey != "" && other.RoomKey == slot.RoomKey {
+		reasons = append(reasons, "room")
+	}
+	if !slot.ClassID.IsZero() && other.ClassID == slot.ClassID {
+		reasons = append(reasons, "class")
+	}
+	if other.SubjectID == slot.SubjectID {
+		reasons = append(reasons, "subject")
+	}
+	return reasons
+}
+
+// offeringSlotConflicts checks the offering's slots still fit the
+// timetable with its new class, teacher or term.
+func offeringSlotConflicts(ctx context.Context, offering *model.SchoolSubject) ([]slotConflict, error) {
+	slots, err := findSlots(ctx, bson.M{"subject_id": offering.ID})
+	if err != nil {
+		return nil, err
+	}
+	conflicts := []slotConflict{}
+	for _, slot := range slots {
+		applyOffering(&slot, offering)
+		found, err := slotConflicts(ctx, slot)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, found...)
+	}
+	return conflicts, nil
+}
+
+// syncOfferingSlots copies the offering's class, teacher and term onto its slots.
+func syncOfferingSlots(ctx context.Context, offering *model.SchoolSubject) error {
+	_, err := database.GetCollection("timetable_slots").UpdateMany(ctx, bson.M{"subject_id": offering.ID}, bson.M{"$set": bson.M{
+		"class_id":   offering.ClassID,
+		"teacher_id": offering.TeacherID,
+		"term_id":    offering.TermID,
+		"updated_at": time.Now(),
+	}})
+	return err
+}
+
+func applyOffering(slot *model.TimetableSlot, offering *model.SchoolSubject) {
+	slot.SchoolID = offering.SchoolID
+	slot.SubjectID = offering.ID
+	slot.ClassID = offering.ClassID
+	slot.TeacherID = offering.TeacherID
+	slot.AcademicYearID = offering.AcademicYearID
+	slot.TermID = offering.TermID
+}
+
+// validateSlot checks the day and times, normalizing them to "HH:MM".
+func validateSlot(slot *model.TimetableSlot) error {
+	if slot.Day < 1 || slot.Day > 7 {
+		return fiber.NewError(fiber.StatusBadRequest, "Day must be 1 (Monday) to 7 (Sunday)")
+	}
+	if slot.Period < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Period cannot be negative")
+	}
+	start, err := time.Parse("15:04", slot.StartTime)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid start_time, use HH:MM")
+	}
+	end, err := time.Parse("15:04", slot.EndTime)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid end_time, use HH:MM")
+	}
+	if !start.Before(end) {
+		return fiber.NewError(fiber.StatusBadRequest, "start_time must be before end_time")
+	}
+	// Zero-padded times compare correctly as strings in queries
+	slot.StartTime = start.Format("15:04")
+	slot.EndTime = end.Format("15:04")
+	slot.RoomKey = roomKey(slot.Room)
+	return nil
+}
+
+func roomKey(room string) string {
+	return strings.ToLower(strings.Join(strings.Fields(room), " "))
+}
+
+func findSlots(ctx context.Context, filter bson.M) ([]model.TimetableSlot, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "day", Value: 1}, {Key: "start_time", Value: 1}})
+	cursor, err := database.GetCollection("timetable_slots").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	slots := []model.TimetableSlot{}
+	if err := cursor.All(ctx, &slots); err != nil {
+		return nil, err
+	}
+	return slots, nil
+}
+
+func findSlot(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.TimetableSlot, error) {
+	var slot model.TimetableSlot
+	err := database.GetCollection("timetable_slots").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&slot)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Timetable slot not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+func findTimetableTeacher(ctx context.Context, c *fiber.Ctx, id primitive.ObjectID) (*model.Teacher, error) {
+	var teacher model.Teacher
+	err := database.GetCollection("teachers").
+		FindOne(ctx, middleware.TenantFilter(c, bson.M{"_id": id}, "school_id")).
+		Decode(&teacher)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Teacher not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &teacher, nil
+}
+
+// describeSlots adds the offering, class and teacher names to slots.
+func describeSlots(ctx context.Context, slots []model.TimetableSlot) ([]timetableEntry, error) {
+	var offeringIDs, classIDs, teacherIDs []primitive.ObjectID
+	for _, slot := range slots {
+		offeringIDs = append(offeringIDs, slot.SubjectID)
+		classIDs = append(classIDs, slot.ClassID)
+		teacherIDs = append(teacherIDs, slot.TeacherID)
+	}
+
+	var offerings []model.SchoolSubject
+	var classes []model.Class
+	var teachers []model.Teacher
+	for _, lookup := range []struct {
+		collection string
+		ids        []primitive.ObjectID
+		out        interface{}
+	}{
+		{"subjects", offeringIDs, &offerings},
+		{"classes", classIDs, &classes},
+		{"teachers", teacherIDs, &teachers},
+	} {
+		if len(lookup.ids) == 0 {
+			continue
+		}
+		cursor, err := database.GetCollection(lookup.collection).Find(ctx, bson.M{"_id": bson.M{"$in": lookup.ids}})
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.All(ctx, lookup.out); err != nil {
+			return nil, err
+		}
+	}
+
+	offeringByID := map[primitive.ObjectID]model.SchoolSubject{}
+	for _, offering := range offerings {
+		offeringByID[offering.ID] = offering
+	}
+	classNames := map[primitive.ObjectID]string{}
+	for _, class := range classes {
+		classNames[class.ID] = class.Name
+	}
+	teacherNames := map[primitive.ObjectID]string{}
+	for _, teacher := range teachers {
+		teacherNames[teacher.ID] = strings.TrimSpace(teacher.FirstName + " " + teacher.LastName)
+	}
+
+	entries := make([]timetableEntry, 0, len(slots))
+	for _, slot := range slots {
+		offering := offeringByID[slot.SubjectID]
+		entries = append(entries, timetableEntry{
+			TimetableSlot: slot,
+			SubjectName:   offering.Name,
+			SubjectCode:   offering.Code,
+			ClassName:     classNames[slot.ClassID],
+			TeacherName:   teacherNames[slot.TeacherID],
+		})
+	}
+	return entries, nil
+}
+
+// timetableYearFilter narrows filter to ?academic_year_id=, or to the
+// school's current year.
+func timetableYearFilter(ctx context.Context, c *fiber.Ctx, schoolID primitive.ObjectID, filter bson.M) error {
+	yearID := primitive.NilObjectID
+	if value := c.Query("academic_year_id"); value != "" {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid academic year ID format")
+		}
+		yearID = id
+	}
+	year, err := resolveAcademicYear(ctx, schoolID, yearID)
+	if err != nil {
+		return err
+	}
+	filter["academic_year_id"] = year.ID
+	return nil
+}
+
+// timetableTermFilter narrows filter to the slots held in ?term_id=, which
+// includes the year-long ones.
+func timetableTermFilter(ctx context.Context, c *fiber.Ctx, schoolID primitive.ObjectID, filter bson.M) error {
+	value := c.Query("term_id")
+	if value == "" {
+		return nil
+	}
+	term, err := summaryTerm(ctx, c, schoolID)
+	if err != nil {
+		return err
+	}
+	filter["term_id"] = bson.M{"$in": bson.A{term.ID, primitive.NilObjectID}}
+	return nil
+}
+
+// timetableSchool returns the school a room view is for: ?school_id=, or
+// the caller's only school.
+func timetableSchool(c *fiber.Ctx) (primitive.ObjectID, error) {
+	if value := c.Query("school_id"); value != "" {
+		schoolID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return primitive.NilObjectID, fiber.NewError(fiber.StatusBadRequest, "Invalid school ID format")
+		}
+		if !middleware.CanAccessSchool(c, schoolID) {
+			return primitive.NilObjectID, fiber.NewError(fiber.StatusForbidden, "You do not have access to this school")
+		}
+		return schoolID, nil
+	}
+	principal := middleware.GetPrincipal(c)
+	if principal == nil || len(principal.SchoolIDs) != 1 {
+		return primitive.NilObjectID, fiber.NewError(fiber.StatusBadRequest, "school_id is required")
+	}
+	return principal.SchoolIDs[0], nil
+}
+
+func calendarURL(c *fiber.Ctx, feed string, id primitive.ObjectID) string {
+	return c.BaseURL() + "/timetable/calendar/" + feed + "/" + id.Hex() + ".ics?token=" +
+		helpers.CalendarToken(feed+":"+id.Hex())
+}
+
+// slotWindow is a span of dates a slot's lessons take place in.
+type slotWindow struct {
+	id         primitive.ObjectID // The term, or the year when it has no terms
+	start, end time.Time
+}
+
+// slotWindowCache finds when slots run: the offering's term, or every term
+// of its year, so that lessons skip the holidays between terms.
+type slotWindowCache map[primitive.ObjectID][]slotWindow
+
+func (cache slotWindowCache) get(ctx context.Context, slot model.TimetableSlot) ([]slotWindow, error) {
+	if _, ok := cache[slot.AcademicYearID]; !ok {
+		cursor, err := database.GetCollection("terms").Find(ctx, bson.M{"academic_year_id": slot.AcademicYearID})
+		if err != nil {
+			return nil, err
+		}
+		var terms []model.Term
+		if err := cursor.All(ctx, &terms); err != nil {
+			return nil, err
+		}
+		windows := []slotWindow{}
+		for _, term := range terms {
+			windows = append(windows, slotWindow{id: term.ID, start: startOfDay(term.StartDate), end: startOfDay(term.EndDate)})
+		}
+		if len(windows) == 0 {
+			var year model.AcademicYear
+			err := database.GetCollection("academic_years").FindOne(ctx, bson.M{"_id": slot.AcademicYearID}).Decode(&year)
+			if err != nil && err != mongo.ErrNoDocuments {
+				return nil, err
+			}
+			if err == nil {
+				windows = append(windows, slotWindow{id: year.ID, start: startOfDay(year.StartDate), end: startOfDay(year.EndDate)})
+			}
+		}
+		sort.Slice(windows, func(i, j int) bool { return windows[i].start.Before(windows[j].start) })
+		cache[slot.AcademicYearID] = windows
+	}
+
+	windows := cache[slot.AcademicYearID]
+	if slot.TermID.IsZero() {
+		return windows, nil
+	}
+	for _, window := range windows {
+		if window.id == slot.TermID {
+			return []slotWindow{window}, nil
+		}
+	}
+	return nil, nil
+}
+
+// firstWeekday returns the first date on or after from that falls on the
+// ISO weekday day.
+func firstWeekday(from time.Time, day int) time.Time {
+	offset := (day - isoWeekday(from) + 7) % 7
+	return from.AddDate(0, 0, offset)
+}
+
+func isoWeekday(t time.Time) int {
+	return (int(t.Weekday())+6)%7 + 1
+}
+
+// atClock returns day at the "HH:MM" time.
+func atClock(day time.Time, clock string) time.Time {
+	parsed, _ := time.Parse("15:04", clock)
+	return time.Date(day.Year(), day.Month(), day.Day(), parsed.Hour(), parsed.Minute(), 0, 0, time.UTC)
+}
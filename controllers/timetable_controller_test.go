@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ReddIndiann/go-messanger/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSlotClashes(t *testing.T) {
+	year := primitive.NewObjectID()
+	term1, term2 := primitive.NewObjectID(), primitive.NewObjectID()
+	teacher, class := primitive.NewObjectID(), primitive.NewObjectID()
+
+	slot := model.TimetableSlot{
+		ID:             primitive.NewObjectID(),
+		SubjectID:      primitive.NewObjectID(),
+		ClassID:        class,
+		TeacherID:      teacher,
+		AcademicYearID: year,
+		TermID:         term1,
+		Day:            1,
+		StartTime:      "09:00",
+		EndTime:        "10:00",
+		RoomKey:        "lab 1",
+	}
+	// other is a slot of another offering, class, teacher and room at the same time
+	other := func(change func(*model.TimetableSlot)) model.TimetableSlot {
+		o := model.TimetableSlot{
+			ID:             primitive.NewObjectID(),
+			SubjectID:      primitive.NewObjectID(),
+			ClassID:        primitive.NewObjectID(),
+			TeacherID:      primitive.NewObjectID(),
+			AcademicYearID: year,
+			TermID:         term1,
+			Day:            1,
+			StartTime:      "09:00",
+			EndTime:        "10:00",
+			RoomKey:        "lab 2",
+		}
+		change(&o)
+		return o
+	}
+
+	tests := []struct {
+		name  string
+		other model.TimetableSlot
+		want  []string
+	}{
+		{"nothing shared", other(func(o *model.TimetableSlot) {}), nil},
+		{"same teacher", other(func(o *model.TimetableSlot) { o.TeacherID = teacher }), []string{"teacher"}},
+		{"same room", other(func(o *model.TimetableSlot) { o.RoomKey = "lab 1" }), []string{"room"}},
+		{"same class", other(func(o *model.TimetableSlot) { o.ClassID = class }), []string{"class"}},
+		{"same offering", other(func(o *model.TimetableSlot) {
+			o.SubjectID, o.ClassID, o.TeacherID = slot.SubjectID, class, teacher
+		}), []string{"teacher", "class", "subject"}},
+		{"partial overlap", other(func(o *model.TimetableSlot) { o.TeacherID, o.StartTime, o.EndTime = teacher, "09:30", "10:30" }), []string{"teacher"}},
+		{"back to back", other(func(o *model.TimetableSlot) { o.TeacherID, o.StartTime, o.EndTime = teacher, "10:00", "11:00" }), nil},
+		{"ends as it starts", other(func(o *model.TimetableSlot) { o.TeacherID, o.StartTime, o.EndTime = teacher, "08:00", "09:00" }), nil},
+		{"another day", other(func(o *model.TimetableSlot) { o.TeacherID, o.Day = teacher, 2 }), nil},
+		{"another term", other(func(o *model.TimetableSlot) { o.TeacherID, o.TermID = teacher, term2 }), nil},
+		{"year-long slot", other(func(o *model.TimetableSlot) { o.TeacherID, o.TermID = teacher, primitive.NilObjectID }), []string{"teacher"}},
+		{"another year", other(func(o *model.TimetableSlot) { o.TeacherID, o.AcademicYearID = teacher, primitive.NewObjectID() }), nil},
+		{"itself", slot, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slotClashes(slot, tt.other); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("slotClashes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("year-long slot clashes with every term", func(t *testing.T) {
+		yearLong := slot
+		yearLong.TermID = primitive.NilObjectID
+		if got := slotClashes(yearLong, other(func(o *model.TimetableSlot) { o.TeacherID, o.TermID = teacher, term2 })); len(got) == 0 {
+			t.Fatal("expected a clash")
+		}
+	})
+
+	t.Run("slots without a teacher or room do not clash on them", func(t *testing.T) {
+		bare := slot
+		bare.TeacherID, bare.RoomKey = primitive.NilObjectID, ""
+		if got := slotClashes(bare, other(func(o *model.TimetableSlot) { o.TeacherID, o.RoomKey = primitive.NilObjectID, "" })); got != nil {
+			t.Fatalf("slotClashes = %v, want nil", got)
+		}
+	})
+}
+
+func TestValidateSlot(t *testing.T) {
+	tests := []struct {
+		name       string
+		slot       model.TimetableSlot
+		start, end string
+		ok         bool
+	}{
+		{"valid", model.TimetableSlot{Day: 1, StartTime: "08:00", EndTime: "08:45"}, "08:00", "08:45", true},
+		{"padded", model.TimetableSlot{Day: 7, StartTime: "8:05", EndTime: "9:00"}, "08:05", "09:00", true},
+		{"day too low", model.TimetableSlot{Day: 0, StartTime: "08:00", EndTime: "09:00"}, "", "", false},
+		{"day too high", model.TimetableSlot{Day: 8, StartTime: "08:00", EndTime: "09:00"}, "", "", false},
+		{"negative period", model.TimetableSlot{Day: 1, Period: -1, StartTime: "08:00", EndTime: "09:00"}, "", "", false},
+		{"bad time", model.TimetableSlot{Day: 1, StartTime: "8am", EndTime: "09:00"}, "", "", false},
+		{"ends before it starts", model.TimetableSlot{Day: 1, StartTime: "10:00", EndTime: "09:00"}, "", "", false},
+		{"empty lesson", model.TimetableSlot{Day: 1, StartTime: "10:00", EndTime: "10:00"}, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot := tt.slot
+			slot.Room = "  Lab   1 "
+			err := validateSlot(&slot)
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateSlot: %v", err)
+			}
+			if slot.StartTime != tt.start || slot.EndTime != tt.end || slot.RoomKey != "lab 1" {
+				t.Fatalf("normalized to %s-%s in %q", slot.StartTime, slot.EndTime, slot.RoomKey)
+			}
+		})
+	}
+}
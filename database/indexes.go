@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes lists the indexes each collection needs, created at startup.
+var indexes = map[string][]mongo.IndexModel{
+	"academic_years": {
+		{Keys: bson.D{{Key: "school_id", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"assessments": {
+		{Keys: bson.D{{Key: "subject_id", Value: 1}, {Key: "term_id", Value: 1}}},
+	},
+	"assignments": {
+		{Keys: bson.D{{Key: "subject_id", Value: 1}, {Key: "due_at", Value: 1}}},
+	},
+	"attendance_notifications": {
+		{Keys: bson.D{{Key: "student_id", Value: 1}, {Key: "date", Value: 1}, {Key: "status", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"attendance_records": {
+		{Keys: bson.D{{Key: "session_id", Value: 1}, {Key: "student_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "student_id", Value: 1}, {Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "class_id", Value: 1}, {Key: "date", Value: 1}}},
+	},
+	"attendance_sessions": {
+		{Keys: bson.D{{Key: "class_id", Value: 1}, {Key: "date", Value: 1}, {Key: "subject_id", Value: 1}, {Key: "period", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"classes": {
+		{Keys: bson.D{{Key: "school_id", Value: 1}, {Key: "academic_year_id", Value: 1}, {Key: "grade", Value: 1}, {Key: "section", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"departments": {
+		{Keys: bson.D{{Key: "school_id", Value: 1}, {Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"grading_scales": {
+		{Keys: bson.D{{Key: "school_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"diary_entries": {
+		{Keys: bson.D{{Key: "subject_id", Value: 1}, {Key: "date", Value: 1}, {Key: "period", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "class_id", Value: 1}, {Key: "date", Value: 1}}},
+	},
+	"timetable_slots": {
+		{Keys: bson.D{{Key: "academic_year_id", Value: 1}, {Key: "day", Value: 1}, {Key: "start_time", Value: 1}}},
+		{Keys: bson.D{{Key: "subject_id", Value: 1}}},
+		{Keys: bson.D{{Key: "class_id", Value: 1}, {Key: "day", Value: 1}}},
+		{Keys: bson.D{{Key: "teacher_id", Value: 1}, {Key: "day", Value: 1}}},
+	},
+	"announcements": {
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "publish_at", Value: 1}}},
+		{Keys: bson.D{{Key: "school_id", Value: 1}, {Key: "publish_at", Value: -1}}},
+	},
+	"announcement_recipients": {
+		{Keys: bson.D{{Key: "announcement_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "read_at", Value: 1}}},
+	},
+	"users": {
+		{Keys: bson.D{{Key: "child_ids", Value: 1}}},
+		// A teacher or student record has at most one account
+		{Keys: bson.D{{Key: "teacher_id", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"teacher_id": bson.M{"$exists": true}})},
+		{Keys: bson.D{{Key: "student_id", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"student_id": bson.M{"$exists": true}})},
+	},
+	"invitations": {
+		// One pending invitation per email, role and school, later ones add to it
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "role", Value: 1}, {Key: "school_ids", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"status": "pending"})},
+		{Keys: bson.D{{Key: "child_ids", Value: 1}}},
+	},
+	"imports": {
+		{Keys: bson.D{{Key: "school_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"import_rows": {
+		{Keys: bson.D{{Key: "job_id", Value: 1}, {Key: "row", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"conversations": {
+		{Keys: bson.D{{Key: "participant_ids", Value: 1}, {Key: "updated_at", Value: -1}}},
+		// At most one direct conversation per pair of users
+		{Keys: bson.D{{Key: "direct_key", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"direct_key": bson.M{"$exists": true}})},
+	},
+	"messages": {
+		{Keys: bson.D{{Key: "conversation_id", Value: 1}, {Key: "_id", Value: -1}}},
+	},
+	"rollover_students": {
+		{Keys: bson.D{{Key: "rollover_id", Value: 1}, {Key: "student_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"outbox": {
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		// Sent and dead messages are deleted after their retention
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"terms": {
+		{Keys: bson.D{{Key: "academic_year_id", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"students": {
+		{Keys: bson.D{{Key: "class_id", Value: 1}}},
+	},
+	"submissions": {
+		{Keys: bson.D{{Key: "assignment_id", Value: 1}, {Key: "student_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "teacher_id", Value: 1}, {Key: "graded", Value: 1}}},
+	},
+	"subjects": {
+		// A rollover clones each offering into the new year once
+		{Keys: bson.D{{Key: "academic_year_id", Value: 1}, {Key: "cloned_from_id", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"cloned_from_id": bson.M{"$exists": true}})},
+	},
+	"subject_catalog": {
+		{Keys: bson.D{{Key: "school_id", Value: 1}, {Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"notification_rules": {
+		{Keys: bson.D{{Key: "school_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"report_card_remarks": {
+		{Keys: bson.D{{Key: "student_id", Value: 1}, {Key: "term_id", Value: 1}, {Key: "subject_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"scores": {
+		{Keys: bson.D{{Key: "assessment_id", Value: 1}, {Key: "student_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "student_id", Value: 1}, {Key: "term_id", Value: 1}}},
+	},
+	"sessions": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		// Drop sessions once their refresh token can no longer be used
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+}
+
+func EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for collectionName, models := range indexes {
+		if _, err := GetCollection(collectionName).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations run in order on every startup, so each must be idempotent.
+// Classes get their academic year before grade and section pairs are
+// matched to classes without one.
+var migrations = []func(ctx context.Context) error{
+	migrateTeacherSubjectIDs,
+	migrateClassAcademicYears,
+	migrateGradeSectionToClasses,
+	migrateOutboxCollection,
+	migrateOfferingStudentIDs,
+	migrateInvitationIndex,
+}
+
+// RunMigrations brings documents written by older versions up to the
+// current schema.
+func RunMigrations() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	for _, migrate := range migrations {
+		if err := migrate(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Teacher.subject_ids used to hold a single ObjectID
+func migrateTeacherSubjectIDs(ctx context.Context) error {
+	teachers := GetCollection("teachers")
+	_, err := teachers.UpdateMany(ctx,
+		bson.M{"subject_ids": bson.M{"$type": "objectId"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"subject_ids": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$subject_ids", primitive.NilObjectID}},
+				bson.A{},
+				bson.A{"$subject_ids"},
+			}},
+		}}}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = teachers.UpdateMany(ctx,
+		bson.M{"$or": bson.A{bson.M{"subject_ids": nil}, bson.M{"subject_ids": bson.M{"$exists": false}}}},
+		bson.M{"$set": bson.M{"subject_ids": bson.A{}}},
+	)
+	return err
+}
+
+// Students and subject offerings used to carry free grade and section
+// strings. Each distinct pair per school becomes a class with no academic
+// year, which admins can then fill in.
+func migrateGradeSectionToClasses(ctx context.Context) error {
+	classes := GetCollection("classes")
+
+	for _, name := range []string{"students", "subjects"} {
+		collection := GetCollection(name)
+		cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"class_id": bson.M{"$exists": false}}}},
+			{{Key: "$group", Value: bson.M{"_id": bson.M{
+				"school_id": "$school_id",
+				"grade":     bson.M{"$ifNull": bson.A{"$grade", ""}},
+				"section":   bson.M{"$ifNull": bson.A{"$section", ""}},
+			}}}},
+		})
+		if err != nil {
+			return err
+		}
+		var groups []struct {
+			ID struct {
+				SchoolID primitive.ObjectID `bson:"school_id"`
+				Grade    string             `bson:"grade"`
+				Section  string             `bson:"section"`
+			} `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &groups); err != nil {
+			return err
+		}
+
+		for _, group := range groups {
+			key := group.ID
+			classID := primitive.NilObjectID
+			if strings.TrimSpace(key.Grade) != "" {
+				now := time.Now()
+				var class struct {
+					ID primitive.ObjectID `bson:"_id"`
+				}
+				err := classes.FindOneAndUpdate(ctx,
+					bson.M{"school_id": key.SchoolID, "academic_year_id": primitive.NilObjectID, "grade": key.Grade, "section": key.Section},
+					bson.M{"$setOnInsert": bson.M{
+						"name":                strings.TrimSpace(key.Grade + " " + key.Section),
+						"homeroom_teacher_id": primitive.NilObjectID,
+						"capacity":            0,
+						"created_at":          now,
+						"updated_at":          now,
+					}},
+					options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+				).Decode(&class)
+				if err != nil {
+					return err
+				}
+				classID = class.ID
+			}
+
+			filter := bson.M{"class_id": bson.M{"$exists": false}, "school_id": key.SchoolID}
+			if key.Grade == "" {
+				filter["grade"] = bson.M{"$in": bson.A{"", nil}}
+			} else {
+				filter["grade"] = key.Grade
+			}
+			if key.Section == "" {
+				filter["section"] = bson.M{"$in": bson.A{"", nil}}
+			} else {
+				filter["section"] = key.Section
+			}
+			_, err := collection.UpdateMany(ctx, filter, bson.M{
+				"$set":   bson.M{"class_id": classID},
+				"$unset": bson.M{"grade": "", "section": ""},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Classes used to name their academic year with a free string. Each named
+// year becomes an open academic year without dates, and offerings take the
+// year of their class.
+func migrateClassAcademicYears(ctx context.Context) error {
+	classes := GetCollection("classes")
+	years := GetCollection("academic_years")
+
+	cursor, err := classes.Find(ctx, bson.M{"academic_year_id": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	var pending []struct {
+		ID           primitive.ObjectID `bson:"_id"`
+		SchoolID     primitive.ObjectID `bson:"school_id"`
+		AcademicYear string             `bson:"academic_year"`
+	}
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+
+	for _, class := range pending {
+		yearID := primitive.NilObjectID
+		if name := strings.TrimSpace(class.AcademicYear); name != "" {
+			now := time.Now()
+			var year struct {
+				ID primitive.ObjectID `bson:"_id"`
+			}
+			err := years.FindOneAndUpdate(ctx,
+				bson.M{"school_id": class.SchoolID, "name": name},
+				bson.M{"$setOnInsert": bson.M{
+					"status":     "open",
+					"is_current": false,
+					"created_at": now,
+					"updated_at": now,
+				}},
+				options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+			).Decode(&year)
+			if err != nil {
+				return err
+			}
+			yearID = year.ID
+		}
+		if _, err := classes.UpdateOne(ctx, bson.M{"_id": class.ID}, bson.M{"$set": bson.M{"academic_year_id": yearID}}); err != nil {
+			return err
+		}
+	}
+
+	subjects := GetCollection("subjects")
+	unstamped, err := subjects.CountDocuments(ctx, bson.M{"academic_year_id": bson.M{"$exists": false}})
+	if err != nil || unstamped == 0 {
+		return err
+	}
+
+	cursor, err = classes.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	var all []struct {
+		ID             primitive.ObjectID `bson:"_id"`
+		AcademicYearID primitive.ObjectID `bson:"academic_year_id"`
+	}
+	if err := cursor.All(ctx, &all); err != nil {
+		return err
+	}
+	for _, class := range all {
+		_, err := subjects.UpdateMany(ctx,
+			bson.M{"class_id": class.ID, "academic_year_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"academic_year_id": class.AcademicYearID, "term_id": primitive.NilObjectID}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = subjects.UpdateMany(ctx,
+		bson.M{"academic_year_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"academic_year_id": primitive.NilObjectID, "term_id": primitive.NilObjectID}},
+	)
+	return err
+}
+
+// The outbox was called email_outbox before it carried text messages, and
+// sent messages used to keep their bodies.
+func migrateOutboxCollection(ctx context.Context) error {
+	names, err := Database.ListCollectionNames(ctx, bson.M{"name": "email_outbox"})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		err := Client.Database("admin").RunCommand(ctx, bson.D{
+			{Key: "renameCollection", Value: Database.Name() + ".email_outbox"},
+			{Key: "to", Value: Database.Name() + ".outbox"},
+		}).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = GetCollection("outbox").UpdateMany(ctx,
+		bson.M{"status": "sent", "$or": bson.A{
+			bson.M{"html_body": bson.M{"$exists": true}},
+			bson.M{"text_body": bson.M{"$exists": true}},
+		}},
+		bson.M{"$unset": bson.M{"html_body": "", "text_body": ""}},
+	)
+	return err
+}
+
+// Offering updates used to store student_ids as the strings they were sent
+// as. IDs that are not valid ObjectIDs are dropped.
+func migrateOfferingStudentIDs(ctx context.Context) error {
+	_, err := GetCollection("subjects").UpdateMany(ctx,
+		bson.M{"student_ids": bson.M{"$type": "string"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"student_ids": bson.M{"$filter": bson.M{
+				"input": bson.M{"$map": bson.M{
+					"input": "$student_ids",
+					"in": bson.M{"$convert": bson.M{
+						"input": "$$this", "to": "objectId", "onError": nil, "onNull": nil,
+					}},
+				}},
+				"cond": bson.M{"$ne": bson.A{"$$this", nil}},
+			}},
+		}}}},
+	)
+	return err
+}
+
+// Pending invitations used to be unique per email and role across schools.
+func migrateInvitationIndex(ctx context.Context) error {
+	_, err := GetCollection("invitations").Indexes().DropOne(ctx, "email_1_role_1")
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == 26 || cmdErr.Code == 27) { // No collection or index yet
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,228 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Each template has a <name>.<locale>.txt file defining "subject" and
+// "body", and a <name>.<locale>.html file defining "body". Both are wrapped
+// in the matching layout.
+//
+//go:embed templates
+var templateFS embed.FS
+
+type EmailTemplate string
+
+const (
+	TemplateVerification    EmailTemplate = "verification"
+	TemplatePasswordReset   EmailTemplate = "password_reset"
+	TemplateInvitation      EmailTemplate = "invitation"
+	TemplateAttendanceAlert EmailTemplate = "attendance_alert"
+	TemplateAnnouncement    EmailTemplate = "announcement"
+)
+
+const DefaultLocale = "en"
+
+var EmailTemplates = []EmailTemplate{
+	TemplateVerification,
+	TemplatePasswordReset,
+	TemplateInvitation,
+	TemplateAttendanceAlert,
+	TemplateAnnouncement,
+}
+
+// Branding is the sender identity shown in the email header and footer.
+type Branding struct {
+	Name    string
+	LogoURL string
+	Email   string
+}
+
+type RenderedEmail struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type templateData struct {
+	Brand  Branding
+	Locale string
+	Data   map[string]interface{}
+}
+
+type parsedTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+var templateCache sync.Map // Maps "<name>.<locale>" to *parsedTemplate
+
+func DefaultBranding() Branding {
+	name := os.Getenv("APP_NAME")
+	if name == "" {
+		name = "School App"
+	}
+	return Branding{Name: name, Email: os.Getenv("SMTP_FROM")}
+}
+
+func SchoolBranding(school model.School) Branding {
+	return Branding{Name: school.Name, LogoURL: school.Logo, Email: school.Email}
+}
+
+// LoadBranding returns the school's branding, or the default one when the
+// school is unknown.
+func LoadBranding(ctx context.Context, schoolID primitive.ObjectID) Branding {
+	if schoolID.IsZero() {
+		return DefaultBranding()
+	}
+	var school model.School
+	if err := database.GetCollection("schools").FindOne(ctx, bson.M{"_id": schoolID}).Decode(&school); err != nil {
+		return DefaultBranding()
+	}
+	return SchoolBranding(school)
+}
+
+// TemplateLocales lists the locales a template is available in.
+func TemplateLocales(name EmailTemplate) []string {
+	matches, _ := fs.Glob(templateFS, "templates/"+string(name)+".*.txt")
+	locales := make([]string, 0, len(matches))
+	for _, match := range matches {
+		parts := strings.Split(strings.TrimPrefix(match, "templates/"), ".")
+		locales = append(locales, parts[1])
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// resolveLocale picks the closest available locale: "fr-CA" falls back to
+// "fr", then to the default locale.
+func resolveLocale(name EmailTemplate, locale string) string {
+	available := TemplateLocales(name)
+	candidates := []string{strings.ToLower(locale)}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, strings.ToLower(locale[:i]))
+	}
+	for _, candidate := range candidates {
+		for _, a := range available {
+			if a == candidate {
+				return a
+			}
+		}
+	}
+	return DefaultLocale
+}
+
+func loadTemplate(name EmailTemplate, locale string) (*parsedTemplate, error) {
+	key := string(name) + "." + locale
+	if cached, ok := templateCache.Load(key); ok {
+		return cached.(*parsedTemplate), nil
+	}
+
+	html, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+key+".html")
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.ParseFS(templateFS, "templates/layout.txt", "templates/"+key+".txt")
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &parsedTemplate{html: html, text: text}
+	templateCache.Store(key, parsed)
+	return parsed, nil
+}
+
+// RenderEmail renders the named template in the closest available locale.
+func RenderEmail(name EmailTemplate, locale string, brand Branding, data map[string]interface{}) (*RenderedEmail, error) {
+	resolved := resolveLocale(name, locale)
+	tmpl, err := loadTemplate(name, resolved)
+	if err != nil {
+		return nil, fmt.Errorf("loading email template %s: %w", name, err)
+	}
+
+	input := templateData{Brand: brand, Locale: resolved, Data: data}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", input); err != nil {
+		return nil, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "layout.txt", input); err != nil {
+		return nil, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout.html", input); err != nil {
+		return nil, err
+	}
+
+	return &RenderedEmail{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+// RenderSMS renders the template's "sms" definition, for templates that
+// also go out as text messages.
+func RenderSMS(name EmailTemplate, locale string, brand Branding, data map[string]interface{}) (string, error) {
+	resolved := resolveLocale(name, locale)
+	tmpl, err := loadTemplate(name, resolved)
+	if err != nil {
+		return "", fmt.Errorf("loading email template %s: %w", name, err)
+	}
+	if tmpl.text.Lookup("sms") == nil {
+		return "", fmt.Errorf("email template %s has no sms text", name)
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&body, "sms", templateData{Brand: brand, Locale: resolved, Data: data}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(body.String()), nil
+}
+
+// SendTemplatedMail renders a template and queues it in the outbox.
+func SendTemplatedMail(ctx context.Context, to string, name EmailTemplate, locale string, brand Branding, data map[string]interface{}) error {
+	email, err := RenderEmail(name, locale, brand, data)
+	if err != nil {
+		return err
+	}
+	return EnqueueMail(ctx, to, email)
+}
+
+// SampleTemplateData is used to preview templates without real records.
+func SampleTemplateData(name EmailTemplate) map[string]interface{} {
+	switch name {
+	case TemplateVerification, TemplatePasswordReset:
+		return map[string]interface{}{"Name": "Ama Mensah", "Code": "482913", "ExpiresInMinutes": int(OTPTTL.Minutes())}
+	case TemplateInvitation:
+		return map[string]interface{}{"Name": "Kwame Boateng", "InviterName": "Head Teacher", "Role": "teacher", "AcceptURL": "https://example.com/invitations/accept?token=sample", "ExpiresAt": "1 January 2030"}
+	case TemplateAttendanceAlert:
+		return map[string]interface{}{"ParentName": "Mr. Mensah", "StudentName": "Ama Mensah", "Status": "absent", "Date": "1 January 2030", "ClassName": "Grade 5 A", "Remark": "", "ConsecutiveDays": 2}
+	case TemplateAnnouncement:
+		return map[string]interface{}{"Title": "Sports Day", "Body": "Sports day takes place on Friday.\nStudents should come in their house colours.", "AuthorName": "Head Teacher", "PublishedAt": "1 January 2030"}
+	}
+	return map[string]interface{}{}
+}
+
+func IsValidEmailTemplate(name string) bool {
+	for _, t := range EmailTemplates {
+		if string(t) == name {
+			return true
+		}
+	}
+	return false
+}
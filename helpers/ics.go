@@ -0,0 +1,104 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// CalendarEvent is a VEVENT. With Until set it repeats weekly until then.
+type CalendarEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	Until       time.Time
+}
+
+// icsTime formats t as a floating local time, so lessons stay at the same
+// wall-clock time in the subscriber's calendar.
+const icsTime = "20060102T150405"
+
+// WriteCalendar writes the events as an iCalendar (RFC 5545) feed.
+func WriteCalendar(w io.Writer, name string, events []CalendarEvent) error {
+	out := bufio.NewWriter(w)
+	line := func(content string) {
+		out.WriteString(foldICS(content))
+	}
+
+	stamp := time.Now().UTC().Format(icsTime) + "Z"
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//go-messanger//Timetable//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICS(name))
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.UID)
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + event.Start.Format(icsTime))
+		line("DTEND:" + event.End.Format(icsTime))
+		if !event.Until.IsZero() {
+			line("RRULE:FREQ=WEEKLY;UNTIL=" + event.Until.Format(icsTime))
+		}
+		line("SUMMARY:" + escapeICS(event.Summary))
+		if event.Location != "" {
+			line("LOCATION:" + escapeICS(event.Location))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION:" + escapeICS(event.Description))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return out.Flush()
+}
+
+// foldICS ends a content line with CRLF, folding lines longer than 75
+// octets onto continuation lines without splitting a UTF-8 character.
+func foldICS(content string) string {
+	var b strings.Builder
+	for len(content) > 75 {
+		cut := 75
+		for cut > 0 && !isRuneStart(content[cut]) {
+			cut--
+		}
+		b.WriteString(content[:cut] + "\r\n")
+		content = " " + content[cut:]
+	}
+	b.WriteString(content + "\r\n")
+	return b.String()
+}
+
+func escapeICS(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// CalendarToken signs a calendar feed name, e.g. "teacher:<id>", so the
+// feed URL can be subscribed to without a login. Set CALENDAR_SECRET to
+// invalidate every issued URL.
+func CalendarToken(feed string) string {
+	secret := os.Getenv("CALENDAR_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("calendar:" + feed))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifyCalendarToken(feed, token string) bool {
+	return hmac.Equal([]byte(CalendarToken(feed)), []byte(token))
+}
@@ -0,0 +1,98 @@
+package helpers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFoldICS(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		lines   int
+	}{
+		{"short", "SUMMARY:Maths", 1},
+		{"exactly 75 octets", strings.Repeat("a", 75), 1},
+		{"76 octets", strings.Repeat("a", 76), 2},
+		{"several folds", strings.Repeat("a", 200), 3},
+		{"multibyte at the cut", strings.Repeat("a", 74) + "éééé", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			folded := foldICS(tt.content)
+			if !strings.HasSuffix(folded, "\r\n") {
+				t.Fatalf("%q does not end with CRLF", folded)
+			}
+			lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+			if len(lines) != tt.lines {
+				t.Fatalf("got %d lines, want %d: %q", len(lines), tt.lines, folded)
+			}
+			unfolded := lines[0]
+			for i, line := range lines {
+				if len(line) > 75 {
+					t.Errorf("line %d has %d octets", i, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a character: %q", i, line)
+				}
+				if i > 0 {
+					if !strings.HasPrefix(line, " ") {
+						t.Errorf("continuation line %d does not start with a space", i)
+					}
+					unfolded += line[1:]
+				}
+			}
+			if unfolded != tt.content {
+				t.Fatalf("unfolded to %q, want %q", unfolded, tt.content)
+			}
+		})
+	}
+}
+
+func TestEscapeICS(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Maths", "Maths"},
+		{"Room 1, floor 2; west", `Room 1\, floor 2\; west`},
+		{`a\b`, `a\\b`},
+		{"line1\nline2\r\nline3", `line1\nline2\nline3`},
+	}
+	for _, tt := range tests {
+		if got := escapeICS(tt.in); got != tt.want {
+			t.Errorf("escapeICS(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteCalendar(t *testing.T) {
+	start := time.Date(2026, 9, 7, 8, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+	err := WriteCalendar(&out, "Class 1A", []CalendarEvent{{
+		UID:     "slot-1@go-messanger",
+		Summary: "Maths, algebra",
+		Start:   start,
+		End:     start.Add(time.Hour),
+		Until:   start.AddDate(0, 3, 0),
+	}})
+	if err != nil {
+		t.Fatalf("WriteCalendar: %v", err)
+	}
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Class 1A\r\n",
+		"DTSTART:20260907T080000\r\n",
+		"DTEND:20260907T090000\r\n",
+		"RRULE:FREQ=WEEKLY;UNTIL=20261207T080000\r\n",
+		"SUMMARY:Maths\\, algebra\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("calendar is missing %q", want)
+		}
+	}
+	if strings.Contains(out.String(), "LOCATION:") {
+		t.Error("calendar has a LOCATION for an event without one")
+	}
+}
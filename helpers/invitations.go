@@ -0,0 +1,76 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InvitationTTL is how long an invitation link stays valid after it is sent.
+const InvitationTTL = 7 * 24 * time.Hour
+
+// InvitationAcceptURL is the page of the app that accepts invitations:
+// INVITATION_URL, or else APP_URL followed by /invitations/accept. Links are
+// never built from the request, whose Host header the client controls.
+func InvitationAcceptURL() (string, error) {
+	base := os.Getenv("INVITATION_URL")
+	if base == "" && os.Getenv("APP_URL") != "" {
+		base = strings.TrimRight(os.Getenv("APP_URL"), "/") + "/invitations/accept"
+	}
+	if base == "" {
+		return "", errors.New("INVITATION_URL or APP_URL must be set")
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invitation URL %q must be an absolute http or https URL", base)
+	}
+	return base, nil
+}
+
+// NewInvitationNonce returns a random value that ties a token to one
+// sending of an invitation.
+func NewInvitationNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// InvitationToken signs the invitation ID and nonce, keyed with
+// INVITATION_SECRET or else JWT_SECRET: "<id>.<signature>".
+func InvitationToken(id primitive.ObjectID, nonce string) string {
+	return id.Hex() + "." + invitationSignature(id, nonce)
+}
+
+// InvitationIDFromToken returns the invitation a token claims to be for.
+// The claim still has to be checked with VerifyInvitationToken.
+func InvitationIDFromToken(token string) (primitive.ObjectID, bool) {
+	id, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	return objectID, err == nil
+}
+
+func VerifyInvitationToken(token string, id primitive.ObjectID, nonce string) bool {
+	return hmac.Equal([]byte(InvitationToken(id, nonce)), []byte(token))
+}
+
+func invitationSignature(id primitive.ObjectID, nonce string) string {
+	secret := os.Getenv("INVITATION_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("invitation:" + id.Hex() + ":" + nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,274 @@
+package helpers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OTPPurpose scopes a code to one flow, so a registration code cannot reset a password.
+type OTPPurpose string
+
+const (
+	OTPPurposeRegister OTPPurpose = "register"
+	OTPPurposeForgot   OTPPurpose = "forgot"
+	OTPPurposeLogin    OTPPurpose = "login"
+)
+
+const (
+	OTPLength         = 6
+	OTPTTL            = 10 * time.Minute
+	OTPMaxAttempts    = 5
+	OTPLockout        = 15 * time.Minute
+	OTPResendCooldown = time.Minute
+)
+
+var (
+	ErrOTPInvalid  = errors.New("invalid OTP")
+	ErrOTPExpired  = errors.New("OTP expired or not found")
+	ErrOTPLocked   = errors.New("too many failed attempts, try again later")
+	ErrOTPCooldown = errors.New("please wait before requesting another code")
+)
+
+// OTPRecord is what is kept for an issued code. The code itself is never
+// stored, only an HMAC of it.
+type OTPRecord struct {
+	Key         string    `bson:"_id"`
+	Hash        string    `bson:"hash"`
+	Attempts    int       `bson:"attempts"`
+	LockedUntil time.Time `bson:"locked_until,omitempty"`
+	SentAt      time.Time `bson:"sent_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+type OTPStore interface {
+	// Get returns nil when there is no record for the key.
+	Get(ctx context.Context, key string) (*OTPRecord, error)
+	Save(ctx context.Context, record *OTPRecord) error
+	// IncrementAttempts records a failed guess and returns the new count.
+	IncrementAttempts(ctx context.Context, key string) (int, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var otpStore OTPStore = NewMemoryOTPStore()
+
+// SetOTPStore replaces the default in-memory store. Call it once at startup.
+func SetOTPStore(store OTPStore) {
+	otpStore = store
+}
+
+func otpKey(email string, purpose OTPPurpose) string {
+	return string(purpose) + ":" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func hashOTP(key, code string) string {
+	secret := os.Getenv("OTP_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(key + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateOTP() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < OTPLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", OTPLength, n), nil
+}
+
+// IssueOTP creates a new code for the email and purpose, replacing any previous one.
+func IssueOTP(ctx context.Context, email string, purpose OTPPurpose) (string, error) {
+	key := otpKey(email, purpose)
+	now := time.Now()
+
+	existing, err := otpStore.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		if existing.LockedUntil.After(now) {
+			return "", ErrOTPLocked
+		}
+		if existing.SentAt.Add(OTPResendCooldown).After(now) {
+			return "", ErrOTPCooldown
+		}
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		return "", err
+	}
+
+	record := &OTPRecord{
+		Key:       key,
+		Hash:      hashOTP(key, code),
+		SentAt:    now,
+		ExpiresAt: now.Add(OTPTTL),
+	}
+	if err := otpStore.Save(ctx, record); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// VerifyOTP checks a code and consumes it on success. After OTPMaxAttempts
+// wrong guesses the code is discarded and the email is locked out.
+func VerifyOTP(ctx context.Context, email string, purpose OTPPurpose, code string) error {
+	key := otpKey(email, purpose)
+	now := time.Now()
+
+	record, err := otpStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrOTPExpired
+	}
+	if record.LockedUntil.After(now) {
+		return ErrOTPLocked
+	}
+	if record.Hash == "" || record.ExpiresAt.Before(now) {
+		return ErrOTPExpired
+	}
+
+	if !hmac.Equal([]byte(record.Hash), []byte(hashOTP(key, code))) {
+		attempts, err := otpStore.IncrementAttempts(ctx, key)
+		if err != nil {
+			return err
+		}
+		if attempts >= OTPMaxAttempts {
+			record.Hash = ""
+			record.Attempts = attempts
+			record.LockedUntil = now.Add(OTPLockout)
+			record.ExpiresAt = record.LockedUntil
+			if err := otpStore.Save(ctx, record); err != nil {
+				return err
+			}
+			return ErrOTPLocked
+		}
+		return ErrOTPInvalid
+	}
+
+	return otpStore.Delete(ctx, key)
+}
+
+// MemoryOTPStore keeps codes in process, for development and tests.
+type MemoryOTPStore struct {
+	cache *cache.Cache
+	mutex sync.Mutex
+}
+
+func NewMemoryOTPStore() *MemoryOTPStore {
+	return &MemoryOTPStore{cache: cache.New(OTPTTL, 10*time.Minute)}
+}
+
+func (s *MemoryOTPStore) Get(ctx context.Context, key string) (*OTPRecord, error) {
+	item, found := s.cache.Get(key)
+	if !found {
+		return nil, nil
+	}
+	record := item.(OTPRecord)
+	return &record, nil
+}
+
+func (s *MemoryOTPStore) Save(ctx context.Context, record *OTPRecord) error {
+	s.cache.Set(record.Key, *record, time.Until(record.ExpiresAt))
+	return nil
+}
+
+func (s *MemoryOTPStore) IncrementAttempts(ctx context.Context, key string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, expiration, found := s.cache.GetWithExpiration(key)
+	if !found {
+		return 0, ErrOTPExpired
+	}
+	record := item.(OTPRecord)
+	record.Attempts++
+	s.cache.Set(key, record, time.Until(expiration))
+	return record.Attempts, nil
+}
+
+func (s *MemoryOTPStore) Delete(ctx context.Context, key string) error {
+	s.cache.Delete(key)
+	return nil
+}
+
+// MongoOTPStore shares codes between replicas and keeps them across restarts.
+type MongoOTPStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoOTPStore(collection *mongo.Collection) (*MongoOTPStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoOTPStore{collection: collection}, nil
+}
+
+func (s *MongoOTPStore) Get(ctx context.Context, key string) (*OTPRecord, error) {
+	var record OTPRecord
+	err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *MongoOTPStore) Save(ctx context.Context, record *OTPRecord) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": record.Key}, record, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoOTPStore) IncrementAttempts(ctx context.Context, key string) (int, error) {
+	var record OTPRecord
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return 0, ErrOTPExpired
+	}
+	if err != nil {
+		return 0, err
+	}
+	return record.Attempts, nil
+}
+
+func (s *MongoOTPStore) Delete(ctx context.Context, key string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,118 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOTPIssueAndVerify(t *testing.T) {
+	ctx := context.Background()
+	SetOTPStore(NewMemoryOTPStore())
+
+	code, err := IssueOTP(ctx, " Jane@Example.com ", OTPPurposeRegister)
+	if err != nil {
+		t.Fatalf("IssueOTP: %v", err)
+	}
+	if len(code) != OTPLength {
+		t.Fatalf("code %q is not %d digits", code, OTPLength)
+	}
+	if _, err := IssueOTP(ctx, "jane@example.com", OTPPurposeRegister); err != ErrOTPCooldown {
+		t.Fatalf("second IssueOTP = %v, want %v", err, ErrOTPCooldown)
+	}
+	if err := VerifyOTP(ctx, "jane@example.com", OTPPurposeForgot, code); err != ErrOTPExpired {
+		t.Fatalf("VerifyOTP for another purpose = %v, want %v", err, ErrOTPExpired)
+	}
+	if err := VerifyOTP(ctx, "JANE@example.com", OTPPurposeRegister, code); err != nil {
+		t.Fatalf("VerifyOTP = %v, want nil", err)
+	}
+	if err := VerifyOTP(ctx, "jane@example.com", OTPPurposeRegister, code); err != ErrOTPExpired {
+		t.Fatalf("VerifyOTP of a used code = %v, want %v", err, ErrOTPExpired)
+	}
+}
+
+func TestOTPVerifyRecords(t *testing.T) {
+	const email, code = "jane@example.com", "123456"
+	key := otpKey(email, OTPPurposeLogin)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		record *OTPRecord // Nil for no code issued
+		guess  string
+		want   error
+	}{
+		{"none issued", nil, code, ErrOTPExpired},
+		{"correct", &OTPRecord{Hash: hashOTP(key, code), ExpiresAt: now.Add(time.Minute)}, code, nil},
+		{"wrong", &OTPRecord{Hash: hashOTP(key, code), ExpiresAt: now.Add(time.Minute)}, "000000", ErrOTPInvalid},
+		{"expired", &OTPRecord{Hash: hashOTP(key, code), ExpiresAt: now.Add(-time.Second)}, code, ErrOTPExpired},
+		{"locked", &OTPRecord{LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Minute)}, code, ErrOTPLocked},
+		{"last attempt", &OTPRecord{Hash: hashOTP(key, code), Attempts: OTPMaxAttempts - 1, ExpiresAt: now.Add(time.Minute)}, "000000", ErrOTPLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryOTPStore()
+			SetOTPStore(store)
+			if tt.record != nil {
+				tt.record.Key = key
+				store.Save(ctx, tt.record)
+			}
+			if err := VerifyOTP(ctx, email, OTPPurposeLogin, tt.guess); err != tt.want {
+				t.Fatalf("VerifyOTP = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOTPLockout(t *testing.T) {
+	ctx := context.Background()
+	SetOTPStore(NewMemoryOTPStore())
+	const email = "jane@example.com"
+
+	code, err := IssueOTP(ctx, email, OTPPurposeForgot)
+	if err != nil {
+		t.Fatalf("IssueOTP: %v", err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 1; i < OTPMaxAttempts; i++ {
+		if err := VerifyOTP(ctx, email, OTPPurposeForgot, wrong); err != ErrOTPInvalid {
+			t.Fatalf("attempt %d = %v, want %v", i, err, ErrOTPInvalid)
+		}
+	}
+	if err := VerifyOTP(ctx, email, OTPPurposeForgot, wrong); err != ErrOTPLocked {
+		t.Fatalf("attempt %d = %v, want %v", OTPMaxAttempts, err, ErrOTPLocked)
+	}
+	// The code is discarded, so even the right one is refused
+	if err := VerifyOTP(ctx, email, OTPPurposeForgot, code); err != ErrOTPLocked {
+		t.Fatalf("correct code while locked = %v, want %v", err, ErrOTPLocked)
+	}
+	if _, err := IssueOTP(ctx, email, OTPPurposeForgot); err != ErrOTPLocked {
+		t.Fatalf("IssueOTP while locked = %v, want %v", err, ErrOTPLocked)
+	}
+}
+
+func TestOTPResendAfterCooldown(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryOTPStore()
+	SetOTPStore(store)
+	const email = "jane@example.com"
+	key := otpKey(email, OTPPurposeRegister)
+
+	store.Save(ctx, &OTPRecord{Key: key, Hash: hashOTP(key, "123456"), SentAt: time.Now().Add(-OTPResendCooldown - time.Second), ExpiresAt: time.Now().Add(time.Minute)})
+	code, err := IssueOTP(ctx, email, OTPPurposeRegister)
+	if err != nil {
+		t.Fatalf("IssueOTP after the cooldown: %v", err)
+	}
+	if code != "123456" {
+		if err := VerifyOTP(ctx, email, OTPPurposeRegister, "123456"); err != ErrOTPInvalid {
+			t.Fatalf("previous code = %v, want %v", err, ErrOTPInvalid)
+		}
+	}
+	if err := VerifyOTP(ctx, email, OTPPurposeRegister, code); err != nil {
+		t.Fatalf("new code = %v, want nil", err)
+	}
+}
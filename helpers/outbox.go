@@ -0,0 +1,182 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OutboxMaxAttempts  = 8
+	outboxBaseBackoff  = 30 * time.Second
+	outboxMaxBackoff   = time.Hour
+	outboxPollInterval = 5 * time.Second
+	outboxLease        = 5 * time.Minute // A worker that dies mid-send releases the message after this
+
+	outboxSentRetention = 7 * 24 * time.Hour
+	outboxDeadRetention = 30 * 24 * time.Hour // Time for an admin to requeue it
+)
+
+// EnqueueMail stores an email in the outbox; the outbox workers deliver it.
+func EnqueueMail(ctx context.Context, to string, email *RenderedEmail) error {
+	return EnqueueMailAt(ctx, to, email, time.Now())
+}
+
+// EnqueueMailAt stores an email that is not delivered before sendAt.
+func EnqueueMailAt(ctx context.Context, to string, email *RenderedEmail, sendAt time.Time) error {
+	return enqueue(ctx, model.OutboxMessage{
+		Channel:       model.OutboxChannelEmail,
+		To:            to,
+		Subject:       email.Subject,
+		HTMLBody:      email.HTML,
+		TextBody:      email.Text,
+		NextAttemptAt: sendAt,
+	})
+}
+
+// EnqueueSMS stores a text message that is not delivered before sendAt.
+func EnqueueSMS(ctx context.Context, to, body string, sendAt time.Time) error {
+	return enqueue(ctx, model.OutboxMessage{
+		Channel:       model.OutboxChannelSMS,
+		To:            to,
+		TextBody:      body,
+		NextAttemptAt: sendAt,
+	})
+}
+
+func enqueue(ctx context.Context, message model.OutboxMessage) error {
+	now := time.Now()
+	message.ID = primitive.NewObjectID()
+	message.Status = model.OutboxStatusPending
+	message.MaxAttempts = OutboxMaxAttempts
+	message.CreatedAt = now
+	message.UpdatedAt = now
+	_, err := database.GetCollection("outbox").InsertOne(ctx, message)
+	return err
+}
+
+// RequeueMail puts a dead message back at the front of the queue with a
+// fresh attempt budget. Sent messages are never sent again, and pending
+// ones are still being retried.
+func RequeueMail(ctx context.Context, id primitive.ObjectID) (*model.OutboxMessage, error) {
+	var message model.OutboxMessage
+	err := database.GetCollection("outbox").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": model.OutboxStatusDead},
+		bson.M{
+			"$set": bson.M{
+				"status":          model.OutboxStatusPending,
+				"attempts":        0,
+				"next_attempt_at": time.Now(),
+				"updated_at":      time.Now(),
+			},
+			"$unset": bson.M{"expires_at": ""},
+		},
+		options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"html_body": 0, "text_body": 0}), // Shown to the admin who requeued it
+	).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// StartOutboxWorkers starts a pool of workers that deliver outbox messages
+// with exponential backoff, dead-lettering them after MaxAttempts.
+func StartOutboxWorkers(mailer Mailer, sms SMSProvider, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				if !deliverNext(mailer, sms) {
+					time.Sleep(outboxPollInterval)
+				}
+			}
+		}()
+	}
+}
+
+// deliverNext claims and sends one due message. It reports whether there was one.
+func deliverNext(mailer Mailer, sms SMSProvider) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	collection := database.GetCollection("outbox")
+	now := time.Now()
+
+	var message model.OutboxMessage
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"$or": []bson.M{
+			{"status": model.OutboxStatusPending, "next_attempt_at": bson.M{"$lte": now}},
+			{"status": model.OutboxStatusSending, "locked_until": bson.M{"$lt": now}},
+		}},
+		bson.M{"$set": bson.M{
+			"status":       model.OutboxStatusSending,
+			"locked_until": now.Add(outboxLease),
+			"updated_at":   now,
+		}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&message)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("Error claiming outbox message:", err)
+		}
+		return false
+	}
+
+	var sendErr error
+	if message.Channel == model.OutboxChannelSMS {
+		sendErr = sms.Send(ctx, SMS{To: message.To, Body: message.TextBody})
+	} else {
+		sendErr = mailer.Send(ctx, Mail{To: message.To, Subject: message.Subject, HTML: message.HTMLBody, Text: message.TextBody})
+	}
+
+	update := bson.M{"updated_at": time.Now()}
+	var unset bson.M
+	if sendErr == nil {
+		update["status"] = model.OutboxStatusSent
+		update["sent_at"] = time.Now()
+		update["expires_at"] = time.Now().Add(outboxSentRetention)
+		unset = bson.M{"html_body": "", "text_body": ""}
+	} else {
+		attempts := message.Attempts + 1
+		update["attempts"] = attempts
+		update["last_error"] = sendErr.Error()
+		if attempts >= message.MaxAttempts {
+			update["status"] = model.OutboxStatusDead
+			update["expires_at"] = time.Now().Add(outboxDeadRetention)
+			log.Printf("Message %s to %s dead-lettered after %d attempts: %v\n", message.ID.Hex(), message.To, attempts, sendErr)
+		} else {
+			update["status"] = model.OutboxStatusPending
+			update["next_attempt_at"] = time.Now().Add(outboxBackoff(attempts))
+		}
+	}
+
+	changes := bson.M{"$set": update}
+	if unset != nil {
+		changes["$unset"] = unset
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": message.ID}, changes); err != nil {
+		log.Println("Error updating outbox message:", err)
+	}
+	return true
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"errors"
+	"unicode"
+)
+
+const MinPasswordLength = 8
+
+// ValidatePassword enforces the password policy for new and reset passwords.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return errors.New("password must be at least 8 characters long")
+	}
+
+	var hasUpper, hasLower, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+
+	if !hasUpper || !hasLower || !hasDigit {
+		return errors.New("password must contain an uppercase letter, a lowercase letter and a digit")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RealtimeEvent is pushed to connected clients, e.g. a new message or a
+// read receipt.
+type RealtimeEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// RealtimeClient is one open connection of a user. Events arrive on Send.
+type RealtimeClient struct {
+	UserID primitive.ObjectID
+	Send   chan RealtimeEvent
+}
+
+// realtimeBufferSize is how many events a slow client may fall behind
+// before further events are dropped for it.
+const realtimeBufferSize = 64
+
+// The hub only knows the connections of this process. Running several
+// instances would need a shared broker to fan events out.
+var realtimeHub = struct {
+	sync.RWMutex
+	clients map[primitive.ObjectID]map[*RealtimeClient]bool
+}{clients: map[primitive.ObjectID]map[*RealtimeClient]bool{}}
+
+func SubscribeRealtime(userID primitive.ObjectID) *RealtimeClient {
+	client := &RealtimeClient{UserID: userID, Send: make(chan RealtimeEvent, realtimeBufferSize)}
+	realtimeHub.Lock()
+	defer realtimeHub.Unlock()
+	if realtimeHub.clients[userID] == nil {
+		realtimeHub.clients[userID] = map[*RealtimeClient]bool{}
+	}
+	realtimeHub.clients[userID][client] = true
+	return client
+}
+
+func UnsubscribeRealtime(client *RealtimeClient) {
+	realtimeHub.Lock()
+	defer realtimeHub.Unlock()
+	delete(realtimeHub.clients[client.UserID], client)
+	if len(realtimeHub.clients[client.UserID]) == 0 {
+		delete(realtimeHub.clients, client.UserID)
+	}
+}
+
+// PublishRealtime sends the event to every connection of the users. It
+// never blocks: a client whose buffer is full misses the event.
+func PublishRealtime(userIDs []primitive.ObjectID, event RealtimeEvent) {
+	realtimeHub.RLock()
+	defer realtimeHub.RUnlock()
+	for _, userID := range userIDs {
+		for client := range realtimeHub.clients[userID] {
+			select {
+			case client.Send <- event:
+			default:
+			}
+		}
+	}
+}
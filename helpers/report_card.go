@@ -0,0 +1,277 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// ReportCard is everything printed on a student's term report card.
+type ReportCard struct {
+	SchoolName   string
+	Logo         []byte
+	LogoType     string // "PNG", "JPG" or "GIF"
+	AcademicYear string
+	Term         string
+	TermStart    time.Time
+	TermEnd      time.Time
+	StudentName  string
+	RollNumber   string
+	ClassName    string
+	Subjects     []ReportCardSubject
+	Average      float64
+	Letter       string
+	GPA          float64
+	HasAverage   bool
+	Attendance   ReportCardAttendance
+	Remark       string
+}
+
+type ReportCardSubject struct {
+	Name        string
+	Code        string
+	Teacher     string
+	Percent     float64
+	Letter      string
+	GPA         float64
+	Graded      bool
+	Remark      string
+	Assessments []ReportCardAssessment
+}
+
+type ReportCardAssessment struct {
+	Title    string
+	Type     string
+	Score    float64
+	MaxScore float64
+	Weight   float64
+	Excused  bool
+	Missing  bool
+}
+
+type ReportCardAttendance struct {
+	Present    int
+	Absent     int
+	Late       int
+	Excused    int
+	Percentage float64
+}
+
+// RenderReportCard writes the report card as a one-student A4 PDF.
+func RenderReportCard(w io.Writer, card ReportCard) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(card.StudentName+" - "+card.Term, true)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AliasNbPages("")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("Generated %s - page %d/{nb}", time.Now().Format("2 January 2006"), pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Header
+	textX := 10.0
+	if len(card.Logo) > 0 {
+		options := fpdf.ImageOptions{ImageType: card.LogoType, ReadDpi: true}
+		pdf.RegisterImageOptionsReader("logo", options, bytes.NewReader(card.Logo))
+		if pdf.Ok() {
+			pdf.ImageOptions("logo", 10, 10, 0, 20, false, options, 0, "")
+			textX = 35
+		} else {
+			// A broken logo should not cost the school its report cards
+			pdf.ClearError()
+		}
+	}
+	pdf.SetXY(textX, 11)
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 8, tr(card.SchoolName), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(0, 6, tr("Term Report Card - "+strings.TrimSpace(card.AcademicYear+" "+card.Term)), "", 2, "L", false, 0, "")
+	if !card.TermStart.IsZero() {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(0, 5, card.TermStart.Format("2 Jan 2006")+" - "+card.TermEnd.Format("2 Jan 2006"), "", 2, "L", false, 0, "")
+	}
+	pdf.SetY(35)
+	pdf.Line(10, 33, 200, 33)
+
+	// Student
+	info := [][2]string{{"Student", card.StudentName}, {"Class", card.ClassName}, {"Roll number", card.RollNumber}}
+	for _, row := range info {
+		if row[1] == "" {
+			continue
+		}
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(30, 6, tr(row[0]), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 6, tr(row[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// Term averages
+	sectionTitle(pdf, tr, "Subjects")
+	widths := []float64{60, 50, 25, 25, 30}
+	tableHeader(pdf, tr, widths, []string{"Subject", "Teacher", "Average", "Grade", "GPA"})
+	pdf.SetFont("Helvetica", "", 9)
+	for _, subject := range card.Subjects {
+		average, letter, gpa := "-", "-", "-"
+		if subject.Graded {
+			average = fmt.Sprintf("%.1f%%", subject.Percent)
+			letter = subject.Letter
+			gpa = fmt.Sprintf("%.2f", subject.GPA)
+		}
+		name := subject.Name
+		if subject.Code != "" {
+			name += " (" + subject.Code + ")"
+		}
+		for i, cell := range []string{name, subject.Teacher, average, letter, gpa} {
+			align := "L"
+			if i >= 2 {
+				align = "C"
+			}
+			pdf.CellFormat(widths[i], 6, tr(fitText(pdf, cell, widths[i]-2)), "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	if card.HasAverage {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(widths[0]+widths[1], 6, tr("Overall"), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 6, fmt.Sprintf("%.1f%%", card.Average), "1", 0, "C", false, 0, "")
+		pdf.CellFormat(widths[3], 6, tr(card.Letter), "1", 0, "C", false, 0, "")
+		pdf.CellFormat(widths[4], 6, fmt.Sprintf("%.2f", card.GPA), "1", 1, "C", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// Scores
+	sectionTitle(pdf, tr, "Assessment scores")
+	widths = []float64{50, 65, 25, 30, 20}
+	tableHeader(pdf, tr, widths, []string{"Subject", "Assessment", "Type", "Score", "Weight"})
+	pdf.SetFont("Helvetica", "", 9)
+	for _, subject := range card.Subjects {
+		for _, assessment := range subject.Assessments {
+			score := fmt.Sprintf("%g / %g", assessment.Score, assessment.MaxScore)
+			if assessment.Excused {
+				score = "Excused"
+			} else if assessment.Missing {
+				score = "-"
+			}
+			for i, cell := range []string{subject.Name, assessment.Title, assessment.Type, score, fmt.Sprintf("%g", assessment.Weight)} {
+				align := "L"
+				if i >= 2 {
+					align = "C"
+				}
+				pdf.CellFormat(widths[i], 6, tr(fitText(pdf, cell, widths[i]-2)), "1", 0, align, false, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+	}
+	pdf.Ln(4)
+
+	// Attendance
+	sectionTitle(pdf, tr, "Attendance")
+	widths = []float64{38, 38, 38, 38, 38}
+	tableHeader(pdf, tr, widths, []string{"Present", "Late", "Absent", "Excused", "Attendance"})
+	pdf.SetFont("Helvetica", "", 9)
+	attendance := card.Attendance
+	for i, cell := range []string{
+		fmt.Sprint(attendance.Present), fmt.Sprint(attendance.Late), fmt.Sprint(attendance.Absent),
+		fmt.Sprint(attendance.Excused), fmt.Sprintf("%.1f%%", attendance.Percentage),
+	} {
+		pdf.CellFormat(widths[i], 6, cell, "1", 0, "C", false, 0, "")
+	}
+	pdf.Ln(10)
+
+	// Remarks
+	remarks := false
+	for _, subject := range card.Subjects {
+		remarks = remarks || subject.Remark != ""
+	}
+	if remarks || card.Remark != "" {
+		sectionTitle(pdf, tr, "Remarks")
+		for _, subject := range card.Subjects {
+			if subject.Remark == "" {
+				continue
+			}
+			pdf.SetFont("Helvetica", "B", 9)
+			pdf.CellFormat(0, 5, tr(subject.Name), "", 1, "L", false, 0, "")
+			pdf.SetFont("Helvetica", "", 9)
+			pdf.MultiCell(0, 5, tr(subject.Remark), "", "L", false)
+			pdf.Ln(1)
+		}
+		if card.Remark != "" {
+			pdf.SetFont("Helvetica", "B", 9)
+			pdf.CellFormat(0, 5, tr("Class teacher"), "", 1, "L", false, 0, "")
+			pdf.SetFont("Helvetica", "", 9)
+			pdf.MultiCell(0, 5, tr(card.Remark), "", "L", false)
+		}
+	}
+
+	return pdf.Output(w)
+}
+
+func sectionTitle(pdf *fpdf.Fpdf, tr func(string) string, title string) {
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(0, 8, tr(title), "", 1, "L", false, 0, "")
+}
+
+func tableHeader(pdf *fpdf.Fpdf, tr func(string) string, widths []float64, titles []string) {
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(230, 230, 230)
+	for i, title := range titles {
+		pdf.CellFormat(widths[i], 7, tr(title), "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+// fitText shortens text with an ellipsis until it fits in width.
+func fitText(pdf *fpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// FetchImage downloads a logo for embedding in a PDF. It returns the image
+// type fpdf expects, and fails for anything but PNG, JPEG and GIF.
+func FetchImage(ctx context.Context, url string) ([]byte, string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetching %s: %s", url, response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, 2<<20))
+	if err != nil {
+		return nil, "", err
+	}
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return data, "PNG", nil
+	case "image/jpeg":
+		return data, "JPG", nil
+	case "image/gif":
+		return data, "GIF", nil
+	}
+	return nil, "", fmt.Errorf("unsupported logo format at %s", url)
+}
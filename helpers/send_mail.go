@@ -1,30 +1,113 @@
 package helpers
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/smtp"
+	"net/textproto"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
-func sendMail(email string, subject string, body string) error {
-	auth := smtp.PlainAuth("", os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASS"), os.Getenv("SMTP_HOST"))
+type Mail struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string // Plain-text alternative, optional
+}
 
-	msg := []byte("Subject: " + subject + "\r\n" +
-		"To: " + email + "\r\n" +
-		"MIME-Version: 1.0\r\n" +
-		"Content-Type: text/html; charset=\"utf-8\"\r\n" +
-		"\r\n" + body + "\r\n")
-
-	for {
-		err := smtp.SendMail(os.Getenv("SMTP_HOST")+":"+os.Getenv("SMTP_PORT"), auth, os.Getenv("SMTP_USER"), []string{email}, msg)
-		if err == nil {
-			fmt.Println("Email sent successfully to", email)
-			return nil
-		}
+// Mailer delivers a single email. Retries are the outbox's job, not the mailer's.
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
 
-		fmt.Println("Error sending email:", err)
-		fmt.Println("Retrying in 5 seconds...")
-		time.Sleep(5 * time.Second)
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	From     string
+}
+
+func NewSMTPMailerFromEnv() *SMTPMailer {
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USER")
+	}
+	return &SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		User:     os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASS"),
+		From:     from,
 	}
 }
+
+func (m *SMTPMailer) Send(ctx context.Context, mail Mail) error {
+	auth := smtp.PlainAuth("", m.User, m.Password, m.Host)
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{mail.To}, buildMessage(m.From, mail))
+}
+
+// LogMailer writes each email to a file in Dir instead of sending it, so the
+// app can run and be tested without a mail server.
+type LogMailer struct {
+	Dir string
+}
+
+func (m *LogMailer) Send(ctx context.Context, mail Mail) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(mail.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, buildMessage("noreply@localhost", mail), 0o644); err != nil {
+		return err
+	}
+
+	log.Printf("Email to %s (%q) written to %s\n", mail.To, mail.Subject, path)
+	return nil
+}
+
+// buildMessage builds a multipart/alternative message so clients that do
+// not render HTML show the plain-text part.
+func buildMessage(from string, mail Mail) []byte {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=\"utf-8\"", mail.Text},
+		{"text/html; charset=\"utf-8\"", mail.HTML},
+	}
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+		w, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.content))
+		qp.Close()
+	}
+	writer.Close()
+
+	return []byte("From: " + from + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", mail.Subject) + "\r\n" +
+		"To: " + mail.To + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"" + writer.Boundary() + "\"\r\n" +
+		"\r\n" + body.String())
+}
@@ -0,0 +1,44 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type SMS struct {
+	To   string
+	Body string
+}
+
+// SMSProvider delivers a single text message. Retries are the outbox's job,
+// as with Mailer.
+type SMSProvider interface {
+	Send(ctx context.Context, sms SMS) error
+}
+
+// LogSMSProvider writes each text message to a file in Dir instead of
+// sending it, so the app can run and be tested without an SMS gateway.
+type LogSMSProvider struct {
+	Dir string
+}
+
+func (p *LogSMSProvider) Send(ctx context.Context, sms SMS) error {
+	if err := os.MkdirAll(p.Dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("+", "", " ", "", "/", "_").Replace(sms.To)
+	name := fmt.Sprintf("%s-%s.txt", time.Now().Format("20060102T150405.000000000"), recipient)
+	path := filepath.Join(p.Dir, name)
+	if err := os.WriteFile(path, []byte("To: "+sms.To+"\n\n"+sms.Body+"\n"), 0o644); err != nil {
+		return err
+	}
+
+	log.Printf("SMS to %s written to %s\n", sms.To, path)
+	return nil
+}
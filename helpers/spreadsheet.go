@@ -0,0 +1,259 @@
+package helpers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSpreadsheetRows bounds the rows read from one file, header included.
+const MaxSpreadsheetRows = 10001
+
+// ReadSpreadsheet reads the rows of a CSV file or of the first sheet of an
+// XLSX workbook, chosen by the extension of name. Trailing empty rows are
+// dropped.
+func ReadSpreadsheet(file, name string) ([][]string, error) {
+	var rows [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		rows, err = readCSV(file)
+	case ".xlsx":
+		rows, err = readXLSX(file)
+	default:
+		return nil, errors.New("only .csv and .xlsx files can be imported")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for len(rows) > 0 && blankRow(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+	if len(rows) > MaxSpreadsheetRows {
+		return nil, fmt.Errorf("the file has more than %d rows", MaxSpreadsheetRows-1)
+	}
+	return rows, nil
+}
+
+// SpreadsheetDate parses a date cell: YYYY-MM-DD, DD/MM/YYYY, or the day
+// number XLSX stores dates as.
+func SpreadsheetDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "02/01/2006", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	if days, err := strconv.ParseFloat(value, 64); err == nil && days > 0 && days < 2958466 {
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(days)), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, use YYYY-MM-DD", value)
+}
+
+func blankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func readCSV(file string) ([][]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel writes a byte order mark
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) == MaxSpreadsheetRows {
+			return nil, fmt.Errorf("the file has more than %d rows", MaxSpreadsheetRows-1)
+		}
+		rows = append(rows, row)
+	}
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxText is a string item, either plain or split in formatted runs.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"` // One based, rows without content are left out
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readXLSX(file string) ([][]string, error) {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, errors.New("invalid XLSX file")
+	}
+	defer archive.Close()
+
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	readXML := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("invalid XLSX file: %s is missing", name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return xml.NewDecoder(r).Decode(v)
+	}
+
+	// The first sheet of the workbook, wherever it is stored
+	var workbook xlsxWorkbook
+	if err := readXML("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("the workbook has no sheets")
+	}
+	var rels xlsxRelationships
+	if err := readXML("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetFile := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RelID {
+			sheetFile = rel.Target
+		}
+	}
+	if sheetFile == "" {
+		return nil, errors.New("invalid XLSX file: the first sheet is missing")
+	}
+	if strings.HasPrefix(sheetFile, "/") {
+		sheetFile = strings.TrimPrefix(sheetFile, "/")
+	} else {
+		sheetFile = path.Join("xl", sheetFile)
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readXML("xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var sheet xlsxSheet
+	if err := readXML(sheetFile, &sheet); err != nil {
+		return nil, err
+	}
+	if len(sheet.Rows) > MaxSpreadsheetRows {
+		return nil, fmt.Errorf("the file has more than %d rows", MaxSpreadsheetRows-1)
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, sheetRow := range sheet.Rows {
+		if sheetRow.Number > MaxSpreadsheetRows {
+			return nil, fmt.Errorf("the file has more than %d rows", MaxSpreadsheetRows-1)
+		}
+		for len(rows) < sheetRow.Number-1 {
+			rows = append(rows, []string{})
+		}
+		row := []string{}
+		for i, cell := range sheetRow.Cells {
+			column := i
+			if cell.Ref != "" {
+				column = xlsxColumn(cell.Ref)
+			}
+			if column < 0 || column > 16383 {
+				return nil, fmt.Errorf("invalid XLSX file: bad cell reference %q", cell.Ref)
+			}
+			for len(row) <= column {
+				row = append(row, "")
+			}
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, fmt.Errorf("invalid XLSX file: bad shared string in %s", cell.Ref)
+				}
+				row[column] = shared.Items[index].String()
+			case "inlineStr":
+				row[column] = cell.Inline.String()
+			default:
+				row[column] = cell.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// xlsxColumn returns the zero based column of a cell reference like "AB12".
+func xlsxColumn(ref string) int {
+	column := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+	}
+	return column - 1
+}
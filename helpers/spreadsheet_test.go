@@ -0,0 +1,207 @@
+package helpers
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// writeTestXLSX writes a workbook holding the given parts, keyed by path.
+func writeTestXLSX(t *testing.T, parts map[string]string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "book.xlsx")
+	out, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(out)
+	for name, content := range parts {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	return file
+}
+
+const (
+	testWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Students" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	testRels     = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+func TestReadSpreadsheetCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name:    "plain",
+			content: "first_name,last_name\nJane,Doe\n",
+			want:    [][]string{{"first_name", "last_name"}, {"Jane", "Doe"}},
+		},
+		{
+			name:    "byte order mark and trailing blank rows",
+			content: "\xef\xbb\xbfemail\njane@example.com\n,\n  \n",
+			want:    [][]string{{"email"}, {"jane@example.com"}},
+		},
+		{
+			name:    "quoted fields and ragged rows",
+			content: "name,city\n\"Doe, Jane\",\"Accra\"\nJohn\n",
+			want:    [][]string{{"name", "city"}, {"Doe, Jane", "Accra"}, {"John"}},
+		},
+		{
+			name:    "header only",
+			content: "email\n",
+			want:    [][]string{{"email"}},
+		},
+		{
+			name:    "too many rows",
+			content: "email\n" + strings.Repeat("a@example.com\n", MaxSpreadsheetRows),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ReadSpreadsheet(writeTestFile(t, "upload", tt.content), "students.CSV")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadSpreadsheet: %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Fatalf("got %q, want %q", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSpreadsheetXLSX(t *testing.T) {
+	sheet := `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+		`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>dob</t></is></c></row>` +
+		`<row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3"><v>42</v></c><c r="C3"><v>45000</v></c></row>` +
+		`<row r="4"><c r="A4"><v></v></c></row>` +
+		`</sheetData></worksheet>`
+	shared := `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>name</t></si><si><r><t>Jane </t></r><r><t>Doe</t></r></si></sst>`
+
+	file := writeTestXLSX(t, map[string]string{
+		"xl/workbook.xml":            testWorkbook,
+		"xl/_rels/workbook.xml.rels": testRels,
+		"xl/sharedStrings.xml":       shared,
+		"xl/worksheets/sheet1.xml":   sheet,
+	})
+	rows, err := ReadSpreadsheet(file, "students.xlsx")
+	if err != nil {
+		t.Fatalf("ReadSpreadsheet: %v", err)
+	}
+	want := [][]string{
+		{"name", "", "dob"},
+		{},
+		{"Jane Doe", "42", "45000"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("got %q, want %q", rows, want)
+	}
+}
+
+func TestReadSpreadsheetXLSXErrors(t *testing.T) {
+	badShared := `<worksheet><sheetData><row r="1"><c r="A1" t="s"><v>7</v></c></row></sheetData></worksheet>`
+	tests := []struct {
+		name  string
+		parts map[string]string
+	}{
+		{"no workbook", map[string]string{"xl/worksheets/sheet1.xml": badShared}},
+		{"missing sheet", map[string]string{"xl/workbook.xml": testWorkbook, "xl/_rels/workbook.xml.rels": testRels}},
+		{"bad shared string", map[string]string{
+			"xl/workbook.xml":            testWorkbook,
+			"xl/_rels/workbook.xml.rels": testRels,
+			"xl/worksheets/sheet1.xml":   badShared,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadSpreadsheet(writeTestXLSX(t, tt.parts), "book.xlsx"); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	if _, err := ReadSpreadsheet(writeTestFile(t, "upload", "not a zip"), "book.xlsx"); err == nil {
+		t.Error("expected an error for a file that is not a workbook")
+	}
+	if _, err := ReadSpreadsheet(writeTestFile(t, "upload", "a,b"), "book.xls"); err == nil {
+		t.Error("expected an error for an unsupported extension")
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{"A1", 0},
+		{"B12", 1},
+		{"Z3", 25},
+		{"AA1", 26},
+		{"AB12", 27},
+		{"XFD1", 16383},
+		{"1", -1},
+	}
+	for _, tt := range tests {
+		if got := xlsxColumn(tt.ref); got != tt.want {
+			t.Errorf("xlsxColumn(%q) = %d, want %d", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestSpreadsheetDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2010-03-25", want: time.Date(2010, 3, 25, 0, 0, 0, 0, time.UTC)},
+		{value: " 25/03/2010 ", want: time.Date(2010, 3, 25, 0, 0, 0, 0, time.UTC)},
+		{value: "40262", want: time.Date(2010, 3, 25, 0, 0, 0, 0, time.UTC)},
+		{value: "03/25/2010", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := SpreadsheetDate(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) {
+				t.Fatalf("SpreadsheetDate(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/model"
+)
+
+const (
+	MaxUploadSize  = 10 << 20 // Per file
+	MaxUploadFiles = 5
+)
+
+// UploadDir is where uploaded files are kept, set by UPLOAD_DIR.
+func UploadDir() string {
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		return dir
+	}
+	return "tmp/uploads"
+}
+
+// SaveUploads stores the files under folder and describes them. On error
+// nothing is left behind.
+func SaveUploads(files []*multipart.FileHeader, folder string) ([]model.Attachment, error) {
+	if len(files) > MaxUploadFiles {
+		return nil, fmt.Errorf("at most %d files can be attached", MaxUploadFiles)
+	}
+	attachments := make([]model.Attachment, 0, len(files))
+	for _, file := range files {
+		attachment, err := saveUpload(file, folder)
+		if err != nil {
+			DeleteUploads(attachments, folder)
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+func saveUpload(file *multipart.FileHeader, folder string) (model.Attachment, error) {
+	if file.Size > MaxUploadSize {
+		return model.Attachment{}, fmt.Errorf("%s is larger than %d MB", file.Filename, MaxUploadSize>>20)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return model.Attachment{}, err
+	}
+	attachment := model.Attachment{
+		ID:          hex.EncodeToString(id),
+		Name:        filepath.Base(file.Filename),
+		ContentType: file.Header.Get("Content-Type"),
+		Size:        file.Size,
+		UploadedAt:  time.Now(),
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return attachment, err
+	}
+	defer src.Close()
+
+	dir := filepath.Join(UploadDir(), folder)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return attachment, err
+	}
+	dst, err := os.Create(filepath.Join(dir, attachment.ID))
+	if err != nil {
+		return attachment, err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
+		return attachment, err
+	}
+	return attachment, nil
+}
+
+// UploadPath is where an attachment's content is stored.
+func UploadPath(folder string, attachment model.Attachment) string {
+	return filepath.Join(UploadDir(), folder, filepath.Base(attachment.ID))
+}
+
+func DeleteUploads(attachments []model.Attachment, folder string) {
+	for _, attachment := range attachments {
+		os.Remove(UploadPath(folder, attachment))
+	}
+}
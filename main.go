@@ -2,9 +2,14 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
 
+	"github.com/ReddIndiann/go-messanger/controllers"
 	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/helpers"
+	"github.com/ReddIndiann/go-messanger/middleware"
 	"github.com/ReddIndiann/go-messanger/routes"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -14,9 +19,63 @@ func main() {
 
 	fmt.Println("Hey World")
 	database.Connect()
+	// Migrations come first so that old documents fit the unique indexes
+	if err := database.RunMigrations(); err != nil {
+		log.Fatal("Error running migrations", err)
+	}
+	if err := database.EnsureIndexes(); err != nil {
+		log.Fatal("Error creating indexes", err)
+	}
+
+	// Revoked tokens are kept in MongoDB so every replica sees a logout.
+	// REVOCATION_STORE=memory keeps them in process for local development.
+	if os.Getenv("REVOCATION_STORE") != "memory" {
+		store, err := middleware.NewMongoRevocationStore(database.GetCollection("revoked_tokens"))
+		if err != nil {
+			log.Fatal("Error setting up token revocation store", err)
+		}
+		middleware.SetRevocationStore(store)
+	}
+
+	if os.Getenv("OTP_STORE") != "memory" {
+		store, err := helpers.NewMongoOTPStore(database.GetCollection("otps"))
+		if err != nil {
+			log.Fatal("Error setting up OTP store", err)
+		}
+		helpers.SetOTPStore(store)
+	}
+
+	// Invitation emails link to the app's page for accepting them
+	if _, err := helpers.InvitationAcceptURL(); err != nil {
+		log.Fatal("Error configuring invitations: ", err)
+	}
+
+	// MAILER=log writes emails to MAIL_LOG_DIR instead of sending them
+	var mailer helpers.Mailer = helpers.NewSMTPMailerFromEnv()
+	if os.Getenv("MAILER") == "log" {
+		dir := os.Getenv("MAIL_LOG_DIR")
+		if dir == "" {
+			dir = "tmp/mail"
+		}
+		mailer = &helpers.LogMailer{Dir: dir}
+	}
+	// Only the log provider exists so far; SMS_LOG_DIR is where it writes
+	smsDir := os.Getenv("SMS_LOG_DIR")
+	if smsDir == "" {
+		smsDir = "tmp/sms"
+	}
+	var sms helpers.SMSProvider = &helpers.LogSMSProvider{Dir: smsDir}
+	workers, err := strconv.Atoi(os.Getenv("MAIL_WORKERS"))
+	if err != nil || workers < 1 {
+		workers = 2
+	}
+	helpers.StartOutboxWorkers(mailer, sms, workers)
+	controllers.StartAnnouncementDispatcher()
 
 	app := fiber.New(fiber.Config{
 		AppName: "School App",
+		// Room for a full set of homework attachments
+		BodyLimit: helpers.MaxUploadFiles*helpers.MaxUploadSize + 1<<20,
 	})
 
 	app.Use(cors.New(cors.Config{
@@ -29,6 +88,23 @@ func main() {
 	routes.SetupTeacherRoutes(app.Group("/teacher"))
 	routes.SetupStudentRoutes(app.Group("/student"))
 	routes.SetupSubjectRoutes(app.Group("/subject"))
+	routes.SetupDepartmentRoutes(app.Group("/department"))
+	routes.SetupClassRoutes(app.Group("/class"))
+	routes.SetupAcademicYearRoutes(app.Group("/academic-year"))
+	routes.SetupTermRoutes(app.Group("/term"))
+	routes.SetupAttendanceRoutes(app.Group("/attendance"))
+	routes.SetupGradebookRoutes(app.Group("/gradebook"))
+	routes.SetupReportCardRoutes(app.Group("/report-card"))
+	routes.SetupHomeworkRoutes(app.Group("/homework"))
+	routes.SetupDiaryRoutes(app.Group("/diary"))
+	routes.SetupTimetableRoutes(app.Group("/timetable"))
+	routes.SetupRolloverRoutes(app.Group("/rollovers"))
+	routes.SetupMessageRoutes(app.Group("/messaging"))
+	routes.SetupAnnouncementRoutes(app.Group("/announcements"))
+	routes.SetupGuardianRoutes(app.Group("/parent"))
+	routes.SetupInvitationRoutes(app.Group("/invitations"))
+	routes.SetupImportRoutes(app.Group("/imports"))
+	routes.SetupAdminRoutes(app.Group("/admin"))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -1,15 +1,20 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
+	"log"
 
 	"os"
-	"sync"
 	"time"
 
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/model"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type TokenDetails struct {
@@ -21,37 +26,7 @@ type TokenDetails struct {
 	RtExpires    int64
 }
 
-type TokenBlacklist struct {
-	blacklist map[string]int64 // Maps access_uuid to expiration time
-	mutex     sync.RWMutex
-}
-
-var tokenBlacklist = &TokenBlacklist{
-
-	blacklist: make(map[string]int64),
-}
-
-func (tb *TokenBlacklist) IsBlacklisted(accessUuid string) bool {
-
-	tb.mutex.RLock()
-	defer tb.mutex.RUnlock()
-
-	expTime, exist := tb.blacklist[accessUuid]
-	if !exist {
-		return false
-	}
-
-	if expTime < time.Now().Unix() {
-		tb.mutex.RUnlock()
-		tb.mutex.Lock()
-		delete(tb.blacklist, accessUuid)
-		tb.mutex.Unlock()
-		tb.mutex.RLocker()
-	}
-	return true
-}
-
-func GenerateTokens(userId primitive.ObjectID) (*TokenDetails, error) {
+func GenerateTokens(userId primitive.ObjectID, sessionId primitive.ObjectID) (*TokenDetails, error) {
 	td := &TokenDetails{}
 	td.AtExpires = time.Now().Add(time.Hour * 24).Unix()
 	td.AccessUuid = primitive.NewObjectID().Hex()
@@ -63,7 +38,9 @@ func GenerateTokens(userId primitive.ObjectID) (*TokenDetails, error) {
 	atClaims := jwt.MapClaims{}
 	atClaims["access_uuid"] = td.AccessUuid
 	atClaims["user_id"] = userId.Hex()
+	atClaims["session_id"] = sessionId.Hex()
 	atClaims["exp"] = td.AtExpires
+	atClaims["iat"] = time.Now().Unix()
 	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
 	td.AccessToken, err = at.SignedString([]byte(os.Getenv("JWT_SECRET")))
 
@@ -73,9 +50,12 @@ func GenerateTokens(userId primitive.ObjectID) (*TokenDetails, error) {
 
 	rtCliams := jwt.MapClaims{}
 	rtCliams["refresh_uuid"] = td.RefreshUuid
+	rtCliams["user_id"] = userId.Hex()
+	rtCliams["session_id"] = sessionId.Hex()
 	rtCliams["exp"] = td.RtExpires
+	rtCliams["iat"] = time.Now().Unix()
 
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
+	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtCliams)
 	td.RefreshToken, err = rt.SignedString([]byte(os.Getenv("JWT_REFRESH_SECRET")))
 
 	if err != nil {
@@ -85,42 +65,56 @@ func GenerateTokens(userId primitive.ObjectID) (*TokenDetails, error) {
 	return td, nil
 }
 
-func (tb *TokenBlacklist) AddToBlacklist(accessUuid string, expiresAt int64) {
-	tb.mutex.Lock()
-	defer tb.mutex.Unlock()
-	tb.blacklist[accessUuid] = expiresAt
-
+func StartCleanupRoutine() {
+	cleanupOnce.Do(func() {
+		go func() {
+			for {
+				time.Sleep(1 * time.Hour)
+				if store, ok := revocationStore.(interface{ Cleanup() }); ok {
+					store.Cleanup()
+				}
+			}
+		}()
+	})
 }
 
-func (tb *TokenBlacklist) CleanupBlacklist() {
-	tb.mutex.Lock()
+func BlacklistToken(accessUuid string, expiresAt int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return revocationStore.Revoke(ctx, accessUuid, time.Unix(expiresAt, 0))
+}
 
-	defer tb.mutex.Lock()
+// IsTokenBlaclisted fails closed: if the store cannot be reached the token is treated as revoked.
+func IsTokenBlaclisted(accessUuid string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	now := time.Now().Unix()
-	for uuid, expTime := range tb.blacklist {
-		if expTime < now {
-			delete(tb.blacklist, uuid)
-		}
+	revoked, err := revocationStore.IsRevoked(ctx, accessUuid)
+	if err != nil {
+		log.Println("Error checking token revocation:", err)
+		return true
 	}
+	return revoked
 }
 
-func StartCleanupRoutine() {
-	go func() {
-		for {
-			time.Sleep(1 * time.Hour)
-			tokenBlacklist.CleanupBlacklist()
-		}
-	}()
-
+// RevokeUserTokens invalidates every access and refresh token issued to the user so far.
+func RevokeUserTokens(userId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return revocationStore.RevokeUser(ctx, userId.Hex(), time.Now())
 }
 
-func BlacklistToken(accessUuid string, expiresAt int64) {
-	tokenBlacklist.AddToBlacklist(accessUuid, expiresAt)
-}
+// IsUserTokenRevoked reports whether a token issued at issuedAt was revoked by RevokeUserTokens.
+func IsUserTokenRevoked(userId primitive.ObjectID, issuedAt int64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-func IsTokenBlaclisted(accessUuid string) bool {
-	return tokenBlacklist.IsBlacklisted(accessUuid)
+	before, err := revocationStore.UserRevokedBefore(ctx, userId.Hex())
+	if err != nil {
+		log.Println("Error checking user token revocation:", err)
+		return true
+	}
+	return issuedAt < before.Unix()
 }
 
 func ExtractTokenMetadata(c *fiber.Ctx) (*AccessDetails, error) {
@@ -139,11 +133,6 @@ func ExtractTokenMetadata(c *fiber.Ctx) (*AccessDetails, error) {
 		return nil, fmt.Errorf("missing access_uuid in token")
 	}
 
-	// Check if token is blacklisted
-	if IsTokenBlaclisted(accessUuid) {
-		return nil, fmt.Errorf("token has been revoked")
-	}
-
 	userIdStr, ok := claims["user_id"].(string)
 	if !ok {
 		return nil, fmt.Errorf("missing user_id in token")
@@ -154,15 +143,64 @@ func ExtractTokenMetadata(c *fiber.Ctx) (*AccessDetails, error) {
 		return nil, fmt.Errorf("invalid user_id format in token")
 	}
 
-	return &AccessDetails{
+	sessionIdStr, _ := claims["session_id"].(string)
+	sessionId, err := primitive.ObjectIDFromHex(sessionIdStr)
+	if err != nil {
+		return nil, fmt.Errorf("missing session_id in token")
+	}
+
+	issuedAt, _ := claims["iat"].(float64)
+	expiresAt, _ := claims["exp"].(float64)
+	details := &AccessDetails{
 		AccessUuid: accessUuid,
 		UserId:     userId,
-	}, nil
+		SessionId:  sessionId,
+		IssuedAt:   int64(issuedAt),
+		ExpiresAt:  int64(expiresAt),
+	}
+	if err := checkRevocation(details); err != nil {
+		return nil, err
+	}
+	return details, nil
 }
 
 type AccessDetails struct {
 	AccessUuid string
 	UserId     primitive.ObjectID
+	SessionId  primitive.ObjectID
+	IssuedAt   int64
+	ExpiresAt  int64
+}
+
+// checkRevocation fails when the token, every token of the user or the
+// token's session has been revoked.
+func checkRevocation(details *AccessDetails) error {
+	if IsTokenBlaclisted(details.AccessUuid) {
+		return fmt.Errorf("token has been revoked")
+	}
+	if IsUserTokenRevoked(details.UserId, details.IssuedAt) {
+		return fmt.Errorf("token has been revoked")
+	}
+	// Revoking a session revokes every access token issued for it
+	if IsTokenBlaclisted(sessionRevocationKey(details.SessionId)) {
+		return fmt.Errorf("session has been revoked")
+	}
+	return nil
+}
+
+// RecheckAccess tells long-lived connections, such as WebSockets, whether
+// the token they were opened with has since expired or been revoked.
+func RecheckAccess(principal *Principal) error {
+	if time.Now().Unix() >= principal.ExpiresAt {
+		return fmt.Errorf("token has expired")
+	}
+	return checkRevocation(&AccessDetails{
+		AccessUuid: principal.AccessUuid,
+		UserId:     principal.UserID,
+		SessionId:  principal.SessionID,
+		IssuedAt:   principal.IssuedAt,
+		ExpiresAt:  principal.ExpiresAt,
+	})
 }
 
 func verifyToken(c *fiber.Ctx) (*jwt.Token, error) {
@@ -192,7 +230,7 @@ func ExtractToken(c *fiber.Ctx) string {
 }
 func JWTAuthMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		_, err := ExtractTokenMetadata(c)
+		tokenMetadata, err := ExtractTokenMetadata(c)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"status":  "error",
@@ -200,6 +238,47 @@ func JWTAuthMiddleware() fiber.Handler {
 				"error":   err.Error(),
 			})
 		}
+
+		// Load the user on every request so role changes apply immediately
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user model.User
+		opts := options.FindOne().SetProjection(bson.M{"password": 0})
+		err = database.GetCollection("users").FindOne(ctx, bson.M{"_id": tokenMetadata.UserId}, opts).Decode(&user)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Unauthorized",
+				"error":   "user no longer exists",
+			})
+		}
+
+		c.Locals(principalKey, &Principal{
+			UserID:     user.ID,
+			Email:      user.Email,
+			Role:       model.Role(user.Role),
+			SchoolIDs:  user.SchoolIDs,
+			TeacherID:  user.TeacherID,
+			StudentID:  user.StudentID,
+			ChildIDs:   user.ChildIDs,
+			AccessUuid: tokenMetadata.AccessUuid,
+			SessionID:  tokenMetadata.SessionId,
+			IssuedAt:   tokenMetadata.IssuedAt,
+			ExpiresAt:  tokenMetadata.ExpiresAt,
+		})
 		return c.Next()
 	}
 }
+
+// QueryTokenAuthMiddleware is JWTAuthMiddleware for clients that cannot set
+// headers, such as browser WebSockets: the access token may come in ?token=.
+func QueryTokenAuthMiddleware() fiber.Handler {
+	auth := JWTAuthMiddleware()
+	return func(c *fiber.Ctx) error {
+		if token := c.Query("token"); token != "" && c.Get("Authorization") == "" {
+			c.Request().Header.Set("Authorization", "Bearer "+token)
+		}
+		return auth(c)
+	}
+}
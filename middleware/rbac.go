@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Permission is an action on a resource, e.g. "school:delete".
+type Permission string
+
+const (
+	PermSchoolCreate Permission = "school:create"
+	PermSchoolRead   Permission = "school:read"
+	PermSchoolUpdate Permission = "school:update"
+	PermSchoolDelete Permission = "school:delete"
+
+	PermTeacherCreate Permission = "teacher:create"
+	PermTeacherRead   Permission = "teacher:read"
+	PermTeacherUpdate Permission = "teacher:update"
+	PermTeacherDelete Permission = "teacher:delete"
+
+	PermStudentCreate Permission = "student:create"
+	PermStudentRead   Permission = "student:read"
+	PermStudentUpdate Permission = "student:update"
+	PermStudentDelete Permission = "student:delete"
+
+	PermSubjectCreate Permission = "subject:create"
+	PermSubjectRead   Permission = "subject:read"
+	PermSubjectUpdate Permission = "subject:update"
+	PermSubjectDelete Permission = "subject:delete"
+
+	PermSubjectCatalogManage Permission = "subject_catalog:manage"
+
+	PermDepartmentCreate Permission = "department:create"
+	PermDepartmentRead   Permission = "department:read"
+	PermDepartmentUpdate Permission = "department:update"
+	PermDepartmentDelete Permission = "department:delete"
+
+	PermClassCreate Permission = "class:create"
+	PermClassRead   Permission = "class:read"
+	PermClassUpdate Permission = "class:update"
+	PermClassDelete Permission = "class:delete"
+
+	PermAcademicYearRead   Permission = "academic_year:read"
+	PermAcademicYearManage Permission = "academic_year:manage"
+	PermAcademicYearReopen Permission = "academic_year:reopen" // Platform admins only
+
+	PermAttendanceRead   Permission = "attendance:read"
+	PermAttendanceMark   Permission = "attendance:mark"   // Own classes only
+	PermAttendanceManage Permission = "attendance:manage" // Any class of the school
+
+	PermGradeRead   Permission = "grade:read"
+	PermGradeEnter  Permission = "grade:enter"  // Own subject offerings only
+	PermGradeManage Permission = "grade:manage" // Any offering of the school, and grading scales
+
+	PermHomeworkRead   Permission = "homework:read"
+	PermHomeworkAssign Permission = "homework:assign" // Own subject offerings only, unless grade:manage
+	PermHomeworkSubmit Permission = "homework:submit"
+
+	PermDiaryRead   Permission = "diary:read"
+	PermDiaryWrite  Permission = "diary:write"  // Own subject offerings only
+	PermDiaryManage Permission = "diary:manage" // Any offering of the school
+
+	PermTimetableRead   Permission = "timetable:read"
+	PermTimetableManage Permission = "timetable:manage"
+
+	PermRolloverManage Permission = "rollover:manage"
+
+	PermGuardianManage Permission = "guardian:manage" // Invite parents and link them to students
+
+	PermInvitationManage Permission = "invitation:manage" // List, resend and revoke invitations, invite teachers and students
+
+	PermImportManage Permission = "import:manage" // Bulk import, also needs the create permission of what is imported
+
+	PermMessageSend Permission = "message:send" // To users the contact rules allow
+
+	PermAnnouncementRead    Permission = "announcement:read"
+	PermAnnouncementPublish Permission = "announcement:publish" // Classes, offerings and the department of the teacher
+	PermAnnouncementManage  Permission = "announcement:manage"  // Any audience, and others' announcements
+
+	PermUserRead        Permission = "user:read"
+	PermUserUpdate      Permission = "user:update"
+	PermUserDelete      Permission = "user:delete"
+	PermUserManageRoles Permission = "user:manage_roles"
+
+	PermOutboxManage         Permission = "outbox:manage"
+	PermEmailTemplatePreview Permission = "email_template:preview"
+)
+
+// rolePermissions maps each role to the actions it may perform.
+// Platform admins are not listed, they are allowed everything.
+var rolePermissions = map[model.Role][]Permission{
+	model.RoleSchoolAdmin: {
+		PermSchoolRead, PermSchoolUpdate,
+		PermTeacherCreate, PermTeacherRead, PermTeacherUpdate, PermTeacherDelete,
+		PermStudentCreate, PermStudentRead, PermStudentUpdate, PermStudentDelete,
+		PermSubjectCreate, PermSubjectRead, PermSubjectUpdate, PermSubjectDelete,
+		PermSubjectCatalogManage,
+		PermDepartmentCreate, PermDepartmentRead, PermDepartmentUpdate, PermDepartmentDelete,
+		PermClassCreate, PermClassRead, PermClassUpdate, PermClassDelete,
+		PermAcademicYearRead, PermAcademicYearManage,
+		PermAttendanceRead, PermAttendanceMark, PermAttendanceManage,
+		PermGradeRead, PermGradeEnter, PermGradeManage,
+		PermHomeworkRead, PermHomeworkAssign,
+		PermDiaryRead, PermDiaryWrite, PermDiaryManage,
+		PermTimetableRead, PermTimetableManage,
+		PermRolloverManage,
+		PermGuardianManage,
+		PermInvitationManage,
+		PermImportManage,
+		PermMessageSend,
+		PermAnnouncementRead, PermAnnouncementPublish, PermAnnouncementManage,
+		PermUserRead,
+		PermEmailTemplatePreview,
+	},
+	model.RoleTeacher: {
+		PermSchoolRead,
+		PermTeacherRead,
+		PermStudentRead,
+		PermSubjectRead, PermSubjectUpdate,
+		PermDepartmentRead,
+		PermClassRead,
+		PermAcademicYearRead,
+		PermAttendanceRead, PermAttendanceMark,
+		PermGradeRead, PermGradeEnter,
+		PermHomeworkRead, PermHomeworkAssign,
+		PermDiaryRead, PermDiaryWrite,
+		PermTimetableRead,
+		PermMessageSend,
+		PermAnnouncementRead, PermAnnouncementPublish,
+	},
+	model.RoleParent: {
+		PermSchoolRead,
+		PermTeacherRead,
+		PermSubjectRead,
+		PermAcademicYearRead,
+		PermMessageSend,
+		PermAnnouncementRead,
+	},
+	model.RoleStudent: {
+		PermSchoolRead,
+		PermTeacherRead,
+		PermSubjectRead,
+		PermAcademicYearRead,
+		PermHomeworkSubmit,
+		PermMessageSend,
+		PermAnnouncementRead,
+	},
+}
+
+const principalKey = "principal"
+
+// Principal is the authenticated caller, stored in c.Locals by JWTAuthMiddleware.
+type Principal struct {
+	UserID     primitive.ObjectID
+	Email      string
+	Role       model.Role
+	SchoolIDs  []primitive.ObjectID
+	TeacherID  primitive.ObjectID   // Set when the account is linked to a teacher record
+	StudentID  primitive.ObjectID   // Set when the account is linked to a student record
+	ChildIDs   []primitive.ObjectID // Student records a parent account is linked to
+	AccessUuid string
+	SessionID  primitive.ObjectID
+	IssuedAt   int64 // Of the access token, in Unix seconds
+	ExpiresAt  int64
+}
+
+func (p *Principal) IsPlatformAdmin() bool {
+	return p.Role == model.RoleAdmin
+}
+
+func (p *Principal) Can(perm Permission) bool {
+	if p.IsPlatformAdmin() {
+		return true
+	}
+	for _, granted := range rolePermissions[p.Role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGuardianOf reports whether the student is one of a parent's children.
+func (p *Principal) IsGuardianOf(studentID string) bool {
+	for _, id := range p.ChildIDs {
+		if id.Hex() == studentID {
+			return true
+		}
+	}
+	return false
+}
+
+func GetPrincipal(c *fiber.Ctx) *Principal {
+	principal, _ := c.Locals(principalKey).(*Principal)
+	return principal
+}
+
+// Authorize lets the request through when the caller holds any of the given permissions.
+func Authorize(perms ...Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := GetPrincipal(c)
+		if principal == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Unauthorized",
+			})
+		}
+		for _, perm := range perms {
+			if principal.Can(perm) {
+				return c.Next()
+			}
+		}
+		return forbidden(c)
+	}
+}
+
+// AuthorizeSelfOr lets the request through when the route parameter is the
+// caller's own user ID, or when the caller holds the given permission.
+func AuthorizeSelfOr(param string, perm Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := GetPrincipal(c)
+		if principal == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Unauthorized",
+			})
+		}
+		if c.Params(param) == principal.UserID.Hex() || principal.Can(perm) {
+			return c.Next()
+		}
+		return forbidden(c)
+	}
+}
+
+// AuthorizeStudentOr lets the request through when the route parameter is
+// the student record linked to the caller's account, or one of the caller's
+// children, or when the caller holds the given permission.
+func AuthorizeStudentOr(param string, perm Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := GetPrincipal(c)
+		if principal == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Unauthorized",
+			})
+		}
+		if (!principal.StudentID.IsZero() && c.Params(param) == principal.StudentID.Hex()) || principal.IsGuardianOf(c.Params(param)) || principal.Can(perm) {
+			return c.Next()
+		}
+		return forbidden(c)
+	}
+}
+
+// AuthorizeTeacherOr lets the request through when the route parameter is
+// the teacher record linked to the caller's account, or when the caller
+// holds the given permission.
+func AuthorizeTeacherOr(param string, perm Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := GetPrincipal(c)
+		if principal == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Unauthorized",
+			})
+		}
+		if (!principal.TeacherID.IsZero() && c.Params(param) == principal.TeacherID.Hex()) || principal.Can(perm) {
+			return c.Next()
+		}
+		return forbidden(c)
+	}
+}
+
+func forbidden(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"status":  "error",
+		"message": "You do not have permission to perform this action",
+	})
+}
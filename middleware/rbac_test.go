@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/ReddIndiann/go-messanger/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPrincipalCan(t *testing.T) {
+	tests := []struct {
+		role    model.Role
+		perm    Permission
+		allowed bool
+	}{
+		{model.RoleAdmin, PermSchoolCreate, true},
+		{model.RoleAdmin, PermAcademicYearReopen, true},
+		{model.RoleSchoolAdmin, PermSchoolUpdate, true},
+		{model.RoleSchoolAdmin, PermGradeManage, true},
+		{model.RoleSchoolAdmin, PermSchoolCreate, false},
+		{model.RoleSchoolAdmin, PermAcademicYearReopen, false},
+		{model.RoleSchoolAdmin, PermUserManageRoles, false},
+		{model.RoleSchoolAdmin, PermOutboxManage, false},
+		{model.RoleTeacher, PermAttendanceMark, true},
+		{model.RoleTeacher, PermGradeEnter, true},
+		{model.RoleTeacher, PermAttendanceManage, false},
+		{model.RoleTeacher, PermGradeManage, false},
+		{model.RoleTeacher, PermStudentCreate, false},
+		{model.RoleParent, PermMessageSend, true},
+		{model.RoleParent, PermStudentRead, false},
+		{model.RoleParent, PermHomeworkSubmit, false},
+		{model.RoleStudent, PermHomeworkSubmit, true},
+		{model.RoleStudent, PermGradeEnter, false},
+		{model.RoleUser, PermSchoolRead, false},
+		{model.Role("unknown"), PermSchoolRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" "+string(tt.perm), func(t *testing.T) {
+			principal := &Principal{Role: tt.role}
+			if got := principal.Can(tt.perm); got != tt.allowed {
+				t.Fatalf("Can(%s) = %v, want %v", tt.perm, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRolePermissionsOmitPlatformAdmin(t *testing.T) {
+	if _, ok := rolePermissions[model.RoleAdmin]; ok {
+		t.Fatal("platform admins are allowed everything and must not be listed")
+	}
+	for role, perms := range rolePermissions {
+		seen := map[Permission]bool{}
+		for _, perm := range perms {
+			if seen[perm] {
+				t.Errorf("%s lists %s twice", role, perm)
+			}
+			seen[perm] = true
+		}
+	}
+}
+
+func TestPrincipalIsGuardianOf(t *testing.T) {
+	child := primitive.NewObjectID()
+	parent := &Principal{Role: model.RoleParent, ChildIDs: []primitive.ObjectID{child}}
+
+	tests := []struct {
+		name      string
+		studentID string
+		want      bool
+	}{
+		{"own child", child.Hex(), true},
+		{"other student", primitive.NewObjectID().Hex(), false},
+		{"empty id", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parent.IsGuardianOf(tt.studentID); got != tt.want {
+				t.Fatalf("IsGuardianOf(%q) = %v, want %v", tt.studentID, got, tt.want)
+			}
+		})
+	}
+}
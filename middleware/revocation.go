@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RevocationStore remembers revoked tokens until they expire. Individual
+// tokens are revoked by their uuid; RevokeUser revokes every token a user
+// was issued before a point in time ("log out everywhere").
+type RevocationStore interface {
+	Revoke(ctx context.Context, tokenUuid string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenUuid string) (bool, error)
+	RevokeUser(ctx context.Context, userId string, before time.Time) error
+	// UserRevokedBefore returns the zero time when the user has no revocation.
+	UserRevokedBefore(ctx context.Context, userId string) (time.Time, error)
+}
+
+// refreshTokenTTL bounds how long a user-wide revocation has to be remembered.
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+var (
+	revocationStore RevocationStore = NewMemoryRevocationStore()
+	cleanupOnce     sync.Once
+)
+
+// SetRevocationStore replaces the default in-memory store. Call it once at startup.
+func SetRevocationStore(store RevocationStore) {
+	revocationStore = store
+}
+
+// MemoryRevocationStore keeps revocations in process. It is lost on restart
+// and not shared between replicas, so it is meant for development and tests.
+type MemoryRevocationStore struct {
+	tokens map[string]time.Time // Maps token uuid to expiration time
+	users  map[string]time.Time // Maps user_id to the time before which its tokens are revoked
+	mutex  sync.RWMutex
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, tokenUuid string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens[tokenUuid] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, tokenUuid string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, exist := s.tokens[tokenUuid]
+	return exist, nil
+}
+
+func (s *MemoryRevocationStore) RevokeUser(ctx context.Context, userId string, before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.users[userId] = before
+	return nil
+}
+
+func (s *MemoryRevocationStore) UserRevokedBefore(ctx context.Context, userId string) (time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.users[userId], nil
+}
+
+// Cleanup drops revocations for tokens that have expired anyway.
+func (s *MemoryRevocationStore) Cleanup() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for uuid, expiresAt := range s.tokens {
+		if expiresAt.Before(now) {
+			delete(s.tokens, uuid)
+		}
+	}
+	for userId, before := range s.users {
+		if before.Add(refreshTokenTTL).Before(now) {
+			delete(s.users, userId)
+		}
+	}
+}
+
+// MongoRevocationStore persists revocations so they survive restarts and are
+// shared by every replica. A TTL index removes entries once they expire.
+type MongoRevocationStore struct {
+	collection *mongo.Collection
+}
+
+type revocationRecord struct {
+	ID            string    `bson:"_id"`
+	RevokedBefore time.Time `bson:"revoked_before,omitempty"`
+	ExpiresAt     time.Time `bson:"expires_at"`
+}
+
+func NewMongoRevocationStore(collection *mongo.Collection) (*MongoRevocationStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoRevocationStore{collection: collection}, nil
+}
+
+func (s *MongoRevocationStore) Revoke(ctx context.Context, tokenUuid string, expiresAt time.Time) error {
+	_, err := s.collection.ReplaceOne(ctx,
+		bson.M{"_id": "token:" + tokenUuid},
+		revocationRecord{ID: "token:" + tokenUuid, ExpiresAt: expiresAt},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoRevocationStore) IsRevoked(ctx context.Context, tokenUuid string) (bool, error) {
+	// The TTL monitor only runs once a minute, so check the expiry as well
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"_id":        "token:" + tokenUuid,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	return count > 0, err
+}
+
+func (s *MongoRevocationStore) RevokeUser(ctx context.Context, userId string, before time.Time) error {
+	_, err := s.collection.ReplaceOne(ctx,
+		bson.M{"_id": "user:" + userId},
+		revocationRecord{ID: "user:" + userId, RevokedBefore: before, ExpiresAt: before.Add(refreshTokenTTL)},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoRevocationStore) UserRevokedBefore(ctx context.Context, userId string) (time.Time, error) {
+	var record revocationRecord
+	err := s.collection.FindOne(ctx, bson.M{"_id": "user:" + userId}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return record.RevokedBefore, nil
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryRevocationStore()
+
+	store.Revoke(ctx, "expired", now.Add(-time.Minute))
+	store.Revoke(ctx, "active", now.Add(time.Hour))
+	store.RevokeUser(ctx, "old-user", now.Add(-refreshTokenTTL-time.Minute))
+	store.RevokeUser(ctx, "recent-user", now.Add(-time.Minute))
+
+	tokens := []struct {
+		uuid    string
+		revoked bool
+	}{
+		{"expired", true},
+		{"active", true},
+		{"unknown", false},
+	}
+	for _, tt := range tokens {
+		if revoked, _ := store.IsRevoked(ctx, tt.uuid); revoked != tt.revoked {
+			t.Errorf("before cleanup IsRevoked(%q) = %v, want %v", tt.uuid, revoked, tt.revoked)
+		}
+	}
+
+	store.Cleanup()
+
+	tokens[0].revoked = false
+	for _, tt := range tokens {
+		if revoked, _ := store.IsRevoked(ctx, tt.uuid); revoked != tt.revoked {
+			t.Errorf("after cleanup IsRevoked(%q) = %v, want %v", tt.uuid, revoked, tt.revoked)
+		}
+	}
+
+	users := []struct {
+		userID  string
+		revoked bool
+	}{
+		{"old-user", false},
+		{"recent-user", true},
+		{"unknown", false},
+	}
+	for _, tt := range users {
+		before, _ := store.UserRevokedBefore(ctx, tt.userID)
+		if revoked := !before.IsZero(); revoked != tt.revoked {
+			t.Errorf("after cleanup UserRevokedBefore(%q) = %v, want revoked %v", tt.userID, before, tt.revoked)
+		}
+	}
+}
+
+func TestRecheckAccess(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	principal := func() *Principal {
+		return &Principal{
+			UserID:     primitive.NewObjectID(),
+			AccessUuid: primitive.NewObjectID().Hex(),
+			SessionID:  primitive.NewObjectID(),
+			IssuedAt:   now.Add(-time.Hour).Unix(),
+			ExpiresAt:  now.Add(time.Hour).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		revoke func(store *MemoryRevocationStore, p *Principal)
+		valid  bool
+	}{
+		{"untouched", func(store *MemoryRevocationStore, p *Principal) {}, true},
+		{"expired", func(store *MemoryRevocationStore, p *Principal) { p.ExpiresAt = now.Unix() }, false},
+		{"token revoked", func(store *MemoryRevocationStore, p *Principal) {
+			store.Revoke(ctx, p.AccessUuid, now.Add(time.Hour))
+		}, false},
+		{"session revoked", func(store *MemoryRevocationStore, p *Principal) {
+			store.Revoke(ctx, sessionRevocationKey(p.SessionID), now.Add(time.Hour))
+		}, false},
+		{"user logged out everywhere", func(store *MemoryRevocationStore, p *Principal) {
+			store.RevokeUser(ctx, p.UserID.Hex(), now)
+		}, false},
+		{"user revoked before the token was issued", func(store *MemoryRevocationStore, p *Principal) {
+			store.RevokeUser(ctx, p.UserID.Hex(), now.Add(-2*time.Hour))
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryRevocationStore()
+			SetRevocationStore(store)
+			p := principal()
+			tt.revoke(store, p)
+			if err := RecheckAccess(p); (err == nil) != tt.valid {
+				t.Fatalf("RecheckAccess = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ReddIndiann/go-messanger/database"
+	"github.com/ReddIndiann/go-messanger/model"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+)
+
+func sessionRevocationKey(sessionId primitive.ObjectID) string {
+	return "session:" + sessionId.Hex()
+}
+
+// CreateSession records a new login for the request's device and issues its first token pair.
+func CreateSession(ctx context.Context, c *fiber.Ctx, userId primitive.ObjectID) (*model.Session, *TokenDetails, error) {
+	sessionId := primitive.NewObjectID()
+	tokens, err := GenerateTokens(userId, sessionId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	device := c.Get("X-Device-Name")
+	if device == "" {
+		device = "Unknown device"
+	}
+
+	now := time.Now()
+	session := &model.Session{
+		ID:          sessionId,
+		UserID:      userId,
+		RefreshUuid: tokens.RefreshUuid,
+		Device:      device,
+		IP:          c.IP(),
+		UserAgent:   c.Get("User-Agent"),
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   time.Unix(tokens.RtExpires, 0),
+	}
+
+	if _, err := database.GetCollection("sessions").InsertOne(ctx, session); err != nil {
+		return nil, nil, err
+	}
+	return session, tokens, nil
+}
+
+// RotateSession exchanges a refresh token for a new pair. Each refresh token
+// can be used once; presenting an already rotated one means it was stolen
+// or replayed, so the whole session is revoked.
+func RotateSession(ctx context.Context, c *fiber.Ctx, refreshToken string) (*TokenDetails, error) {
+	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_REFRESH_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	refreshUuid, _ := claims["refresh_uuid"].(string)
+	userIdStr, _ := claims["user_id"].(string)
+	sessionIdStr, _ := claims["session_id"].(string)
+	userId, err := primitive.ObjectIDFromHex(userIdStr)
+	if err != nil || refreshUuid == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	sessionId, err := primitive.ObjectIDFromHex(sessionIdStr)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	issuedAt, _ := claims["iat"].(float64)
+	if IsUserTokenRevoked(userId, int64(issuedAt)) {
+		return nil, ErrSessionRevoked
+	}
+
+	tokens, err := GenerateTokens(userId, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := database.GetCollection("sessions")
+	filter := bson.M{
+		"_id":          sessionId,
+		"user_id":      userId,
+		"refresh_uuid": refreshUuid,
+		"revoked_at":   bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{
+		"refresh_uuid": tokens.RefreshUuid,
+		"last_used_at": time.Now(),
+		"ip":           c.IP(),
+		"user_agent":   c.Get("User-Agent"),
+		"expires_at":   time.Unix(tokens.RtExpires, 0),
+	}}
+
+	err = collection.FindOneAndUpdate(ctx, filter, update).Err()
+	if err == nil {
+		return tokens, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	// The token is validly signed but not the session's current one
+	var session model.Session
+	err = collection.FindOne(ctx, bson.M{"_id": sessionId, "user_id": userId}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	if err := RevokeSession(ctx, sessionId, "refresh_token_reuse"); err != nil {
+		return nil, err
+	}
+	return nil, ErrRefreshTokenReused
+}
+
+// RevokeSession ends a session: its refresh token stops working and its
+// access tokens are rejected until they expire.
+func RevokeSession(ctx context.Context, sessionId primitive.ObjectID, reason string) error {
+	now := time.Now()
+	_, err := database.GetCollection("sessions").UpdateOne(ctx,
+		bson.M{"_id": sessionId, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now, "revoked_reason": reason}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Access tokens outlive nothing longer than a day
+	return revocationStore.Revoke(ctx, sessionRevocationKey(sessionId), now.Add(24*time.Hour))
+}
+
+// RevokeUserSessions ends every session of the user, e.g. after a password reset.
+func RevokeUserSessions(ctx context.Context, userId primitive.ObjectID, reason string) error {
+	_, err := database.GetCollection("sessions").UpdateMany(ctx,
+		bson.M{"user_id": userId, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now(), "revoked_reason": reason}},
+	)
+	if err != nil {
+		return err
+	}
+	return RevokeUserTokens(userId)
+}
+
+// ListUserSessions returns the user's active sessions, most recently used first.
+func ListUserSessions(ctx context.Context, userId primitive.ObjectID) ([]model.Session, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}})
+	cursor, err := database.GetCollection("sessions").Find(ctx, bson.M{
+		"user_id":    userId,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []model.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (p *Principal) BelongsToSchool(schoolID primitive.ObjectID) bool {
+	for _, id := range p.SchoolIDs {
+		if id == schoolID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessSchool reports whether the caller may read or write records of the given school.
+func CanAccessSchool(c *fiber.Ctx, schoolID primitive.ObjectID) bool {
+	principal := GetPrincipal(c)
+	if principal == nil {
+		return false
+	}
+	return principal.IsPlatformAdmin() || principal.BelongsToSchool(schoolID)
+}
+
+// TenantFilter restricts filter to the caller's schools by constraining field.
+// Platform admins see every school, and anyone may narrow the result to a
+// single school they can access with ?school_id=.
+func TenantFilter(c *fiber.Ctx, filter bson.M, field string) bson.M {
+	principal := GetPrincipal(c)
+
+	if schoolID, err := primitive.ObjectIDFromHex(c.Query("school_id")); err == nil {
+		if principal != nil && (principal.IsPlatformAdmin() || principal.BelongsToSchool(schoolID)) {
+			filter[field] = schoolID
+			return filter
+		}
+	}
+
+	if principal != nil && principal.IsPlatformAdmin() {
+		return filter
+	}
+
+	schoolIDs := []primitive.ObjectID{}
+	if principal != nil {
+		schoolIDs = append(schoolIDs, principal.SchoolIDs...)
+	}
+	filter[field] = bson.M{"$in": schoolIDs}
+	return filter
+}
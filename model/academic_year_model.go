@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PeriodStatusOpen   = "open"
+	PeriodStatusClosed = "closed" // Records of a closed period can no longer be edited
+)
+
+// AcademicYear is a school year, e.g. "2025/2026". Classes and subject
+// offerings belong to one.
+type AcademicYear struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID  primitive.ObjectID `bson:"school_id" json:"school_id"` // Reference to School
+	Name      string             `bson:"name" json:"name"`           // e.g., "2025/2026"
+	StartDate time.Time          `bson:"start_date" json:"start_date"`
+	EndDate   time.Time          `bson:"end_date" json:"end_date"`
+	Status    string             `bson:"status" json:"status"`         // open, closed
+	IsCurrent bool               `bson:"is_current" json:"is_current"` // At most one per school
+	CreatedAt time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// Term is a part of an academic year, e.g. "Term 1".
+type Term struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID       primitive.ObjectID `bson:"school_id" json:"school_id"`               // Reference to School
+	AcademicYearID primitive.ObjectID `bson:"academic_year_id" json:"academic_year_id"` // Reference to AcademicYear
+	Name           string             `bson:"name" json:"name"`                         // e.g., "Term 1"
+	StartDate      time.Time          `bson:"start_date" json:"start_date"`
+	EndDate        time.Time          `bson:"end_date" json:"end_date"`
+	Status         string             `bson:"status" json:"status"`         // open, closed
+	IsCurrent      bool               `bson:"is_current" json:"is_current"` // At most one per school
+	CreatedAt      time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
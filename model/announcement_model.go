@@ -0,0 +1,73 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AudienceSchool     = "school"
+	AudienceGrade      = "grade"      // Every class of the grade in the current academic year
+	AudienceClass      = "class"      // One class/section
+	AudienceSubject    = "subject"    // The roster of a SchoolSubject offering
+	AudienceDepartment = "department" // The department's teachers
+)
+
+const (
+	AnnouncementScheduled  = "scheduled"
+	AnnouncementPublishing = "publishing" // Claimed by the dispatcher, recipients are being added
+	AnnouncementPublished  = "published"
+)
+
+// Announcement is a notice from a school admin or teacher. When PublishAt
+// is reached the dispatcher works out the recipients of the audience, adds
+// it to their feed and, with EmailParents, emails the students' parents.
+type Announcement struct {
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	SchoolID       primitive.ObjectID   `bson:"school_id" json:"school_id"`
+	Title          string               `bson:"title" json:"title"`
+	Body           string               `bson:"body" json:"body"`
+	Audience       AnnouncementAudience `bson:"audience" json:"audience"`
+	PublishAt      time.Time            `bson:"publish_at" json:"publish_at"`
+	ExpiresAt      *time.Time           `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // Hidden from feeds afterwards
+	Pinned         bool                 `bson:"pinned" json:"pinned"`
+	EmailParents   bool                 `bson:"email_parents" json:"email_parents"`
+	Status         string               `bson:"status" json:"status"`
+	LockedUntil    time.Time            `bson:"locked_until,omitempty" json:"-"`
+	RecipientCount int                  `bson:"recipient_count" json:"recipient_count"`
+	EmailCount     int                  `bson:"email_count" json:"email_count"`
+	AuthorID       primitive.ObjectID   `bson:"author_id" json:"author_id"`
+	AuthorName     string               `bson:"author_name" json:"author_name"`
+	PublishedAt    *time.Time           `bson:"published_at,omitempty" json:"published_at,omitempty"`
+	CreatedAt      time.Time            `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt      time.Time            `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// AnnouncementAudience selects who receives an announcement. Only the field
+// of its Type is set.
+type AnnouncementAudience struct {
+	Type         string             `bson:"type" json:"type"`
+	Grade        string             `bson:"grade,omitempty" json:"grade,omitempty"`
+	ClassID      primitive.ObjectID `bson:"class_id,omitempty" json:"class_id,omitempty"`
+	SubjectID    primitive.ObjectID `bson:"subject_id,omitempty" json:"subject_id,omitempty"` // Reference to the SchoolSubject offering
+	DepartmentID primitive.ObjectID `bson:"department_id,omitempty" json:"department_id,omitempty"`
+}
+
+// AnnouncementRecipient puts an announcement in a user's feed and tracks
+// whether they have read it.
+type AnnouncementRecipient struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AnnouncementID primitive.ObjectID `bson:"announcement_id" json:"announcement_id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ReadAt         *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at,omitempty" json:"created_at"`
+}
+
+func IsValidAudience(audience string) bool {
+	switch audience {
+	case AudienceSchool, AudienceGrade, AudienceClass, AudienceSubject, AudienceDepartment:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AttendancePresent = "present"
+	AttendanceAbsent  = "absent"
+	AttendanceLate    = "late"
+	AttendanceExcused = "excused"
+)
+
+var AttendanceStatuses = []string{AttendancePresent, AttendanceAbsent, AttendanceLate, AttendanceExcused}
+
+func IsValidAttendanceStatus(status string) bool {
+	for _, s := range AttendanceStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// AttendanceSession is one roll call of a class on a day, either for the
+// whole day or for a single subject period.
+type AttendanceSession struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID       primitive.ObjectID `bson:"school_id" json:"school_id"`               // Reference to School
+	ClassID        primitive.ObjectID `bson:"class_id" json:"class_id"`                 // Reference to Class
+	SubjectID      primitive.ObjectID `bson:"subject_id" json:"subject_id"`             // Reference to SchoolSubject, empty for daily attendance
+	Period         int                `bson:"period" json:"period"`                     // Period of the day, 0 for daily attendance
+	Date           time.Time          `bson:"date" json:"date"`                         // Midnight UTC of the day
+	AcademicYearID primitive.ObjectID `bson:"academic_year_id" json:"academic_year_id"` // Reference to AcademicYear
+	TermID         primitive.ObjectID `bson:"term_id" json:"term_id"`                   // Reference to Term, empty outside terms
+	TakenBy        primitive.ObjectID `bson:"taken_by" json:"taken_by"`                 // Reference to User
+	CreatedAt      time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// AttendanceRecord is a student's status in a session. Session fields are
+// copied so records can be queried on their own.
+type AttendanceRecord struct {
+	ID             primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	SessionID      primitive.ObjectID     `bson:"session_id" json:"session_id"` // Reference to AttendanceSession
+	SchoolID       primitive.ObjectID     `bson:"school_id" json:"school_id"`
+	ClassID        primitive.ObjectID     `bson:"class_id" json:"class_id"`
+	SubjectID      primitive.ObjectID     `bson:"subject_id" json:"subject_id"`
+	StudentID      primitive.ObjectID     `bson:"student_id" json:"student_id"` // Reference to Student
+	Date           time.Time              `bson:"date" json:"date"`
+	AcademicYearID primitive.ObjectID     `bson:"academic_year_id" json:"academic_year_id"`
+	TermID         primitive.ObjectID     `bson:"term_id" json:"term_id"`
+	Status         string                 `bson:"status" json:"status"` // present, absent, late, excused
+	Remark         string                 `bson:"remark" json:"remark"`
+	MarkedBy       primitive.ObjectID     `bson:"marked_by" json:"marked_by"` // Reference to User
+	MarkedAt       time.Time              `bson:"marked_at" json:"marked_at"`
+	Corrections    []AttendanceCorrection `bson:"corrections" json:"corrections"` // Oldest first
+}
+
+// AttendanceCorrection records a change to a status after it was marked.
+type AttendanceCorrection struct {
+	PreviousStatus string             `bson:"previous_status" json:"previous_status"`
+	Status         string             `bson:"status" json:"status"`
+	Reason         string             `bson:"reason" json:"reason"`
+	CorrectedBy    primitive.ObjectID `bson:"corrected_by" json:"corrected_by"` // Reference to User
+	CorrectedAt    time.Time          `bson:"corrected_at" json:"corrected_at"`
+}
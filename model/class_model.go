@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Class is a grade/section group of students for one academic year, e.g.
+// "Grade 5 A" in 2025/2026. Students and subject offerings reference it.
+// Closing its academic year locks the class and its roster.
+type Class struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID          primitive.ObjectID `bson:"school_id" json:"school_id"`               // Reference to School
+	AcademicYearID    primitive.ObjectID `bson:"academic_year_id" json:"academic_year_id"` // Reference to AcademicYear
+	AcademicYear      string             `bson:"academic_year" json:"academic_year"`       // Copied from the academic year, e.g., "2025/2026"
+	Grade             string             `bson:"grade" json:"grade"`                       // e.g., "5", "JHS 1"
+	Section           string             `bson:"section" json:"section"`                   // e.g., "A", "Gold"
+	Name              string             `bson:"name" json:"name"`                         // Display name, defaults to "<grade> <section>"
+	HomeroomTeacherID primitive.ObjectID `bson:"homeroom_teacher_id" json:"homeroom_teacher_id"`
+	Capacity          int                `bson:"capacity" json:"capacity"` // 0 means no limit
+	CreatedAt         time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt         time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
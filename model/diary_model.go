@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DiaryEntry is a teacher's log of one lesson of a subject offering.
+type DiaryEntry struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID     primitive.ObjectID `bson:"school_id" json:"school_id"`
+	ClassID      primitive.ObjectID `bson:"class_id" json:"class_id"`
+	SubjectID    primitive.ObjectID `bson:"subject_id" json:"subject_id"` // Reference to the SchoolSubject offering
+	Date         time.Time          `bson:"date" json:"date"`
+	Period       int                `bson:"period" json:"period"` // 0 when the entry covers the whole day
+	Topic        string             `bson:"topic" json:"topic"`
+	Notes        string             `bson:"notes" json:"notes"`
+	Homework     string             `bson:"homework" json:"homework"`
+	AssignmentID primitive.ObjectID `bson:"assignment_id" json:"assignment_id"` // Optional link to the homework assignment
+	Resources    []DiaryResource    `bson:"resources" json:"resources"`
+	AuthorID     primitive.ObjectID `bson:"author_id" json:"author_id"`
+	CreatedAt    time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+type DiaryResource struct {
+	Title string `bson:"title" json:"title"`
+	URL   string `bson:"url" json:"url"`
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AssessmentQuiz       = "quiz"
+	AssessmentTest       = "test"
+	AssessmentExam       = "exam"
+	AssessmentAssignment = "assignment"
+)
+
+var AssessmentTypes = []string{AssessmentQuiz, AssessmentTest, AssessmentExam, AssessmentAssignment}
+
+func IsValidAssessmentType(assessmentType string) bool {
+	for _, t := range AssessmentTypes {
+		if t == assessmentType {
+			return true
+		}
+	}
+	return false
+}
+
+// Assessment is a marked piece of work in a subject offering. Its weight is
+// relative to the other assessments of the offering in the same term.
+type Assessment struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID       primitive.ObjectID `bson:"school_id" json:"school_id"`
+	SubjectID      primitive.ObjectID `bson:"subject_id" json:"subject_id"` // Reference to the SchoolSubject offering
+	ClassID        primitive.ObjectID `bson:"class_id" json:"class_id"`
+	AcademicYearID primitive.ObjectID `bson:"academic_year_id" json:"academic_year_id"`
+	TermID         primitive.ObjectID `bson:"term_id" json:"term_id"`
+	Title          string             `bson:"title" json:"title"`
+	Type           string             `bson:"type" json:"type"`
+	MaxScore       float64            `bson:"max_score" json:"max_score"`
+	Weight         float64            `bson:"weight" json:"weight"`
+	Date           time.Time          `bson:"date" json:"date"`
+	CreatedBy      primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt      time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// Score is one student's mark on an assessment. Excused scores are left out
+// of the term average.
+type Score struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AssessmentID primitive.ObjectID `bson:"assessment_id" json:"assessment_id"`
+	SchoolID     primitive.ObjectID `bson:"school_id" json:"school_id"`
+	SubjectID    primitive.ObjectID `bson:"subject_id" json:"subject_id"`
+	TermID       primitive.ObjectID `bson:"term_id" json:"term_id"`
+	StudentID    primitive.ObjectID `bson:"student_id" json:"student_id"`
+	Score        float64            `bson:"score" json:"score"`
+	Excused      bool               `bson:"excused" json:"excused"`
+	Remark       string             `bson:"remark" json:"remark"`
+	GradedBy     primitive.ObjectID `bson:"graded_by" json:"graded_by"`
+	CreatedAt    time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// GradingScale maps a percentage to a letter and grade point. A school
+// without a stored scale uses DefaultGradingScale.
+type GradingScale struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID  primitive.ObjectID `bson:"school_id" json:"school_id"`
+	Name      string             `bson:"name" json:"name"`
+	Bands     []GradeBand        `bson:"bands" json:"bands"` // Highest min_percent first
+	CreatedAt time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+type GradeBand struct {
+	MinPercent float64 `bson:"min_percent" json:"min_percent"`
+	Letter     string  `bson:"letter" json:"letter"`
+	GPA        float64 `bson:"gpa" json:"gpa"`
+}
+
+func DefaultGradingScale(schoolID primitive.ObjectID) GradingScale {
+	return GradingScale{
+		SchoolID: schoolID,
+		Name:     "Default",
+		Bands: []GradeBand{
+			{MinPercent: 90, Letter: "A", GPA: 4.0},
+			{MinPercent: 80, Letter: "B", GPA: 3.0},
+			{MinPercent: 70, Letter: "C", GPA: 2.0},
+			{MinPercent: 60, Letter: "D", GPA: 1.0},
+			{MinPercent: 0, Letter: "F", GPA: 0},
+		},
+	}
+}
+
+// Grade returns the band a percentage falls in.
+func (s GradingScale) Grade(percent float64) GradeBand {
+	for _, band := range s.Bands {
+		if percent >= band.MinPercent {
+			return band
+		}
+	}
+	return GradeBand{}
+}
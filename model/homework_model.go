@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Attachment is an uploaded file kept by helpers.SaveUpload.
+type Attachment struct {
+	ID          string    `bson:"id" json:"id"`
+	Name        string    `bson:"name" json:"name"`
+	ContentType string    `bson:"content_type" json:"content_type"`
+	Size        int64     `bson:"size" json:"size"`
+	UploadedAt  time.Time `bson:"uploaded_at" json:"uploaded_at"`
+}
+
+// Assignment is homework posted to a subject offering. When it carries a
+// weight, grading a submission also records the score on AssessmentID in
+// the gradebook.
+type Assignment struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID     primitive.ObjectID `bson:"school_id" json:"school_id"`
+	SubjectID    primitive.ObjectID `bson:"subject_id" json:"subject_id"` // Reference to the SchoolSubject offering
+	ClassID      primitive.ObjectID `bson:"class_id" json:"class_id"`
+	TeacherID    primitive.ObjectID `bson:"teacher_id" json:"teacher_id"` // Copied from the offering
+	AssessmentID primitive.ObjectID `bson:"assessment_id" json:"assessment_id"`
+	Title        string             `bson:"title" json:"title"`
+	Instructions string             `bson:"instructions" json:"instructions"`
+	DueAt        time.Time          `bson:"due_at" json:"due_at"`
+	AllowLate    bool               `bson:"allow_late" json:"allow_late"`
+	MaxScore     float64            `bson:"max_score" json:"max_score"`
+	Attachments  []Attachment       `bson:"attachments" json:"attachments"`
+	CreatedBy    primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt    time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// Submission is a student's answer to an assignment. Resubmitting replaces
+// it until it has been graded.
+type Submission struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AssignmentID primitive.ObjectID `bson:"assignment_id" json:"assignment_id"`
+	SchoolID     primitive.ObjectID `bson:"school_id" json:"school_id"`
+	SubjectID    primitive.ObjectID `bson:"subject_id" json:"subject_id"`
+	TeacherID    primitive.ObjectID `bson:"teacher_id" json:"teacher_id"` // Copied from the assignment
+	StudentID    primitive.ObjectID `bson:"student_id" json:"student_id"`
+	Text         string             `bson:"text" json:"text"`
+	Attachments  []Attachment       `bson:"attachments" json:"attachments"`
+	SubmittedAt  time.Time          `bson:"submitted_at" json:"submitted_at"`
+	Late         bool               `bson:"late" json:"late"`
+	Graded       bool               `bson:"graded" json:"graded"`
+	Score        float64            `bson:"score" json:"score"`
+	Feedback     string             `bson:"feedback" json:"feedback"`
+	GradedBy     primitive.ObjectID `bson:"graded_by" json:"graded_by"`
+	GradedAt     *time.Time         `bson:"graded_at,omitempty" json:"graded_at,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
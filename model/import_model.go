@@ -0,0 +1,73 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Import kinds, also the collections the records are created in.
+const (
+	ImportKindStudents = "students"
+	ImportKindTeachers = "teachers"
+)
+
+const (
+	ImportStatusUploaded  = "uploaded"  // Waiting for the column mapping to be confirmed
+	ImportStatusRunning   = "running"   // Dry run or import in progress
+	ImportStatusValidated = "validated" // Dry run done, ready to import
+	ImportStatusFailed    = "failed"    // Stopped part way, running it again resumes
+	ImportStatusCompleted = "completed"
+)
+
+const (
+	ImportRowValid     = "valid"     // Passed a dry run
+	ImportRowInvalid   = "invalid"   // See Errors, the row is not imported
+	ImportRowImporting = "importing" // Record being created, checked when an import resumes
+	ImportRowImported  = "imported"
+)
+
+// ImportJob imports students or teachers of a school from an uploaded CSV or
+// XLSX file. Every row is validated like a registration through the API; a
+// dry run reports the result without creating anything.
+type ImportJob struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID    primitive.ObjectID `bson:"school_id" json:"school_id"`
+	Kind        string             `bson:"kind" json:"kind"` // students or teachers
+	File        Attachment         `bson:"file" json:"file"`
+	Headers     []string           `bson:"headers" json:"headers"`
+	Mapping     map[string]string  `bson:"mapping" json:"mapping"` // Field to column header
+	DryRun      bool               `bson:"dry_run" json:"dry_run"` // Of the current or last run
+	Invite      bool               `bson:"invite" json:"invite"`   // Email invitations to imported records
+	Status      string             `bson:"status" json:"status"`
+	Counts      ImportCounts       `bson:"counts" json:"counts"`
+	Error       string             `bson:"error" json:"error"`
+	CreatedBy   primitive.ObjectID `bson:"created_by" json:"created_by"`
+	StartedAt   time.Time          `bson:"started_at,omitempty" json:"started_at"`
+	HeartbeatAt time.Time          `bson:"heartbeat_at,omitempty" json:"heartbeat_at"` // Refreshed while running
+	CompletedAt time.Time          `bson:"completed_at,omitempty" json:"completed_at"`
+	CreatedAt   time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+type ImportCounts struct {
+	Rows      int `bson:"rows" json:"rows"` // Data rows in the file, blank ones excluded
+	Processed int `bson:"processed" json:"processed"`
+	Valid     int `bson:"valid" json:"valid"`
+	Invalid   int `bson:"invalid" json:"invalid"`
+	Imported  int `bson:"imported" json:"imported"`
+}
+
+// ImportRow is the outcome of one row of the file in the last run.
+type ImportRow struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	JobID        primitive.ObjectID `bson:"job_id" json:"job_id"`
+	Row          int                `bson:"row" json:"row"` // Line in the file, the header is row 1
+	Email        string             `bson:"email" json:"email"`
+	Name         string             `bson:"name" json:"name"`
+	Status       string             `bson:"status" json:"status"`
+	Errors       []string           `bson:"errors" json:"errors"`
+	RecordID     primitive.ObjectID `bson:"record_id,omitempty" json:"record_id,omitempty"` // The student or teacher created
+	InvitationID primitive.ObjectID `bson:"invitation_id,omitempty" json:"invitation_id,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at,omitempty" json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+)
+
+// Invitation asks someone to create an account, or to link their existing
+// one, with the given role. Teacher and student invitations bind the account
+// to their record, a parent invitation to the children it carries. There is
+// at most one pending per email, role and school.
+type Invitation struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Role       string               `bson:"role" json:"role"`
+	Email      string               `bson:"email" json:"email"` // Lower case
+	Name       string               `bson:"name" json:"name"`
+	SchoolIDs  []primitive.ObjectID `bson:"school_ids" json:"school_ids"`
+	TeacherID  primitive.ObjectID   `bson:"teacher_id,omitempty" json:"teacher_id,omitempty"`
+	StudentID  primitive.ObjectID   `bson:"student_id,omitempty" json:"student_id,omitempty"`
+	ChildIDs   []primitive.ObjectID `bson:"child_ids,omitempty" json:"child_ids,omitempty"` // Parent invitations only
+	Status     string               `bson:"status" json:"status"`
+	Nonce      string               `bson:"nonce" json:"-"` // Part of the signed token, changed on resend so older links stop working
+	ExpiresAt  time.Time            `bson:"expires_at" json:"expires_at"`
+	InvitedBy  primitive.ObjectID   `bson:"invited_by" json:"invited_by"`
+	SentCount  int                  `bson:"sent_count" json:"sent_count"`
+	LastSentAt time.Time            `bson:"last_sent_at,omitempty" json:"last_sent_at"`
+	AcceptedBy primitive.ObjectID   `bson:"accepted_by,omitempty" json:"accepted_by,omitempty"` // The user account
+	AcceptedAt *time.Time           `bson:"accepted_at,omitempty" json:"accepted_at,omitempty"`
+	CreatedAt  time.Time            `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt  time.Time            `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+func (i *Invitation) Expired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ConversationDirect = "direct" // Between two users, at most one per pair
+	ConversationGroup  = "group"
+)
+
+// Conversation is a thread of messages between users.
+type Conversation struct {
+	ID             primitive.ObjectID        `bson:"_id,omitempty" json:"id"`
+	Type           string                    `bson:"type" json:"type"`
+	Title          string                    `bson:"title" json:"title"`            // Groups only
+	DirectKey      string                    `bson:"direct_key,omitempty" json:"-"` // Sorted user IDs of a direct conversation
+	ParticipantIDs []primitive.ObjectID      `bson:"participant_ids" json:"participant_ids"`
+	Participants   []ConversationParticipant `bson:"participants" json:"participants"`
+	CreatedBy      primitive.ObjectID        `bson:"created_by" json:"created_by"`
+	LastMessage    *MessagePreview           `bson:"last_message,omitempty" json:"last_message,omitempty"`
+	CreatedAt      time.Time                 `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt      time.Time                 `bson:"updated_at,omitempty" json:"updated_at"` // Time of the last message
+}
+
+// ConversationParticipant is a member of a conversation and how far they have read.
+type ConversationParticipant struct {
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name       string             `bson:"name" json:"name"`
+	Role       string             `bson:"role" json:"role"`
+	JoinedAt   time.Time          `bson:"joined_at" json:"joined_at"`
+	LastReadID primitive.ObjectID `bson:"last_read_id" json:"last_read_id"` // Latest message read, empty when none
+	LastReadAt time.Time          `bson:"last_read_at,omitempty" json:"last_read_at"`
+}
+
+type MessagePreview struct {
+	ID       primitive.ObjectID `bson:"id" json:"id"`
+	SenderID primitive.ObjectID `bson:"sender_id" json:"sender_id"`
+	Text     string             `bson:"text" json:"text"` // Shortened
+	SentAt   time.Time          `bson:"sent_at" json:"sent_at"`
+}
+
+type Message struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ConversationID primitive.ObjectID `bson:"conversation_id" json:"conversation_id"`
+	SenderID       primitive.ObjectID `bson:"sender_id" json:"sender_id"`
+	Text           string             `bson:"text" json:"text"`
+	Attachments    []Attachment       `bson:"attachments" json:"attachments"`
+	CreatedAt      time.Time          `bson:"created_at,omitempty" json:"created_at"`
+}
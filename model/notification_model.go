@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelSMS   = "sms"
+)
+
+// NotificationRule decides when a school's parents hear about attendance.
+// A school without a stored rule uses DefaultNotificationRule.
+type NotificationRule struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID primitive.ObjectID `bson:"school_id" json:"school_id"`
+	Enabled  bool               `bson:"enabled" json:"enabled"`
+	// Parents are told once a student has been absent this many school days in a row
+	ConsecutiveAbsences int      `bson:"consecutive_absences" json:"consecutive_absences"`
+	NotifyLate          bool     `bson:"notify_late" json:"notify_late"`
+	Channels            []string `bson:"channels" json:"channels"`
+	// Messages due in quiet hours ("HH:MM" in Timezone) wait until they end
+	QuietHoursStart string    `bson:"quiet_hours_start" json:"quiet_hours_start"`
+	QuietHoursEnd   string    `bson:"quiet_hours_end" json:"quiet_hours_end"`
+	Timezone        string    `bson:"timezone" json:"timezone"`
+	Locale          string    `bson:"locale" json:"locale"`
+	CreatedAt       time.Time `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt       time.Time `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+func DefaultNotificationRule(schoolID primitive.ObjectID) NotificationRule {
+	return NotificationRule{
+		SchoolID:            schoolID,
+		Enabled:             true,
+		ConsecutiveAbsences: 1,
+		Channels:            []string{NotificationChannelEmail, NotificationChannelSMS},
+		Timezone:            "UTC",
+		Locale:              "en",
+	}
+}
+
+func IsValidNotificationChannel(channel string) bool {
+	return channel == NotificationChannelEmail || channel == NotificationChannelSMS
+}
+
+// AttendanceNotification records that a student's parents were notified
+// about a status on a date, so a later session that day does not repeat it.
+type AttendanceNotification struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID        primitive.ObjectID `bson:"school_id" json:"school_id"`
+	StudentID       primitive.ObjectID `bson:"student_id" json:"student_id"`
+	RecordID        primitive.ObjectID `bson:"record_id" json:"record_id"`
+	Date            time.Time          `bson:"date" json:"date"`
+	Status          string             `bson:"status" json:"status"`
+	ConsecutiveDays int                `bson:"consecutive_days" json:"consecutive_days"`
+	Recipients      []string           `bson:"recipients" json:"recipients"`
+	SendAt          time.Time          `bson:"send_at" json:"send_at"`
+	CreatedAt       time.Time          `bson:"created_at,omitempty" json:"created_at"`
+}
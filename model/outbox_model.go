@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead" // Gave up after MaxAttempts, needs an admin to requeue
+)
+
+const (
+	OutboxChannelEmail = "email"
+	OutboxChannelSMS   = "sms"
+)
+
+// OutboxMessage is an email or text message waiting to be delivered by the
+// outbox workers. Messages without a channel are emails. Bodies can carry
+// codes and tokens, so they are dropped once sent and never shown to admins.
+type OutboxMessage struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Channel       string             `bson:"channel,omitempty" json:"channel"`
+	To            string             `bson:"to" json:"to"`
+	Subject       string             `bson:"subject" json:"subject"`
+	HTMLBody      string             `bson:"html_body,omitempty" json:"html_body,omitempty"`
+	TextBody      string             `bson:"text_body,omitempty" json:"text_body,omitempty"`
+	Status        string             `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	MaxAttempts   int                `bson:"max_attempts" json:"max_attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil   time.Time          `bson:"locked_until,omitempty" json:"-"`
+	LastError     string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	SentAt        *time.Time         `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	ExpiresAt     *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // Deleted afterwards, set once sent or dead
+	CreatedAt     time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReportCardRemark is a teacher's comment on a student's term report card,
+// either for one subject offering or, with no subject, for the whole term.
+type ReportCardRemark struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID  primitive.ObjectID `bson:"school_id" json:"school_id"`
+	StudentID primitive.ObjectID `bson:"student_id" json:"student_id"`
+	TermID    primitive.ObjectID `bson:"term_id" json:"term_id"`
+	SubjectID primitive.ObjectID `bson:"subject_id" json:"subject_id"` // Empty for the overall remark
+	Remark    string             `bson:"remark" json:"remark"`
+	AuthorID  primitive.ObjectID `bson:"author_id" json:"author_id"`
+	CreatedAt time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	RolloverStatusDraft     = "draft"     // Created or changed since its last dry run
+	RolloverStatusPreviewed = "previewed" // Dry run done, ready to run
+	RolloverStatusRunning   = "running"
+	RolloverStatusFailed    = "failed" // Stopped part way, running it again resumes
+	RolloverStatusCompleted = "completed"
+)
+
+const (
+	RolloverPromote  = "promote"  // Move to the next grade, same section
+	RolloverRetain   = "retain"   // Repeat the grade
+	RolloverGraduate = "graduate" // Leave the school with status Graduated
+)
+
+const (
+	RolloverStepClasses   = "classes"
+	RolloverStepStudents  = "students"
+	RolloverStepOfferings = "offerings"
+)
+
+const StudentStatusGraduated = "Graduated"
+
+// Rollover moves a school from one academic year to the next: it creates
+// the new year's classes, promotes, retains or graduates every student and
+// clones the subject offerings.
+type Rollover struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID       primitive.ObjectID `bson:"school_id" json:"school_id"`
+	FromYearID     primitive.ObjectID `bson:"from_year_id" json:"from_year_id"`
+	ToYearID       primitive.ObjectID `bson:"to_year_id" json:"to_year_id"`
+	Grades         []string           `bson:"grades" json:"grades"` // Grade order, students in the last one graduate
+	Overrides      []RolloverOverride `bson:"overrides" json:"overrides"`
+	CloneOfferings bool               `bson:"clone_offerings" json:"clone_offerings"`
+	Status         string             `bson:"status" json:"status"`
+	Step           string             `bson:"step" json:"step"` // Step being run, empty before the first run
+	Counts         RolloverCounts     `bson:"counts" json:"counts"`
+	Error          string             `bson:"error" json:"error"`
+	CreatedBy      primitive.ObjectID `bson:"created_by" json:"created_by"`
+	PreviewedAt    time.Time          `bson:"previewed_at,omitempty" json:"previewed_at"`
+	StartedAt      time.Time          `bson:"started_at,omitempty" json:"started_at"`
+	HeartbeatAt    time.Time          `bson:"heartbeat_at,omitempty" json:"heartbeat_at"` // Refreshed while running
+	CompletedAt    time.Time          `bson:"completed_at,omitempty" json:"completed_at"`
+	CreatedAt      time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// RolloverOverride replaces the default promotion of one student.
+type RolloverOverride struct {
+	StudentID primitive.ObjectID `bson:"student_id" json:"student_id"`
+	Action    string             `bson:"action" json:"action"` // promote, retain or graduate
+}
+
+type RolloverCounts struct {
+	ClassesCreated  int `bson:"classes_created" json:"classes_created"`
+	Promoted        int `bson:"promoted" json:"promoted"`
+	Retained        int `bson:"retained" json:"retained"`
+	Graduated       int `bson:"graduated" json:"graduated"`
+	OfferingsCloned int `bson:"offerings_cloned" json:"offerings_cloned"`
+}
+
+// RolloverStudent records what a rollover did to one student. It is written
+// before the student is changed so an interrupted run can finish the job.
+type RolloverStudent struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RolloverID  primitive.ObjectID `bson:"rollover_id" json:"rollover_id"`
+	StudentID   primitive.ObjectID `bson:"student_id" json:"student_id"`
+	Action      string             `bson:"action" json:"action"`
+	FromClassID primitive.ObjectID `bson:"from_class_id" json:"from_class_id"`
+	ToClassID   primitive.ObjectID `bson:"to_class_id" json:"to_class_id"` // Empty for graduates
+	Applied     bool               `bson:"applied" json:"applied"`
+	CreatedAt   time.Time          `bson:"created_at,omitempty" json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one login on one device. Its refresh token rotates on every
+// refresh; only the latest RefreshUuid is accepted.
+type Session struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
+	RefreshUuid   string             `bson:"refresh_uuid" json:"-"`
+	Device        string             `bson:"device" json:"device"`
+	IP            string             `bson:"ip" json:"ip"`
+	UserAgent     string             `bson:"user_agent" json:"user_agent"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt    time.Time          `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt     time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt     *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	RevokedReason string             `bson:"revoked_reason,omitempty" json:"revoked_reason,omitempty"`
+}
@@ -17,8 +17,7 @@ type Student struct {
 	DateOfBirth   time.Time          `bson:"date_of_birth" json:"date_of_birth"`
 	Gender        string             `bson:"gender" json:"gender"`
 	Address       Address            `bson:"address" json:"address"`
-	Grade         string             `bson:"grade" json:"grade"`     // e.g., "10th Grade"
-	Section       string             `bson:"section" json:"section"` // e.g., "A", "B"
+	ClassID       primitive.ObjectID `bson:"class_id" json:"class_id"` // Reference to Class
 	RollNumber    string             `bson:"roll_number" json:"roll_number"`
 	ParentDetails ParentDetails      `bson:"parent_details" json:"parent_details"`
 	Status        string             `bson:"status" json:"status"` // Active, Inactive, Graduated, etc.
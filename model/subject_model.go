@@ -6,16 +6,33 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Subject is a catalog entry, defined once per school and offered to many
+// classes through SchoolSubject.
+type Subject struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID    primitive.ObjectID `bson:"school_id" json:"school_id"` // Reference to School
+	Name        string             `bson:"name" json:"name"`           // e.g., "Mathematics", "Physics"
+	Code        string             `bson:"code" json:"code"`           // e.g., "MATH101", "PHY101", unique per school
+	Description string             `bson:"description" json:"description"`
+	CreatedAt   time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
+
+// SchoolSubject is an offering of a catalog subject to a grade and section.
 type SchoolSubject struct {
-	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Name        string               `bson:"name" json:"name"`
-	Description string               `bson:"description" json:"description"`
-	SchoolID    primitive.ObjectID   `bson:"school_id" json:"school_id"`     // Reference to School
-	TeacherID   primitive.ObjectID   `bson:"teacher_id" json:"teacher_id"`   // Reference to Teacher
-	StudentIDs  []primitive.ObjectID `bson:"student_ids" json:"student_ids"` // References to Students
-	Grade       string               `bson:"grade" json:"grade"`             // e.g., "10th Grade"
-	Section     string               `bson:"section" json:"section"`         // e.g., "A", "B"
-	Status      string               `bson:"status" json:"status"`           // e.g., "Active", "Inactive"
-	CreatedAt   time.Time            `bson:"created_at,omitempty" json:"created_at"`
-	UpdatedAt   time.Time            `bson:"updated_at,omitempty" json:"updated_at"`
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	SubjectID      primitive.ObjectID   `bson:"subject_id" json:"subject_id"` // Reference to the catalog Subject
+	Name           string               `bson:"name" json:"name"`             // Copied from the catalog subject
+	Code           string               `bson:"code" json:"code"`             // Copied from the catalog subject
+	Description    string               `bson:"description" json:"description"`
+	SchoolID       primitive.ObjectID   `bson:"school_id" json:"school_id"`                               // Reference to School
+	TeacherID      primitive.ObjectID   `bson:"teacher_id" json:"teacher_id"`                             // Reference to Teacher
+	StudentIDs     []primitive.ObjectID `bson:"student_ids" json:"student_ids"`                           // References to Students
+	ClassID        primitive.ObjectID   `bson:"class_id" json:"class_id"`                                 // Reference to Class
+	AcademicYearID primitive.ObjectID   `bson:"academic_year_id" json:"academic_year_id"`                 // Reference to AcademicYear
+	TermID         primitive.ObjectID   `bson:"term_id" json:"term_id"`                                   // Reference to Term, empty for the whole year
+	Status         string               `bson:"status" json:"status"`                                     // e.g., "Active", "Inactive"
+	ClonedFromID   primitive.ObjectID   `bson:"cloned_from_id,omitempty" json:"cloned_from_id,omitempty"` // Offering of the previous year it was rolled over from
+	CreatedAt      time.Time            `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt      time.Time            `bson:"updated_at,omitempty" json:"updated_at"`
 }
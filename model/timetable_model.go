@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TimetableSlot schedules a subject offering for one weekly lesson. The
+// class, teacher, year and term are copied from the offering so conflicts
+// can be found with one query.
+type TimetableSlot struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SchoolID       primitive.ObjectID `bson:"school_id" json:"school_id"`
+	SubjectID      primitive.ObjectID `bson:"subject_id" json:"subject_id"` // Reference to the SchoolSubject offering
+	ClassID        primitive.ObjectID `bson:"class_id" json:"class_id"`
+	TeacherID      primitive.ObjectID `bson:"teacher_id" json:"teacher_id"`
+	AcademicYearID primitive.ObjectID `bson:"academic_year_id" json:"academic_year_id"`
+	TermID         primitive.ObjectID `bson:"term_id" json:"term_id"`       // Empty when the offering runs all year
+	Day            int                `bson:"day" json:"day"`               // ISO weekday, 1 is Monday and 7 is Sunday
+	Period         int                `bson:"period" json:"period"`         // Optional period number shown on the timetable
+	StartTime      string             `bson:"start_time" json:"start_time"` // "HH:MM"
+	EndTime        string             `bson:"end_time" json:"end_time"`     // "HH:MM"
+	Room           string             `bson:"room" json:"room"`
+	RoomKey        string             `bson:"room_key" json:"-"` // Lowercased room, for matching
+	CreatedAt      time.Time          `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+}
@@ -7,20 +7,41 @@ import (
 )
 
 type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	Email     string             `bson:"email" json:"email"`
-	Password  string             `bson:"password,omitempty" json:"-"`
-	Phone     string             `bson:"phone" json:"phone"`
-	Verified  bool               `bson:"verified" json:"verified"`
-	Role      string             `bson:"role" json:"role"`
-	CreatedAt time.Time          `bson:"created_at,omitempty" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at,omitempty" json:"updated_at"`
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name      string               `bson:"name" json:"name"`
+	Email     string               `bson:"email" json:"email"`
+	Password  string               `bson:"password,omitempty" json:"-"`
+	Phone     string               `bson:"phone" json:"phone"`
+	Verified  bool                 `bson:"verified" json:"verified"`
+	Role      string               `bson:"role" json:"role"`
+	SchoolIDs []primitive.ObjectID `bson:"school_ids" json:"school_ids"`                     // Schools the user is a member of
+	Locale    string               `bson:"locale,omitempty" json:"locale,omitempty"`         // e.g. "en", "fr", used for emails
+	TeacherID primitive.ObjectID   `bson:"teacher_id,omitempty" json:"teacher_id,omitempty"` // Teacher record of a teacher account
+	StudentID primitive.ObjectID   `bson:"student_id,omitempty" json:"student_id,omitempty"` // Student record of a student account
+	ChildIDs  []primitive.ObjectID `bson:"child_ids,omitempty" json:"child_ids,omitempty"`   // Student records of a parent account
+	CreatedAt time.Time            `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt time.Time            `bson:"updated_at,omitempty" json:"updated_at"`
 }
 
 type Role string
 
 const (
-	RoleAdmin Role = "admin"
-	RoleUser  Role = "user"
+	RoleAdmin       Role = "admin" // Platform admin, manages every school
+	RoleSchoolAdmin Role = "school_admin"
+	RoleTeacher     Role = "teacher"
+	RoleParent      Role = "parent"
+	RoleStudent     Role = "student"
+	RoleUser        Role = "user" // Registered but not yet granted a role
 )
+
+// Roles lists every role an admin may grant.
+var Roles = []Role{RoleAdmin, RoleSchoolAdmin, RoleTeacher, RoleParent, RoleStudent, RoleUser}
+
+func IsValidRole(role string) bool {
+	for _, r := range Roles {
+		if string(r) == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupAcademicYearRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Academic year routes
+	api.Post("/register", middleware.Authorize(middleware.PermAcademicYearManage), controllers.CreateAcademicYear())
+	api.Get("/", middleware.Authorize(middleware.PermAcademicYearRead), controllers.ListAcademicYears())
+	api.Get("/:id", middleware.Authorize(middleware.PermAcademicYearRead), controllers.GetAcademicYear())
+	api.Put("/:id", middleware.Authorize(middleware.PermAcademicYearManage), controllers.UpdateAcademicYear())
+	api.Delete("/:id", middleware.Authorize(middleware.PermAcademicYearManage), controllers.DeleteAcademicYear())
+	api.Post("/:id/current", middleware.Authorize(middleware.PermAcademicYearManage), controllers.SetCurrentAcademicYear())
+	api.Post("/:id/close", middleware.Authorize(middleware.PermAcademicYearManage), controllers.CloseAcademicYear())
+	api.Post("/:id/reopen", middleware.Authorize(middleware.PermAcademicYearReopen), controllers.ReopenAcademicYear())
+}
+
+func SetupTermRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Term routes
+	api.Post("/register", middleware.Authorize(middleware.PermAcademicYearManage), controllers.CreateTerm())
+	api.Get("/", middleware.Authorize(middleware.PermAcademicYearRead), controllers.ListTerms())
+	api.Get("/:id", middleware.Authorize(middleware.PermAcademicYearRead), controllers.GetTerm())
+	api.Put("/:id", middleware.Authorize(middleware.PermAcademicYearManage), controllers.UpdateTerm())
+	api.Delete("/:id", middleware.Authorize(middleware.PermAcademicYearManage), controllers.DeleteTerm())
+	api.Post("/:id/current", middleware.Authorize(middleware.PermAcademicYearManage), controllers.SetCurrentTerm())
+	api.Post("/:id/close", middleware.Authorize(middleware.PermAcademicYearManage), controllers.CloseTerm())
+	api.Post("/:id/reopen", middleware.Authorize(middleware.PermAcademicYearReopen), controllers.ReopenTerm())
+}
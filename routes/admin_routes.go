@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupAdminRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Email outbox routes
+	api.Get("/outbox", middleware.Authorize(middleware.PermOutboxManage), controllers.ListOutboxMessages())
+	api.Get("/outbox/:id", middleware.Authorize(middleware.PermOutboxManage), controllers.GetOutboxMessage())
+	api.Post("/outbox/:id/requeue", middleware.Authorize(middleware.PermOutboxManage), controllers.RequeueOutboxMessage())
+
+	// Email template routes
+	api.Get("/email-templates", middleware.Authorize(middleware.PermEmailTemplatePreview), controllers.ListEmailTemplates())
+	api.Get("/email-templates/:name/preview", middleware.Authorize(middleware.PermEmailTemplatePreview), controllers.PreviewEmailTemplate())
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupAnnouncementRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Feed routes
+	api.Get("/feed", middleware.Authorize(middleware.PermAnnouncementRead), controllers.AnnouncementFeed())
+	api.Post("/:id/read", middleware.Authorize(middleware.PermAnnouncementRead), controllers.MarkAnnouncementRead())
+
+	// Announcement routes
+	api.Post("/", middleware.Authorize(middleware.PermAnnouncementPublish), controllers.CreateAnnouncement())
+	api.Get("/", middleware.Authorize(middleware.PermAnnouncementPublish), controllers.ListAnnouncements())
+	api.Get("/:id", middleware.Authorize(middleware.PermAnnouncementRead), controllers.GetAnnouncement())
+	api.Put("/:id", middleware.Authorize(middleware.PermAnnouncementPublish), controllers.UpdateAnnouncement())
+	api.Delete("/:id", middleware.Authorize(middleware.PermAnnouncementPublish), controllers.DeleteAnnouncement())
+	api.Post("/:id/publish", middleware.Authorize(middleware.PermAnnouncementPublish), controllers.PublishAnnouncement())
+	api.Get("/:id/reads", middleware.Authorize(middleware.PermAnnouncementPublish), controllers.AnnouncementReads())
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupAttendanceRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Session routes
+	api.Post("/sessions", middleware.Authorize(middleware.PermAttendanceMark), controllers.TakeAttendance())
+	api.Get("/sessions", middleware.Authorize(middleware.PermAttendanceRead), controllers.ListAttendanceSessions())
+	api.Get("/sessions/:id", middleware.Authorize(middleware.PermAttendanceRead), controllers.GetAttendanceSession())
+	api.Put("/records/:id", middleware.Authorize(middleware.PermAttendanceMark), controllers.CorrectAttendanceRecord())
+
+	// Report routes
+	api.Get("/students/:id", middleware.AuthorizeStudentOr("id", middleware.PermAttendanceRead), controllers.ListStudentAttendance())
+	api.Get("/students/:id/summary", middleware.AuthorizeStudentOr("id", middleware.PermAttendanceRead), controllers.StudentAttendanceSummary())
+	api.Get("/classes/:id", middleware.Authorize(middleware.PermAttendanceRead), controllers.ListClassAttendance())
+	api.Get("/classes/:id/summary", middleware.Authorize(middleware.PermAttendanceRead), controllers.ClassAttendanceSummary())
+
+	// Parent notification routes
+	api.Get("/notification-rules/:schoolId", middleware.Authorize(middleware.PermAttendanceRead), controllers.GetNotificationRule())
+	api.Put("/notification-rules/:schoolId", middleware.Authorize(middleware.PermAttendanceManage), controllers.UpdateNotificationRule())
+	api.Get("/notifications", middleware.Authorize(middleware.PermAttendanceManage), controllers.ListAttendanceNotifications())
+}
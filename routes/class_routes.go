@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupClassRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Class routes
+	api.Post("/register", middleware.Authorize(middleware.PermClassCreate), controllers.CreateClass())
+	api.Get("/", middleware.Authorize(middleware.PermClassRead), controllers.ListClasses())
+	api.Get("/:id", middleware.Authorize(middleware.PermClassRead), controllers.GetClass())
+	api.Put("/:id", middleware.Authorize(middleware.PermClassUpdate), controllers.UpdateClass())
+	api.Delete("/:id", middleware.Authorize(middleware.PermClassDelete), controllers.DeleteClass())
+
+	// Roster routes
+	api.Get("/:id/students", middleware.Authorize(middleware.PermClassRead, middleware.PermStudentRead), controllers.ListClassStudents())
+	api.Post("/:id/students", middleware.Authorize(middleware.PermClassUpdate, middleware.PermStudentUpdate), controllers.AddClassStudents())
+	api.Delete("/:id/students/:studentId", middleware.Authorize(middleware.PermClassUpdate, middleware.PermStudentUpdate), controllers.RemoveClassStudent())
+	api.Post("/:id/students/:studentId/transfer", middleware.Authorize(middleware.PermClassUpdate, middleware.PermStudentUpdate), controllers.TransferClassStudent())
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupDepartmentRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Department routes
+	api.Post("/register", middleware.Authorize(middleware.PermDepartmentCreate), controllers.CreateDepartment())
+	api.Get("/", middleware.Authorize(middleware.PermDepartmentRead), controllers.ListDepartments())
+	api.Get("/:id", middleware.Authorize(middleware.PermDepartmentRead), controllers.GetDepartment())
+	api.Get("/:id/teachers", middleware.Authorize(middleware.PermDepartmentRead, middleware.PermTeacherRead), controllers.ListDepartmentTeachers())
+	api.Put("/:id", middleware.Authorize(middleware.PermDepartmentUpdate), controllers.UpdateDepartment())
+	api.Delete("/:id", middleware.Authorize(middleware.PermDepartmentDelete), controllers.DeleteDepartment())
+}
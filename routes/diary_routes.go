@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupDiaryRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Entry routes
+	api.Post("/entries", middleware.Authorize(middleware.PermDiaryWrite), controllers.CreateDiaryEntry())
+	api.Get("/entries", middleware.Authorize(middleware.PermDiaryRead), controllers.ListDiaryEntries())
+	api.Get("/entries/:id", middleware.Authorize(middleware.PermDiaryRead), controllers.GetDiaryEntry())
+	api.Put("/entries/:id", middleware.Authorize(middleware.PermDiaryWrite), controllers.UpdateDiaryEntry())
+	api.Delete("/entries/:id", middleware.Authorize(middleware.PermDiaryWrite), controllers.DeleteDiaryEntry())
+
+	// Week routes
+	api.Get("/classes/:id/week", middleware.Authorize(middleware.PermDiaryRead), controllers.ClassDiaryWeek())
+	api.Get("/classes/:id/missing", middleware.Authorize(middleware.PermDiaryRead), controllers.ListMissingDiaryEntries())
+	api.Get("/students/:id/week", middleware.AuthorizeStudentOr("id", middleware.PermDiaryRead), controllers.StudentDiaryWeek())
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupGradebookRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Assessment routes
+	api.Post("/assessments", middleware.Authorize(middleware.PermGradeEnter), controllers.CreateAssessment())
+	api.Get("/assessments", middleware.Authorize(middleware.PermGradeRead), controllers.ListAssessments())
+	api.Get("/assessments/:id", middleware.Authorize(middleware.PermGradeRead), controllers.GetAssessment())
+	api.Put("/assessments/:id", middleware.Authorize(middleware.PermGradeEnter), controllers.UpdateAssessment())
+	api.Delete("/assessments/:id", middleware.Authorize(middleware.PermGradeEnter), controllers.DeleteAssessment())
+	api.Put("/assessments/:id/scores", middleware.Authorize(middleware.PermGradeEnter), controllers.EnterScores())
+
+	// Term grade routes
+	api.Get("/subjects/:id/grades", middleware.Authorize(middleware.PermGradeRead), controllers.ListSubjectGrades())
+	api.Get("/students/:id/grades", middleware.AuthorizeStudentOr("id", middleware.PermGradeRead), controllers.ListStudentGrades())
+
+	// Grading scale routes
+	api.Get("/grading-scales/:schoolId", middleware.Authorize(middleware.PermGradeRead), controllers.GetGradingScale())
+	api.Put("/grading-scales/:schoolId", middleware.Authorize(middleware.PermGradeManage), controllers.UpdateGradingScale())
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupGuardianRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Parent view routes
+	api.Get("/children", controllers.ListChildren())
+	api.Get("/children/:id", middleware.AuthorizeStudentOr("id", middleware.PermStudentRead), controllers.GetChild())
+
+	// Guardian management routes
+	api.Post("/invitations", middleware.Authorize(middleware.PermGuardianManage), controllers.InviteGuardians())
+	api.Get("/students/:id/guardians", middleware.Authorize(middleware.PermGuardianManage), controllers.ListStudentGuardians())
+	api.Delete("/students/:id/guardians/:userId", middleware.Authorize(middleware.PermGuardianManage), controllers.UnlinkGuardian())
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupHomeworkRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Assignment routes
+	api.Post("/assignments", middleware.Authorize(middleware.PermHomeworkAssign), controllers.CreateAssignment())
+	api.Get("/assignments", middleware.Authorize(middleware.PermHomeworkRead), controllers.ListAssignments())
+	api.Get("/assignments/:id", middleware.Authorize(middleware.PermHomeworkRead, middleware.PermHomeworkSubmit), controllers.GetAssignment())
+	api.Put("/assignments/:id", middleware.Authorize(middleware.PermHomeworkAssign), controllers.UpdateAssignment())
+	api.Delete("/assignments/:id", middleware.Authorize(middleware.PermHomeworkAssign), controllers.DeleteAssignment())
+	api.Get("/assignments/:id/attachments/:fileId", middleware.Authorize(middleware.PermHomeworkRead, middleware.PermHomeworkSubmit), controllers.DownloadAssignmentAttachment())
+
+	// Submission routes
+	api.Post("/assignments/:id/submissions", middleware.Authorize(middleware.PermHomeworkSubmit), controllers.SubmitAssignment())
+	api.Get("/assignments/:id/submissions", middleware.Authorize(middleware.PermHomeworkRead), controllers.ListSubmissions())
+	api.Get("/submissions/:id", middleware.Authorize(middleware.PermHomeworkRead, middleware.PermHomeworkSubmit), controllers.GetSubmission())
+	api.Get("/submissions/:id/attachments/:fileId", middleware.Authorize(middleware.PermHomeworkRead, middleware.PermHomeworkSubmit), controllers.DownloadSubmissionAttachment())
+	api.Put("/submissions/:id/grade", middleware.Authorize(middleware.PermHomeworkAssign), controllers.GradeSubmission())
+
+	// Dashboard routes
+	api.Get("/students/:id/due", middleware.AuthorizeStudentOr("id", middleware.PermHomeworkRead), controllers.ListStudentDueAssignments())
+	api.Get("/teachers/:id/ungraded", middleware.AuthorizeTeacherOr("id", middleware.PermGradeManage), controllers.ListTeacherUngradedSubmissions())
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupImportRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Import routes
+	api.Post("/", middleware.Authorize(middleware.PermImportManage), controllers.CreateImport())
+	api.Get("/", middleware.Authorize(middleware.PermImportManage), controllers.ListImports())
+	api.Get("/:id", middleware.Authorize(middleware.PermImportManage), controllers.GetImport())
+	api.Delete("/:id", middleware.Authorize(middleware.PermImportManage), controllers.DeleteImport())
+	api.Post("/:id/run", middleware.Authorize(middleware.PermImportManage), controllers.RunImport())
+	api.Get("/:id/rows", middleware.Authorize(middleware.PermImportManage), controllers.ListImportRows())
+	api.Get("/:id/report", middleware.Authorize(middleware.PermImportManage), controllers.ImportReport())
+}
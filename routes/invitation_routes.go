@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupInvitationRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	api.Get("/", middleware.Authorize(middleware.PermInvitationManage), controllers.ListInvitations())
+	api.Post("/:id/resend", middleware.Authorize(middleware.PermInvitationManage), controllers.ResendInvitation())
+	api.Delete("/:id", middleware.Authorize(middleware.PermInvitationManage), controllers.RevokeInvitation())
+
+	// Invite records registered with ?invite=false or before invitations
+	api.Post("/teachers/:id", middleware.Authorize(middleware.PermInvitationManage), controllers.InviteTeacher())
+	api.Post("/students/:id", middleware.Authorize(middleware.PermInvitationManage), controllers.InviteStudent())
+}
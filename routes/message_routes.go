@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupMessageRoutes(app fiber.Router) {
+	// Browsers cannot set headers on a WebSocket handshake, so the JWT may
+	// also be passed as ?token=
+	app.Get("/ws", middleware.QueryTokenAuthMiddleware(), middleware.Authorize(middleware.PermMessageSend), controllers.MessagingSocketUpgrade(), controllers.MessagingSocket())
+
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Conversation routes
+	api.Post("/conversations", middleware.Authorize(middleware.PermMessageSend), controllers.CreateConversation())
+	api.Get("/conversations", middleware.Authorize(middleware.PermMessageSend), controllers.ListConversations())
+	api.Get("/conversations/:id", middleware.Authorize(middleware.PermMessageSend), controllers.GetConversation())
+	api.Post("/conversations/:id/participants", middleware.Authorize(middleware.PermMessageSend), controllers.AddConversationParticipants())
+	api.Delete("/conversations/:id/participants/:userId", middleware.Authorize(middleware.PermMessageSend), controllers.RemoveConversationParticipant())
+	api.Post("/conversations/:id/read", middleware.Authorize(middleware.PermMessageSend), controllers.MarkConversationRead())
+
+	// Message routes
+	api.Get("/conversations/:id/messages", middleware.Authorize(middleware.PermMessageSend), controllers.ListMessages())
+	api.Post("/conversations/:id/messages", middleware.Authorize(middleware.PermMessageSend), controllers.SendMessage())
+	api.Get("/conversations/:id/messages/:messageId/attachments/:fileId", middleware.Authorize(middleware.PermMessageSend), controllers.DownloadMessageAttachment())
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupReportCardRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// PDF routes
+	api.Get("/students/:id", middleware.AuthorizeStudentOr("id", middleware.PermGradeRead), controllers.StudentReportCard())
+	api.Get("/classes/:id", middleware.Authorize(middleware.PermGradeRead), controllers.ClassReportCards())
+
+	// Remark routes
+	api.Get("/students/:id/remarks", middleware.Authorize(middleware.PermGradeRead), controllers.ListReportCardRemarks())
+	api.Put("/students/:id/remarks", middleware.Authorize(middleware.PermGradeEnter), controllers.SetReportCardRemark())
+}
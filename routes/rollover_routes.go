@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupRolloverRoutes(app fiber.Router) {
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Rollover routes
+	api.Post("/", middleware.Authorize(middleware.PermRolloverManage), controllers.CreateRollover())
+	api.Get("/", middleware.Authorize(middleware.PermRolloverManage), controllers.ListRollovers())
+	api.Get("/:id", middleware.Authorize(middleware.PermRolloverManage), controllers.GetRollover())
+	api.Put("/:id", middleware.Authorize(middleware.PermRolloverManage), controllers.UpdateRollover())
+	api.Delete("/:id", middleware.Authorize(middleware.PermRolloverManage), controllers.DeleteRollover())
+	api.Post("/:id/preview", middleware.Authorize(middleware.PermRolloverManage), controllers.PreviewRollover())
+	api.Post("/:id/run", middleware.Authorize(middleware.PermRolloverManage), controllers.RunRollover())
+	api.Get("/:id/students", middleware.Authorize(middleware.PermRolloverManage), controllers.ListRolloverStudents())
+}
@@ -11,10 +11,10 @@ func SetupSchoolRoutes(app fiber.Router) {
 	middleware.StartCleanupRoutine()
 
 	api := app.Group("/api", middleware.JWTAuthMiddleware())
-	api.Post("/register", controllers.RegisterSchool())
-	api.Get("/", controllers.GetAllSchool())
-	api.Get("/:id", controllers.GetSchoolByID())
-	api.Put("/:id", controllers.UpdateSchool())
-	api.Delete("/:id", controllers.DeleteSchool())
+	api.Post("/register", middleware.Authorize(middleware.PermSchoolCreate), controllers.RegisterSchool())
+	api.Get("/", middleware.Authorize(middleware.PermSchoolRead), controllers.GetAllSchool())
+	api.Get("/:id", middleware.Authorize(middleware.PermSchoolRead), controllers.GetSchoolByID())
+	api.Put("/:id", middleware.Authorize(middleware.PermSchoolUpdate), controllers.UpdateSchool())
+	api.Delete("/:id", middleware.Authorize(middleware.PermSchoolDelete), controllers.DeleteSchool())
 
 }
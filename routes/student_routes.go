@@ -10,9 +10,9 @@ func SetupStudentRoutes(app fiber.Router) {
 	api := app.Group("/api", middleware.JWTAuthMiddleware())
 
 	// Student routes
-	api.Post("/register", controllers.RegisterStudent())
-	api.Get("/", controllers.ListStudents())
-	api.Get("/:id", controllers.GetStudent())
-	api.Put("/:id", controllers.UpdateStudent())
-	api.Delete("/:id", controllers.DeleteStudent())
+	api.Post("/register", middleware.Authorize(middleware.PermStudentCreate), controllers.RegisterStudent())
+	api.Get("/", middleware.Authorize(middleware.PermStudentRead), controllers.ListStudents())
+	api.Get("/:id", middleware.Authorize(middleware.PermStudentRead), controllers.GetStudent())
+	api.Put("/:id", middleware.Authorize(middleware.PermStudentUpdate), controllers.UpdateStudent())
+	api.Delete("/:id", middleware.Authorize(middleware.PermStudentDelete), controllers.DeleteStudent())
 }
@@ -9,10 +9,17 @@ import (
 func SetupSubjectRoutes(app fiber.Router) {
 	api := app.Group("/api", middleware.JWTAuthMiddleware())
 
-	// Subject routes
-	api.Post("/register", controllers.RegisterSubject())
-	api.Get("/", controllers.ListSubjects())
-	api.Get("/:id", controllers.GetSubject())
-	api.Put("/:id", controllers.UpdateSubject())
-	api.Delete("/:id", controllers.DeleteSubject())
+	// Catalog routes come first so "/catalog" is not taken as an offering ID
+	api.Post("/catalog/register", middleware.Authorize(middleware.PermSubjectCatalogManage), controllers.CreateCatalogSubject())
+	api.Get("/catalog", middleware.Authorize(middleware.PermSubjectRead), controllers.ListCatalogSubjects())
+	api.Get("/catalog/:id", middleware.Authorize(middleware.PermSubjectRead), controllers.GetCatalogSubject())
+	api.Put("/catalog/:id", middleware.Authorize(middleware.PermSubjectCatalogManage), controllers.UpdateCatalogSubject())
+	api.Delete("/catalog/:id", middleware.Authorize(middleware.PermSubjectCatalogManage), controllers.DeleteCatalogSubject())
+
+	// Subject offering routes
+	api.Post("/register", middleware.Authorize(middleware.PermSubjectCreate), controllers.RegisterSubject())
+	api.Get("/", middleware.Authorize(middleware.PermSubjectRead), controllers.ListSubjects())
+	api.Get("/:id", middleware.Authorize(middleware.PermSubjectRead), controllers.GetSubject())
+	api.Put("/:id", middleware.Authorize(middleware.PermSubjectUpdate), controllers.UpdateSubject())
+	api.Delete("/:id", middleware.Authorize(middleware.PermSubjectDelete), controllers.DeleteSubject())
 }
@@ -10,9 +10,9 @@ func SetupTeacherRoutes(app fiber.Router) {
 	api := app.Group("/api", middleware.JWTAuthMiddleware())
 
 	// Teacher routes
-	api.Post("/register", controllers.RegisterTeacher())
-	api.Get("/", controllers.GetAllTeachers())
-	api.Get("/:id", controllers.GetTeacherByID())
-	api.Put("/:id", controllers.UpdateTeacher())
-	api.Delete("/:id", controllers.DeleteTeacher())
+	api.Post("/register", middleware.Authorize(middleware.PermTeacherCreate), controllers.RegisterTeacher())
+	api.Get("/", middleware.Authorize(middleware.PermTeacherRead), controllers.GetAllTeachers())
+	api.Get("/:id", middleware.Authorize(middleware.PermTeacherRead), controllers.GetTeacherByID())
+	api.Put("/:id", middleware.Authorize(middleware.PermTeacherUpdate), controllers.UpdateTeacher())
+	api.Delete("/:id", middleware.Authorize(middleware.PermTeacherDelete), controllers.DeleteTeacher())
 }
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupTimetableRoutes(app fiber.Router) {
+	// Calendar feeds are fetched by calendar apps, authenticated by the
+	// token in their URL
+	app.Get("/calendar/teachers/:id.ics", controllers.TeacherCalendar())
+	app.Get("/calendar/classes/:id.ics", controllers.ClassCalendar())
+
+	api := app.Group("/api", middleware.JWTAuthMiddleware())
+
+	// Slot routes
+	api.Post("/slots", middleware.Authorize(middleware.PermTimetableManage), controllers.CreateTimetableSlot())
+	api.Get("/slots", middleware.Authorize(middleware.PermTimetableRead), controllers.ListTimetableSlots())
+	api.Get("/slots/:id", middleware.Authorize(middleware.PermTimetableRead), controllers.GetTimetableSlot())
+	api.Put("/slots/:id", middleware.Authorize(middleware.PermTimetableManage), controllers.UpdateTimetableSlot())
+	api.Delete("/slots/:id", middleware.Authorize(middleware.PermTimetableManage), controllers.DeleteTimetableSlot())
+
+	// View routes
+	api.Get("/classes/:id", middleware.Authorize(middleware.PermTimetableRead), controllers.ClassTimetable())
+	api.Get("/classes/:id/calendar-link", middleware.Authorize(middleware.PermTimetableRead), controllers.ClassCalendarLink())
+	api.Get("/teachers/:id", middleware.AuthorizeTeacherOr("id", middleware.PermTimetableRead), controllers.TeacherTimetable())
+	api.Get("/teachers/:id/calendar-link", middleware.AuthorizeTeacherOr("id", middleware.PermTimetableManage), controllers.TeacherCalendarLink())
+	api.Get("/rooms/:room", middleware.Authorize(middleware.PermTimetableRead), controllers.RoomTimetable())
+}
@@ -1,7 +1,7 @@
 package routes
 
 import (
-		"github.com/ReddIndiann/go-messanger/controllers"
+	"github.com/ReddIndiann/go-messanger/controllers"
 	"github.com/ReddIndiann/go-messanger/middleware"
 	"github.com/gofiber/fiber/v2"
 )
@@ -15,15 +15,26 @@ func SetupUserRoutes(app fiber.Router) {
 	app.Post("/api/resend-otp", controllers.ResendOTP())
 	app.Post("/api/login", controllers.LoginUser())
 	app.Post("/api/refresh-token", controllers.RefreshToken())
+	app.Post("/api/forgot-password", controllers.ForgotPassword())
+	app.Post("/api/reset-password", controllers.ResetPassword())
+	app.Get("/api/invitations/:token", controllers.GetInvitation())
+	app.Post("/api/invitations/accept", controllers.AcceptInvitation())
 
 	// Protected routes - require JWT authentication
 	api := app.Group("/api", middleware.JWTAuthMiddleware())
 
-
 	// User routes
-	api.Get("/users", controllers.GetAllUsers())
-	api.Get("/users/:id", controllers.GetUserByID())
-	api.Put("/users/:id", controllers.UpdateUser())
-	api.Delete("/users/:id", controllers.DeleteUser())
+	api.Get("/users", middleware.Authorize(middleware.PermUserRead), controllers.GetAllUsers())
+	api.Get("/users/:id", middleware.AuthorizeSelfOr("id", middleware.PermUserRead), controllers.GetUserByID())
+	api.Put("/users/:id", middleware.AuthorizeSelfOr("id", middleware.PermUserUpdate), controllers.UpdateUser())
+	api.Put("/users/:id/role", middleware.Authorize(middleware.PermUserManageRoles), controllers.UpdateUserRole())
+	api.Put("/users/:id/schools", middleware.Authorize(middleware.PermUserManageRoles), controllers.UpdateUserSchools())
+	api.Put("/users/:id/links", middleware.Authorize(middleware.PermUserManageRoles), controllers.UpdateUserLinks())
+	api.Delete("/users/:id", middleware.Authorize(middleware.PermUserDelete), controllers.DeleteUser())
 	api.Post("/logout", controllers.LogoutUser())
-}
\ No newline at end of file
+	api.Post("/logout-all", controllers.LogoutAllSessions())
+
+	// Session routes
+	api.Get("/sessions", controllers.ListSessions())
+	api.Delete("/sessions/:id", controllers.DeleteSession())
+}